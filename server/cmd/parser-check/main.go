@@ -0,0 +1,70 @@
+// Command parser-check runs the parsing rules of the config over a corpus of recorded usernames and service
+// names and prints what changed compared to the results recorded in the corpus.
+//
+// Usage, from the server directory:
+//
+//	go run ./cmd/parser-check [-config config.yaml] [-corpus internal/lab_polling/testdata/corpus.json] [-update]
+//
+// The exit code is 1 when results changed, -update records the new results instead
+package main
+
+import (
+	"flag"
+	"fmt"
+	"labgrab/internal/lab_polling"
+	"labgrab/pkg/config"
+	"os"
+)
+
+func main() {
+	configPath := flag.String("config", "config.yaml", "path to the config with the parser rules")
+	corpusPath := flag.String("corpus", "internal/lab_polling/testdata/corpus.json", "path to the corpus")
+	update := flag.Bool("update", false, "record the new results in the corpus")
+	flag.Parse()
+
+	if err := run(*configPath, *corpusPath, *update); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func run(configPath, corpusPath string, update bool) error {
+	cfg, err := config.LoadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	parser, err := lab_polling.NewParser(&cfg.PollingServiceConfig.ParserConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create parser: %w", err)
+	}
+
+	entries, err := lab_polling.LoadCorpus(corpusPath)
+	if err != nil {
+		return fmt.Errorf("failed to load corpus: %w", err)
+	}
+
+	checked, diff := parser.CheckCorpus(entries)
+	for _, line := range diff {
+		fmt.Println(line)
+	}
+
+	failed := 0
+	for _, entry := range checked {
+		if entry.Result.Error != "" {
+			failed++
+		}
+	}
+	fmt.Printf("%d entries, %d changed fields, %d failing to parse\n", len(checked), len(diff), failed)
+
+	if update {
+		if err := lab_polling.WriteCorpus(corpusPath, checked); err != nil {
+			return fmt.Errorf("failed to write corpus: %w", err)
+		}
+		return nil
+	}
+	if len(diff) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
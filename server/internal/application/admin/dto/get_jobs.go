@@ -0,0 +1,34 @@
+package dto
+
+import "time"
+
+type GetJobsReqDTO struct {
+	Job   string `json:"job"`
+	Limit uint64 `json:"limit"`
+}
+
+type GetJobsResDTO struct {
+	Jobs []JobDTO    `json:"jobs"`
+	Runs []JobRunDTO `json:"runs"`
+}
+
+// JobDTO is the next scheduled run of a job as shared by the instance that ran it last, NextRunAt is null
+// when the job is not scheduled
+type JobDTO struct {
+	Name      string     `json:"name"`
+	NextRunAt *time.Time `json:"next_run_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// JobRunDTO duration is a duration string like 1.5s
+type JobRunDTO struct {
+	RunUUID    string         `json:"run_uuid"`
+	Job        string         `json:"job"`
+	Instance   string         `json:"instance"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Duration   string         `json:"duration"`
+	Outcome    string         `json:"outcome"`
+	Error      string         `json:"error,omitempty"`
+	Counts     map[string]int `json:"counts"`
+}
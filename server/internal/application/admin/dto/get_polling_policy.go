@@ -0,0 +1,36 @@
+package dto
+
+import "time"
+
+// GetPollingPolicyResDTO intervals and durations are duration strings like 30s or 5m
+type GetPollingPolicyResDTO struct {
+	// Rule is "default", "boost" or the name of the window in effect now
+	Rule         string             `json:"rule"`
+	MinInterval  string             `json:"min_interval"`
+	MaxInterval  string             `json:"max_interval"`
+	BoostUntil   *time.Time         `json:"boost_until"`
+	LastChangeAt *time.Time         `json:"last_change_at"`
+	NextPollAt   *time.Time         `json:"next_poll_at"`
+	NextPollRule string             `json:"next_poll_rule"`
+	Default      PollingIntervalDTO `json:"default"`
+	Windows      []PollingWindowDTO `json:"windows"`
+	Boost        *PollingBoostDTO   `json:"boost"`
+}
+
+type PollingIntervalDTO struct {
+	MinInterval string `json:"min_interval"`
+	MaxInterval string `json:"max_interval"`
+}
+
+type PollingWindowDTO struct {
+	Name  string   `json:"name"`
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	PollingIntervalDTO
+}
+
+type PollingBoostDTO struct {
+	Duration string `json:"duration"`
+	PollingIntervalDTO
+}
@@ -0,0 +1,22 @@
+package dto
+
+import "time"
+
+type GetUnparsedEntriesReqDTO struct {
+	Severity string `json:"severity"`
+	Limit    uint64 `json:"limit"`
+}
+
+type GetUnparsedEntriesResDTO struct {
+	ServiceID   int       `json:"service_id"`
+	MasterID    int       `json:"master_id"`
+	Field       string    `json:"field"`
+	RawText     string    `json:"raw_text"`
+	Severity    string    `json:"severity"`
+	Username    string    `json:"username"`
+	ServiceName string    `json:"service_name"`
+	Reason      string    `json:"reason"`
+	Occurrences int       `json:"occurrences"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
@@ -0,0 +1,138 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"labgrab/internal/application/admin/dto"
+	"labgrab/internal/application/admin/usecase"
+	"labgrab/internal/lab_polling"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("admin-handler")
+
+type Handler struct {
+	getUnparsedEntries *usecase.GetUnparsedEntriesUseCase
+	getPollingPolicy   *usecase.GetPollingPolicyUseCase
+	getJobs            *usecase.GetJobsUseCase
+	logger             *zap.SugaredLogger
+}
+
+func NewHandler(labPollingSvc *lab_polling.Service, logger *zap.SugaredLogger) *Handler {
+	return &Handler{
+		getUnparsedEntries: usecase.NewGetUnparsedEntriesUseCase(labPollingSvc, logger),
+		getPollingPolicy:   usecase.NewGetPollingPolicyUseCase(labPollingSvc, logger),
+		getJobs:            usecase.NewGetJobsUseCase(labPollingSvc, logger),
+		logger:             logger,
+	}
+}
+
+func (h *Handler) GetUnparsedEntries(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "admin.handler.GetUnparsedEntries")
+	defer span.End()
+
+	req := &dto.GetUnparsedEntriesReqDTO{
+		Severity: r.URL.Query().Get("severity"),
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid limit: %w", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Limit = parsed
+	}
+
+	resp, err := h.getUnparsedEntries.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) GetPollingPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "admin.handler.GetPollingPolicy")
+	defer span.End()
+
+	resp, err := h.getPollingPolicy.Exec(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) GetJobs(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "admin.handler.GetJobs")
+	defer span.End()
+
+	req := &dto.GetJobsReqDTO{
+		Job: r.URL.Query().Get("job"),
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid limit: %w", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Limit = parsed
+	}
+
+	resp, err := h.getJobs.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/admin/unparsed-entries", h.GetUnparsedEntries).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/polling-policy", h.GetPollingPolicy).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/jobs", h.GetJobs).Methods(http.MethodGet)
+}
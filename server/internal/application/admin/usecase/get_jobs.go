@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+	"labgrab/internal/application/admin/dto"
+	"labgrab/internal/lab_polling"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+const defaultJobRunsLimit = 100
+
+type GetJobsUseCase struct {
+	labPollingSvc *lab_polling.Service
+	logger        *zap.SugaredLogger
+}
+
+func NewGetJobsUseCase(labPollingSvc *lab_polling.Service, logger *zap.SugaredLogger) *GetJobsUseCase {
+	return &GetJobsUseCase{
+		labPollingSvc: labPollingSvc,
+		logger:        logger,
+	}
+}
+
+func (uc *GetJobsUseCase) Exec(ctx context.Context, data *dto.GetJobsReqDTO) (*dto.GetJobsResDTO, error) {
+	ctx, span := tracer.Start(ctx, "admin.usecase.GetJobs")
+	defer span.End()
+
+	req := &lab_polling.GetJobsReq{Limit: data.Limit}
+	if req.Limit == 0 {
+		req.Limit = defaultJobRunsLimit
+	}
+	if data.Job != "" {
+		req.Job = &data.Job
+	}
+
+	jobs, err := uc.labPollingSvc.GetJobs(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := &dto.GetJobsResDTO{
+		Jobs: make([]dto.JobDTO, len(jobs.Jobs)),
+		Runs: make([]dto.JobRunDTO, len(jobs.Runs)),
+	}
+	for i, job := range jobs.Jobs {
+		result.Jobs[i] = dto.JobDTO{
+			Name:      job.Name,
+			NextRunAt: job.NextRunAt,
+			UpdatedAt: job.UpdatedAt,
+		}
+	}
+	for i, run := range jobs.Runs {
+		result.Runs[i] = dto.JobRunDTO{
+			RunUUID:    run.RunUUID.String(),
+			Job:        run.Job,
+			Instance:   run.Instance,
+			StartedAt:  run.StartedAt,
+			FinishedAt: run.FinishedAt,
+			Duration:   run.FinishedAt.Sub(run.StartedAt).String(),
+			Outcome:    string(run.Outcome),
+			Error:      run.Error,
+			Counts:     run.Counts,
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"labgrab/internal/application/admin/dto"
+	"labgrab/internal/lab_polling"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetPollingPolicyUseCase struct {
+	labPollingSvc *lab_polling.Service
+	logger        *zap.SugaredLogger
+}
+
+func NewGetPollingPolicyUseCase(labPollingSvc *lab_polling.Service, logger *zap.SugaredLogger) *GetPollingPolicyUseCase {
+	return &GetPollingPolicyUseCase{
+		labPollingSvc: labPollingSvc,
+		logger:        logger,
+	}
+}
+
+func (uc *GetPollingPolicyUseCase) Exec(ctx context.Context) (*dto.GetPollingPolicyResDTO, error) {
+	ctx, span := tracer.Start(ctx, "admin.usecase.GetPollingPolicy")
+	defer span.End()
+
+	policy, err := uc.labPollingSvc.GetPollingPolicy(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := &dto.GetPollingPolicyResDTO{
+		Rule:         policy.Rule,
+		MinInterval:  policy.MinInterval.String(),
+		MaxInterval:  policy.MaxInterval.String(),
+		BoostUntil:   policy.BoostUntil,
+		LastChangeAt: policy.LastChangeAt,
+		NextPollAt:   policy.NextPollAt,
+		NextPollRule: policy.NextPollRule,
+		Default:      newPollingIntervalDTO(policy.Default),
+		Windows:      make([]dto.PollingWindowDTO, len(policy.Windows)),
+	}
+	for i, window := range policy.Windows {
+		days := make([]string, len(window.Days))
+		for j, day := range window.Days {
+			days[j] = string(day)
+		}
+		result.Windows[i] = dto.PollingWindowDTO{
+			Name:               window.Name,
+			Days:               days,
+			Start:              window.Start,
+			End:                window.End,
+			PollingIntervalDTO: newPollingIntervalDTO(window.Interval),
+		}
+	}
+	if policy.Boost != nil {
+		result.Boost = &dto.PollingBoostDTO{
+			Duration:           policy.Boost.Duration.String(),
+			PollingIntervalDTO: newPollingIntervalDTO(policy.Boost.Interval),
+		}
+	}
+
+	return result, nil
+}
+
+func newPollingIntervalDTO(interval lab_polling.PollingIntervalState) dto.PollingIntervalDTO {
+	return dto.PollingIntervalDTO{
+		MinInterval: interval.MinInterval.String(),
+		MaxInterval: interval.MaxInterval.String(),
+	}
+}
@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/admin/dto"
+	"labgrab/internal/lab_polling"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("admin-usecase")
+
+const defaultUnparsedEntriesLimit = 100
+
+type GetUnparsedEntriesUseCase struct {
+	labPollingSvc *lab_polling.Service
+	logger        *zap.SugaredLogger
+}
+
+func NewGetUnparsedEntriesUseCase(labPollingSvc *lab_polling.Service, logger *zap.SugaredLogger) *GetUnparsedEntriesUseCase {
+	return &GetUnparsedEntriesUseCase{
+		labPollingSvc: labPollingSvc,
+		logger:        logger,
+	}
+}
+
+func (uc *GetUnparsedEntriesUseCase) Exec(ctx context.Context, data *dto.GetUnparsedEntriesReqDTO) ([]dto.GetUnparsedEntriesResDTO, error) {
+	ctx, span := tracer.Start(ctx, "admin.usecase.GetUnparsedEntries")
+	defer span.End()
+
+	req := &lab_polling.GetUnparsedEntriesReq{Limit: data.Limit}
+	if req.Limit == 0 {
+		req.Limit = defaultUnparsedEntriesLimit
+	}
+
+	if data.Severity != "" {
+		severity := lab_polling.DiagnosticSeverity(data.Severity)
+		if severity != lab_polling.SeverityWarning && severity != lab_polling.SeverityError {
+			err := fmt.Errorf("invalid severity: %s", data.Severity)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		req.Severity = &severity
+	}
+
+	entries, err := uc.labPollingSvc.GetUnparsedEntries(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]dto.GetUnparsedEntriesResDTO, len(entries))
+	for i, entry := range entries {
+		result[i] = dto.GetUnparsedEntriesResDTO{
+			ServiceID:   entry.ServiceID,
+			MasterID:    entry.MasterID,
+			Field:       string(entry.Field),
+			RawText:     entry.RawText,
+			Severity:    string(entry.Severity),
+			Username:    entry.Username,
+			ServiceName: entry.ServiceName,
+			Reason:      entry.Reason,
+			Occurrences: entry.Occurrences,
+			FirstSeenAt: entry.FirstSeenAt,
+			LastSeenAt:  entry.LastSeenAt,
+		}
+	}
+
+	return result, nil
+}
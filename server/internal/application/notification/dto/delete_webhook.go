@@ -0,0 +1,6 @@
+package dto
+
+type DeleteWebhookReqDTO struct {
+	UserUUID    string `json:"user_uuid"`
+	WebhookUUID string `json:"webhook_uuid"`
+}
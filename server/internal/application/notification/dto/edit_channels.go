@@ -0,0 +1,10 @@
+package dto
+
+type EditChannelsReqDTO struct {
+	UserUUID string   `json:"user_uuid"`
+	Channels []string `json:"channels"`
+}
+
+type EditChannelsResDTO struct {
+	Channels []string `json:"channels"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+type EditWebhookReqDTO struct {
+	UserUUID    string `json:"user_uuid"`
+	WebhookUUID string `json:"webhook_uuid"`
+	Enabled     bool   `json:"enabled"`
+}
+
+type EditWebhookResDTO struct {
+	UUID string `json:"uuid"`
+}
@@ -0,0 +1,9 @@
+package dto
+
+type GetChannelsReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+}
+
+type GetChannelsResDTO struct {
+	Channels []string `json:"channels"`
+}
@@ -0,0 +1,19 @@
+package dto
+
+import "time"
+
+type GetWebhookDeliveriesReqDTO struct {
+	UserUUID    string `json:"user_uuid"`
+	WebhookUUID string `json:"webhook_uuid"`
+	Limit       uint64 `json:"limit"`
+}
+
+type GetWebhookDeliveriesResDTO struct {
+	UUID             string    `json:"uuid"`
+	SubscriptionUUID *string   `json:"subscription_uuid"`
+	Attempt          int       `json:"attempt"`
+	StatusCode       *int      `json:"status_code"`
+	Error            *string   `json:"error"`
+	Succeeded        bool      `json:"succeeded"`
+	DeliveredAt      time.Time `json:"delivered_at"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+type GetWebhooksReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+}
+
+type GetWebhooksResDTO struct {
+	UUID                string     `json:"uuid"`
+	URL                 string     `json:"url"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+type NewWebhookReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+	URL      string `json:"url"`
+}
+
+type NewWebhookResDTO struct {
+	UUID   string `json:"uuid"`
+	Secret string `json:"secret"`
+}
@@ -0,0 +1,12 @@
+package dto
+
+type StreamEventsReqDTO struct {
+	UserUUID    string `json:"user_uuid"`
+	LastEventID string `json:"last_event_id"`
+}
+
+type StreamEventDTO struct {
+	ID    string
+	Event string
+	Data  []byte
+}
@@ -0,0 +1,363 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/application/notification/usecase"
+	"labgrab/internal/notification"
+	"labgrab/pkg/config"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("notification-handler")
+
+// defaultStreamHeartbeat is used when the stream config sets no heartbeat, proxies commonly drop idle
+// connections after 30 to 60 seconds
+const defaultStreamHeartbeat = 15 * time.Second
+
+type Handler struct {
+	streamEvents         *usecase.StreamEventsUseCase
+	getWebhooks          *usecase.GetWebhooksUseCase
+	newWebhook           *usecase.NewWebhookUseCase
+	editWebhook          *usecase.EditWebhookUseCase
+	deleteWebhook        *usecase.DeleteWebhookUseCase
+	getWebhookDeliveries *usecase.GetWebhookDeliveriesUseCase
+	getChannels          *usecase.GetChannelsUseCase
+	editChannels         *usecase.EditChannelsUseCase
+	heartbeat            time.Duration
+	logger               *zap.SugaredLogger
+}
+
+func NewHandler(notificationSvc *notification.Service, cfg *config.StreamConfig, logger *zap.SugaredLogger) *Handler {
+	heartbeat := cfg.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+
+	return &Handler{
+		streamEvents:         usecase.NewStreamEventsUseCase(notificationSvc, logger),
+		getWebhooks:          usecase.NewGetWebhooksUseCase(notificationSvc, logger),
+		newWebhook:           usecase.NewNewWebhookUseCase(notificationSvc, logger),
+		editWebhook:          usecase.NewEditWebhookUseCase(notificationSvc, logger),
+		deleteWebhook:        usecase.NewDeleteWebhookUseCase(notificationSvc, logger),
+		getWebhookDeliveries: usecase.NewGetWebhookDeliveriesUseCase(notificationSvc, logger),
+		getChannels:          usecase.NewGetChannelsUseCase(notificationSvc, logger),
+		editChannels:         usecase.NewEditChannelsUseCase(notificationSvc, logger),
+		heartbeat:            heartbeat,
+		logger:               logger,
+	}
+}
+
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.StreamEvents")
+	defer span.End()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err := fmt.Errorf("streaming is not supported by response writer")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	req := &dto.StreamEventsReqDTO{
+		UserUUID:    vars["user_uuid"],
+		LastEventID: r.Header.Get("Last-Event-ID"),
+	}
+
+	events, err := h.streamEvents.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Event, event.Data); err != nil {
+				err = fmt.Errorf("failed to write event: %w", err)
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.GetWebhooks")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetWebhooksReqDTO{
+		UserUUID: vars["user_uuid"],
+	}
+
+	resp, err := h.getWebhooks.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) NewWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.NewWebhook")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	userUUID := vars["user_uuid"]
+
+	var req dto.NewWebhookReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = userUUID
+
+	resp, err := h.newWebhook.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) EditWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.EditWebhook")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	userUUID := vars["user_uuid"]
+	webhookUUID := vars["id"]
+
+	var req dto.EditWebhookReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = userUUID
+	req.WebhookUUID = webhookUUID
+
+	resp, err := h.editWebhook.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, notification.ErrWebhookNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.DeleteWebhook")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.DeleteWebhookReqDTO{
+		UserUUID:    vars["user_uuid"],
+		WebhookUUID: vars["id"],
+	}
+
+	if err := h.deleteWebhook.Exec(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, notification.ErrWebhookNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.GetWebhookDeliveries")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetWebhookDeliveriesReqDTO{
+		UserUUID:    vars["user_uuid"],
+		WebhookUUID: vars["id"],
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid limit: %w", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Limit = parsed
+	}
+
+	resp, err := h.getWebhookDeliveries.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) GetChannels(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.GetChannels")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetChannelsReqDTO{
+		UserUUID: vars["user_uuid"],
+	}
+
+	resp, err := h.getChannels.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) EditChannels(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "notification.handler.EditChannels")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	userUUID := vars["user_uuid"]
+
+	var req dto.EditChannelsReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = userUUID
+
+	resp, err := h.editChannels.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/users/{user_uuid}/events", h.StreamEvents).Methods(http.MethodGet)
+	r.HandleFunc("/api/users/{user_uuid}/webhooks", h.GetWebhooks).Methods(http.MethodGet)
+	r.HandleFunc("/api/users/{user_uuid}/webhooks", h.NewWebhook).Methods(http.MethodPost)
+	r.HandleFunc("/api/users/{user_uuid}/webhooks/{id}", h.EditWebhook).Methods(http.MethodPatch)
+	r.HandleFunc("/api/users/{user_uuid}/webhooks/{id}", h.DeleteWebhook).Methods(http.MethodDelete)
+	r.HandleFunc("/api/users/{user_uuid}/channels", h.GetChannels).Methods(http.MethodGet)
+	r.HandleFunc("/api/users/{user_uuid}/channels", h.EditChannels).Methods(http.MethodPut)
+	r.HandleFunc("/api/users/{user_uuid}/webhooks/{id}/deliveries", h.GetWebhookDeliveries).Methods(http.MethodGet)
+}
@@ -0,0 +1,92 @@
+package notification
+
+import (
+	"context"
+	"labgrab/internal/application/notification/usecase"
+	"labgrab/internal/notification"
+	"labgrab/internal/subscription"
+	"labgrab/internal/user"
+	"labgrab/pkg/config"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"go.uber.org/zap"
+)
+
+type Scheduler struct {
+	cfg                   *config.OutboxConfig
+	logger                *zap.SugaredLogger
+	scheduler             gocron.Scheduler
+	notificationSvc       *notification.Service
+	dispatchNotifications *usecase.DispatchNotificationsUseCase
+}
+
+func NewScheduler(
+	notificationSvc *notification.Service,
+	subscriptionSvc *subscription.Service,
+	userSvc *user.Service,
+	cfg *config.OutboxConfig,
+	logger *zap.SugaredLogger,
+) *Scheduler {
+	return &Scheduler{
+		cfg:                   cfg,
+		logger:                logger,
+		notificationSvc:       notificationSvc,
+		dispatchNotifications: usecase.NewDispatchNotificationsUseCase(notificationSvc, subscriptionSvc, userSvc, logger),
+	}
+}
+
+func (s *Scheduler) Start(ctx context.Context) error {
+	scheduler, err := gocron.NewScheduler()
+	if err != nil {
+		return err
+	}
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(s.cfg.Interval),
+		gocron.NewTask(s.DispatchNotifications, ctx),
+		// A slow dispatch skips the next tick instead of claiming the outbox twice
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(s.PruneOutbox, ctx),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		return err
+	}
+
+	scheduler.Start()
+	s.scheduler = scheduler
+	return nil
+}
+
+func (s *Scheduler) Stop() error {
+	return s.scheduler.Shutdown()
+}
+
+func (s *Scheduler) DispatchNotifications(ctx context.Context) {
+	now := time.Now()
+	err := s.dispatchNotifications.Exec(ctx)
+	if err != nil {
+		s.logger.Errorw("Error dispatching notifications", "error", err)
+	}
+	if elapsed := time.Since(now); elapsed > s.cfg.Interval {
+		s.logger.Warnw("Dispatching notifications took longer than interval", "job", "DispatchNotifications", "elapsed", elapsed)
+	}
+}
+
+// PruneOutbox deletes delivered and failed outbox entries older than the retention
+func (s *Scheduler) PruneOutbox(ctx context.Context) {
+	pruned, err := s.notificationSvc.PruneOutbox(ctx)
+	if err != nil {
+		s.logger.Errorw("Error pruning outbox", "error", err)
+		return
+	}
+	if pruned > 0 {
+		s.logger.Infow("Outbox pruned", "deleted", pruned)
+	}
+}
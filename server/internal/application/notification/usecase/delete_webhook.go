@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type DeleteWebhookUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewDeleteWebhookUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *DeleteWebhookUseCase {
+	return &DeleteWebhookUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *DeleteWebhookUseCase) Exec(ctx context.Context, data *dto.DeleteWebhookReqDTO) error {
+	ctx, span := tracer.Start(ctx, "notification.usecase.DeleteWebhook")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	webhookUUID, err := uuid.Parse(data.WebhookUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid webhook uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := uc.notificationSvc.DeleteWebhook(ctx, userUUID, webhookUUID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package usecase
+
+import (
+	"context"
+	"labgrab/internal/notification"
+	"labgrab/internal/subscription"
+	"labgrab/internal/user"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// digestKey groups claimed entries delivered in one digest
+type digestKey struct {
+	userUUID    uuid.UUID
+	channel     notification.Channel
+	webhookUUID uuid.UUID
+}
+
+type DispatchNotificationsUseCase struct {
+	notificationSvc *notification.Service
+	subscriptionSvc *subscription.Service
+	userSvc         *user.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewDispatchNotificationsUseCase(
+	notificationSvc *notification.Service,
+	subscriptionSvc *subscription.Service,
+	userSvc *user.Service,
+	logger *zap.SugaredLogger,
+) *DispatchNotificationsUseCase {
+	return &DispatchNotificationsUseCase{
+		notificationSvc: notificationSvc,
+		subscriptionSvc: subscriptionSvc,
+		userSvc:         userSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *DispatchNotificationsUseCase) Exec(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "notification.usecase.DispatchNotifications")
+	defer span.End()
+
+	entries, err := uc.notificationSvc.ClaimOutbox(ctx)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	contacts := make(map[uuid.UUID]notification.Contacts)
+	preferences := make(map[uuid.UUID]*notification.Preferences)
+	outcomes := make(map[notification.DeliveryOutcome]int)
+	// Entries of users that receive digests are delivered together per user, channel and webhook
+	digests := make(map[digestKey][]notification.OutboxEntry)
+	var digestKeys []digestKey
+	for _, entry := range entries {
+		userUUID := entry.Notification.UserUUID
+		if _, ok := contacts[userUUID]; !ok {
+			contacts[userUUID] = uc.getContacts(ctx, userUUID)
+			preferences[userUUID] = uc.getPreferences(ctx, userUUID)
+		}
+		entry.Notification.Contacts = contacts[userUUID]
+
+		if prefs := preferences[userUUID]; prefs != nil && prefs.DigestInterval > 0 {
+			key := digestKey{userUUID: userUUID, channel: entry.Channel}
+			if entry.WebhookUUID != nil {
+				key.webhookUUID = *entry.WebhookUUID
+			}
+			if _, ok := digests[key]; !ok {
+				digestKeys = append(digestKeys, key)
+			}
+			digests[key] = append(digests[key], entry)
+			continue
+		}
+
+		outcome, err := uc.notificationSvc.Deliver(ctx, &entry, preferences[userUUID])
+		outcomes[outcome]++
+		if err != nil {
+			uc.logger.Errorw("error delivering notification",
+				"outbox_uuid", entry.OutboxUUID,
+				"channel", entry.Channel,
+				"subscription", entry.Notification.SubscriptionUUID,
+				"attempt", entry.Attempts+1,
+				"err", err)
+		}
+	}
+	for _, key := range digestKeys {
+		digestOutcomes, err := uc.notificationSvc.DeliverDigest(ctx, digests[key], preferences[key.userUUID])
+		for outcome, count := range digestOutcomes {
+			outcomes[outcome] += count
+		}
+		if err != nil {
+			uc.logger.Errorw("error delivering digest",
+				"user", key.userUUID,
+				"channel", key.channel,
+				"webhook", key.webhookUUID,
+				"entries", len(digests[key]),
+				"err", err)
+		}
+	}
+	uc.logger.Infow("Dispatch complete",
+		"claimed", len(entries),
+		"sent", outcomes[notification.DeliverySent],
+		"postponed", outcomes[notification.DeliveryPostponed],
+		"skipped", outcomes[notification.DeliverySkipped],
+		"failed", outcomes[notification.DeliveryFailed])
+
+	return nil
+}
+
+// getContacts collects addresses for channels that need them. A failed lookup only disables those channels
+func (uc *DispatchNotificationsUseCase) getContacts(ctx context.Context, userUUID uuid.UUID) notification.Contacts {
+	var contacts notification.Contacts
+
+	info, err := uc.userSvc.GetUserInfo(ctx, userUUID.String())
+	if err != nil {
+		uc.logger.Errorw("error getting user contacts", "user", userUUID, "err", err)
+		return contacts
+	}
+
+	if info.EmailVerified {
+		contacts.Email = info.Email
+	}
+
+	return contacts
+}
+
+// getPreferences loads delivery preferences of the user. If they can't be loaded, notifications
+// are delivered with the defaults rather than held back
+func (uc *DispatchNotificationsUseCase) getPreferences(ctx context.Context, userUUID uuid.UUID) *notification.Preferences {
+	prefs, err := uc.subscriptionSvc.GetNotificationPreferences(ctx, userUUID)
+	if err != nil {
+		uc.logger.Errorw("error getting notification preferences", "user", userUUID, "err", err)
+		return nil
+	}
+
+	result := &notification.Preferences{}
+	if prefs.QuietHoursStart != nil && prefs.QuietHoursEnd != nil {
+		result.QuietHours = &notification.QuietHours{
+			Start: time.Duration(*prefs.QuietHoursStart) * time.Minute,
+			End:   time.Duration(*prefs.QuietHoursEnd) * time.Minute,
+		}
+	}
+	if prefs.DeliveryMode == subscription.DeliveryModeDigest {
+		result.DigestInterval = time.Duration(prefs.DigestInterval) * time.Minute
+	}
+	if prefs.MaxPerHour != nil {
+		result.MaxPerHour = *prefs.MaxPerHour
+	}
+	if prefs.PreferredChannel != nil {
+		channel := notification.Channel(*prefs.PreferredChannel)
+		result.PreferredChannel = &channel
+	}
+
+	return result
+}
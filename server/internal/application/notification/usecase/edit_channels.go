@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type EditChannelsUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewEditChannelsUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *EditChannelsUseCase {
+	return &EditChannelsUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *EditChannelsUseCase) Exec(ctx context.Context, data *dto.EditChannelsReqDTO) (*dto.EditChannelsResDTO, error) {
+	ctx, span := tracer.Start(ctx, "notification.usecase.EditChannels")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	channels := make([]notification.Channel, len(data.Channels))
+	for i, channel := range data.Channels {
+		channels[i] = notification.Channel(channel)
+	}
+
+	err = uc.notificationSvc.UpdateChannels(ctx, &notification.UpdateChannelsReq{
+		UserUUID: userUUID,
+		Channels: channels,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &dto.EditChannelsResDTO{
+		Channels: data.Channels,
+	}, nil
+}
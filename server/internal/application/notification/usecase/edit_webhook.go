@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type EditWebhookUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewEditWebhookUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *EditWebhookUseCase {
+	return &EditWebhookUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *EditWebhookUseCase) Exec(ctx context.Context, data *dto.EditWebhookReqDTO) (*dto.EditWebhookResDTO, error) {
+	ctx, span := tracer.Start(ctx, "notification.usecase.EditWebhook")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	webhookUUID, err := uuid.Parse(data.WebhookUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid webhook uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	err = uc.notificationSvc.UpdateWebhook(ctx, &notification.UpdateWebhookReq{
+		UserUUID:    userUUID,
+		WebhookUUID: webhookUUID,
+		Enabled:     data.Enabled,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &dto.EditWebhookResDTO{
+		UUID: webhookUUID.String(),
+	}, nil
+}
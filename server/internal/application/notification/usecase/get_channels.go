@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetChannelsUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetChannelsUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *GetChannelsUseCase {
+	return &GetChannelsUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetChannelsUseCase) Exec(ctx context.Context, data *dto.GetChannelsReqDTO) (*dto.GetChannelsResDTO, error) {
+	ctx, span := tracer.Start(ctx, "notification.usecase.GetChannels")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	channels, err := uc.notificationSvc.GetChannels(ctx, userUUID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]string, len(channels))
+	for i, channel := range channels {
+		result[i] = string(channel)
+	}
+
+	return &dto.GetChannelsResDTO{
+		Channels: result,
+	}, nil
+}
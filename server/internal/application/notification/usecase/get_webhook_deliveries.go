@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+const defaultDeliveriesLimit = 50
+
+type GetWebhookDeliveriesUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetWebhookDeliveriesUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *GetWebhookDeliveriesUseCase {
+	return &GetWebhookDeliveriesUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetWebhookDeliveriesUseCase) Exec(ctx context.Context, data *dto.GetWebhookDeliveriesReqDTO) ([]dto.GetWebhookDeliveriesResDTO, error) {
+	ctx, span := tracer.Start(ctx, "notification.usecase.GetWebhookDeliveries")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	webhookUUID, err := uuid.Parse(data.WebhookUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid webhook uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	limit := data.Limit
+	if limit == 0 {
+		limit = defaultDeliveriesLimit
+	}
+
+	deliveries, err := uc.notificationSvc.GetWebhookDeliveries(ctx, &notification.GetWebhookDeliveriesReq{
+		UserUUID:    userUUID,
+		WebhookUUID: webhookUUID,
+		Limit:       limit,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]dto.GetWebhookDeliveriesResDTO, len(deliveries))
+	for i, delivery := range deliveries {
+		var subscriptionUUID *string
+		if delivery.SubscriptionUUID != nil {
+			value := delivery.SubscriptionUUID.String()
+			subscriptionUUID = &value
+		}
+		result[i] = dto.GetWebhookDeliveriesResDTO{
+			UUID:             delivery.DeliveryUUID.String(),
+			SubscriptionUUID: subscriptionUUID,
+			Attempt:          delivery.Attempt,
+			StatusCode:       delivery.StatusCode,
+			Error:            delivery.Error,
+			Succeeded:        delivery.Succeeded,
+			DeliveredAt:      delivery.DeliveredAt,
+		}
+	}
+
+	return result, nil
+}
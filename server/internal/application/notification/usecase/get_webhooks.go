@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetWebhooksUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetWebhooksUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *GetWebhooksUseCase {
+	return &GetWebhooksUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetWebhooksUseCase) Exec(ctx context.Context, data *dto.GetWebhooksReqDTO) ([]dto.GetWebhooksResDTO, error) {
+	ctx, span := tracer.Start(ctx, "notification.usecase.GetWebhooks")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	webhooks, err := uc.notificationSvc.GetWebhooks(ctx, userUUID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]dto.GetWebhooksResDTO, len(webhooks))
+	for i, webhook := range webhooks {
+		result[i] = dto.GetWebhooksResDTO{
+			UUID:                webhook.WebhookUUID.String(),
+			URL:                 webhook.URL,
+			Enabled:             webhook.Enabled,
+			ConsecutiveFailures: webhook.ConsecutiveFailures,
+			CreatedAt:           webhook.CreatedAt,
+			DisabledAt:          webhook.DisabledAt,
+		}
+	}
+
+	return result, nil
+}
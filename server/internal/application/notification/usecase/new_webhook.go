@@ -0,0 +1,52 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type NewWebhookUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewNewWebhookUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *NewWebhookUseCase {
+	return &NewWebhookUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *NewWebhookUseCase) Exec(ctx context.Context, data *dto.NewWebhookReqDTO) (*dto.NewWebhookResDTO, error) {
+	ctx, span := tracer.Start(ctx, "notification.usecase.NewWebhook")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	res, err := uc.notificationSvc.CreateWebhook(ctx, &notification.CreateWebhookReq{
+		UserUUID: userUUID,
+		URL:      data.URL,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &dto.NewWebhookResDTO{
+		UUID:   res.WebhookUUID.String(),
+		Secret: res.Secret,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/notification/dto"
+	"labgrab/internal/notification"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("notification-usecase")
+
+type StreamEventsUseCase struct {
+	notificationSvc *notification.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewStreamEventsUseCase(notificationSvc *notification.Service, logger *zap.SugaredLogger) *StreamEventsUseCase {
+	return &StreamEventsUseCase{
+		notificationSvc: notificationSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *StreamEventsUseCase) Exec(ctx context.Context, data *dto.StreamEventsReqDTO) (<-chan dto.StreamEventDTO, error) {
+	ctx, span := tracer.Start(ctx, "notification.usecase.StreamEvents")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	events, err := uc.notificationSvc.SubscribeEvents(ctx, &notification.SubscribeEventsReq{
+		UserUUID:    userUUID,
+		LastEventID: data.LastEventID,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make(chan dto.StreamEventDTO)
+	go func() {
+		defer close(result)
+		for event := range events {
+			select {
+			case result <- dto.StreamEventDTO{ID: event.ID, Event: event.Event, Data: event.Data}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return result, nil
+}
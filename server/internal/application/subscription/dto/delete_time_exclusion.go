@@ -0,0 +1,6 @@
+package dto
+
+type DeleteTimeExclusionReqDTO struct {
+	UserUUID      string `json:"user_uuid"`
+	ExclusionUUID string `json:"exclusion_uuid"`
+}
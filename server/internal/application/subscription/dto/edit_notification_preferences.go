@@ -0,0 +1,6 @@
+package dto
+
+type EditNotificationPreferencesReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+	NotificationPreferencesDTO
+}
@@ -5,8 +5,12 @@ type EditSubscriptionReqDTO struct {
 	SubscriptionUUID string  `json:"subscription_uuid"`
 	LabType          *string `json:"lab_type"`
 	LabTopic         *string `json:"lab_topic"`
-	LabNumber        *int    `json:"lab_number"`
-	LabAuditorium    *int    `json:"lab_auditorium"`
+	LabNumbers       []int   `json:"lab_numbers"`
+	LabAuditoriums   []int   `json:"lab_auditoriums"` // An empty array matches any auditorium
+	// Dates are YYYY-MM-DD, an empty string removes the constraint
+	ValidFrom   *string `json:"valid_from"`
+	ValidUntil  *string `json:"valid_until"`
+	SlotsBefore *string `json:"slots_before"`
 }
 
 type EditSubscriptionResDTO struct {
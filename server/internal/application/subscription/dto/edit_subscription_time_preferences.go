@@ -0,0 +1,7 @@
+package dto
+
+type EditSubscriptionTimePreferencesReqDTO struct {
+	UserUUID         string `json:"user_uuid"`
+	SubscriptionUUID string `json:"subscription_uuid"`
+	SubscriptionTimePreferencesDTO
+}
@@ -0,0 +1,6 @@
+package dto
+
+type EditTeacherPreferencesReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+	TeacherPreferencesDTO
+}
@@ -0,0 +1,11 @@
+package dto
+
+type LabCatalogEntryDTO struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type GetLabCatalogResDTO struct {
+	Types  []LabCatalogEntryDTO `json:"types"`
+	Topics []LabCatalogEntryDTO `json:"topics"`
+}
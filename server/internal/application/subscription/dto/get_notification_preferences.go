@@ -0,0 +1,15 @@
+package dto
+
+type GetNotificationPreferencesReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+}
+
+// NotificationPreferencesDTO times of day are formatted as HH:MM, digest interval is in minutes
+type NotificationPreferencesDTO struct {
+	QuietHoursStart  *string `json:"quiet_hours_start"`
+	QuietHoursEnd    *string `json:"quiet_hours_end"`
+	DeliveryMode     string  `json:"delivery_mode"`
+	DigestInterval   int     `json:"digest_interval"`
+	MaxPerHour       *int    `json:"max_per_hour"`
+	PreferredChannel *string `json:"preferred_channel"`
+}
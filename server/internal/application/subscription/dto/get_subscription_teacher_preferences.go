@@ -0,0 +1,6 @@
+package dto
+
+type GetSubscriptionTeacherPreferencesReqDTO struct {
+	UserUUID         string `json:"user_uuid"`
+	SubscriptionUUID string `json:"subscription_uuid"`
+}
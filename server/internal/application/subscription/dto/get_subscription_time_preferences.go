@@ -0,0 +1,12 @@
+package dto
+
+type GetSubscriptionTimePreferencesReqDTO struct {
+	UserUUID         string `json:"user_uuid"`
+	SubscriptionUUID string `json:"subscription_uuid"`
+}
+
+// SubscriptionTimePreferencesDTO maps days of week to lessons. An empty map means the subscription uses time
+// preferences of the user
+type SubscriptionTimePreferencesDTO struct {
+	TimePreferences map[string][]int `json:"time_preferences"`
+}
@@ -8,11 +8,14 @@ type GetSubscriptionsReqDTO struct {
 }
 
 type GetSubscriptionsResDTO struct {
-	UUID          string     `json:"uuid"`
-	LabType       string     `json:"lab_type"`
-	LabTopic      string     `json:"lab_topic"`
-	LabNumber     int        `json:"lab_number"`
-	LabAuditorium *int       `json:"lab_auditorium"`
-	CreatedAt     time.Time  `json:"created_at"`
-	ClosedAt      *time.Time `json:"closed_at"`
+	UUID           string     `json:"uuid"`
+	LabType        string     `json:"lab_type"`
+	LabTopic       string     `json:"lab_topic"`
+	LabNumbers     []int      `json:"lab_numbers"`
+	LabAuditoriums []int      `json:"lab_auditoriums"`
+	ValidFrom      *string    `json:"valid_from"`
+	ValidUntil     *string    `json:"valid_until"`
+	SlotsBefore    *string    `json:"slots_before"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
 }
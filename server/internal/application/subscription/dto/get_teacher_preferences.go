@@ -0,0 +1,13 @@
+package dto
+
+type GetTeacherPreferencesReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+}
+
+// TeacherPreferencesDTO mode is one of 'Blacklist', 'Whitelist' or 'Ranked'. Preferred teachers are ordered from
+// the most preferred one
+type TeacherPreferencesDTO struct {
+	Mode                string   `json:"mode"`
+	BlacklistedTeachers []string `json:"blacklisted_teachers"`
+	PreferredTeachers   []string `json:"preferred_teachers"`
+}
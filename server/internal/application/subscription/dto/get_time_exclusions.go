@@ -0,0 +1,13 @@
+package dto
+
+type GetTimeExclusionsReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+}
+
+// TimeExclusionDTO dates are formatted as YYYY-MM-DD and both are inclusive
+type TimeExclusionDTO struct {
+	UUID     string  `json:"uuid"`
+	StartsOn string  `json:"starts_on"`
+	EndsOn   string  `json:"ends_on"`
+	Reason   *string `json:"reason"`
+}
@@ -1,12 +1,15 @@
 package dto
 
 type NewSubscriptionReqDTO struct {
-	UserUUID      string `json:"user_uuid"`
-	LabType       string `json:"lab_type"`
-	LabTopic      string `json:"lab_topic"`
-	LabNumber     int    `json:"lab_number"`
-	LabAuditorium *int   `json:"lab_auditorium"`
-	CreatedAt     int64  `json:"created_at"`
+	UserUUID       string  `json:"user_uuid"`
+	LabType        string  `json:"lab_type"`
+	LabTopic       string  `json:"lab_topic"`
+	LabNumbers     []int   `json:"lab_numbers"`
+	LabAuditoriums []int   `json:"lab_auditoriums"` // Omitted or empty to match any auditorium
+	ValidFrom      *string `json:"valid_from"`      // YYYY-MM-DD
+	ValidUntil     *string `json:"valid_until"`     // YYYY-MM-DD
+	SlotsBefore    *string `json:"slots_before"`    // YYYY-MM-DD
+	CreatedAt      int64   `json:"created_at"`
 }
 
 type NewSubscriptionResDTO struct {
@@ -0,0 +1,12 @@
+package dto
+
+type NewTimeExclusionReqDTO struct {
+	UserUUID string  `json:"user_uuid"`
+	StartsOn string  `json:"starts_on"` // YYYY-MM-DD
+	EndsOn   *string `json:"ends_on"`   // YYYY-MM-DD, omitted for a single date
+	Reason   *string `json:"reason"`
+}
+
+type NewTimeExclusionResDTO struct {
+	UUID string `json:"uuid"`
+}
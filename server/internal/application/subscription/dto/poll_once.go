@@ -0,0 +1,28 @@
+package dto
+
+type PollOnceResDTO struct {
+	Events               []PollOnceEventDTO `json:"events"`
+	MatchedSubscriptions int                `json:"matched_subscriptions"`
+}
+
+type PollOnceEventDTO struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Topic      string   `json:"topic"`
+	Number     int      `json:"number"`
+	Auditorium int      `json:"auditorium"`
+	Spot       *int     `json:"spot,omitempty"`
+	Groups     []string `json:"groups,omitempty"`
+	// Schedule holds teachers by lesson number by day of week, Dates holds YYYY-MM-DD dates the same way
+	Schedule map[string]map[int][]string `json:"schedule"`
+	Dates    map[string]map[int][]string `json:"dates,omitempty"`
+	Matches  []PollOnceMatchDTO          `json:"matches"`
+}
+
+type PollOnceMatchDTO struct {
+	UserUUID          string           `json:"user_uuid"`
+	SubscriptionUUID  string           `json:"subscription_uuid"`
+	MatchingTimeslots map[string][]int `json:"matching_timeslots"`
+	Teachers          []string         `json:"teachers"`
+	PreferredTeachers []string         `json:"preferred_teachers"`
+}
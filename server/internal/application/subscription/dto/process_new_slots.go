@@ -0,0 +1,9 @@
+package dto
+
+// ProcessNewSlotsResDTO counts what a polling cycle processed
+type ProcessNewSlotsResDTO struct {
+	Events               int `json:"events"`
+	GoneEvents           int `json:"gone_events"`
+	MatchedSubscriptions int `json:"matched_subscriptions"`
+	GoneSubscriptions    int `json:"gone_subscriptions"`
+}
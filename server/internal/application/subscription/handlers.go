@@ -2,6 +2,7 @@ package subscription
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"labgrab/internal/subscription"
 	"net/http"
@@ -18,20 +19,46 @@ import (
 var tracer = otel.Tracer("subscription-handler")
 
 type Handler struct {
-	getSubscriptions *usecase.GetSubscriptionsUseCase
-	newSubscription  *usecase.NewSubscriptionUseCase
-	editSubscription *usecase.EditSubscriptionUseCase
-	logger           *zap.SugaredLogger
+	getSubscriptions      *usecase.GetSubscriptionsUseCase
+	newSubscription       *usecase.NewSubscriptionUseCase
+	editSubscription      *usecase.EditSubscriptionUseCase
+	getPreferences        *usecase.GetNotificationPreferencesUseCase
+	editPreferences       *usecase.EditNotificationPreferencesUseCase
+	getTimePrefs          *usecase.GetSubscriptionTimePreferencesUseCase
+	editTimePrefs         *usecase.EditSubscriptionTimePreferencesUseCase
+	getExclusions         *usecase.GetTimeExclusionsUseCase
+	newExclusion          *usecase.NewTimeExclusionUseCase
+	deleteExclusion       *usecase.DeleteTimeExclusionUseCase
+	getTeacherPrefs       *usecase.GetTeacherPreferencesUseCase
+	editTeacherPrefs      *usecase.EditTeacherPreferencesUseCase
+	getSubTeacherPrefs    *usecase.GetSubscriptionTeacherPreferencesUseCase
+	editSubTeacherPrefs   *usecase.EditSubscriptionTeacherPreferencesUseCase
+	deleteSubTeacherPrefs *usecase.DeleteSubscriptionTeacherPreferencesUseCase
+	getLabCatalog         *usecase.GetLabCatalogUseCase
+	logger                *zap.SugaredLogger
 }
 
 func NewHandler(subscriptionSvc *subscription.Service,
 	logger *zap.SugaredLogger,
 ) *Handler {
 	return &Handler{
-		getSubscriptions: usecase.NewGetSubscriptionsUseCase(subscriptionSvc, logger),
-		newSubscription:  usecase.NewNewSubscriptionUseCase(subscriptionSvc, logger),
-		editSubscription: usecase.NewEditSubscriptionUseCase(subscriptionSvc, logger),
-		logger:           logger,
+		getSubscriptions:      usecase.NewGetSubscriptionsUseCase(subscriptionSvc, logger),
+		newSubscription:       usecase.NewNewSubscriptionUseCase(subscriptionSvc, logger),
+		editSubscription:      usecase.NewEditSubscriptionUseCase(subscriptionSvc, logger),
+		getPreferences:        usecase.NewGetNotificationPreferencesUseCase(subscriptionSvc, logger),
+		editPreferences:       usecase.NewEditNotificationPreferencesUseCase(subscriptionSvc, logger),
+		getTimePrefs:          usecase.NewGetSubscriptionTimePreferencesUseCase(subscriptionSvc, logger),
+		editTimePrefs:         usecase.NewEditSubscriptionTimePreferencesUseCase(subscriptionSvc, logger),
+		getExclusions:         usecase.NewGetTimeExclusionsUseCase(subscriptionSvc, logger),
+		newExclusion:          usecase.NewNewTimeExclusionUseCase(subscriptionSvc, logger),
+		deleteExclusion:       usecase.NewDeleteTimeExclusionUseCase(subscriptionSvc, logger),
+		getTeacherPrefs:       usecase.NewGetTeacherPreferencesUseCase(subscriptionSvc, logger),
+		editTeacherPrefs:      usecase.NewEditTeacherPreferencesUseCase(subscriptionSvc, logger),
+		getSubTeacherPrefs:    usecase.NewGetSubscriptionTeacherPreferencesUseCase(subscriptionSvc, logger),
+		editSubTeacherPrefs:   usecase.NewEditSubscriptionTeacherPreferencesUseCase(subscriptionSvc, logger),
+		deleteSubTeacherPrefs: usecase.NewDeleteSubscriptionTeacherPreferencesUseCase(subscriptionSvc, logger),
+		getLabCatalog:         usecase.NewGetLabCatalogUseCase(subscriptionSvc, logger),
+		logger:                logger,
 	}
 }
 
@@ -146,9 +173,404 @@ func (h *Handler) EditSubscription(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.GetNotificationPreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetNotificationPreferencesReqDTO{
+		UserUUID: vars["user_uuid"],
+	}
+
+	resp, err := h.getPreferences.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) EditNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.EditNotificationPreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	userUUID := vars["user_uuid"]
+
+	var req dto.EditNotificationPreferencesReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = userUUID
+
+	resp, err := h.editPreferences.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) GetSubscriptionTimePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.GetSubscriptionTimePreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetSubscriptionTimePreferencesReqDTO{
+		UserUUID:         vars["user_uuid"],
+		SubscriptionUUID: vars["id"],
+	}
+
+	resp, err := h.getTimePrefs.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) EditSubscriptionTimePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.EditSubscriptionTimePreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+
+	var req dto.EditSubscriptionTimePreferencesReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = vars["user_uuid"]
+	req.SubscriptionUUID = vars["id"]
+
+	resp, err := h.editTimePrefs.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) GetTimeExclusions(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.GetTimeExclusions")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetTimeExclusionsReqDTO{
+		UserUUID: vars["user_uuid"],
+	}
+
+	resp, err := h.getExclusions.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) NewTimeExclusion(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.NewTimeExclusion")
+	defer span.End()
+
+	vars := mux.Vars(r)
+
+	var req dto.NewTimeExclusionReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = vars["user_uuid"]
+
+	resp, err := h.newExclusion.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) DeleteTimeExclusion(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.DeleteTimeExclusion")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.DeleteTimeExclusionReqDTO{
+		UserUUID:      vars["user_uuid"],
+		ExclusionUUID: vars["id"],
+	}
+
+	if err := h.deleteExclusion.Exec(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, subscription.ErrTimeExclusionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetTeacherPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.GetTeacherPreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetTeacherPreferencesReqDTO{
+		UserUUID: vars["user_uuid"],
+	}
+
+	resp, err := h.getTeacherPrefs.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) EditTeacherPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.EditTeacherPreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+
+	var req dto.EditTeacherPreferencesReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = vars["user_uuid"]
+
+	resp, err := h.editTeacherPrefs.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) GetSubscriptionTeacherPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.GetSubscriptionTeacherPreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.GetSubscriptionTeacherPreferencesReqDTO{
+		UserUUID:         vars["user_uuid"],
+		SubscriptionUUID: vars["id"],
+	}
+
+	resp, err := h.getSubTeacherPrefs.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) EditSubscriptionTeacherPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.EditSubscriptionTeacherPreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+
+	var req dto.EditSubscriptionTeacherPreferencesReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = vars["user_uuid"]
+	req.SubscriptionUUID = vars["id"]
+
+	resp, err := h.editSubTeacherPrefs.Exec(ctx, &req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) DeleteSubscriptionTeacherPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.DeleteSubscriptionTeacherPreferences")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	req := &dto.DeleteSubscriptionTeacherPreferencesReqDTO{
+		UserUUID:         vars["user_uuid"],
+		SubscriptionUUID: vars["id"],
+	}
+
+	if err := h.deleteSubTeacherPrefs.Exec(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetLabCatalog(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "subscription.handler.GetLabCatalog")
+	defer span.End()
+
+	resp, err := h.getLabCatalog.Exec(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (h *Handler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/subscriptions/{user_uuid}", h.GetSubscriptions).Methods(http.MethodGet)
 	r.HandleFunc("/api/subscriptions/{user_uuid}", h.NewSubscription).Methods(http.MethodPost)
 	r.HandleFunc("/api/subscriptions/{user_uuid}/{id}", h.GetSubscriptions).Methods(http.MethodGet)
 	r.HandleFunc("/api/subscriptions/{user_uuid}/{id}", h.EditSubscription).Methods(http.MethodPatch)
+	r.HandleFunc("/api/subscriptions/{user_uuid}/{id}/time-preferences", h.GetSubscriptionTimePreferences).Methods(http.MethodGet)
+	r.HandleFunc("/api/subscriptions/{user_uuid}/{id}/time-preferences", h.EditSubscriptionTimePreferences).Methods(http.MethodPut)
+	r.HandleFunc("/api/users/{user_uuid}/notification-preferences", h.GetNotificationPreferences).Methods(http.MethodGet)
+	r.HandleFunc("/api/users/{user_uuid}/notification-preferences", h.EditNotificationPreferences).Methods(http.MethodPut)
+	r.HandleFunc("/api/subscriptions/{user_uuid}/{id}/teacher-preferences", h.GetSubscriptionTeacherPreferences).Methods(http.MethodGet)
+	r.HandleFunc("/api/subscriptions/{user_uuid}/{id}/teacher-preferences", h.EditSubscriptionTeacherPreferences).Methods(http.MethodPut)
+	r.HandleFunc("/api/subscriptions/{user_uuid}/{id}/teacher-preferences", h.DeleteSubscriptionTeacherPreferences).Methods(http.MethodDelete)
+	r.HandleFunc("/api/users/{user_uuid}/teacher-preferences", h.GetTeacherPreferences).Methods(http.MethodGet)
+	r.HandleFunc("/api/users/{user_uuid}/teacher-preferences", h.EditTeacherPreferences).Methods(http.MethodPut)
+	r.HandleFunc("/api/users/{user_uuid}/exclusions", h.GetTimeExclusions).Methods(http.MethodGet)
+	r.HandleFunc("/api/users/{user_uuid}/exclusions", h.NewTimeExclusion).Methods(http.MethodPost)
+	r.HandleFunc("/api/users/{user_uuid}/exclusions/{id}", h.DeleteTimeExclusion).Methods(http.MethodDelete)
+	r.HandleFunc("/api/lab-catalog", h.GetLabCatalog).Methods(http.MethodGet)
 }
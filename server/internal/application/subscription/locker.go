@@ -0,0 +1,121 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"labgrab/pkg/config"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var errLockTaken = errors.New("lock is taken by another instance")
+
+// acquireScript takes the lock in KEYS[1] for ARGV[1] unless another owner holds it. The owner keeps the lock
+// across runs, so it may take it again while the lock is still held. ARGV[2] is the TTL in milliseconds
+var acquireScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// extendScript sets the TTL of the lock in KEYS[1] to ARGV[2] milliseconds if ARGV[1] still owns it,
+// a zero TTL deletes the lock
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == '0' then
+	redis.call('DEL', KEYS[1])
+else
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// RedisLocker is a gocron distributed locker keeping a job on a single instance. A running job extends its
+// lock, and after the run the instance keeps the lock for the hold period so that it stays the one running
+// the job. Another instance takes the job over once the owner stops running it for longer than the hold
+type RedisLocker struct {
+	cache  *redis.Client
+	cfg    *config.LockConfig
+	owner  string
+	logger *zap.SugaredLogger
+}
+
+func NewRedisLocker(cache *redis.Client, cfg *config.LockConfig, logger *zap.SugaredLogger) *RedisLocker {
+	return &RedisLocker{
+		cache:  cache,
+		cfg:    cfg,
+		owner:  uuid.NewString(),
+		logger: logger,
+	}
+}
+
+func (l *RedisLocker) Lock(ctx context.Context, key string) (gocron.Lock, error) {
+	key = l.cfg.KeyPrefix + ":" + key
+	acquired, err := acquireScript.Run(ctx, l.cache, []string{key}, l.owner, l.cfg.TTL.Milliseconds()).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if acquired == 0 {
+		l.logger.Debugw("Skipping job, lock is taken by another instance", "key", key)
+		return nil, errLockTaken
+	}
+
+	lock := &redisLock{
+		locker: l,
+		key:    key,
+		done:   make(chan struct{}),
+	}
+	go lock.keepAlive()
+	return lock, nil
+}
+
+type redisLock struct {
+	locker *RedisLocker
+	key    string
+	done   chan struct{}
+}
+
+// keepAlive extends the lock every third of the TTL until it is unlocked
+func (l *redisLock) keepAlive() {
+	ticker := time.NewTicker(l.locker.cfg.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			if err := l.extend(context.Background(), l.locker.cfg.TTL); err != nil {
+				l.locker.logger.Warnw("Failed to extend lock", "key", l.key, "error", err)
+			}
+		}
+	}
+}
+
+// Unlock stops extending the lock and leaves it with the instance for the hold period. gocron passes the job
+// context, which is already cancelled when the job is rescheduled or removed, so cancellation is ignored
+func (l *redisLock) Unlock(ctx context.Context) error {
+	close(l.done)
+	return l.extend(context.WithoutCancel(ctx), l.locker.cfg.Hold)
+}
+
+func (l *redisLock) extend(ctx context.Context, ttl time.Duration) error {
+	extended, err := extendScript.Run(ctx, l.locker.cache, []string{l.key}, l.locker.owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to extend lock %s: %w", l.key, err)
+	}
+	if extended == 0 {
+		return fmt.Errorf("failed to extend lock %s: %w", l.key, errLockTaken)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"labgrab/internal/shared/redistest"
+	"labgrab/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// newTestLockers returns two lockers standing for two instances, sharing a key prefix unique to the test
+func newTestLockers(t *testing.T, ttl, hold time.Duration) (*redis.Client, *RedisLocker, *RedisLocker) {
+	t.Helper()
+
+	cache, prefix := redistest.New(t)
+	cfg := &config.LockConfig{KeyPrefix: prefix, TTL: ttl, Hold: hold}
+	logger := zap.NewNop().Sugar()
+	return cache, NewRedisLocker(cache, cfg, logger), NewRedisLocker(cache, cfg, logger)
+}
+
+func TestRedisLockerLock(t *testing.T) {
+	cache, first, second := newTestLockers(t, time.Minute, time.Hour)
+	ctx := context.Background()
+
+	lock, err := first.Lock(ctx, "job")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer lock.Unlock(ctx)
+
+	key := first.cfg.KeyPrefix + ":job"
+	if owner := cache.Get(ctx, key).Val(); owner != first.owner {
+		t.Errorf("lock owner = %q, want %q", owner, first.owner)
+	}
+	if ttl := cache.PTTL(ctx, key).Val(); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("lock TTL = %s, want up to %s", ttl, time.Minute)
+	}
+
+	if _, err := second.Lock(ctx, "job"); !errors.Is(err, errLockTaken) {
+		t.Errorf("Lock() on another instance error = %v, want %v", err, errLockTaken)
+	}
+	other, err := second.Lock(ctx, "other-job")
+	if err != nil {
+		t.Fatalf("Lock() of another job error = %v", err)
+	}
+	other.Unlock(ctx)
+}
+
+func TestRedisLockerExtendsRunningLock(t *testing.T) {
+	cache, first, second := newTestLockers(t, 300*time.Millisecond, time.Hour)
+	ctx := context.Background()
+
+	lock, err := first.Lock(ctx, "job")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer lock.Unlock(ctx)
+
+	// The job runs for several TTLs, the lock must outlive them
+	time.Sleep(time.Second)
+
+	key := first.cfg.KeyPrefix + ":job"
+	if owner := cache.Get(ctx, key).Val(); owner != first.owner {
+		t.Errorf("lock owner = %q after %s, want it extended", owner, time.Second)
+	}
+	if _, err := second.Lock(ctx, "job"); !errors.Is(err, errLockTaken) {
+		t.Errorf("Lock() on another instance error = %v, want %v", err, errLockTaken)
+	}
+}
+
+func TestRedisLockerHoldsLockAfterUnlock(t *testing.T) {
+	cache, first, second := newTestLockers(t, time.Minute, 300*time.Millisecond)
+	ctx := context.Background()
+
+	lock, err := first.Lock(ctx, "job")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	key := first.cfg.KeyPrefix + ":job"
+	if ttl := cache.PTTL(ctx, key).Val(); ttl <= 0 || ttl > 300*time.Millisecond {
+		t.Errorf("lock TTL = %s after unlock, want up to the hold %s", ttl, 300*time.Millisecond)
+	}
+
+	if _, err := second.Lock(ctx, "job"); !errors.Is(err, errLockTaken) {
+		t.Errorf("Lock() on another instance during the hold error = %v, want %v", err, errLockTaken)
+	}
+
+	// The owner runs the job again while it holds the lock
+	lock, err = first.Lock(ctx, "job")
+	if err != nil {
+		t.Fatalf("Lock() by the owner during the hold error = %v", err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	// The owner stops running the job, another instance takes it over once the hold expires
+	time.Sleep(500 * time.Millisecond)
+	lock, err = second.Lock(ctx, "job")
+	if err != nil {
+		t.Fatalf("Lock() on another instance after the hold error = %v", err)
+	}
+	defer lock.Unlock(ctx)
+
+	if owner := cache.Get(ctx, key).Val(); owner != second.owner {
+		t.Errorf("lock owner = %q, want %q", owner, second.owner)
+	}
+	if _, err := first.Lock(ctx, "job"); !errors.Is(err, errLockTaken) {
+		t.Errorf("Lock() by the former owner error = %v, want %v", err, errLockTaken)
+	}
+}
+
+func TestRedisLockerUnlockOnlyByOwner(t *testing.T) {
+	cache, first, second := newTestLockers(t, time.Minute, 0)
+	ctx := context.Background()
+
+	lock, err := first.Lock(ctx, "job")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	// The lock expired while the owner was stalled and another instance took it
+	key := first.cfg.KeyPrefix + ":job"
+	cache.Set(ctx, key, second.owner, time.Minute)
+
+	if err := lock.Unlock(ctx); !errors.Is(err, errLockTaken) {
+		t.Errorf("Unlock() of a lost lock error = %v, want %v", err, errLockTaken)
+	}
+	if owner := cache.Get(ctx, key).Val(); owner != second.owner {
+		t.Errorf("lock owner = %q after unlock by the former owner, want %q", owner, second.owner)
+	}
+
+	cache.Del(ctx, key)
+	lock, err = second.Lock(ctx, "job")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	// Without a hold the owner releases the lock right away
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if exists := cache.Exists(ctx, key).Val(); exists != 0 {
+		t.Error("lock still exists after unlock without a hold")
+	}
+}
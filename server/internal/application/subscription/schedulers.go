@@ -2,58 +2,126 @@ package subscription
 
 import (
 	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
 	"labgrab/internal/application/subscription/usecase"
 	"labgrab/internal/lab_polling"
+	"labgrab/internal/notification"
 	"labgrab/internal/shared/api/dikidi"
 	"labgrab/internal/subscription"
+	"labgrab/pkg/config"
+	"math/rand/v2"
+	"os"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+const (
+	jobProcessNewSlots           = "ProcessNewSlots"
+	jobCloseExpiredSubscriptions = "CloseExpiredSubscriptions"
+	jobPruneJobRuns              = "PruneJobRuns"
+
+	jobOverlapSkip  = "skip"
+	jobOverlapQueue = "queue"
+
+	defaultJobRunsRetention = 7 * 24 * time.Hour
+
+	// Slot sources are reloaded by the poll once they are older than a random age in this range
+	slotSourcesMinAge = 12 * time.Hour
+	slotSourcesMaxAge = 24 * time.Hour
+)
+
 type Scheduler struct {
 	dikidiClient    *dikidi.Client
 	pollingSvc      *lab_polling.Service
 	subscriptionSvc *subscription.Service
 	logger          *zap.SugaredLogger
 	scheduler       gocron.Scheduler
-	processNewSlots *usecase.ProcessNewSlotsUseCase
+	locker          gocron.Locker
+	overlapMode     gocron.LimitMode
+	runsRetention   time.Duration
+	// instance identifies the process in recorded runs
+	instance string
+	// slotSourcesExpireAt is when the poll reloads slot sources, zero until they are loaded
+	slotSourcesExpireAt time.Time
+	processNewSlots     *usecase.ProcessNewSlotsUseCase
+	pollOnce            *usecase.PollOnceUseCase
 }
 
-func NewScheduler(dikidiClient *dikidi.Client, pollingSvc *lab_polling.Service, subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *Scheduler {
+// NewScheduler creates the scheduler of polling jobs. With a locker only one instance at a time polls Dikidi, a nil
+// locker polls on every instance. A nil jobsCfg skips runs that overlap
+func NewScheduler(dikidiClient *dikidi.Client, pollingSvc *lab_polling.Service, subscriptionSvc *subscription.Service, notificationSvc *notification.Service, jobsCfg *config.JobsConfig, locker gocron.Locker, logger *zap.SugaredLogger) (*Scheduler, error) {
+	var overlapMode gocron.LimitMode = gocron.LimitModeReschedule
+	runsRetention := defaultJobRunsRetention
+	if jobsCfg != nil {
+		switch jobsCfg.Overlap {
+		case "", jobOverlapSkip:
+		case jobOverlapQueue:
+			overlapMode = gocron.LimitModeWait
+		default:
+			return nil, fmt.Errorf("unknown job overlap policy %q", jobsCfg.Overlap)
+		}
+		if jobsCfg.RunsRetention > 0 {
+			runsRetention = jobsCfg.RunsRetention
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
 	return &Scheduler{
 		dikidiClient:    dikidiClient,
 		pollingSvc:      pollingSvc,
 		subscriptionSvc: subscriptionSvc,
 		logger:          logger,
-		processNewSlots: usecase.NewProcessNewSlotsUseCase(pollingSvc, subscriptionSvc, logger),
-	}
+		locker:          locker,
+		overlapMode:     overlapMode,
+		runsRetention:   runsRetention,
+		instance:        fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		processNewSlots: usecase.NewProcessNewSlotsUseCase(pollingSvc, subscriptionSvc, notificationSvc, logger),
+		pollOnce:        usecase.NewPollOnceUseCase(pollingSvc, subscriptionSvc, logger),
+	}, nil
 }
 
 func (s *Scheduler) Start(ctx context.Context) error {
-	s.UpdateSlotSources(ctx)
-	scheduler, err := gocron.NewScheduler()
+	scheduler, err := gocron.NewScheduler(gocron.WithMonitor(&jobMonitor{ctx: ctx, scheduler: s}))
 	if err != nil {
 		return err
 	}
+	s.scheduler = scheduler
+	// Polls run as one time jobs, every run schedules the next one by the polling policy
+	next, _ := s.pollingSvc.NextPoll(ctx, time.Now())
 	_, err = scheduler.NewJob(
-		gocron.DurationRandomJob(time.Second*30, time.Minute),
+		gocron.OneTimeJob(gocron.OneTimeJobStartDateTime(next)),
 		gocron.NewTask(s.ProcessNewSlots, ctx),
+		s.pollJobOptions(ctx)...,
 	)
 	if err != nil {
 		return err
 	}
 	_, err = scheduler.NewJob(
-		gocron.DurationRandomJob(time.Hour*12, time.Hour*24),
-		gocron.NewTask(s.UpdateSlotSources, ctx),
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(s.CloseExpiredSubscriptions, ctx),
+		s.jobOptions(ctx, jobCloseExpiredSubscriptions, false)...,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(s.PruneJobRuns, ctx),
+		s.jobOptions(ctx, jobPruneJobRuns, false)...,
 	)
 	if err != nil {
 		return err
 	}
 
 	scheduler.Start()
-	s.scheduler = scheduler
 	return nil
 }
 
@@ -61,22 +129,202 @@ func (s *Scheduler) Stop() error {
 	return s.scheduler.Shutdown()
 }
 
-func (s *Scheduler) ProcessNewSlots(ctx context.Context) {
-	now := time.Now()
-	s.logger.Infow("Running job", "job", "ProcessNewSlots", "time", now)
-	err := s.processNewSlots.Exec(ctx)
+func (s *Scheduler) pollJobOptions(ctx context.Context) []gocron.JobOption {
+	return append(
+		s.baseJobOptions(jobProcessNewSlots, true),
+		gocron.WithEventListeners(
+			gocron.AfterJobRuns(func(jobID uuid.UUID, _ string) {
+				s.scheduleNextPoll(ctx, jobID, true)
+			}),
+			gocron.AfterLockError(func(jobID uuid.UUID, _ string, _ error) {
+				s.scheduleNextPoll(ctx, jobID, false)
+			}),
+		),
+	)
+}
+
+// scheduleNextPoll moves the poll job to the next time picked by the polling policy. It also runs when another
+// instance holds the lock, so that the poll is retried and taken over once the lock is free. Only the instance
+// that polled shares its next poll
+func (s *Scheduler) scheduleNextPoll(ctx context.Context, jobID uuid.UUID, polled bool) {
+	next, rule := s.pollingSvc.NextPoll(ctx, time.Now())
+	if polled {
+		if err := s.pollingSvc.SaveNextPoll(ctx, next, rule); err != nil {
+			s.logger.Errorw("Error saving next poll", "error", err)
+		}
+		if err := s.pollingSvc.SaveJobNextRun(ctx, jobProcessNewSlots, &next); err != nil {
+			s.logger.Errorw("Error saving next run", "job", jobProcessNewSlots, "error", err)
+		}
+	}
+	// Update waits for the current run to be cleaned up, so it must not block the run
+	go func() {
+		_, err := s.scheduler.Update(
+			jobID,
+			gocron.OneTimeJob(gocron.OneTimeJobStartDateTime(next)),
+			gocron.NewTask(s.ProcessNewSlots, ctx),
+			s.pollJobOptions(ctx)...,
+		)
+		if err != nil {
+			s.logger.Errorw("Error scheduling next poll", "error", err)
+			return
+		}
+		s.logger.Debugw("Scheduled next poll", "time", next, "rule", rule)
+	}()
+}
+
+// jobOptions are the options of a job that is scheduled by its own interval. The next run is shared after every
+// run, so that any instance can show it
+func (s *Scheduler) jobOptions(ctx context.Context, name string, locked bool) []gocron.JobOption {
+	return append(
+		s.baseJobOptions(name, locked),
+		gocron.WithEventListeners(
+			gocron.AfterJobRuns(func(jobID uuid.UUID, name string) {
+				s.saveNextRun(ctx, jobID, name)
+			}),
+		),
+	)
+}
+
+// baseJobOptions names the job and keeps its runs from overlapping by the overlap policy. The name is the key
+// of the lock of a locked job
+func (s *Scheduler) baseJobOptions(name string, locked bool) []gocron.JobOption {
+	options := []gocron.JobOption{gocron.WithName(name), gocron.WithSingletonMode(s.overlapMode)}
+	if locked && s.locker != nil {
+		options = append(options, gocron.WithDistributedJobLocker(s.locker))
+	}
+	return options
+}
+
+// saveNextRun shares the next run of a job. A job that ran longer than its interval may still list the runs it
+// skipped, so the first run after now is taken
+func (s *Scheduler) saveNextRun(ctx context.Context, jobID uuid.UUID, name string) {
+	var nextRunAt *time.Time
+	for _, job := range s.scheduler.Jobs() {
+		if job.ID() != jobID {
+			continue
+		}
+		nextRuns, err := job.NextRuns(2)
+		if err != nil {
+			s.logger.Errorw("Error getting next run", "job", name, "error", err)
+			return
+		}
+		now := time.Now()
+		for _, nextRun := range nextRuns {
+			if nextRun.After(now) {
+				nextRunAt = &nextRun
+				break
+			}
+		}
+	}
+
+	if err := s.pollingSvc.SaveJobNextRun(ctx, name, nextRunAt); err != nil {
+		s.logger.Errorw("Error saving next run", "job", name, "error", err)
+	}
+}
+
+// runJob runs the task of a job and records the run with the counts returned by the task
+func (s *Scheduler) runJob(ctx context.Context, name string, task func(ctx context.Context) (map[string]int, error)) {
+	run := &lab_polling.JobRun{
+		Job:       name,
+		Instance:  s.instance,
+		StartedAt: time.Now(),
+		Outcome:   lab_polling.JobOutcomeSuccess,
+	}
+	s.logger.Infow("Running job", "job", name, "time", run.StartedAt)
+
+	counts, err := task(ctx)
+	run.FinishedAt = time.Now()
+	run.Counts = counts
 	if err != nil {
-		s.logger.Errorw("Error executing process new slots", "error", err)
+		run.Outcome = lab_polling.JobOutcomeFailed
+		run.Error = err.Error()
+		s.logger.Errorw("Error running job", "job", name, "error", err)
+	}
+	s.logger.Infow("Finished running job", "job", name, "counts", counts, "elapsed", run.FinishedAt.Sub(run.StartedAt))
+
+	s.saveJobRun(ctx, run)
+}
+
+// saveJobRun records a run even when ctx is cancelled by a shutdown during the run
+func (s *Scheduler) saveJobRun(ctx context.Context, run *lab_polling.JobRun) {
+	if err := s.pollingSvc.SaveJobRun(context.WithoutCancel(ctx), run); err != nil {
+		s.logger.Errorw("Error saving job run", "job", run.Job, "error", err)
 	}
-	s.logger.Infow("Finished running job", "job", "ProcessNewSlots", "elapsed", time.Now().Sub(now))
 }
 
-func (s *Scheduler) UpdateSlotSources(ctx context.Context) {
+// jobMonitor records runs skipped because the previous run of the job was still going. Runs skipped because
+// another instance holds the lock are not recorded, the instance holding it records its runs
+type jobMonitor struct {
+	ctx       context.Context
+	scheduler *Scheduler
+}
+
+func (m *jobMonitor) IncrementJob(_ uuid.UUID, name string, _ []string, status gocron.JobStatus) {
+	if status != gocron.SingletonRescheduled {
+		return
+	}
+	m.scheduler.logger.Warnw("Skipping job, previous run is still running", "job", name)
 	now := time.Now()
-	s.logger.Infow("Running job", "job", "UpdateSlotSources", "time", now)
-	err := s.dikidiClient.UpdateSlotSourceIDs(ctx)
-	if err != nil {
-		s.logger.Errorw("Error updating slot sources", "error", err)
+	m.scheduler.saveJobRun(m.ctx, &lab_polling.JobRun{
+		Job:        name,
+		Instance:   m.scheduler.instance,
+		StartedAt:  now,
+		FinishedAt: now,
+		Outcome:    lab_polling.JobOutcomeSkipped,
+		Error:      "previous run is still running",
+	})
+}
+
+func (m *jobMonitor) RecordJobTiming(time.Time, time.Time, uuid.UUID, string, []string) {}
+
+func (s *Scheduler) ProcessNewSlots(ctx context.Context) {
+	s.runJob(ctx, jobProcessNewSlots, func(ctx context.Context) (map[string]int, error) {
+		if err := s.refreshSlotSources(ctx); err != nil {
+			return nil, err
+		}
+		res, err := s.processNewSlots.Exec(ctx)
+		return map[string]int{
+			"events":                res.Events,
+			"gone_events":           res.GoneEvents,
+			"matched_subscriptions": res.MatchedSubscriptions,
+			"gone_subscriptions":    res.GoneSubscriptions,
+		}, err
+	})
+}
+
+// PollOnce loads slot sources and runs a single polling cycle without the scheduler, matching slots without
+// claiming them or notifying anyone
+func (s *Scheduler) PollOnce(ctx context.Context) (*dto.PollOnceResDTO, error) {
+	if err := s.dikidiClient.UpdateSlotSourceIDs(ctx); err != nil {
+		return nil, err
 	}
-	s.logger.Infow("Finished running job", "job", "UpdateSlotSources", "elapsed", time.Now().Sub(now))
+	return s.pollOnce.Exec(ctx)
+}
+
+func (s *Scheduler) CloseExpiredSubscriptions(ctx context.Context) {
+	s.runJob(ctx, jobCloseExpiredSubscriptions, func(ctx context.Context) (map[string]int, error) {
+		closed, err := s.subscriptionSvc.CloseExpiredSubscriptions(ctx)
+		return map[string]int{"closed": int(closed)}, err
+	})
+}
+
+// refreshSlotSources reloads slot sources when this instance has not loaded them yet or they expired. It runs
+// inside the locked poll, so the instance that polls always uses sources it loaded itself after taking the lock
+func (s *Scheduler) refreshSlotSources(ctx context.Context) error {
+	if time.Now().Before(s.slotSourcesExpireAt) {
+		return nil
+	}
+	if err := s.dikidiClient.UpdateSlotSourceIDs(ctx); err != nil {
+		return fmt.Errorf("failed to update slot sources: %w", err)
+	}
+	s.slotSourcesExpireAt = time.Now().Add(slotSourcesMinAge + rand.N(slotSourcesMaxAge-slotSourcesMinAge))
+	return nil
+}
+
+// PruneJobRuns deletes recorded runs older than the retention
+func (s *Scheduler) PruneJobRuns(ctx context.Context) {
+	s.runJob(ctx, jobPruneJobRuns, func(ctx context.Context) (map[string]int, error) {
+		deleted, err := s.pollingSvc.PruneJobRuns(ctx, time.Now().Add(-s.runsRetention))
+		return map[string]int{"deleted": int(deleted)}, err
+	})
 }
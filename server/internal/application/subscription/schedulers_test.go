@@ -0,0 +1,202 @@
+package subscription
+
+import (
+	"context"
+	"labgrab/internal/lab_polling"
+	"labgrab/internal/shared/api/dikidi"
+	"labgrab/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fakeJobRunsRepo records job runs in memory. Methods other than job runs are not used
+type fakeJobRunsRepo struct {
+	lab_polling.Repository
+	mu     sync.Mutex
+	runs   []lab_polling.DBJobRun
+	before time.Time
+}
+
+func (r *fakeJobRunsRepo) SaveJobRun(ctx context.Context, run *lab_polling.DBJobRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs = append(r.runs, *run)
+	return nil
+}
+
+func (r *fakeJobRunsRepo) DeleteJobRunsBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.before = before
+	return 3, nil
+}
+
+// outcomes returns the number of recorded runs by outcome
+func (r *fakeJobRunsRepo) outcomes() map[lab_polling.JobOutcome]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	outcomes := make(map[lab_polling.JobOutcome]int)
+	for _, run := range r.runs {
+		outcomes[run.Outcome]++
+	}
+	return outcomes
+}
+
+func newTestScheduler(t *testing.T, jobsCfg *config.JobsConfig) (*Scheduler, *fakeJobRunsRepo) {
+	t.Helper()
+
+	logger := zap.NewNop().Sugar()
+	repo := &fakeJobRunsRepo{}
+	pollingSvc, err := lab_polling.NewService(repo, nil, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	s, err := NewScheduler(nil, pollingSvc, nil, nil, jobsCfg, nil, logger)
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+	return s, repo
+}
+
+func TestSchedulerRecordsSkippedRuns(t *testing.T) {
+	s, repo := newTestScheduler(t, nil)
+	ctx := context.Background()
+
+	scheduler, err := gocron.NewScheduler(gocron.WithMonitor(&jobMonitor{ctx: ctx, scheduler: s}))
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+	s.scheduler = scheduler
+
+	// Every run takes longer than the interval, so the runs due in between are skipped
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(50*time.Millisecond),
+		gocron.NewTask(func(ctx context.Context) {
+			s.runJob(ctx, "Slow", func(ctx context.Context) (map[string]int, error) {
+				time.Sleep(120 * time.Millisecond)
+				return nil, nil
+			})
+		}, ctx),
+		s.baseJobOptions("Slow", false)...,
+	)
+	if err != nil {
+		t.Fatalf("NewJob() error = %v", err)
+	}
+	scheduler.Start()
+	time.Sleep(400 * time.Millisecond)
+	if err := scheduler.Shutdown(); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	outcomes := repo.outcomes()
+	if outcomes[lab_polling.JobOutcomeSuccess] == 0 {
+		t.Errorf("recorded runs = %v, want successful runs", outcomes)
+	}
+	if outcomes[lab_polling.JobOutcomeSkipped] == 0 {
+		t.Errorf("recorded runs = %v, want skipped runs", outcomes)
+	}
+	for _, run := range repo.runs {
+		if run.Job != "Slow" || run.Instance != s.instance {
+			t.Errorf("recorded run of %q on %q, want %q on %q", run.Job, run.Instance, "Slow", s.instance)
+		}
+	}
+}
+
+func TestSchedulerIgnoresOtherJobStatuses(t *testing.T) {
+	s, repo := newTestScheduler(t, nil)
+	monitor := &jobMonitor{ctx: context.Background(), scheduler: s}
+
+	for _, status := range []gocron.JobStatus{gocron.Success, gocron.Fail, gocron.Skip} {
+		monitor.IncrementJob(uuid.Nil, "Job", nil, status)
+	}
+
+	if outcomes := repo.outcomes(); len(outcomes) != 0 {
+		t.Errorf("recorded runs = %v, want none", outcomes)
+	}
+}
+
+func TestSchedulerPruneJobRuns(t *testing.T) {
+	tests := []struct {
+		name      string
+		jobsCfg   *config.JobsConfig
+		retention time.Duration
+	}{
+		{name: "default", jobsCfg: nil, retention: defaultJobRunsRetention},
+		{name: "configured", jobsCfg: &config.JobsConfig{RunsRetention: 48 * time.Hour}, retention: 48 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := newTestScheduler(t, tt.jobsCfg)
+
+			start := time.Now()
+			s.PruneJobRuns(context.Background())
+
+			if repo.before.Before(start.Add(-tt.retention)) || repo.before.After(time.Now().Add(-tt.retention)) {
+				t.Errorf("pruned runs before %s, want %s ago", repo.before, tt.retention)
+			}
+			if len(repo.runs) != 1 {
+				t.Fatalf("recorded %d runs, want 1", len(repo.runs))
+			}
+			run := repo.runs[0]
+			if run.Job != jobPruneJobRuns || run.Outcome != lab_polling.JobOutcomeSuccess || run.Counts["deleted"] != 3 {
+				t.Errorf("recorded run = %+v, want a successful %s run that deleted 3", run, jobPruneJobRuns)
+			}
+		})
+	}
+}
+
+func TestSchedulerRefreshSlotSources(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	s, _ := newTestScheduler(t, nil)
+	s.dikidiClient = dikidi.NewClient(
+		&config.DikidiClientConfig{SourcesConfig: config.SourcesConfig{SourcesIDsProviderURL: server.URL}},
+		dikidi.NewAdaptiveHTTPClient(&config.HTTPClientConfig{Timeout: time.Second, IncreaseFactor: 1, DecreaseFactor: 1, MinRate: 100, MaxRate: 100, BurstSize: 1}),
+	)
+	ctx := context.Background()
+
+	// The first poll on the instance loads slot sources, later polls reuse them until they expire
+	for range 2 {
+		if err := s.refreshSlotSources(ctx); err != nil {
+			t.Fatalf("refreshSlotSources() error = %v", err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("loaded slot sources %d times, want 1", got)
+	}
+	if age := time.Until(s.slotSourcesExpireAt); age < slotSourcesMinAge-time.Minute || age > slotSourcesMaxAge {
+		t.Errorf("slot sources expire in %s, want between %s and %s", age, slotSourcesMinAge, slotSourcesMaxAge)
+	}
+
+	s.slotSourcesExpireAt = time.Now().Add(-time.Second)
+	if err := s.refreshSlotSources(ctx); err != nil {
+		t.Fatalf("refreshSlotSources() error = %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("loaded slot sources %d times, want expired sources reloaded", got)
+	}
+
+	// A failed load leaves the sources expired, so that the next poll loads them again
+	server.Close()
+	s.slotSourcesExpireAt = time.Time{}
+	if err := s.refreshSlotSources(ctx); err == nil {
+		t.Error("refreshSlotSources() error = nil, want the load error")
+	}
+	if !s.slotSourcesExpireAt.IsZero() {
+		t.Errorf("slot sources expire at %s after a failed load, want them expired", s.slotSourcesExpireAt)
+	}
+}
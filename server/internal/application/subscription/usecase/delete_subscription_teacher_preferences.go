@@ -0,0 +1,49 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type DeleteSubscriptionTeacherPreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewDeleteSubscriptionTeacherPreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *DeleteSubscriptionTeacherPreferencesUseCase {
+	return &DeleteSubscriptionTeacherPreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *DeleteSubscriptionTeacherPreferencesUseCase) Exec(ctx context.Context, data *dto.DeleteSubscriptionTeacherPreferencesReqDTO) error {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.DeleteSubscriptionTeacherPreferences")
+	defer span.End()
+
+	subscriptionUUID, err := uuid.Parse(data.SubscriptionUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid subscription uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	req := &subscription.UpdateSubscriptionTeacherPreferencesReq{
+		SubscriptionUUID: subscriptionUUID,
+	}
+
+	if err := uc.subscriptionSvc.UpdateSubscriptionTeacherPreferences(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type DeleteTimeExclusionUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewDeleteTimeExclusionUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *DeleteTimeExclusionUseCase {
+	return &DeleteTimeExclusionUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *DeleteTimeExclusionUseCase) Exec(ctx context.Context, data *dto.DeleteTimeExclusionReqDTO) error {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.DeleteTimeExclusion")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	exclusionUUID, err := uuid.Parse(data.ExclusionUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid exclusion uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := uc.subscriptionSvc.DeleteTimeExclusion(ctx, userUUID, exclusionUUID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
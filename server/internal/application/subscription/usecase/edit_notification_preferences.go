@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/notification"
+	"labgrab/internal/shared/errors"
+	"labgrab/internal/subscription"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+const timeOfDayLayout = "15:04"
+
+type EditNotificationPreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewEditNotificationPreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *EditNotificationPreferencesUseCase {
+	return &EditNotificationPreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *EditNotificationPreferencesUseCase) Exec(ctx context.Context, data *dto.EditNotificationPreferencesReqDTO) (*dto.NotificationPreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.EditNotificationPreferences")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	validationErr := errors.NewValidationError()
+	quietHoursStart, err := parseTimeOfDay(data.QuietHoursStart)
+	if err != nil {
+		validationErr.Add("quiet_hours_start", "Should be a time of day formatted as HH:MM")
+	}
+	quietHoursEnd, err := parseTimeOfDay(data.QuietHoursEnd)
+	if err != nil {
+		validationErr.Add("quiet_hours_end", "Should be a time of day formatted as HH:MM")
+	}
+	if data.PreferredChannel != nil && !slices.Contains(notification.Channels, notification.Channel(*data.PreferredChannel)) {
+		validationErr.Add("preferred_channel", fmt.Sprintf("Unknown channel '%s'", *data.PreferredChannel))
+	}
+	if validationErr.HasErrors() {
+		span.RecordError(validationErr)
+		span.SetStatus(codes.Error, validationErr.Error())
+		return nil, validationErr
+	}
+
+	req := &subscription.UpdateNotificationPreferencesReq{
+		UserUUID: userUUID,
+		NotificationPreferences: subscription.NotificationPreferences{
+			QuietHoursStart:  quietHoursStart,
+			QuietHoursEnd:    quietHoursEnd,
+			DeliveryMode:     subscription.DeliveryMode(data.DeliveryMode),
+			DigestInterval:   data.DigestInterval,
+			MaxPerHour:       data.MaxPerHour,
+			PreferredChannel: data.PreferredChannel,
+		},
+	}
+
+	if err := uc.subscriptionSvc.UpdateNotificationPreferences(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &data.NotificationPreferencesDTO, nil
+}
+
+// parseTimeOfDay converts HH:MM to minutes since midnight
+func parseTimeOfDay(value *string) (*int, error) {
+	if value == nil {
+		return nil, nil
+	}
+	parsed, err := time.Parse(timeOfDayLayout, *value)
+	if err != nil {
+		return nil, err
+	}
+	minutes := parsed.Hour()*60 + parsed.Minute()
+	return &minutes, nil
+}
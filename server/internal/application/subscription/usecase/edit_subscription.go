@@ -3,8 +3,10 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/shared/lab"
 	"labgrab/internal/subscription"
 
 	"github.com/google/uuid"
@@ -53,22 +55,46 @@ func (uc *EditSubscriptionUseCase) Exec(ctx context.Context, data *dto.EditSubsc
 
 	labType := existingSub.LabType
 	if data.LabType != nil {
-		labType = subscription.LabType(*data.LabType)
+		labType = lab.Type(*data.LabType)
 	}
 
 	labTopic := existingSub.LabTopic
 	if data.LabTopic != nil {
-		labTopic = subscription.LabTopic(*data.LabTopic)
+		labTopic = lab.Topic(*data.LabTopic)
 	}
 
-	labNumber := existingSub.LabNumber
-	if data.LabNumber != nil {
-		labNumber = *data.LabNumber
+	labNumbers := existingSub.LabNumbers
+	if data.LabNumbers != nil {
+		labNumbers = data.LabNumbers
 	}
 
-	labAuditorium := existingSub.LabAuditorium
-	if data.LabAuditorium != nil {
-		labAuditorium = data.LabAuditorium
+	labAuditoriums := existingSub.LabAuditoriums
+	if data.LabAuditoriums != nil {
+		labAuditoriums = anyIfEmpty(data.LabAuditoriums)
+	}
+
+	validFrom, err := mergeDate(existingSub.ValidFrom, data.ValidFrom)
+	if err != nil {
+		err = fmt.Errorf("invalid valid_from: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	validUntil, err := mergeDate(existingSub.ValidUntil, data.ValidUntil)
+	if err != nil {
+		err = fmt.Errorf("invalid valid_until: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	slotsBefore, err := mergeDate(existingSub.SlotsBefore, data.SlotsBefore)
+	if err != nil {
+		err = fmt.Errorf("invalid slots_before: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
 	}
 
 	req := &subscription.UpdateSubscriptionDataReq{
@@ -76,8 +102,11 @@ func (uc *EditSubscriptionUseCase) Exec(ctx context.Context, data *dto.EditSubsc
 		SubscriptionUUID: subscriptionUUID,
 		LabType:          labType,
 		LabTopic:         labTopic,
-		LabNumber:        labNumber,
-		LabAuditorium:    labAuditorium,
+		LabNumbers:       labNumbers,
+		LabAuditoriums:   labAuditoriums,
+		ValidFrom:        validFrom,
+		ValidUntil:       validUntil,
+		SlotsBefore:      slotsBefore,
 	}
 
 	if err := uc.subscriptionSvc.UpdateSubscription(ctx, req); err != nil {
@@ -90,3 +119,11 @@ func (uc *EditSubscriptionUseCase) Exec(ctx context.Context, data *dto.EditSubsc
 		UUID: subscriptionUUID.String(),
 	}, nil
 }
+
+// mergeDate keeps the existing date when no value is provided and clears it on an empty string
+func mergeDate(existing *time.Time, value *string) (*time.Time, error) {
+	if value == nil {
+		return existing, nil
+	}
+	return parseDate(value)
+}
@@ -0,0 +1,51 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type EditSubscriptionTeacherPreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewEditSubscriptionTeacherPreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *EditSubscriptionTeacherPreferencesUseCase {
+	return &EditSubscriptionTeacherPreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *EditSubscriptionTeacherPreferencesUseCase) Exec(ctx context.Context, data *dto.EditSubscriptionTeacherPreferencesReqDTO) (*dto.TeacherPreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.EditSubscriptionTeacherPreferences")
+	defer span.End()
+
+	subscriptionUUID, err := uuid.Parse(data.SubscriptionUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid subscription uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	prefs := fromTeacherPreferencesDTO(&data.TeacherPreferencesDTO)
+	req := &subscription.UpdateSubscriptionTeacherPreferencesReq{
+		SubscriptionUUID:   subscriptionUUID,
+		TeacherPreferences: &prefs,
+	}
+
+	if err := uc.subscriptionSvc.UpdateSubscriptionTeacherPreferences(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &data.TeacherPreferencesDTO, nil
+}
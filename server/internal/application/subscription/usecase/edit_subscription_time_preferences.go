@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/shared/types"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type EditSubscriptionTimePreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewEditSubscriptionTimePreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *EditSubscriptionTimePreferencesUseCase {
+	return &EditSubscriptionTimePreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *EditSubscriptionTimePreferencesUseCase) Exec(ctx context.Context, data *dto.EditSubscriptionTimePreferencesReqDTO) (*dto.SubscriptionTimePreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.EditSubscriptionTimePreferences")
+	defer span.End()
+
+	subscriptionUUID, err := uuid.Parse(data.SubscriptionUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid subscription uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	timePreferences := make(map[types.DayOfWeek][]int, len(data.TimePreferences))
+	for day, lessons := range data.TimePreferences {
+		timePreferences[types.DayOfWeek(day)] = lessons
+	}
+
+	req := &subscription.UpdateSubscriptionTimePreferencesReq{
+		SubscriptionUUID: subscriptionUUID,
+		TimePreferences:  timePreferences,
+	}
+
+	if err := uc.subscriptionSvc.UpdateSubscriptionTimePreferences(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &data.SubscriptionTimePreferencesDTO, nil
+}
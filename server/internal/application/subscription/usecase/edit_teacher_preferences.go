@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type EditTeacherPreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewEditTeacherPreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *EditTeacherPreferencesUseCase {
+	return &EditTeacherPreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *EditTeacherPreferencesUseCase) Exec(ctx context.Context, data *dto.EditTeacherPreferencesReqDTO) (*dto.TeacherPreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.EditTeacherPreferences")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	req := &subscription.UpdateTeacherPreferencesReq{
+		UserUUID:           userUUID,
+		TeacherPreferences: fromTeacherPreferencesDTO(&data.TeacherPreferencesDTO),
+	}
+
+	if err := uc.subscriptionSvc.UpdateTeacherPreferences(ctx, req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &data.TeacherPreferencesDTO, nil
+}
+
+func fromTeacherPreferencesDTO(data *dto.TeacherPreferencesDTO) subscription.TeacherPreferences {
+	return subscription.TeacherPreferences{
+		Mode:                subscription.TeacherPreferenceMode(data.Mode),
+		BlacklistedTeachers: data.BlacklistedTeachers,
+		PreferredTeachers:   data.PreferredTeachers,
+	}
+}
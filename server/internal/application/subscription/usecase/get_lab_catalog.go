@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"context"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetLabCatalogUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetLabCatalogUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *GetLabCatalogUseCase {
+	return &GetLabCatalogUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetLabCatalogUseCase) Exec(ctx context.Context) (*dto.GetLabCatalogResDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.GetLabCatalog")
+	defer span.End()
+
+	catalog, err := uc.subscriptionSvc.GetLabCatalog(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := &dto.GetLabCatalogResDTO{
+		Types:  make([]dto.LabCatalogEntryDTO, len(catalog.Types)),
+		Topics: make([]dto.LabCatalogEntryDTO, len(catalog.Topics)),
+	}
+	for i, labType := range catalog.Types {
+		result.Types[i] = dto.LabCatalogEntryDTO{Code: string(labType.Code), Name: labType.Name}
+	}
+	for i, topic := range catalog.Topics {
+		result.Topics[i] = dto.LabCatalogEntryDTO{Code: string(topic.Code), Name: topic.Name}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetNotificationPreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetNotificationPreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *GetNotificationPreferencesUseCase {
+	return &GetNotificationPreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetNotificationPreferencesUseCase) Exec(ctx context.Context, data *dto.GetNotificationPreferencesReqDTO) (*dto.NotificationPreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.GetNotificationPreferences")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	prefs, err := uc.subscriptionSvc.GetNotificationPreferences(ctx, userUUID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &dto.NotificationPreferencesDTO{
+		QuietHoursStart:  formatTimeOfDay(prefs.QuietHoursStart),
+		QuietHoursEnd:    formatTimeOfDay(prefs.QuietHoursEnd),
+		DeliveryMode:     string(prefs.DeliveryMode),
+		DigestInterval:   prefs.DigestInterval,
+		MaxPerHour:       prefs.MaxPerHour,
+		PreferredChannel: prefs.PreferredChannel,
+	}, nil
+}
+
+func formatTimeOfDay(minutes *int) *string {
+	if minutes == nil {
+		return nil
+	}
+	formatted := fmt.Sprintf("%02d:%02d", *minutes/60, *minutes%60)
+	return &formatted
+}
@@ -0,0 +1,51 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetSubscriptionTeacherPreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetSubscriptionTeacherPreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *GetSubscriptionTeacherPreferencesUseCase {
+	return &GetSubscriptionTeacherPreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+// Exec returns nil when the subscription uses teacher preferences of the user
+func (uc *GetSubscriptionTeacherPreferencesUseCase) Exec(ctx context.Context, data *dto.GetSubscriptionTeacherPreferencesReqDTO) (*dto.TeacherPreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.GetSubscriptionTeacherPreferences")
+	defer span.End()
+
+	subscriptionUUID, err := uuid.Parse(data.SubscriptionUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid subscription uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	prefs, err := uc.subscriptionSvc.GetSubscriptionTeacherPreferences(ctx, subscriptionUUID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if prefs == nil {
+		return nil, nil
+	}
+
+	return toTeacherPreferencesDTO(prefs), nil
+}
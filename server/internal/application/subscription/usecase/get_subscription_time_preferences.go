@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetSubscriptionTimePreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetSubscriptionTimePreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *GetSubscriptionTimePreferencesUseCase {
+	return &GetSubscriptionTimePreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetSubscriptionTimePreferencesUseCase) Exec(ctx context.Context, data *dto.GetSubscriptionTimePreferencesReqDTO) (*dto.SubscriptionTimePreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.GetSubscriptionTimePreferences")
+	defer span.End()
+
+	subscriptionUUID, err := uuid.Parse(data.SubscriptionUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid subscription uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	prefs, err := uc.subscriptionSvc.GetSubscriptionTimePreferences(ctx, subscriptionUUID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make(map[string][]int, len(prefs))
+	for day, lessons := range prefs {
+		result[string(day)] = lessons
+	}
+
+	return &dto.SubscriptionTimePreferencesDTO{
+		TimePreferences: result,
+	}, nil
+}
@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"labgrab/internal/application/subscription/dto"
 	"labgrab/internal/subscription"
@@ -57,13 +58,16 @@ func (uc *GetSubscriptionsUseCase) Exec(ctx context.Context, data *dto.GetSubscr
 
 		return []dto.GetSubscriptionsResDTO{
 			{
-				UUID:          sub.SubscriptionUUID.String(),
-				LabType:       string(sub.LabType),
-				LabTopic:      string(sub.LabTopic),
-				LabNumber:     sub.LabNumber,
-				LabAuditorium: sub.LabAuditorium,
-				CreatedAt:     sub.CreatedAt,
-				ClosedAt:      sub.ClosedAt,
+				UUID:           sub.SubscriptionUUID.String(),
+				LabType:        string(sub.LabType),
+				LabTopic:       string(sub.LabTopic),
+				LabNumbers:     sub.LabNumbers,
+				LabAuditoriums: sub.LabAuditoriums,
+				ValidFrom:      formatDate(sub.ValidFrom),
+				ValidUntil:     formatDate(sub.ValidUntil),
+				SlotsBefore:    formatDate(sub.SlotsBefore),
+				CreatedAt:      sub.CreatedAt,
+				ClosedAt:       sub.ClosedAt,
 			},
 		}, nil
 	}
@@ -78,15 +82,26 @@ func (uc *GetSubscriptionsUseCase) Exec(ctx context.Context, data *dto.GetSubscr
 	result := make([]dto.GetSubscriptionsResDTO, len(subs))
 	for i, sub := range subs {
 		result[i] = dto.GetSubscriptionsResDTO{
-			UUID:          sub.SubscriptionUUID.String(),
-			LabType:       string(sub.LabType),
-			LabTopic:      string(sub.LabTopic),
-			LabNumber:     sub.LabNumber,
-			LabAuditorium: sub.LabAuditorium,
-			CreatedAt:     sub.CreatedAt,
-			ClosedAt:      sub.ClosedAt,
+			UUID:           sub.SubscriptionUUID.String(),
+			LabType:        string(sub.LabType),
+			LabTopic:       string(sub.LabTopic),
+			LabNumbers:     sub.LabNumbers,
+			LabAuditoriums: sub.LabAuditoriums,
+			ValidFrom:      formatDate(sub.ValidFrom),
+			ValidUntil:     formatDate(sub.ValidUntil),
+			SlotsBefore:    formatDate(sub.SlotsBefore),
+			CreatedAt:      sub.CreatedAt,
+			ClosedAt:       sub.ClosedAt,
 		}
 	}
 
 	return result, nil
 }
+
+func formatDate(date *time.Time) *string {
+	if date == nil {
+		return nil
+	}
+	formatted := date.Format(time.DateOnly)
+	return &formatted
+}
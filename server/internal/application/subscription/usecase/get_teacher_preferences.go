@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetTeacherPreferencesUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetTeacherPreferencesUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *GetTeacherPreferencesUseCase {
+	return &GetTeacherPreferencesUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetTeacherPreferencesUseCase) Exec(ctx context.Context, data *dto.GetTeacherPreferencesReqDTO) (*dto.TeacherPreferencesDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.GetTeacherPreferences")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	prefs, err := uc.subscriptionSvc.GetTeacherPreferences(ctx, userUUID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return toTeacherPreferencesDTO(prefs), nil
+}
+
+func toTeacherPreferencesDTO(prefs *subscription.TeacherPreferences) *dto.TeacherPreferencesDTO {
+	return &dto.TeacherPreferencesDTO{
+		Mode:                string(prefs.Mode),
+		BlacklistedTeachers: prefs.BlacklistedTeachers,
+		PreferredTeachers:   prefs.PreferredTeachers,
+	}
+}
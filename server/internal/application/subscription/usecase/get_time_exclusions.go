@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type GetTimeExclusionsUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewGetTimeExclusionsUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *GetTimeExclusionsUseCase {
+	return &GetTimeExclusionsUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *GetTimeExclusionsUseCase) Exec(ctx context.Context, data *dto.GetTimeExclusionsReqDTO) ([]dto.TimeExclusionDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.GetTimeExclusions")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	exclusions, err := uc.subscriptionSvc.GetTimeExclusions(ctx, userUUID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]dto.TimeExclusionDTO, len(exclusions))
+	for i, exclusion := range exclusions {
+		result[i] = dto.TimeExclusionDTO{
+			UUID:     exclusion.ExclusionUUID.String(),
+			StartsOn: exclusion.StartsOn.Format(time.DateOnly),
+			EndsOn:   exclusion.EndsOn.Format(time.DateOnly),
+			Reason:   exclusion.Reason,
+		}
+	}
+
+	return result, nil
+}
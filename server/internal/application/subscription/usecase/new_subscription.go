@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/shared/lab"
 	"labgrab/internal/subscription"
 	"time"
 
@@ -36,13 +37,40 @@ func (uc *NewSubscriptionUseCase) Exec(ctx context.Context, data *dto.NewSubscri
 		return uuid.Nil, err
 	}
 
+	validFrom, err := parseDate(data.ValidFrom)
+	if err != nil {
+		err = fmt.Errorf("invalid valid_from: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return uuid.Nil, err
+	}
+
+	validUntil, err := parseDate(data.ValidUntil)
+	if err != nil {
+		err = fmt.Errorf("invalid valid_until: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return uuid.Nil, err
+	}
+
+	slotsBefore, err := parseDate(data.SlotsBefore)
+	if err != nil {
+		err = fmt.Errorf("invalid slots_before: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return uuid.Nil, err
+	}
+
 	req := &subscription.CreateSubscriptionReq{
-		UserUUID:      userUUID,
-		LabType:       subscription.LabType(data.LabType),
-		LabTopic:      subscription.LabTopic(data.LabTopic),
-		LabNumber:     data.LabNumber,
-		LabAuditorium: data.LabAuditorium,
-		CreatedAt:     time.Unix(data.CreatedAt, 0),
+		UserUUID:       userUUID,
+		LabType:        lab.Type(data.LabType),
+		LabTopic:       lab.Topic(data.LabTopic),
+		LabNumbers:     data.LabNumbers,
+		LabAuditoriums: anyIfEmpty(data.LabAuditoriums),
+		ValidFrom:      validFrom,
+		ValidUntil:     validUntil,
+		SlotsBefore:    slotsBefore,
+		CreatedAt:      time.Unix(data.CreatedAt, 0),
 	}
 
 	subscriptionUUID, err := uc.subscriptionSvc.CreateSubscription(ctx, req)
@@ -54,3 +82,23 @@ func (uc *NewSubscriptionUseCase) Exec(ctx context.Context, data *dto.NewSubscri
 
 	return subscriptionUUID, nil
 }
+
+// anyIfEmpty turns an empty auditorium list into nil, which matches any auditorium
+func anyIfEmpty(auditoriums []int) []int {
+	if len(auditoriums) == 0 {
+		return nil
+	}
+	return auditoriums
+}
+
+// parseDate parses an optional YYYY-MM-DD date, an empty string is treated as no date
+func parseDate(value *string) (*time.Time, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.DateOnly, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
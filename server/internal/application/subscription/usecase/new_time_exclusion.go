@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/subscription"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type NewTimeExclusionUseCase struct {
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewNewTimeExclusionUseCase(subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *NewTimeExclusionUseCase {
+	return &NewTimeExclusionUseCase{
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *NewTimeExclusionUseCase) Exec(ctx context.Context, data *dto.NewTimeExclusionReqDTO) (*dto.NewTimeExclusionResDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.NewTimeExclusion")
+	defer span.End()
+
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		err = fmt.Errorf("invalid user uuid: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	startsOn, err := time.Parse(time.DateOnly, data.StartsOn)
+	if err != nil {
+		err = fmt.Errorf("invalid starts_on: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	endsOn := startsOn
+	if data.EndsOn != nil {
+		endsOn, err = time.Parse(time.DateOnly, *data.EndsOn)
+		if err != nil {
+			err = fmt.Errorf("invalid ends_on: %w", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	req := &subscription.CreateTimeExclusionReq{
+		UserUUID: userUUID,
+		StartsOn: startsOn,
+		EndsOn:   endsOn,
+		Reason:   data.Reason,
+	}
+
+	exclusionUUID, err := uc.subscriptionSvc.CreateTimeExclusion(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &dto.NewTimeExclusionResDTO{
+		UUID: exclusionUUID.String(),
+	}, nil
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"context"
+	"labgrab/internal/application/subscription/dto"
+	"labgrab/internal/lab_polling"
+	"labgrab/internal/subscription"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+// PollOnceUseCase runs a single polling cycle for debugging. It matches the open slots against subscriptions
+// without claiming them in the deduplicator and without enqueueing notifications
+type PollOnceUseCase struct {
+	labPollingSvc   *lab_polling.Service
+	subscriptionSvc *subscription.Service
+	logger          *zap.SugaredLogger
+}
+
+func NewPollOnceUseCase(labPollingSvc *lab_polling.Service, subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *PollOnceUseCase {
+	return &PollOnceUseCase{
+		labPollingSvc:   labPollingSvc,
+		subscriptionSvc: subscriptionSvc,
+		logger:          logger,
+	}
+}
+
+func (uc *PollOnceUseCase) Exec(ctx context.Context) (*dto.PollOnceResDTO, error) {
+	ctx, span := tracer.Start(ctx, "subscription.usecase.PollOnce")
+	defer span.End()
+
+	// Gone slots are left to the worker, so that the poll it stored is not replaced by this one
+	var events []*lab_polling.Event
+	for event := range uc.labPollingSvc.GetOpenLabEventsStream(ctx) {
+		events = append(events, event)
+	}
+	if err := ctx.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	searchReqs := make([]*subscription.GetMatchingSubscriptionsReq, len(events))
+	for i, event := range events {
+		searchReqs[i] = newMatchingSubscriptionsReq(event)
+	}
+
+	var matches [][]subscription.GetMatchingSubscriptionsRes
+	if len(searchReqs) > 0 {
+		var err error
+		matches, err = uc.subscriptionSvc.PreviewMatchingSubscriptions(ctx, searchReqs)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	result := &dto.PollOnceResDTO{
+		Events: make([]dto.PollOnceEventDTO, len(events)),
+	}
+	for i, event := range events {
+		result.Events[i] = newPollOnceEventDTO(event, matches[i])
+		result.MatchedSubscriptions += len(matches[i])
+	}
+
+	return result, nil
+}
+
+func newPollOnceEventDTO(event *lab_polling.Event, matches []subscription.GetMatchingSubscriptionsRes) dto.PollOnceEventDTO {
+	result := dto.PollOnceEventDTO{
+		Name:       event.Name,
+		Type:       string(event.Type),
+		Topic:      string(event.Topic),
+		Number:     event.Number,
+		Auditorium: event.Auditorium,
+		Spot:       event.Spot,
+		Groups:     event.Groups,
+		Schedule:   make(map[string]map[int][]string, len(event.Schedule)),
+		Matches:    make([]dto.PollOnceMatchDTO, len(matches)),
+	}
+
+	for day, lessons := range event.Schedule {
+		result.Schedule[string(day)] = lessons
+	}
+	if len(event.Dates) > 0 {
+		result.Dates = make(map[string]map[int][]string, len(event.Dates))
+		for day, lessons := range event.Dates {
+			result.Dates[string(day)] = make(map[int][]string, len(lessons))
+			for lesson, dates := range lessons {
+				for _, date := range dates {
+					result.Dates[string(day)][lesson] = append(result.Dates[string(day)][lesson], date.Format("2006-01-02"))
+				}
+			}
+		}
+	}
+
+	for i, match := range matches {
+		timeslots := make(map[string][]int, len(match.MatchingTimeslots))
+		for day, lessons := range match.MatchingTimeslots {
+			timeslots[string(day)] = lessons
+		}
+		result.Matches[i] = dto.PollOnceMatchDTO{
+			UserUUID:          match.UserUUID.String(),
+			SubscriptionUUID:  match.SubscriptionUUID.String(),
+			MatchingTimeslots: timeslots,
+			Teachers:          match.Teachers,
+			PreferredTeachers: match.PreferredTeachers,
+		}
+	}
+
+	return result
+}
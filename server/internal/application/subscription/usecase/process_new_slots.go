@@ -2,9 +2,14 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"labgrab/internal/application/subscription/dto"
 	"labgrab/internal/lab_polling"
+	"labgrab/internal/notification"
+	"labgrab/internal/shared/types"
 	"labgrab/internal/subscription"
-	"sync"
+	"slices"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -12,74 +17,259 @@ import (
 type ProcessNewSlotsUseCase struct {
 	labPollingSvc   *lab_polling.Service
 	subscriptionSvc *subscription.Service
+	notificationSvc *notification.Service
 	logger          *zap.SugaredLogger
 }
 
-func NewProcessNewSlotsUseCase(labPollingSvc *lab_polling.Service, subscriptionSvc *subscription.Service, logger *zap.SugaredLogger) *ProcessNewSlotsUseCase {
+func NewProcessNewSlotsUseCase(labPollingSvc *lab_polling.Service, subscriptionSvc *subscription.Service, notificationSvc *notification.Service, logger *zap.SugaredLogger) *ProcessNewSlotsUseCase {
 	return &ProcessNewSlotsUseCase{
 		labPollingSvc:   labPollingSvc,
 		subscriptionSvc: subscriptionSvc,
+		notificationSvc: notificationSvc,
 		logger:          logger,
 	}
 }
 
-func (uc *ProcessNewSlotsUseCase) Exec(ctx context.Context) error {
-	currentEvents := uc.labPollingSvc.GetLabEventsStream(ctx)
-	targetSubscriptions := make(chan subscription.GetMatchingSubscriptionsRes)
-	sem := make(chan struct{}, 50)
-	wg := sync.WaitGroup{}
-	totalEvents, matchedSubscriptions := 0, 0
-	go func() {
-		for event := range currentEvents {
-			totalEvents++
-			wg.Add(1)
-			go func() {
-				defer func() {
-					<-sem
-					wg.Done()
-				}()
-				sem <- struct{}{}
-				err := uc.HandleEvent(ctx, event, targetSubscriptions)
-				if err != nil {
-					uc.logger.Errorw("error handling event", "event", event, "err", err)
-				}
-			}()
+// matchBatchSize bounds the number of events matched by a single query
+const matchBatchSize = 200
+
+// Exec runs a polling cycle and returns what it processed. Events that fail are logged and skipped, their errors
+// are returned together with the counts of the rest of the cycle
+func (uc *ProcessNewSlotsUseCase) Exec(ctx context.Context) (*dto.ProcessNewSlotsResDTO, error) {
+	var openEvents, goneEvents []*lab_polling.Event
+	for event := range uc.labPollingSvc.GetLabEventsStream(ctx) {
+		if event.Gone {
+			goneEvents = append(goneEvents, event)
+		} else {
+			openEvents = append(openEvents, event)
+		}
+	}
+
+	var errs []error
+	matchedSubscriptions := 0
+	for batch := range slices.Chunk(openEvents, matchBatchSize) {
+		matched, err := uc.HandleEvents(ctx, batch)
+		if err != nil {
+			uc.logger.Errorw("error handling events", "events", len(batch), "err", err)
+			errs = append(errs, err)
+		}
+		matchedSubscriptions += matched
+	}
+
+	goneSubscriptions := 0
+	for _, event := range goneEvents {
+		notified, err := uc.handleGoneEvent(ctx, event)
+		if err != nil {
+			uc.logger.Errorw("error handling gone event", "event", event, "err", err)
+			errs = append(errs, err)
+		}
+		goneSubscriptions += notified
+	}
+
+	uc.logger.Infow("Processing complete",
+		"total events", len(openEvents),
+		"gone events", len(goneEvents),
+		"matched subscriptions", matchedSubscriptions,
+		"gone subscriptions", goneSubscriptions)
+
+	return &dto.ProcessNewSlotsResDTO{
+		Events:               len(openEvents),
+		GoneEvents:           len(goneEvents),
+		MatchedSubscriptions: matchedSubscriptions,
+		GoneSubscriptions:    goneSubscriptions,
+	}, errors.Join(errs...)
+}
+
+// HandleEvents finds subscriptions with new slots in a batch of open slot events, matching all of them with a
+// single query and enqueueing all notifications at once, and only then marks the slots as seen. A failed query or
+// enqueue falls back to handling the events one at a time, so that a single bad event does not hold back the rest
+// of the batch. Returns the number of enqueued matches
+func (uc *ProcessNewSlotsUseCase) HandleEvents(ctx context.Context, events []*lab_polling.Event) (int, error) {
+	searchReqs := make([]*subscription.GetMatchingSubscriptionsReq, len(events))
+	for i, event := range events {
+		searchReqs[i] = newMatchingSubscriptionsReq(event)
+	}
+
+	relevantSubs, err := uc.subscriptionSvc.GetMatchingSubscriptionsBatch(ctx, searchReqs)
+	if relevantSubs == nil {
+		uc.logger.Warnw("batch matching failed, matching events one at a time", "events", len(events), "err", err)
+		return uc.handleEventsOneByOne(ctx, searchReqs, events)
+	}
+	// Events whose claim failed have no matches and are picked up again on the next cycle
+	errs := []error{err}
+
+	eventNotifications := make([][]*notification.Notification, len(events))
+	var notifications []*notification.Notification
+	for i, event := range events {
+		eventNotifications[i] = uc.newMatchNotifications(event, relevantSubs[i])
+		notifications = append(notifications, eventNotifications[i]...)
+	}
+	if len(notifications) == 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	if err := uc.notificationSvc.Enqueue(ctx, notifications); err != nil {
+		uc.logger.Warnw("batch enqueue failed, enqueueing events one at a time", "events", len(events), "err", err)
+		matched := 0
+		for i, event := range events {
+			enqueued, err := uc.enqueueMatches(ctx, searchReqs[i], relevantSubs[i], eventNotifications[i])
+			if err != nil {
+				uc.logger.Errorw("error handling event", "event", event, "err", err)
+				errs = append(errs, err)
+			}
+			matched += enqueued
 		}
-		wg.Wait()
-		close(targetSubscriptions)
-		close(sem)
-	}()
+		return matched, errors.Join(errs...)
+	}
 
-	for sub := range targetSubscriptions {
-		matchedSubscriptions++
-		uc.logger.Infow("Processing subscription", "subscription", sub)
+	// Notifications are already enqueued, the worst outcome of a failed commit is a duplicate on the next cycle
+	for i, searchReq := range searchReqs {
+		if len(relevantSubs[i]) == 0 {
+			continue
+		}
+		if err := uc.subscriptionSvc.CommitMatches(ctx, searchReq, relevantSubs[i]); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	uc.logger.Infow("Processing complete", "total events", totalEvents, "matched subscriptions", matchedSubscriptions)
 
-	return nil
+	return len(notifications), errors.Join(errs...)
 }
 
-func (uc *ProcessNewSlotsUseCase) HandleEvent(ctx context.Context, event *lab_polling.Event, subsChan chan subscription.GetMatchingSubscriptionsRes) error {
-	searchReq := &subscription.GetMatchingSubscriptionsReq{
-		LabType:        subscription.LabType(event.Type),
-		LabTopic:       subscription.LabTopic(event.Topic),
+// handleEventsOneByOne matches, enqueues and commits every event on its own. Returns the number of enqueued matches
+func (uc *ProcessNewSlotsUseCase) handleEventsOneByOne(
+	ctx context.Context,
+	searchReqs []*subscription.GetMatchingSubscriptionsReq,
+	events []*lab_polling.Event,
+) (int, error) {
+	var errs []error
+	matched := 0
+	for i, event := range events {
+		relevantSubs, err := uc.subscriptionSvc.GetMatchingSubscriptions(ctx, searchReqs[i])
+		if err == nil {
+			var enqueued int
+			enqueued, err = uc.enqueueMatches(ctx, searchReqs[i], relevantSubs, uc.newMatchNotifications(event, relevantSubs))
+			matched += enqueued
+		}
+		if err != nil {
+			uc.logger.Errorw("error handling event", "event", event, "err", err)
+			errs = append(errs, err)
+		}
+	}
+	return matched, errors.Join(errs...)
+}
+
+// enqueueMatches enqueues notifications for the matches of a single event and then marks their slots as seen.
+// Returns the number of enqueued matches
+func (uc *ProcessNewSlotsUseCase) enqueueMatches(
+	ctx context.Context,
+	searchReq *subscription.GetMatchingSubscriptionsReq,
+	relevantSubs []subscription.GetMatchingSubscriptionsRes,
+	notifications []*notification.Notification,
+) (int, error) {
+	if len(relevantSubs) == 0 {
+		return 0, nil
+	}
+
+	if err := uc.notificationSvc.Enqueue(ctx, notifications); err != nil {
+		return 0, err
+	}
+
+	if err := uc.subscriptionSvc.CommitMatches(ctx, searchReq, relevantSubs); err != nil {
+		// Notifications are already enqueued, the worst outcome is a duplicate on the next cycle
+		return len(relevantSubs), err
+	}
+
+	return len(relevantSubs), nil
+}
+
+func newMatchingSubscriptionsReq(event *lab_polling.Event) *subscription.GetMatchingSubscriptionsReq {
+	return &subscription.GetMatchingSubscriptionsReq{
+		LabType:        event.Type,
+		LabTopic:       event.Topic,
 		LabNumber:      event.Number,
 		LabAuditorium:  event.Auditorium,
 		AvailableSlots: event.Schedule,
+		SlotDates:      event.Dates,
+		Groups:         event.Groups,
 	}
+}
 
-	relevantSubs, err := uc.subscriptionSvc.GetMatchingSubscriptions(ctx, searchReq)
+func (uc *ProcessNewSlotsUseCase) newMatchNotifications(
+	event *lab_polling.Event,
+	subs []subscription.GetMatchingSubscriptionsRes,
+) []*notification.Notification {
+	notifications := make([]*notification.Notification, len(subs))
+	for i, sub := range subs {
+		uc.logger.Infow("Processing subscription", "subscription", sub.SubscriptionUUID, "user", sub.UserUUID)
+		notifications[i] = &notification.Notification{
+			Kind:               notification.KindSlotsOpen,
+			UserUUID:           sub.UserUUID,
+			SubscriptionUUID:   sub.SubscriptionUUID,
+			LabType:            string(event.Type),
+			LabTopic:           string(event.Topic),
+			LabNumber:          event.Number,
+			LabAuditorium:      event.Auditorium,
+			MatchingTimeslots:  sub.MatchingTimeslots,
+			NewTimeslots:       sub.NewTimeslots,
+			StillOpenTimeslots: sub.StillOpenTimeslots,
+			Teachers:           sub.Teachers,
+			PreferredTeachers:  sub.PreferredTeachers,
+			CreatedAt:          time.Now(),
+		}
+	}
+	return notifications
+}
+
+// handleGoneEvent notifies subscriptions that were told about the gone slots and then clears their dedup
+// state, so that the slots are announced again once they open. Returns the number of enqueued notifications
+func (uc *ProcessNewSlotsUseCase) handleGoneEvent(ctx context.Context, event *lab_polling.Event) (int, error) {
+	goneTimeslots := make(map[types.DayOfWeek][]int, len(event.Schedule))
+	for day, lessons := range event.Schedule {
+		for lesson := range lessons {
+			goneTimeslots[day] = append(goneTimeslots[day], lesson)
+		}
+	}
+
+	goneReq := &subscription.GetGoneSlotSubscriptionsReq{
+		LabType:       event.Type,
+		LabTopic:      event.Topic,
+		LabNumber:     event.Number,
+		LabAuditorium: event.Auditorium,
+		GoneTimeslots: goneTimeslots,
+	}
+
+	notifiedSubs, err := uc.subscriptionSvc.GetGoneSlotSubscriptions(ctx, goneReq)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if len(notifiedSubs) == 0 {
+		return 0, nil
 	}
 
-	for _, sub := range relevantSubs {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case subsChan <- sub:
+	notifications := make([]*notification.Notification, len(notifiedSubs))
+	for i, sub := range notifiedSubs {
+		uc.logger.Infow("Slots gone for subscription", "subscription", sub.SubscriptionUUID, "user", sub.UserUUID)
+		notifications[i] = &notification.Notification{
+			Kind:             notification.KindSlotsGone,
+			UserUUID:         sub.UserUUID,
+			SubscriptionUUID: sub.SubscriptionUUID,
+			LabType:          string(event.Type),
+			LabTopic:         string(event.Topic),
+			LabNumber:        event.Number,
+			LabAuditorium:    event.Auditorium,
+			GoneTimeslots:    sub.GoneTimeslots,
+			CreatedAt:        time.Now(),
 		}
 	}
 
-	return nil
+	if err := uc.notificationSvc.Enqueue(ctx, notifications); err != nil {
+		return 0, err
+	}
+
+	if err := uc.subscriptionSvc.ReleaseGoneSlots(ctx, goneReq, notifiedSubs); err != nil {
+		// Notifications are already enqueued, the worst outcome is a duplicate on the next gone event
+		return len(notifiedSubs), err
+	}
+
+	return len(notifiedSubs), nil
 }
@@ -0,0 +1,6 @@
+package dto
+
+type RequestEmailVerificationReqDTO struct {
+	UserUUID string `json:"user_uuid"`
+	Email    string `json:"email"`
+}
@@ -0,0 +1,9 @@
+package dto
+
+type VerifyEmailReqDTO struct {
+	Token string `json:"token"`
+}
+
+type VerifyEmailRespDTO struct {
+	Verified bool `json:"verified"`
+}
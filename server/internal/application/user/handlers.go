@@ -2,6 +2,7 @@ package user
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"labgrab/internal/application/user/dto"
 	"labgrab/internal/application/user/usecase"
@@ -20,16 +21,20 @@ import (
 var tracer = otel.Tracer("user-handler")
 
 type Handler struct {
-	authUser *usecase.AuthUserUseCase
-	newUser  *usecase.NewUserUseCase
-	logger   *zap.SugaredLogger
+	authUser                 *usecase.AuthUserUseCase
+	newUser                  *usecase.NewUserUseCase
+	requestEmailVerification *usecase.RequestEmailVerificationUseCase
+	verifyEmail              *usecase.VerifyEmailUseCase
+	logger                   *zap.SugaredLogger
 }
 
 func NewHandler(authSvc *auth.Service, userSvc *user.Service, subscriptionSvc *subscription.Service, pool *pgxpool.Pool, logger *zap.SugaredLogger) *Handler {
 	return &Handler{
-		authUser: usecase.NewAuthUserUseCase(authSvc, userSvc),
-		newUser:  usecase.NewNewUserUseCase(userSvc, subscriptionSvc, pool),
-		logger:   logger,
+		authUser:                 usecase.NewAuthUserUseCase(authSvc, userSvc),
+		newUser:                  usecase.NewNewUserUseCase(userSvc, subscriptionSvc, pool),
+		requestEmailVerification: usecase.NewRequestEmailVerificationUseCase(userSvc),
+		verifyEmail:              usecase.NewVerifyEmailUseCase(userSvc),
+		logger:                   logger,
 	}
 }
 
@@ -93,7 +98,66 @@ func (h *Handler) NewUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "user.handler.RequestEmailVerification")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	userUUID := vars["user_uuid"]
+
+	var req dto.RequestEmailVerificationReqDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("failed to decode request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req.UserUUID = userUUID
+
+	if err := h.requestEmailVerification.Exec(ctx, &req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "user.handler.VerifyEmail")
+	defer span.End()
+
+	req := &dto.VerifyEmailReqDTO{
+		Token: r.URL.Query().Get("token"),
+	}
+
+	resp, err := h.verifyEmail.Exec(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, user.ErrInvalidVerificationToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		err := fmt.Errorf("failed to write response: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (h *Handler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/users/auth", h.Auth).Methods(http.MethodPost)
 	r.HandleFunc("/api/users", h.NewUser).Methods(http.MethodPost)
+	r.HandleFunc("/api/users/email/verify", h.VerifyEmail).Methods(http.MethodGet)
+	r.HandleFunc("/api/users/{user_uuid}/email", h.RequestEmailVerification).Methods(http.MethodPost)
 }
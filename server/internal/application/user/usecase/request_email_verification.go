@@ -0,0 +1,30 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"labgrab/internal/application/user/dto"
+	"labgrab/internal/user"
+
+	"github.com/google/uuid"
+)
+
+type RequestEmailVerificationUseCase struct {
+	userSvc *user.Service
+}
+
+func NewRequestEmailVerificationUseCase(userSvc *user.Service) *RequestEmailVerificationUseCase {
+	return &RequestEmailVerificationUseCase{userSvc: userSvc}
+}
+
+func (uc *RequestEmailVerificationUseCase) Exec(ctx context.Context, data *dto.RequestEmailVerificationReqDTO) error {
+	userUUID, err := uuid.Parse(data.UserUUID)
+	if err != nil {
+		return fmt.Errorf("invalid user uuid: %w", err)
+	}
+
+	return uc.userSvc.RequestEmailVerification(ctx, &user.RequestEmailVerificationReq{
+		UserUUID: userUUID,
+		Email:    data.Email,
+	})
+}
@@ -0,0 +1,25 @@
+package usecase
+
+import (
+	"context"
+	"labgrab/internal/application/user/dto"
+	"labgrab/internal/user"
+)
+
+type VerifyEmailUseCase struct {
+	userSvc *user.Service
+}
+
+func NewVerifyEmailUseCase(userSvc *user.Service) *VerifyEmailUseCase {
+	return &VerifyEmailUseCase{userSvc: userSvc}
+}
+
+func (uc *VerifyEmailUseCase) Exec(ctx context.Context, data *dto.VerifyEmailReqDTO) (*dto.VerifyEmailRespDTO, error) {
+	if err := uc.userSvc.VerifyEmail(ctx, data.Token); err != nil {
+		return nil, err
+	}
+
+	return &dto.VerifyEmailRespDTO{
+		Verified: true,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package lab_polling
+
+import (
+	"encoding/json"
+	"fmt"
+	"labgrab/internal/shared/lab"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CorpusEntry is a recorded master of a dikidi service together with what the parser extracted from it
+type CorpusEntry struct {
+	Username    string       `json:"username"`
+	ServiceName string       `json:"service_name"`
+	Result      CorpusResult `json:"result"`
+}
+
+type CorpusResult struct {
+	Name       string    `json:"name,omitempty"`
+	Type       lab.Type  `json:"type,omitempty"`
+	Topic      lab.Topic `json:"topic,omitempty"`
+	Number     int       `json:"number,omitempty"`
+	Auditorium int       `json:"auditorium,omitempty"`
+	Spot       *int      `json:"spot,omitempty"`
+	Groups     []string  `json:"groups,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func LoadCorpus(path string) ([]CorpusEntry, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CorpusEntry
+	if err := json.Unmarshal(file, &entries); err != nil {
+		return nil, fmt.Errorf("invalid corpus: %w", err)
+	}
+
+	return entries, nil
+}
+
+func WriteCorpus(path string, entries []CorpusEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// CheckCorpus parses every entry again. It returns the entries with the new results and a line for every
+// field whose result differs from the recorded one
+func (p *Parser) CheckCorpus(entries []CorpusEntry) ([]CorpusEntry, []string) {
+	checked := make([]CorpusEntry, len(entries))
+	var diff []string
+	for i, entry := range entries {
+		checked[i] = CorpusEntry{
+			Username:    entry.Username,
+			ServiceName: entry.ServiceName,
+			Result:      p.parseCorpusEntry(entry.Username, entry.ServiceName),
+		}
+		for _, line := range diffCorpusResults(&entry.Result, &checked[i].Result) {
+			diff = append(diff, fmt.Sprintf("#%d %q | %q: %s", i, entry.Username, entry.ServiceName, line))
+		}
+	}
+	return checked, diff
+}
+
+func (p *Parser) parseCorpusEntry(username, serviceName string) CorpusResult {
+	event, err := p.parseSlotInfo(username, serviceName)
+	if err != nil {
+		return CorpusResult{Error: err.Error()}
+	}
+	return CorpusResult{
+		Name:       event.Name,
+		Type:       event.Type,
+		Topic:      event.Topic,
+		Number:     event.Number,
+		Auditorium: event.Auditorium,
+		Spot:       event.Spot,
+		Groups:     event.Groups,
+	}
+}
+
+func diffCorpusResults(old, new *CorpusResult) []string {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"name", old.Name, new.Name},
+		{"type", string(old.Type), string(new.Type)},
+		{"topic", string(old.Topic), string(new.Topic)},
+		{"number", strconv.Itoa(old.Number), strconv.Itoa(new.Number)},
+		{"auditorium", strconv.Itoa(old.Auditorium), strconv.Itoa(new.Auditorium)},
+		{"spot", formatSpot(old.Spot), formatSpot(new.Spot)},
+		{"groups", strings.Join(old.Groups, ","), strings.Join(new.Groups, ",")},
+		{"error", old.Error, new.Error},
+	}
+
+	var diff []string
+	for _, field := range fields {
+		if field.old != field.new {
+			diff = append(diff, fmt.Sprintf("%s %q -> %q", field.name, field.old, field.new))
+		}
+	}
+	return diff
+}
+
+func formatSpot(spot *int) string {
+	if spot == nil {
+		return ""
+	}
+	return strconv.Itoa(*spot)
+}
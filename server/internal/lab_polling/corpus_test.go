@@ -0,0 +1,90 @@
+package lab_polling_test
+
+import (
+	"flag"
+	"labgrab/internal/lab_polling"
+	"labgrab/internal/shared/lab"
+	"labgrab/pkg/config"
+	"strings"
+	"testing"
+)
+
+const corpusPath = "testdata/corpus.json"
+
+var update = flag.Bool("update", false, "record the new parser results in the corpus")
+
+// TestCorpus runs the rules of the service config over the recorded corpus, run with -update after an
+// intended change of the rules
+func TestCorpus(t *testing.T) {
+	cfg, err := config.LoadFile("../../config.yaml")
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	parser, err := lab_polling.NewParser(&cfg.PollingServiceConfig.ParserConfig)
+	if err != nil {
+		t.Fatalf("NewParser() error = %v", err)
+	}
+	entries, err := lab_polling.LoadCorpus(corpusPath)
+	if err != nil {
+		t.Fatalf("LoadCorpus() error = %v", err)
+	}
+
+	checked, diff := parser.CheckCorpus(entries)
+	if *update {
+		if err := lab_polling.WriteCorpus(corpusPath, checked); err != nil {
+			t.Fatalf("WriteCorpus() error = %v", err)
+		}
+		return
+	}
+	if len(diff) > 0 {
+		t.Errorf("parser results differ from the corpus:\n%s", strings.Join(diff, "\n"))
+	}
+}
+
+func TestParserRulePriority(t *testing.T) {
+	cfg := &config.ParserConfig{
+		Rules: []config.ParsingRuleConfig{
+			{Field: "number", Pattern: `№\s*(?P<value>\d+)`, Strip: true},
+			{Field: "auditorium", Pattern: `\((?P<room>\d+)\s*ауд\.\)`, Capture: "room", Strip: true},
+			{Field: "topic", Pattern: `Оптика`, Value: "Optics"},
+			{Field: "type", Pattern: `Выполнение`, Value: "Performance"},
+			{Field: "type", Pattern: `Аудиторное`, Value: "Defence", Priority: 10},
+		},
+		Timezone:    "UTC",
+		DefaultType: "Performance",
+	}
+	parser, err := lab_polling.NewParser(cfg)
+	if err != nil {
+		t.Fatalf("NewParser() error = %v", err)
+	}
+
+	checked, _ := parser.CheckCorpus([]lab_polling.CorpusEntry{{
+		Username:    "№3 (214 ауд.) Иванов",
+		ServiceName: "Оптика. Выполнение. Аудиторное занятие",
+	}})
+	got := checked[0].Result
+	if got.Type != lab.TypeDefence || got.Auditorium != 214 || got.Name != "Иванов" {
+		t.Errorf("result = %+v, want Defence in auditorium 214 by Иванов", got)
+	}
+}
+
+func TestNewParserRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.ParsingRuleConfig
+	}{
+		{"unknown field", config.ParsingRuleConfig{Field: "teacher", Pattern: `.+`}},
+		{"invalid pattern", config.ParsingRuleConfig{Field: "number", Pattern: `(\d+`}},
+		{"unknown source", config.ParsingRuleConfig{Field: "number", Pattern: `(\d+)`, Source: "title"}},
+		{"unknown capture", config.ParsingRuleConfig{Field: "number", Pattern: `(\d+)`, Capture: "number"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.ParserConfig{Rules: []config.ParsingRuleConfig{tt.rule}, Timezone: "UTC"}
+			if _, err := lab_polling.NewParser(cfg); err == nil {
+				t.Error("NewParser() error = nil, want error")
+			}
+		})
+	}
+}
@@ -5,10 +5,33 @@ import (
 	"fmt"
 )
 
-type ErrSlotParsing struct {
-	errors []error
+var (
+	errPatternNotMatched = errors.New("pattern did not match")
+	errValueNotMapped    = errors.New("captured text is missing from the rule map")
+)
+
+// fieldError is a failure to parse a single field of a slot, rawText is the fragment that failed to
+// convert and is empty when the pattern did not match at all
+type fieldError struct {
+	field   DiagnosticField
+	rawText string
+	err     error
+}
+
+func (e *fieldError) Error() string {
+	if e.rawText == "" {
+		return fmt.Sprintf("failed to parse %s: %v", e.field, e.err)
+	}
+	return fmt.Sprintf("failed to parse %s %q: %v", e.field, e.rawText, e.err)
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
 }
 
-func (e *ErrSlotParsing) Error() string {
-	return fmt.Sprintf("Encountered %d errors when parsing slot: %s", len(e.errors), errors.Join(e.errors...))
+func newNotFoundError(field DiagnosticField, unmapped string) *fieldError {
+	if unmapped != "" {
+		return &fieldError{field: field, rawText: unmapped, err: errValueNotMapped}
+	}
+	return &fieldError{field: field, err: errPatternNotMatched}
 }
@@ -0,0 +1,199 @@
+package lab_polling
+
+import (
+	"errors"
+	"fmt"
+	"labgrab/internal/shared/types"
+	"labgrab/pkg/config"
+	"math"
+	"slices"
+	"time"
+)
+
+var defaultLessonGridConfig = config.LessonGridConfig{
+	Terms: []config.LessonTermConfig{{
+		Lessons: []config.LessonPeriodConfig{
+			{Number: 1, Start: "08:50", End: "10:20"},
+			{Number: 2, Start: "10:35", End: "12:05"},
+			{Number: 3, Start: "12:35", End: "14:05"},
+			{Number: 4, Start: "14:15", End: "15:45"},
+			{Number: 5, Start: "15:55", End: "17:20"},
+			{Number: 6, Start: "17:30", End: "19:00"},
+			{Number: 7, Start: "19:10", End: "20:30"},
+			{Number: 8, Start: "20:40", End: "22:00"},
+		},
+	}},
+}
+
+// LessonGrid maps slot start times to lesson numbers. The timetable may change between terms and differ
+// between weekdays of a term
+type LessonGrid struct {
+	terms []lessonTerm // ordered by effectiveFrom, the undated term goes first
+}
+
+type lessonTerm struct {
+	effectiveFrom time.Time // zero for the undated term
+	lessons       []lessonPeriod
+	weekdays      map[types.DayOfWeek][]lessonPeriod
+}
+
+type lessonPeriod struct {
+	number     int
+	start, end int // minutes since midnight
+}
+
+// NewLessonGrid validates the configured timetable, dates are interpreted in the given timezone.
+// The default timetable is used when no terms are configured
+func NewLessonGrid(cfg *config.LessonGridConfig, timezone *time.Location) (*LessonGrid, error) {
+	if len(cfg.Terms) == 0 {
+		cfg = &defaultLessonGridConfig
+	}
+
+	var errs []error
+	terms := make([]lessonTerm, 0, len(cfg.Terms))
+	for i, termCfg := range cfg.Terms {
+		term, err := newLessonTerm(&termCfg, timezone)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lesson_grid term %d: %w", i, err))
+			continue
+		}
+		terms = append(terms, *term)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	slices.SortFunc(terms, func(a, b lessonTerm) int {
+		return a.effectiveFrom.Compare(b.effectiveFrom)
+	})
+	for i := 1; i < len(terms); i++ {
+		if terms[i].effectiveFrom.Equal(terms[i-1].effectiveFrom) {
+			if terms[i].effectiveFrom.IsZero() {
+				return nil, fmt.Errorf("lesson_grid: only one term may omit effective_from")
+			}
+			return nil, fmt.Errorf("lesson_grid: several terms are effective from %s",
+				terms[i].effectiveFrom.Format(time.DateOnly))
+		}
+	}
+
+	return &LessonGrid{terms: terms}, nil
+}
+
+// Lesson returns the lesson a slot starting at the given time belongs to. The start time is rounded to
+// ten minutes to tolerate slots that are slightly shifted from the timetable. False is returned when no
+// term applies to the date or the time falls outside of every lesson
+func (g *LessonGrid) Lesson(datetime time.Time) (int, bool) {
+	var term *lessonTerm
+	for i := range g.terms {
+		if g.terms[i].effectiveFrom.After(datetime) {
+			break
+		}
+		term = &g.terms[i]
+	}
+	if term == nil {
+		return 0, false
+	}
+
+	periods, ok := term.weekdays[nativeWeekdayToDayOfWeek(datetime.Weekday())]
+	if !ok {
+		periods = term.lessons
+	}
+
+	roundedMinute := int(math.Round(float64(datetime.Minute())/10.0) * 10)
+	totalMinutes := datetime.Hour()*60 + roundedMinute
+
+	for _, period := range periods {
+		if totalMinutes >= period.start && totalMinutes <= period.end {
+			return period.number, true
+		}
+	}
+
+	return 0, false
+}
+
+func newLessonTerm(cfg *config.LessonTermConfig, timezone *time.Location) (*lessonTerm, error) {
+	term := &lessonTerm{weekdays: make(map[types.DayOfWeek][]lessonPeriod)}
+
+	if cfg.EffectiveFrom != "" {
+		effectiveFrom, err := time.ParseInLocation(time.DateOnly, cfg.EffectiveFrom, timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid effective_from %q: %w", cfg.EffectiveFrom, err)
+		}
+		term.effectiveFrom = effectiveFrom
+	}
+
+	if len(cfg.Lessons) == 0 && len(cfg.Weekdays) == 0 {
+		return nil, fmt.Errorf("either lessons or weekdays must be set")
+	}
+
+	var errs []error
+	lessons, err := newLessonPeriods(cfg.Lessons)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("lessons: %w", err))
+	}
+	term.lessons = lessons
+
+	for day, periodsCfg := range cfg.Weekdays {
+		dayOfWeek := types.DayOfWeek(day)
+		if !slices.Contains(types.DaysOfWeek, dayOfWeek) {
+			errs = append(errs, fmt.Errorf("weekdays: unknown day of week %q", day))
+			continue
+		}
+		periods, err := newLessonPeriods(periodsCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("weekdays %s: %w", day, err))
+			continue
+		}
+		term.weekdays[dayOfWeek] = periods
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return term, nil
+}
+
+func newLessonPeriods(cfg []config.LessonPeriodConfig) ([]lessonPeriod, error) {
+	periods := make([]lessonPeriod, 0, len(cfg))
+	for _, periodCfg := range cfg {
+		if periodCfg.Number <= 0 {
+			return nil, fmt.Errorf("lesson number must be positive, got %d", periodCfg.Number)
+		}
+		if slices.ContainsFunc(periods, func(p lessonPeriod) bool { return p.number == periodCfg.Number }) {
+			return nil, fmt.Errorf("lesson %d is listed twice", periodCfg.Number)
+		}
+		start, err := parseLessonTime(periodCfg.Start)
+		if err != nil {
+			return nil, fmt.Errorf("lesson %d: invalid start %q: %w", periodCfg.Number, periodCfg.Start, err)
+		}
+		end, err := parseLessonTime(periodCfg.End)
+		if err != nil {
+			return nil, fmt.Errorf("lesson %d: invalid end %q: %w", periodCfg.Number, periodCfg.End, err)
+		}
+		if start >= end {
+			return nil, fmt.Errorf("lesson %d: start %s is not before end %s",
+				periodCfg.Number, periodCfg.Start, periodCfg.End)
+		}
+		periods = append(periods, lessonPeriod{number: periodCfg.Number, start: start, end: end})
+	}
+
+	slices.SortFunc(periods, func(a, b lessonPeriod) int {
+		return a.start - b.start
+	})
+	for i := 1; i < len(periods); i++ {
+		if periods[i].start <= periods[i-1].end {
+			return nil, fmt.Errorf("lessons %d and %d overlap", periods[i-1].number, periods[i].number)
+		}
+	}
+
+	return periods, nil
+}
+
+func parseLessonTime(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,138 @@
+package lab_polling_test
+
+import (
+	"labgrab/internal/lab_polling"
+	"labgrab/internal/shared/api/dikidi"
+	"labgrab/pkg/config"
+	"testing"
+	"time"
+)
+
+func TestLessonGridLesson(t *testing.T) {
+	grid, err := lab_polling.NewLessonGrid(&config.LessonGridConfig{
+		Terms: []config.LessonTermConfig{
+			{
+				EffectiveFrom: "2025-09-01",
+				Lessons: []config.LessonPeriodConfig{
+					{Number: 1, Start: "09:00", End: "10:30"},
+					{Number: 2, Start: "10:40", End: "12:10"},
+				},
+			},
+			{
+				Lessons: []config.LessonPeriodConfig{
+					{Number: 1, Start: "08:50", End: "10:20"},
+					{Number: 2, Start: "10:35", End: "12:05"},
+				},
+				Weekdays: map[string][]config.LessonPeriodConfig{
+					"SAT": {{Number: 1, Start: "10:00", End: "11:30"}},
+				},
+			},
+		},
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("NewLessonGrid() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		datetime   time.Time
+		wantLesson int
+		wantOk     bool
+	}{
+		{"undated term", time.Date(2025, 1, 13, 8, 50, 0, 0, time.UTC), 1, true},
+		{"rounded to ten minutes", time.Date(2025, 1, 13, 10, 24, 0, 0, time.UTC), 1, true},
+		{"weekday override", time.Date(2025, 1, 18, 10, 0, 0, 0, time.UTC), 1, true},
+		{"weekday override excludes default lessons", time.Date(2025, 1, 18, 8, 50, 0, 0, time.UTC), 0, false},
+		{"dated term", time.Date(2025, 9, 1, 10, 40, 0, 0, time.UTC), 2, true},
+		{"between lessons", time.Date(2025, 9, 1, 13, 0, 0, 0, time.UTC), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lesson, ok := grid.Lesson(tt.datetime)
+			if lesson != tt.wantLesson || ok != tt.wantOk {
+				t.Errorf("Lesson() = %d, %v, want %d, %v", lesson, ok, tt.wantLesson, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestNewLessonGridValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms []config.LessonTermConfig
+	}{
+		{
+			name:  "empty term",
+			terms: []config.LessonTermConfig{{EffectiveFrom: "2025-09-01"}},
+		},
+		{
+			name: "invalid effective_from",
+			terms: []config.LessonTermConfig{{
+				EffectiveFrom: "01.09.2025",
+				Lessons:       []config.LessonPeriodConfig{{Number: 1, Start: "08:50", End: "10:20"}},
+			}},
+		},
+		{
+			name: "overlapping lessons",
+			terms: []config.LessonTermConfig{{
+				Lessons: []config.LessonPeriodConfig{
+					{Number: 1, Start: "08:50", End: "10:20"},
+					{Number: 2, Start: "10:20", End: "11:50"},
+				},
+			}},
+		},
+		{
+			name: "end before start",
+			terms: []config.LessonTermConfig{{
+				Lessons: []config.LessonPeriodConfig{{Number: 1, Start: "10:20", End: "08:50"}},
+			}},
+		},
+		{
+			name: "unknown weekday",
+			terms: []config.LessonTermConfig{{
+				Weekdays: map[string][]config.LessonPeriodConfig{
+					"Monday": {{Number: 1, Start: "08:50", End: "10:20"}},
+				},
+			}},
+		},
+		{
+			name: "duplicate effective_from",
+			terms: []config.LessonTermConfig{
+				{EffectiveFrom: "2025-09-01", Lessons: []config.LessonPeriodConfig{{Number: 1, Start: "08:50", End: "10:20"}}},
+				{EffectiveFrom: "2025-09-01", Lessons: []config.LessonPeriodConfig{{Number: 1, Start: "09:00", End: "10:30"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lab_polling.NewLessonGrid(&config.LessonGridConfig{Terms: tt.terms}, time.UTC); err == nil {
+				t.Error("NewLessonGrid() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestParseSlotReportsUnmappedTimes(t *testing.T) {
+	parser := newTestParser(t, "")
+
+	events, diagnostics := parser.ParseSlot(&dikidi.APISlotData{
+		Data: dikidi.APIServiceData{
+			Masters: dikidi.APIMasters{1: {Username: "Лабораторная работа №3 (214 ауд.) Иванов", ServiceName: "Оптика"}},
+			Times:   dikidi.APITimes{1: {"2025-01-13 08:50:00", "2025-01-13 23:00:00"}},
+		},
+	})
+	if len(diagnostics) != 1 || diagnostics[0].Field != lab_polling.FieldLesson || diagnostics[0].RawText != "2025-01-13 23:00:00" {
+		t.Errorf("diagnostics = %v, want one lesson warning for 23:00", diagnostics)
+	}
+	if len(events) != 1 {
+		t.Fatalf("ParseSlot() returned %d events, want 1", len(events))
+	}
+	if _, ok := events[0].Schedule["MON"][0]; ok {
+		t.Error("unmapped time was put into lesson 0")
+	}
+	if _, ok := events[0].Schedule["MON"][1]; !ok {
+		t.Error("mapped time is missing from lesson 1")
+	}
+}
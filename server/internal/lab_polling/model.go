@@ -1,30 +1,175 @@
 package lab_polling
 
-import "labgrab/internal/shared/types"
+import (
+	"labgrab/internal/shared/lab"
+	"labgrab/internal/shared/types"
+	"time"
 
-type Type string
-
-const (
-	TypeDefence     Type = "Defence"
-	TypePerformance Type = "Performance"
-)
-
-type Topic string
-
-const (
-	TopicVirtual     Topic = "Virtual"
-	TopicElectricity Topic = "Electricity"
-	TopicMechanics   Topic = "Mechanics"
-	TopicOptics      Topic = "Optics"
-	TopicRigidBody   Topic = "Rigid Body"
+	"github.com/google/uuid"
 )
 
 type Event struct {
 	Name       string
-	Type       Type
-	Topic      Topic
+	Type       lab.Type
+	Topic      lab.Topic
 	Number     int
 	Auditorium int
 	Spot       *int
 	Schedule   map[types.DayOfWeek]map[int][]string
+	// Dates holds the calendar dates of every slot in Schedule, in the parser timezone
+	Dates map[types.DayOfWeek]map[int][]time.Time
+	// Groups the event is restricted to, upper case. A group may be a stream prefix like "ИУ-12" covering
+	// "ИУ-12-3". Nil means the event is open to everyone
+	Groups []string
+	// Gone marks an event that lists lessons of the lab that were open in the previous poll and are not
+	// open anymore. Its Schedule has no teachers and Dates hold the dates seen in the previous poll
+	Gone bool
+}
+
+type DiagnosticSeverity string
+
+const (
+	// SeverityWarning marks a skipped slot time, the rest of the master is kept
+	SeverityWarning DiagnosticSeverity = "Warning"
+	// SeverityError marks a master that was dropped
+	SeverityError DiagnosticSeverity = "Error"
+)
+
+type DiagnosticField string
+
+const (
+	FieldNumber     DiagnosticField = "number"
+	FieldAuditorium DiagnosticField = "auditorium"
+	FieldSpot       DiagnosticField = "spot"
+	FieldTopic      DiagnosticField = "topic"
+	FieldType       DiagnosticField = "type"
+	FieldGroup      DiagnosticField = "group"
+	FieldTime       DiagnosticField = "time"
+	FieldLesson     DiagnosticField = "lesson"
+)
+
+// ParseDiagnostic describes a part of a slot that could not be parsed. RawText is the fragment that failed,
+// it is empty when the field pattern did not match the master at all
+type ParseDiagnostic struct {
+	Severity    DiagnosticSeverity
+	ServiceID   int
+	MasterID    int
+	Username    string
+	ServiceName string
+	Field       DiagnosticField
+	RawText     string
+	Reason      string
+}
+
+// DBUnparsedEntry is a diagnostic aggregated over polls, keyed by service, master, field and raw text
+type DBUnparsedEntry struct {
+	ServiceID   int
+	MasterID    int
+	Field       DiagnosticField
+	RawText     string
+	Severity    DiagnosticSeverity
+	Username    string
+	ServiceName string
+	Reason      string
+	Occurrences int
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+type GetUnparsedEntriesReq struct {
+	Severity *DiagnosticSeverity
+	Limit    uint64
+}
+
+type GetUnparsedEntryRes struct {
+	ServiceID   int
+	MasterID    int
+	Field       DiagnosticField
+	RawText     string
+	Severity    DiagnosticSeverity
+	Username    string
+	ServiceName string
+	Reason      string
+	Occurrences int
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+type DBPollingState struct {
+	LastChangeAt *time.Time
+	NextPollAt   *time.Time
+	NextPollRule *string
+}
+
+// GetPollingPolicyRes is the polling schedule with the rule in effect now and the state of the last poll
+type GetPollingPolicyRes struct {
+	PollingPolicyState
+	LastChangeAt *time.Time
+	NextPollAt   *time.Time
+	NextPollRule string
+}
+
+type JobOutcome string
+
+const (
+	JobOutcomeSuccess JobOutcome = "success"
+	JobOutcomeFailed  JobOutcome = "failed"
+	// JobOutcomeSkipped marks a run that was due while the previous run of the job was still going
+	JobOutcomeSkipped JobOutcome = "skipped"
+)
+
+// JobRun is a single run of a worker job. Counts hold what the run processed, keyed by names specific to the job
+type JobRun struct {
+	Job        string
+	Instance   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Outcome    JobOutcome
+	Error      string
+	Counts     map[string]int
+}
+
+type DBJobRun struct {
+	RunUUID    uuid.UUID
+	Job        string
+	Instance   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Outcome    JobOutcome
+	Error      *string
+	Counts     map[string]int
+}
+
+type DBJob struct {
+	Name      string
+	NextRunAt *time.Time
+	UpdatedAt time.Time
+}
+
+type GetJobsReq struct {
+	Job   *string
+	Limit uint64
+}
+
+// GetJobsRes holds the next run of every job that has run at least once and the most recent runs, newest first
+type GetJobsRes struct {
+	Jobs []JobRes
+	Runs []JobRunRes
+}
+
+type JobRes struct {
+	Name      string
+	NextRunAt *time.Time
+	UpdatedAt time.Time
+}
+
+type JobRunRes struct {
+	RunUUID    uuid.UUID
+	Job        string
+	Instance   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Outcome    JobOutcome
+	Error      string
+	Counts     map[string]int
 }
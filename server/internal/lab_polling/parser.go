@@ -3,48 +3,36 @@ package lab_polling
 import (
 	"fmt"
 	"labgrab/internal/shared/api/dikidi"
+	"labgrab/internal/shared/lab"
 	"labgrab/internal/shared/types"
 	"labgrab/pkg/config"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type Parser struct {
-	numberRegexp     *regexp.Regexp
-	auditoriumRegexp *regexp.Regexp
-	spotRegexp       *regexp.Regexp
-	topicRegexp      *regexp.Regexp
+	rules      map[DiagnosticField][]*parsingRule
+	stripRules []*parsingRule
 
 	namePrefix string
 
-	timezone *time.Location
+	timezone   *time.Location
+	lessonGrid *LessonGrid
 
-	topicMap    map[string]Topic
-	typeMap     map[string]Type
-	defaultType Type
+	defaultType lab.Type
 }
 
 func NewParser(cfg *config.ParserConfig) (*Parser, error) {
-	numberRegexp, err := regexp.Compile(cfg.NumberRegexpPattern)
-	if err != nil {
-		return nil, fmt.Errorf("invalid number_regexp pattern: %v", err)
-	}
-
-	auditoriumRegexp, err := regexp.Compile(cfg.AuditoriumRegexpPattern)
-	if err != nil {
-		return nil, fmt.Errorf("invalid auditorium_regexp pattern: %v", err)
+	rulesCfg := cfg.Rules
+	if len(rulesCfg) == 0 {
+		rulesCfg = legacyParsingRules(cfg)
 	}
 
-	spotRegexp, err := regexp.Compile(cfg.SpotRegexpPattern)
+	rules, stripRules, err := newParsingRules(rulesCfg)
 	if err != nil {
-		return nil, fmt.Errorf("invalid spot_regexp pattern: %v", err)
-	}
-
-	topicRegexp, err := regexp.Compile(cfg.TopicRegexpPattern)
-	if err != nil {
-		return nil, fmt.Errorf("invalid topic_regexp pattern: %v", err)
+		return nil, err
 	}
 
 	timezone, err := time.LoadLocation(cfg.Timezone)
@@ -52,69 +40,90 @@ func NewParser(cfg *config.ParserConfig) (*Parser, error) {
 		return nil, fmt.Errorf("invalid timezone: %v", err)
 	}
 
-	topicMap := make(map[string]Topic)
-	for k, v := range cfg.TopicMap {
-		topicMap[k] = Topic(v)
-	}
-
-	typeMap := make(map[string]Type)
-	for k, v := range cfg.TypeMap {
-		typeMap[k] = Type(v)
+	lessonGrid, err := NewLessonGrid(&cfg.LessonGrid, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lesson grid: %w", err)
 	}
 
 	return &Parser{
-		numberRegexp:     numberRegexp,
-		auditoriumRegexp: auditoriumRegexp,
-		spotRegexp:       spotRegexp,
-		topicRegexp:      topicRegexp,
-		namePrefix:       cfg.NamePrefix,
-		timezone:         timezone,
-		topicMap:         topicMap,
-		typeMap:          typeMap,
-		defaultType:      Type(cfg.DefaultType),
+		rules:       rules,
+		stripRules:  stripRules,
+		namePrefix:  cfg.NamePrefix,
+		timezone:    timezone,
+		lessonGrid:  lessonGrid,
+		defaultType: lab.Type(cfg.DefaultType),
 	}, nil
 }
 
-func (p *Parser) ParseSlot(slot *dikidi.APISlotData) ([]Event, error) {
+// ParseSlot returns an event per master of the slot. A master whose fields cannot be parsed is dropped
+// with an error diagnostic, the other masters are kept. Slot times that cannot be parsed or map to no lesson
+// are skipped with a warning diagnostic
+func (p *Parser) ParseSlot(slot *dikidi.APISlotData) ([]Event, []ParseDiagnostic) {
 	events := make([]Event, 0)
-	errors := make([]error, 0)
+	diagnostics := make([]ParseDiagnostic, 0)
 	masters := slot.Data.Masters
 	if len(masters) == 0 {
-		return events, nil
+		return events, diagnostics
 	}
 
 	for id, master := range masters {
+		newDiagnostic := func(severity DiagnosticSeverity, field DiagnosticField, rawText, reason string) ParseDiagnostic {
+			return ParseDiagnostic{
+				Severity:    severity,
+				ServiceID:   slot.Data.ServiceID,
+				MasterID:    id,
+				Username:    master.Username,
+				ServiceName: master.ServiceName,
+				Field:       field,
+				RawText:     rawText,
+				Reason:      reason,
+			}
+		}
+
 		event, err := p.parseSlotInfo(master.Username, master.ServiceName)
 		if err != nil {
-			errors = append(errors, err)
+			diagnostics = append(diagnostics, newDiagnostic(SeverityError, err.field, err.rawText, err.err.Error()))
 			continue
 		}
 
+		// Every master is a single teacher's calendar, so all its slots share the teacher
+		teachers := make([]string, 0, 1)
+		if event.Name != "" {
+			teachers = append(teachers, event.Name)
+		}
+
 		schedule := make(map[types.DayOfWeek]map[int][]string)
+		dates := make(map[types.DayOfWeek]map[int][]time.Time)
 		times := slot.Data.Times
 		for _, timeStr := range times[id] {
-			dayOfWeek, lesson, err := p.parseTimeString(timeStr)
+			datetime, err := p.parseDatetime(timeStr)
 			if err != nil {
-				errors = append(errors, err)
+				diagnostics = append(diagnostics, newDiagnostic(SeverityWarning, FieldTime, timeStr, err.Error()))
+				continue
+			}
+			dayOfWeek := nativeWeekdayToDayOfWeek(datetime.Weekday())
+			lesson, ok := p.lessonGrid.Lesson(datetime)
+			if !ok {
+				diagnostics = append(diagnostics, newDiagnostic(SeverityWarning, FieldLesson, timeStr,
+					"time does not fall into any lesson"))
 				continue
 			}
 			if _, ok := schedule[dayOfWeek]; !ok {
 				schedule[dayOfWeek] = make(map[int][]string)
+				dates[dayOfWeek] = make(map[int][]time.Time)
 			}
-			schedule[dayOfWeek][lesson] = make([]string, 0)
+			schedule[dayOfWeek][lesson] = teachers
+			dates[dayOfWeek][lesson] = append(dates[dayOfWeek][lesson], datetime)
 		}
 		event.Schedule = schedule
+		event.Dates = dates
 		events = append(events, *event)
 	}
 
-	if len(errors) > 0 {
-		return nil, &ErrSlotParsing{errors: errors}
-	}
-
-	return events, nil
+	return events, diagnostics
 }
 
-func (p *Parser) parseSlotInfo(username, serviceName string) (*Event, error) {
+func (p *Parser) parseSlotInfo(username, serviceName string) (*Event, *fieldError) {
 	number, err := p.parseNumber(username, serviceName)
 	if err != nil {
 		return nil, err
@@ -132,6 +141,7 @@ func (p *Parser) parseSlotInfo(username, serviceName string) (*Event, error) {
 		return nil, err
 	}
 	labType := p.parseType(username, serviceName)
+	groups := p.parseGroups(username, serviceName)
 	name := p.parseName(username)
 
 	return &Event{
@@ -141,81 +151,91 @@ func (p *Parser) parseSlotInfo(username, serviceName string) (*Event, error) {
 		Spot:       spot,
 		Topic:      topic,
 		Type:       labType,
+		Groups:     groups,
 	}, nil
 }
 
 func (p *Parser) parseName(username string) string {
-	name := p.numberRegexp.ReplaceAllString(username, "")
-	name = p.auditoriumRegexp.ReplaceAllString(name, "")
-	name = p.spotRegexp.ReplaceAllString(name, "")
+	name := username
+	for _, rule := range p.stripRules {
+		name = rule.regexp.ReplaceAllString(name, "")
+	}
 	name = strings.TrimPrefix(name, p.namePrefix)
 	name = strings.TrimSpace(name)
 	name = strings.Join(strings.Fields(name), " ")
 	return name
 }
 
-func (p *Parser) parseNumber(username, serviceName string) (int, error) {
-	if match := p.numberRegexp.FindStringSubmatch(username); match != nil {
-		return strconv.Atoi(match[1])
+func (p *Parser) parseNumber(username, serviceName string) (int, *fieldError) {
+	value, unmapped, found := matchRules(p.rules[FieldNumber], username, serviceName)
+	if !found {
+		return 0, newNotFoundError(FieldNumber, unmapped)
 	}
-	if match := p.numberRegexp.FindStringSubmatch(serviceName); match != nil {
-		return strconv.Atoi(match[1])
+	return parseIntField(FieldNumber, value)
+}
+
+func (p *Parser) parseAuditorium(username, serviceName string) (int, *fieldError) {
+	value, unmapped, found := matchRules(p.rules[FieldAuditorium], username, serviceName)
+	if !found {
+		return 0, newNotFoundError(FieldAuditorium, unmapped)
 	}
-	return 0, fmt.Errorf("lab number not found")
+	return parseIntField(FieldAuditorium, value)
 }
 
-func (p *Parser) parseAuditorium(username, serviceName string) (int, error) {
-	if match := p.auditoriumRegexp.FindStringSubmatch(username); match != nil {
-		return strconv.Atoi(match[1])
+func (p *Parser) parseSpot(username, serviceName string) (*int, *fieldError) {
+	value, _, found := matchRules(p.rules[FieldSpot], username, serviceName)
+	if !found {
+		return nil, nil
 	}
-	if match := p.auditoriumRegexp.FindStringSubmatch(serviceName); match != nil {
-		return strconv.Atoi(match[1])
+	spot, err := parseIntField(FieldSpot, value)
+	if err != nil {
+		return nil, err
 	}
-	return 0, fmt.Errorf("lab auditorium not found")
+	return &spot, nil
 }
 
-func (p *Parser) parseSpot(username, serviceName string) (*int, error) {
-	if match := p.spotRegexp.FindStringSubmatch(username); match != nil {
-		spot, err := strconv.Atoi(match[1])
-		return &spot, err
-	}
-	if match := p.spotRegexp.FindStringSubmatch(serviceName); match != nil {
-		spot, err := strconv.Atoi(match[1])
-		return &spot, err
+func (p *Parser) parseTopic(username, serviceName string) (lab.Topic, *fieldError) {
+	value, unmapped, found := matchRules(p.rules[FieldTopic], username, serviceName)
+	if !found {
+		return "", newNotFoundError(FieldTopic, unmapped)
 	}
-	return nil, nil
+	return lab.Topic(value), nil
 }
 
-func (p *Parser) parseTopic(username, serviceName string) (Topic, error) {
-	if match := p.topicRegexp.FindStringSubmatch(username); match != nil {
-		if topic, ok := p.topicMap[match[1]]; ok {
-			return topic, nil
-		}
+func (p *Parser) parseGroups(username, serviceName string) []string {
+	value, _, found := matchRules(p.rules[FieldGroup], username, serviceName)
+	if !found {
+		return nil
 	}
-	if match := p.topicRegexp.FindStringSubmatch(serviceName); match != nil {
-		if topic, ok := p.topicMap[match[1]]; ok {
-			return topic, nil
+	var groups []string
+	for _, group := range strings.FieldsFunc(value, isGroupSeparator) {
+		group = strings.ToUpper(strings.Join(strings.Fields(group), ""))
+		if group != "" && !slices.Contains(groups, group) {
+			groups = append(groups, group)
 		}
 	}
-	return "", fmt.Errorf("topic not found")
+	return groups
 }
 
-func (p *Parser) parseType(username, serviceName string) Type {
-	for keyword := range p.typeMap {
-		if strings.Contains(username, keyword) || strings.Contains(serviceName, keyword) {
-			return p.typeMap[keyword]
-		}
+func isGroupSeparator(r rune) bool {
+	return r == ',' || r == ';'
+}
+
+func (p *Parser) parseType(username, serviceName string) lab.Type {
+	if value, _, found := matchRules(p.rules[FieldType], username, serviceName); found {
+		return lab.Type(value)
 	}
 	return p.defaultType
 }
 
-func (p *Parser) parseTimeString(timeString string) (types.DayOfWeek, int, error) {
-	datetime, err := time.ParseInLocation("2006-01-02 15:04:05", timeString, p.timezone)
+func parseIntField(field DiagnosticField, rawText string) (int, *fieldError) {
+	value, err := strconv.Atoi(rawText)
 	if err != nil {
-		return types.DayMon, 0, err
+		return 0, &fieldError{field: field, rawText: rawText, err: err}
 	}
-	dayOfWeek := nativeWeekdayToDayOfWeek(datetime.Weekday())
-	lesson := localTimeToLesson(datetime)
+	return value, nil
+}
 
-	return dayOfWeek, lesson, nil
+func (p *Parser) parseDatetime(timeString string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04:05", timeString, p.timezone)
 }
@@ -0,0 +1,163 @@
+package lab_polling_test
+
+import (
+	"labgrab/internal/lab_polling"
+	"labgrab/internal/shared/api/dikidi"
+	"labgrab/pkg/config"
+	"slices"
+	"testing"
+)
+
+func newTestParser(t *testing.T, groupPattern string) *lab_polling.Parser {
+	t.Helper()
+
+	parser, err := lab_polling.NewParser(&config.ParserConfig{
+		NumberRegexpPattern:     `№\s*(\d+)`,
+		AuditoriumRegexpPattern: `\((\d+)\s*\p{L}+\.\)`,
+		SpotRegexpPattern:       `\((\d+)-?\p{L}*\s*место\)`,
+		TopicRegexpPattern:      `(Оптика|Механика)`,
+		GroupRegexpPattern:      groupPattern,
+		NamePrefix:              "Лабораторная работа",
+		Timezone:                "UTC",
+		TopicMap:                map[string]string{"Оптика": "Optics", "Механика": "Mechanics"},
+		DefaultType:             "Performance",
+	})
+	if err != nil {
+		t.Fatalf("NewParser() error = %v", err)
+	}
+	return parser
+}
+
+func TestParseSlotGroups(t *testing.T) {
+	const groupPattern = `\(только\s+(?:для\s+)?(?:гр\.|групп[аы]?|потока?)?\s*([^)]+)\)`
+
+	tests := []struct {
+		name        string
+		pattern     string
+		username    string
+		serviceName string
+		wantGroups  []string
+		wantName    string
+	}{
+		{
+			name:        "no restriction",
+			pattern:     groupPattern,
+			username:    "Лабораторная работа №3 (214 ауд.) Иванов",
+			serviceName: "Оптика",
+			wantGroups:  nil,
+			wantName:    "Иванов",
+		},
+		{
+			name:        "groups in service name",
+			pattern:     groupPattern,
+			username:    "Лабораторная работа №3 (214 ауд.) Иванов",
+			serviceName: "Оптика (только для групп ИУ-12-3, иу-12-4; ИУ-12-3)",
+			wantGroups:  []string{"ИУ-12-3", "ИУ-12-4"},
+			wantName:    "Иванов",
+		},
+		{
+			name:        "stream in username is stripped from name",
+			pattern:     groupPattern,
+			username:    "Лабораторная работа №5 (105 ауд.) (только для потока ИУ-12) Петров",
+			serviceName: "Механика",
+			wantGroups:  []string{"ИУ-12"},
+			wantName:    "Петров",
+		},
+		{
+			name:        "pattern disabled",
+			pattern:     "",
+			username:    "Лабораторная работа №3 (214 ауд.) Иванов",
+			serviceName: "Оптика (только для групп ИУ-12-3)",
+			wantGroups:  nil,
+			wantName:    "Иванов",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := newTestParser(t, tt.pattern)
+			events, diagnostics := parser.ParseSlot(&dikidi.APISlotData{
+				Data: dikidi.APIServiceData{
+					Masters: dikidi.APIMasters{1: {Username: tt.username, ServiceName: tt.serviceName}},
+					Times:   dikidi.APITimes{1: {"2025-01-13 08:50:00"}},
+				},
+			})
+			if len(diagnostics) != 0 {
+				t.Fatalf("ParseSlot() diagnostics = %v, want none", diagnostics)
+			}
+			if len(events) != 1 {
+				t.Fatalf("ParseSlot() returned %d events, want 1", len(events))
+			}
+			if !slices.Equal(events[0].Groups, tt.wantGroups) {
+				t.Errorf("Groups = %v, want %v", events[0].Groups, tt.wantGroups)
+			}
+			if events[0].Name != tt.wantName {
+				t.Errorf("Name = %q, want %q", events[0].Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestNewParserRejectsGroupPatternWithoutCapture(t *testing.T) {
+	_, err := lab_polling.NewParser(&config.ParserConfig{
+		NumberRegexpPattern:     `(\d+)`,
+		AuditoriumRegexpPattern: `(\d+)`,
+		SpotRegexpPattern:       `(\d+)`,
+		TopicRegexpPattern:      `(\p{L}+)`,
+		GroupRegexpPattern:      `только для групп`,
+		Timezone:                "UTC",
+	})
+	if err == nil {
+		t.Fatal("NewParser() error = nil, want error for group pattern without capture group")
+	}
+}
+
+func TestParseSlotIsolatesMasterErrors(t *testing.T) {
+	parser := newTestParser(t, "")
+
+	events, diagnostics := parser.ParseSlot(&dikidi.APISlotData{
+		Data: dikidi.APIServiceData{
+			ServiceID: 42,
+			Masters: dikidi.APIMasters{
+				1: {Username: "Лабораторная работа №3 (214 ауд.) Иванов", ServiceName: "Оптика"},
+				2: {Username: "Лабораторная работа (214 ауд.) Петров", ServiceName: "Оптика"},
+				3: {Username: "Лабораторная работа №4 (214 ауд.) Сидоров", ServiceName: "Акустика"},
+			},
+			Times: dikidi.APITimes{
+				1: {"2025-01-13 08:50:00", "13.01.2025 10:35"},
+				2: {"2025-01-13 08:50:00"},
+				3: {"2025-01-13 08:50:00"},
+			},
+		},
+	})
+
+	if len(events) != 1 || events[0].Name != "Иванов" {
+		t.Fatalf("ParseSlot() events = %v, want only the event of master 1", events)
+	}
+	if _, ok := events[0].Schedule["MON"][1]; !ok {
+		t.Error("valid time of master 1 is missing")
+	}
+
+	want := map[int]lab_polling.ParseDiagnostic{
+		1: {Severity: lab_polling.SeverityWarning, Field: lab_polling.FieldTime, RawText: "13.01.2025 10:35"},
+		2: {Severity: lab_polling.SeverityError, Field: lab_polling.FieldNumber, RawText: ""},
+		3: {Severity: lab_polling.SeverityError, Field: lab_polling.FieldTopic, RawText: ""},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("ParseSlot() returned %d diagnostics, want %d: %v", len(diagnostics), len(want), diagnostics)
+	}
+	for _, diagnostic := range diagnostics {
+		w, ok := want[diagnostic.MasterID]
+		if !ok {
+			t.Errorf("unexpected diagnostic %v", diagnostic)
+			continue
+		}
+		if diagnostic.Severity != w.Severity || diagnostic.Field != w.Field || diagnostic.RawText != w.RawText {
+			t.Errorf("master %d diagnostic = %+v, want severity %s, field %s, raw text %q",
+				diagnostic.MasterID, diagnostic, w.Severity, w.Field, w.RawText)
+		}
+		if diagnostic.ServiceID != 42 || diagnostic.Username == "" || diagnostic.Reason == "" {
+			t.Errorf("master %d diagnostic is missing context: %+v", diagnostic.MasterID, diagnostic)
+		}
+	}
+}
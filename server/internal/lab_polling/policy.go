@@ -0,0 +1,281 @@
+package lab_polling
+
+import (
+	"errors"
+	"fmt"
+	"labgrab/internal/shared/types"
+	"labgrab/pkg/config"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	PollingRuleDefault = "default"
+	PollingRuleBoost   = "boost"
+)
+
+var defaultPollingScheduleConfig = config.PollingScheduleConfig{
+	Default: config.PollingIntervalConfig{Min: 30 * time.Second, Max: time.Minute},
+}
+
+// PollingPolicy picks the interval before the next poll from the time of day and the last slot change
+type PollingPolicy struct {
+	timezone     *time.Location
+	defaultRange pollingInterval
+	windows      []pollingWindow
+	boost        *pollingBoost
+}
+
+type pollingInterval struct {
+	min, max time.Duration
+}
+
+type pollingWindow struct {
+	name       string
+	days       []types.DayOfWeek // every day when empty
+	start, end int               // minutes since midnight
+	interval   pollingInterval
+}
+
+type pollingBoost struct {
+	duration time.Duration
+	interval pollingInterval
+}
+
+// NewPollingPolicy validates the schedule, window times are interpreted in the given timezone. The fixed
+// 30s to 1m interval is used when cfg is nil
+func NewPollingPolicy(cfg *config.PollingScheduleConfig, timezone *time.Location) (*PollingPolicy, error) {
+	if cfg == nil {
+		cfg = &defaultPollingScheduleConfig
+	}
+
+	var errs []error
+	defaultRange, err := newPollingInterval(&cfg.Default)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("default: %w", err))
+	}
+
+	windows := make([]pollingWindow, 0, len(cfg.Windows))
+	for i, windowCfg := range cfg.Windows {
+		window, err := newPollingWindow(&windowCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("window %d: %w", i, err))
+			continue
+		}
+		windows = append(windows, *window)
+	}
+
+	var boost *pollingBoost
+	if cfg.Boost != nil {
+		interval, err := newPollingInterval(&cfg.Boost.Interval)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("boost: %w", err))
+		}
+		if cfg.Boost.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("boost: duration must be positive"))
+		}
+		boost = &pollingBoost{duration: cfg.Boost.Duration, interval: interval}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &PollingPolicy{
+		timezone:     timezone,
+		defaultRange: defaultRange,
+		windows:      windows,
+		boost:        boost,
+	}, nil
+}
+
+func newPollingInterval(cfg *config.PollingIntervalConfig) (pollingInterval, error) {
+	if cfg.Min <= 0 {
+		return pollingInterval{}, fmt.Errorf("min must be positive")
+	}
+	if cfg.Max < cfg.Min {
+		return pollingInterval{}, fmt.Errorf("max %s is less than min %s", cfg.Max, cfg.Min)
+	}
+	return pollingInterval{min: cfg.Min, max: cfg.Max}, nil
+}
+
+func newPollingWindow(cfg *config.PollingWindowConfig) (*pollingWindow, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("name must be set")
+	}
+
+	var errs []error
+	window := &pollingWindow{name: cfg.Name}
+	for _, day := range cfg.Days {
+		dayOfWeek := types.DayOfWeek(day)
+		if !slices.Contains(types.DaysOfWeek, dayOfWeek) {
+			errs = append(errs, fmt.Errorf("%s: unknown day of week %q", cfg.Name, day))
+			continue
+		}
+		window.days = append(window.days, dayOfWeek)
+	}
+
+	start, startErr := parseLessonTime(cfg.Start)
+	if startErr != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid start %q: %w", cfg.Name, cfg.Start, startErr))
+	}
+	end, endErr := parseLessonTime(cfg.End)
+	if endErr != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid end %q: %w", cfg.Name, cfg.End, endErr))
+	}
+	if startErr == nil && endErr == nil && start == end {
+		errs = append(errs, fmt.Errorf("%s: start and end are equal", cfg.Name))
+	}
+	window.start, window.end = start, end
+
+	interval, err := newPollingInterval(&cfg.Interval)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", cfg.Name, err))
+	}
+	window.interval = interval
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return window, nil
+}
+
+// contains reports whether the window covers the local time. A window spanning midnight belongs to the day
+// it starts on
+func (w *pollingWindow) contains(local time.Time) bool {
+	minute := local.Hour()*60 + local.Minute()
+	day := local
+	if w.start < w.end {
+		if minute < w.start || minute >= w.end {
+			return false
+		}
+	} else {
+		if minute < w.start && minute >= w.end {
+			return false
+		}
+		if minute < w.end {
+			day = local.AddDate(0, 0, -1)
+		}
+	}
+	return len(w.days) == 0 || slices.Contains(w.days, nativeWeekdayToDayOfWeek(day.Weekday()))
+}
+
+// PollingPolicyState is the configured schedule together with the rule in effect at some moment
+type PollingPolicyState struct {
+	// Rule is PollingRuleDefault, PollingRuleBoost or the name of a window
+	Rule        string
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// BoostUntil is set while the boost is active
+	BoostUntil *time.Time
+
+	Default PollingIntervalState
+	Windows []PollingWindowState
+	Boost   *PollingBoostState
+}
+
+type PollingIntervalState struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+type PollingWindowState struct {
+	Name     string
+	Days     []types.DayOfWeek
+	Start    string
+	End      string
+	Interval PollingIntervalState
+}
+
+type PollingBoostState struct {
+	Duration time.Duration
+	Interval PollingIntervalState
+}
+
+// State returns the schedule and the rule in effect at now. lastChangeAt is the last time a poll found slots
+// that appeared or disappeared, nil when unknown
+func (p *PollingPolicy) State(now time.Time, lastChangeAt *time.Time) PollingPolicyState {
+	state := PollingPolicyState{
+		Rule:        PollingRuleDefault,
+		MinInterval: p.defaultRange.min,
+		MaxInterval: p.defaultRange.max,
+		Default:     p.defaultRange.state(),
+		Windows:     make([]PollingWindowState, len(p.windows)),
+	}
+	for i, window := range p.windows {
+		state.Windows[i] = PollingWindowState{
+			Name:     window.name,
+			Days:     window.days,
+			Start:    formatMinutes(window.start),
+			End:      formatMinutes(window.end),
+			Interval: window.interval.state(),
+		}
+	}
+	if p.boost != nil {
+		state.Boost = &PollingBoostState{Duration: p.boost.duration, Interval: p.boost.interval.state()}
+	}
+
+	if p.boost != nil && lastChangeAt != nil {
+		boostUntil := lastChangeAt.Add(p.boost.duration)
+		if now.Before(boostUntil) {
+			state.Rule = PollingRuleBoost
+			state.MinInterval = p.boost.interval.min
+			state.MaxInterval = p.boost.interval.max
+			state.BoostUntil = &boostUntil
+			return state
+		}
+	}
+
+	local := now.In(p.timezone)
+	for _, window := range p.windows {
+		if window.contains(local) {
+			state.Rule = window.name
+			state.MinInterval = window.interval.min
+			state.MaxInterval = window.interval.max
+			break
+		}
+	}
+
+	return state
+}
+
+// Next picks a random time of the next poll within the range of the rule in effect at now, returning the rule
+func (p *PollingPolicy) Next(now time.Time, lastChangeAt *time.Time) (time.Time, string) {
+	state := p.State(now, lastChangeAt)
+	interval := state.MinInterval
+	if state.MaxInterval > state.MinInterval {
+		interval += rand.N(state.MaxInterval - state.MinInterval)
+	}
+	return now.Add(interval), state.Rule
+}
+
+// CheckMaxInterval returns an error naming every rule whose max interval is not below limit. Dedup keys are
+// refreshed only by polls, so a longer interval lets them expire between polls and announces open slots again
+func (p *PollingPolicy) CheckMaxInterval(limit time.Duration) error {
+	var errs []error
+	check := func(rule string, interval pollingInterval) {
+		if interval.max >= limit {
+			errs = append(errs, fmt.Errorf("%s: max %s is not below %s", rule, interval.max, limit))
+		}
+	}
+
+	check(PollingRuleDefault, p.defaultRange)
+	for _, window := range p.windows {
+		check(window.name, window.interval)
+	}
+	if p.boost != nil {
+		check(PollingRuleBoost, p.boost.interval)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (i pollingInterval) state() PollingIntervalState {
+	return PollingIntervalState{MinInterval: i.min, MaxInterval: i.max}
+}
+
+func formatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
@@ -0,0 +1,173 @@
+package lab_polling_test
+
+import (
+	"labgrab/internal/lab_polling"
+	"labgrab/pkg/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPollingPolicy(t *testing.T) *lab_polling.PollingPolicy {
+	t.Helper()
+
+	policy, err := lab_polling.NewPollingPolicy(&config.PollingScheduleConfig{
+		Default: config.PollingIntervalConfig{Min: 30 * time.Second, Max: time.Minute},
+		Windows: []config.PollingWindowConfig{
+			{
+				Name:     "night",
+				Start:    "23:00",
+				End:      "07:00",
+				Days:     []string{"SUN", "MON", "TUE", "WED", "THU"},
+				Interval: config.PollingIntervalConfig{Min: 5 * time.Minute, Max: 10 * time.Minute},
+			},
+			{
+				Name:     "office hours",
+				Start:    "09:00",
+				End:      "18:00",
+				Days:     []string{"MON", "TUE", "WED", "THU", "FRI"},
+				Interval: config.PollingIntervalConfig{Min: 20 * time.Second, Max: 40 * time.Second},
+			},
+		},
+		Boost: &config.PollingBoostConfig{
+			Duration: 10 * time.Minute,
+			Interval: config.PollingIntervalConfig{Min: 10 * time.Second, Max: 20 * time.Second},
+		},
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("NewPollingPolicy() error = %v", err)
+	}
+	return policy
+}
+
+func TestPollingPolicyState(t *testing.T) {
+	policy := newTestPollingPolicy(t)
+	// 2025-10-06 is a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2025, 10, 6, hour, minute, 0, 0, time.UTC)
+	}
+	changedAt := monday(2, 0)
+
+	tests := []struct {
+		name         string
+		now          time.Time
+		lastChangeAt *time.Time
+		wantRule     string
+	}{
+		{name: "office hours", now: monday(9, 0), wantRule: "office hours"},
+		{name: "office hours end is exclusive", now: monday(18, 0), wantRule: lab_polling.PollingRuleDefault},
+		{name: "night before midnight", now: monday(23, 30), wantRule: "night"},
+		{name: "night after midnight belongs to the previous day", now: monday(3, 0), wantRule: "night"},
+		{
+			name:     "night starting on a day outside the window",
+			now:      time.Date(2025, 10, 11, 3, 0, 0, 0, time.UTC), // Saturday, the night started on Friday
+			wantRule: lab_polling.PollingRuleDefault,
+		},
+		{name: "weekend daytime", now: time.Date(2025, 10, 11, 12, 0, 0, 0, time.UTC), wantRule: lab_polling.PollingRuleDefault},
+		{name: "boost overrides the night", now: monday(2, 5), lastChangeAt: &changedAt, wantRule: lab_polling.PollingRuleBoost},
+		{name: "boost ends after its duration", now: monday(2, 10), lastChangeAt: &changedAt, wantRule: "night"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := policy.State(tt.now, tt.lastChangeAt)
+			if state.Rule != tt.wantRule {
+				t.Errorf("State().Rule = %q, want %q", state.Rule, tt.wantRule)
+			}
+			if (state.BoostUntil != nil) != (tt.wantRule == lab_polling.PollingRuleBoost) {
+				t.Errorf("State().BoostUntil = %v for rule %q", state.BoostUntil, state.Rule)
+			}
+		})
+	}
+}
+
+func TestPollingPolicyNext(t *testing.T) {
+	policy := newTestPollingPolicy(t)
+	now := time.Date(2025, 10, 6, 12, 0, 0, 0, time.UTC)
+
+	for range 100 {
+		next, rule := policy.Next(now, nil)
+		if rule != "office hours" {
+			t.Fatalf("Next() rule = %q, want office hours", rule)
+		}
+		if interval := next.Sub(now); interval < 20*time.Second || interval > 40*time.Second {
+			t.Fatalf("Next() interval = %s, want between 20s and 40s", interval)
+		}
+	}
+}
+
+func TestNewPollingPolicyDefault(t *testing.T) {
+	policy, err := lab_polling.NewPollingPolicy(nil, time.UTC)
+	if err != nil {
+		t.Fatalf("NewPollingPolicy() error = %v", err)
+	}
+
+	state := policy.State(time.Now(), nil)
+	if state.Rule != lab_polling.PollingRuleDefault || state.MinInterval != 30*time.Second || state.MaxInterval != time.Minute {
+		t.Errorf("State() = %+v, want the default 30s to 1m interval", state)
+	}
+}
+
+func TestNewPollingPolicyInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.PollingScheduleConfig
+	}{
+		{
+			name: "max below min",
+			cfg:  config.PollingScheduleConfig{Default: config.PollingIntervalConfig{Min: time.Minute, Max: time.Second}},
+		},
+		{
+			name: "unknown day",
+			cfg: config.PollingScheduleConfig{
+				Default: config.PollingIntervalConfig{Min: time.Second, Max: time.Second},
+				Windows: []config.PollingWindowConfig{{
+					Name: "w", Start: "09:00", End: "18:00", Days: []string{"MONDAY"},
+					Interval: config.PollingIntervalConfig{Min: time.Second, Max: time.Second},
+				}},
+			},
+		},
+		{
+			name: "empty window",
+			cfg: config.PollingScheduleConfig{
+				Default: config.PollingIntervalConfig{Min: time.Second, Max: time.Second},
+				Windows: []config.PollingWindowConfig{{
+					Name: "w", Start: "09:00", End: "09:00",
+					Interval: config.PollingIntervalConfig{Min: time.Second, Max: time.Second},
+				}},
+			},
+		},
+		{
+			name: "boost without duration",
+			cfg: config.PollingScheduleConfig{
+				Default: config.PollingIntervalConfig{Min: time.Second, Max: time.Second},
+				Boost:   &config.PollingBoostConfig{Interval: config.PollingIntervalConfig{Min: time.Second, Max: time.Second}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lab_polling.NewPollingPolicy(&tt.cfg, time.UTC); err == nil {
+				t.Error("NewPollingPolicy() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestPollingPolicyCheckMaxInterval(t *testing.T) {
+	policy := newTestPollingPolicy(t)
+
+	if err := policy.CheckMaxInterval(15 * time.Minute); err != nil {
+		t.Errorf("CheckMaxInterval(15m) error = %v, want nil", err)
+	}
+
+	// The night window polls at most every 10 minutes, so dedup keys living 10 minutes expire between polls
+	err := policy.CheckMaxInterval(10 * time.Minute)
+	if err == nil {
+		t.Fatal("CheckMaxInterval(10m) error = nil, want an error")
+	}
+	if !strings.Contains(err.Error(), "night") || strings.Contains(err.Error(), "office hours") {
+		t.Errorf("CheckMaxInterval(10m) error = %q, want only the night window", err)
+	}
+}
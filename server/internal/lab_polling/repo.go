@@ -0,0 +1,509 @@
+package lab_polling
+
+import (
+	"context"
+	stderrors "errors"
+	"labgrab/internal/shared/errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Repository is the storage used by Service. Repo implements it on postgres
+type Repository interface {
+	SaveUnparsedEntries(ctx context.Context, diagnostics []ParseDiagnostic, seenAt time.Time) error
+	GetUnparsedEntries(ctx context.Context, severity *DiagnosticSeverity, limit uint64) ([]DBUnparsedEntry, error)
+	SavePollingChange(ctx context.Context, changedAt time.Time) error
+	SaveNextPoll(ctx context.Context, nextPollAt time.Time, rule string) error
+	GetPollingState(ctx context.Context) (*DBPollingState, error)
+	SaveSlotSnapshot(ctx context.Context, snapshot []byte) error
+	GetSlotSnapshot(ctx context.Context) ([]byte, error)
+	SaveJobRun(ctx context.Context, run *DBJobRun) error
+	SaveJobNextRun(ctx context.Context, name string, nextRunAt *time.Time, updatedAt time.Time) error
+	GetJobs(ctx context.Context) ([]DBJob, error)
+	GetJobRuns(ctx context.Context, job *string, limit uint64) ([]DBJobRun, error)
+	DeleteJobRunsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ Repository = (*Repo)(nil)
+
+type Repo struct {
+	pool *pgxpool.Pool
+	sq   squirrel.StatementBuilderType
+}
+
+func NewRepo(pool *pgxpool.Pool) *Repo {
+	return &Repo{pool: pool, sq: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+}
+
+// SaveUnparsedEntries upserts diagnostics, repeated entries bump their occurrence counter and last seen time.
+// Diagnostics must be unique by service, master, field and raw text
+func (r *Repo) SaveUnparsedEntries(ctx context.Context, diagnostics []ParseDiagnostic, seenAt time.Time) error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	builder := r.sq.Insert("polling_service.unparsed_entries").
+		Columns(
+			"service_id",
+			"master_id",
+			"field",
+			"raw_text",
+			"severity",
+			"username",
+			"service_name",
+			"reason",
+			"first_seen_at",
+			"last_seen_at",
+		)
+	for _, diagnostic := range diagnostics {
+		builder = builder.Values(
+			diagnostic.ServiceID,
+			diagnostic.MasterID,
+			string(diagnostic.Field),
+			diagnostic.RawText,
+			string(diagnostic.Severity),
+			diagnostic.Username,
+			diagnostic.ServiceName,
+			diagnostic.Reason,
+			seenAt,
+			seenAt,
+		)
+	}
+
+	query, args, err := builder.
+		Suffix(`ON CONFLICT (service_id, master_id, field, raw_text) DO UPDATE SET
+			severity = EXCLUDED.severity,
+			username = EXCLUDED.username,
+			service_name = EXCLUDED.service_name,
+			reason = EXCLUDED.reason,
+			occurrences = unparsed_entries.occurrences + 1,
+			last_seen_at = EXCLUDED.last_seen_at`).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveUnparsedEntries",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveUnparsedEntries",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) GetUnparsedEntries(ctx context.Context, severity *DiagnosticSeverity, limit uint64) ([]DBUnparsedEntry, error) {
+	builder := r.sq.Select(
+		"service_id",
+		"master_id",
+		"field",
+		"raw_text",
+		"severity",
+		"username",
+		"service_name",
+		"reason",
+		"occurrences",
+		"first_seen_at",
+		"last_seen_at",
+	).
+		From("polling_service.unparsed_entries").
+		OrderBy("last_seen_at DESC", "service_id", "master_id").
+		Limit(limit)
+	if severity != nil {
+		builder = builder.Where(squirrel.Eq{"severity": string(*severity)})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetUnparsedEntries",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetUnparsedEntries",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var entries []DBUnparsedEntry
+	for rows.Next() {
+		var entry DBUnparsedEntry
+		var field, entrySeverity string
+		err = rows.Scan(
+			&entry.ServiceID,
+			&entry.MasterID,
+			&field,
+			&entry.RawText,
+			&entrySeverity,
+			&entry.Username,
+			&entry.ServiceName,
+			&entry.Reason,
+			&entry.Occurrences,
+			&entry.FirstSeenAt,
+			&entry.LastSeenAt,
+		)
+		if err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetUnparsedEntries",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		entry.Field = DiagnosticField(field)
+		entry.Severity = DiagnosticSeverity(entrySeverity)
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetUnparsedEntries",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return entries, nil
+}
+
+// SavePollingChange records the time a poll found slots that appeared or disappeared
+func (r *Repo) SavePollingChange(ctx context.Context, changedAt time.Time) error {
+	query, args, err := r.sq.Insert("polling_service.polling_state").
+		Columns("last_change_at").
+		Values(changedAt).
+		Suffix("ON CONFLICT (id) DO UPDATE SET last_change_at = EXCLUDED.last_change_at").
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SavePollingChange",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SavePollingChange",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) SaveNextPoll(ctx context.Context, nextPollAt time.Time, rule string) error {
+	query, args, err := r.sq.Insert("polling_service.polling_state").
+		Columns("next_poll_at", "next_poll_rule").
+		Values(nextPollAt, rule).
+		Suffix("ON CONFLICT (id) DO UPDATE SET next_poll_at = EXCLUDED.next_poll_at, next_poll_rule = EXCLUDED.next_poll_rule").
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveNextPoll",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveNextPoll",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+// GetPollingState returns an empty state until the first poll is scheduled
+func (r *Repo) GetPollingState(ctx context.Context) (*DBPollingState, error) {
+	query, args, err := r.sq.Select("last_change_at", "next_poll_at", "next_poll_rule").
+		From("polling_service.polling_state").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetPollingState",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	state := &DBPollingState{}
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&state.LastChangeAt, &state.NextPollAt, &state.NextPollRule)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetPollingState",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+
+	return state, nil
+}
+
+// SaveSlotSnapshot stores the open slots of the last complete poll
+func (r *Repo) SaveSlotSnapshot(ctx context.Context, snapshot []byte) error {
+	query, args, err := r.sq.Insert("polling_service.polling_state").
+		Columns("slot_snapshot").
+		Values(snapshot).
+		Suffix("ON CONFLICT (id) DO UPDATE SET slot_snapshot = EXCLUDED.slot_snapshot").
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveSlotSnapshot",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveSlotSnapshot",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+// GetSlotSnapshot returns nil until the first complete poll is saved
+func (r *Repo) GetSlotSnapshot(ctx context.Context) ([]byte, error) {
+	query, args, err := r.sq.Select("slot_snapshot").
+		From("polling_service.polling_state").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetSlotSnapshot",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var snapshot []byte
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&snapshot)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetSlotSnapshot",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+
+	return snapshot, nil
+}
+
+func (r *Repo) SaveJobRun(ctx context.Context, run *DBJobRun) error {
+	query, args, err := r.sq.Insert("polling_service.job_runs").
+		Columns("run_uuid", "job", "instance", "started_at", "finished_at", "outcome", "error", "counts").
+		Values(run.RunUUID, run.Job, run.Instance, run.StartedAt, run.FinishedAt, string(run.Outcome), run.Error, run.Counts).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveJobRun",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveJobRun",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+// SaveJobNextRun upserts the next scheduled run of a job, a nil nextRunAt means the job is not scheduled
+func (r *Repo) SaveJobNextRun(ctx context.Context, name string, nextRunAt *time.Time, updatedAt time.Time) error {
+	query, args, err := r.sq.Insert("polling_service.jobs").
+		Columns("name", "next_run_at", "updated_at").
+		Values(name, nextRunAt, updatedAt).
+		Suffix("ON CONFLICT (name) DO UPDATE SET next_run_at = EXCLUDED.next_run_at, updated_at = EXCLUDED.updated_at").
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveJobNextRun",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SaveJobNextRun",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) GetJobs(ctx context.Context) ([]DBJob, error) {
+	query, args, err := r.sq.Select("name", "next_run_at", "updated_at").
+		From("polling_service.jobs").
+		OrderBy("name").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetJobs",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetJobs",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var jobs []DBJob
+	for rows.Next() {
+		var job DBJob
+		if err = rows.Scan(&job.Name, &job.NextRunAt, &job.UpdatedAt); err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetJobs",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetJobs",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return jobs, nil
+}
+
+// GetJobRuns returns the most recent runs, newest first, of a single job when job is set
+func (r *Repo) GetJobRuns(ctx context.Context, job *string, limit uint64) ([]DBJobRun, error) {
+	builder := r.sq.Select("run_uuid", "job", "instance", "started_at", "finished_at", "outcome", "error", "counts").
+		From("polling_service.job_runs").
+		OrderBy("started_at DESC").
+		Limit(limit)
+	if job != nil {
+		builder = builder.Where(squirrel.Eq{"job": *job})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetJobRuns",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetJobRuns",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var runs []DBJobRun
+	for rows.Next() {
+		var run DBJobRun
+		var outcome string
+		err = rows.Scan(
+			&run.RunUUID,
+			&run.Job,
+			&run.Instance,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&outcome,
+			&run.Error,
+			&run.Counts,
+		)
+		if err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetJobRuns",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		run.Outcome = JobOutcome(outcome)
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetJobRuns",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return runs, nil
+}
+
+// DeleteJobRunsBefore deletes runs started before the given time. Returns the number of deleted runs
+func (r *Repo) DeleteJobRunsBefore(ctx context.Context, before time.Time) (int64, error) {
+	query, args, err := r.sq.Delete("polling_service.job_runs").
+		Where(squirrel.Lt{"started_at": before}).
+		ToSql()
+	if err != nil {
+		return 0, &errors.ErrDBProcedure{
+			Procedure: "DeleteJobRunsBefore",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, &errors.ErrDBProcedure{
+			Procedure: "DeleteJobRunsBefore",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return tag.RowsAffected(), nil
+}
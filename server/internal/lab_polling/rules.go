@@ -0,0 +1,175 @@
+package lab_polling
+
+import (
+	"fmt"
+	"labgrab/pkg/config"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+const defaultCaptureName = "value"
+
+type ruleSource string
+
+const (
+	sourceUsername    ruleSource = "username"
+	sourceServiceName ruleSource = "service_name"
+)
+
+// ruleFields lists the fields parsing rules can extract
+var ruleFields = []DiagnosticField{FieldNumber, FieldAuditorium, FieldSpot, FieldTopic, FieldType, FieldGroup}
+
+type parsingRule struct {
+	name     string
+	field    DiagnosticField
+	regexp   *regexp.Regexp
+	priority int
+	sources  []ruleSource
+	capture  int // index of the group holding the value, 0 for the whole match
+	value    string
+	valueMap map[string]string
+	strip    bool
+}
+
+func newParsingRule(cfg *config.ParsingRuleConfig) (*parsingRule, error) {
+	field := DiagnosticField(cfg.Field)
+	if !slices.Contains(ruleFields, field) {
+		return nil, fmt.Errorf("unknown field %q", cfg.Field)
+	}
+
+	re, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+
+	var sources []ruleSource
+	switch ruleSource(cfg.Source) {
+	case "":
+		sources = []ruleSource{sourceUsername, sourceServiceName}
+	case sourceUsername, sourceServiceName:
+		sources = []ruleSource{ruleSource(cfg.Source)}
+	default:
+		return nil, fmt.Errorf("unknown source %q", cfg.Source)
+	}
+
+	var capture int
+	switch {
+	case cfg.Capture != "":
+		capture = re.SubexpIndex(cfg.Capture)
+		if capture < 0 {
+			return nil, fmt.Errorf("pattern has no capture group named %q", cfg.Capture)
+		}
+	case re.SubexpIndex(defaultCaptureName) > 0:
+		capture = re.SubexpIndex(defaultCaptureName)
+	case re.NumSubexp() > 0:
+		capture = 1
+	}
+	if field == FieldGroup && capture == 0 {
+		return nil, fmt.Errorf("a capture group is required for group rules")
+	}
+
+	return &parsingRule{
+		name:     cfg.Name,
+		field:    field,
+		regexp:   re,
+		priority: cfg.Priority,
+		sources:  sources,
+		capture:  capture,
+		value:    cfg.Value,
+		valueMap: cfg.Map,
+		strip:    cfg.Strip,
+	}, nil
+}
+
+// newParsingRules groups the rules by field, ordered by descending priority and then by position
+func newParsingRules(cfgs []config.ParsingRuleConfig) (map[DiagnosticField][]*parsingRule, []*parsingRule, error) {
+	rules := make(map[DiagnosticField][]*parsingRule)
+	var stripRules []*parsingRule
+	for i := range cfgs {
+		rule, err := newParsingRule(&cfgs[i])
+		if err != nil {
+			name := cfgs[i].Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			return nil, nil, fmt.Errorf("invalid parsing rule %s: %w", name, err)
+		}
+		rules[rule.field] = append(rules[rule.field], rule)
+		if rule.strip {
+			stripRules = append(stripRules, rule)
+		}
+	}
+
+	for _, fieldRules := range rules {
+		slices.SortStableFunc(fieldRules, func(a, b *parsingRule) int {
+			return b.priority - a.priority
+		})
+	}
+
+	return rules, stripRules, nil
+}
+
+// legacyParsingRules converts the per-field patterns and maps of the config into rules. Type keywords are
+// tried in alphabetical order, so that a name containing several keywords always gets the same type
+func legacyParsingRules(cfg *config.ParserConfig) []config.ParsingRuleConfig {
+	rules := []config.ParsingRuleConfig{
+		{Name: "number", Field: string(FieldNumber), Pattern: cfg.NumberRegexpPattern, Strip: true},
+		{Name: "auditorium", Field: string(FieldAuditorium), Pattern: cfg.AuditoriumRegexpPattern, Strip: true},
+		{Name: "spot", Field: string(FieldSpot), Pattern: cfg.SpotRegexpPattern, Strip: true},
+		{Name: "topic", Field: string(FieldTopic), Pattern: cfg.TopicRegexpPattern, Map: cfg.TopicMap},
+	}
+	if cfg.GroupRegexpPattern != "" {
+		rules = append(rules, config.ParsingRuleConfig{
+			Name:    "group",
+			Field:   string(FieldGroup),
+			Pattern: cfg.GroupRegexpPattern,
+			Strip:   true,
+		})
+	}
+	for _, keyword := range slices.Sorted(maps.Keys(cfg.TypeMap)) {
+		rules = append(rules, config.ParsingRuleConfig{
+			Name:    "type " + keyword,
+			Field:   string(FieldType),
+			Pattern: regexp.QuoteMeta(keyword),
+			Value:   cfg.TypeMap[keyword],
+		})
+	}
+	return rules
+}
+
+// matchRules returns the value extracted by the first matching rule of the field. When no rule matches,
+// unmapped holds the text captured by the first rule whose map lacks it
+func matchRules(rules []*parsingRule, username, serviceName string) (value string, unmapped string, found bool) {
+	for _, rule := range rules {
+		for _, source := range rule.sources {
+			text := username
+			if source == sourceServiceName {
+				text = serviceName
+			}
+
+			match := rule.regexp.FindStringSubmatch(text)
+			if match == nil {
+				continue
+			}
+			captured := match[rule.capture]
+
+			switch {
+			case rule.value != "":
+				return rule.value, "", true
+			case rule.valueMap != nil:
+				mapped, ok := rule.valueMap[captured]
+				if !ok {
+					if unmapped == "" {
+						unmapped = captured
+					}
+					continue
+				}
+				return mapped, "", true
+			default:
+				return captured, "", true
+			}
+		}
+	}
+	return "", unmapped, false
+}
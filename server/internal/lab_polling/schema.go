@@ -0,0 +1,9 @@
+package lab_polling
+
+import _ "embed"
+
+// Schema creates the tables of the service and upgrades tables created by earlier versions. Every statement
+// checks what is already there, so it is applied on every migration
+//
+//go:embed schema.sql
+var Schema string
@@ -0,0 +1,62 @@
+create schema if not exists polling_service;
+
+create table if not exists polling_service.unparsed_entries
+(
+    service_id    int         not null,
+    master_id     int         not null,
+    field         text        not null,
+    raw_text      text        not null,
+    severity      text        not null,
+    username      text        not null,
+    service_name  text        not null,
+    reason        text        not null,
+    occurrences   int         not null default 1,
+    first_seen_at timestamptz not null,
+    last_seen_at  timestamptz not null,
+    constraint unparsed_entries_pk primary key (service_id, master_id, field, raw_text)
+);
+
+create index if not exists unparsed_entries_last_seen_idx on polling_service.unparsed_entries (last_seen_at);
+
+-- State of the polling policy shared by all instances, the table holds a single row
+create table if not exists polling_service.polling_state
+(
+    id             boolean not null default true,
+    last_change_at timestamptz,
+    next_poll_at   timestamptz,
+    next_poll_rule text,
+    slot_snapshot  jsonb,
+    constraint polling_state_pk primary key (id),
+    constraint polling_state_single_row_check check (id)
+);
+
+-- Open slots of the last complete poll, so that gone slots are found across restarts and lock handovers
+alter table polling_service.polling_state
+    add column if not exists slot_snapshot jsonb;
+
+-- Runs of the worker jobs, pruned after the configured retention
+create table if not exists polling_service.job_runs
+(
+    run_uuid    uuid        not null,
+    job         text        not null,
+    instance    text        not null,
+    started_at  timestamptz not null,
+    finished_at timestamptz not null,
+    outcome     text        not null,
+    error       text,
+    counts      jsonb       not null default '{}',
+    constraint job_runs_pk primary key (run_uuid)
+);
+
+create index if not exists job_runs_started_at_idx on polling_service.job_runs (started_at);
+
+create index if not exists job_runs_job_started_at_idx on polling_service.job_runs (job, started_at);
+
+-- Next scheduled run of every worker job, written by the instance that ran the job last
+create table if not exists polling_service.jobs
+(
+    name        text        not null,
+    next_run_at timestamptz,
+    updated_at  timestamptz not null,
+    constraint jobs_pk primary key (name)
+);
@@ -2,32 +2,67 @@ package lab_polling
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"labgrab/internal/shared/api/dikidi"
+	"labgrab/internal/shared/errors"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 )
 
-var tracer = otel.Tracer("lab-polling-service")
+var (
+	tracer = otel.Tracer("lab-polling-service")
+	meter  = otel.Meter("lab-polling-service")
+)
 
 type Service struct {
-	dikidiClient *dikidi.Client
-	slotParser   *Parser
-	logger       *zap.SugaredLogger
+	repo               Repository
+	dikidiClient       *dikidi.Client
+	slotParser         *Parser
+	policy             *PollingPolicy
+	diagnosticsCounter metric.Int64Counter
+	logger             *zap.SugaredLogger
 }
 
-func NewService(client *dikidi.Client, slotParser *Parser, logger *zap.SugaredLogger) *Service {
-	return &Service{
-		dikidiClient: client,
-		slotParser:   slotParser,
-		logger:       logger,
+func NewService(repo Repository, client *dikidi.Client, slotParser *Parser, policy *PollingPolicy, logger *zap.SugaredLogger) (*Service, error) {
+	diagnosticsCounter, err := meter.Int64Counter(
+		"lab_polling.parse_diagnostics",
+		metric.WithDescription("Number of slot parts that could not be parsed, by severity and field"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parse diagnostics counter: %w", err)
 	}
+
+	return &Service{
+		repo:               repo,
+		dikidiClient:       client,
+		slotParser:         slotParser,
+		policy:             policy,
+		diagnosticsCounter: diagnosticsCounter,
+		logger:             logger,
+	}, nil
 }
 
+// GetLabEventsStream streams the open slots of a poll followed by gone events for slots that were open in the
+// previous complete poll, which is stored for the next poll of any instance
 func (s *Service) GetLabEventsStream(ctx context.Context) chan *Event {
+	return s.labEventsStream(ctx, true)
+}
+
+// GetOpenLabEventsStream streams the open slots of a poll only. The stored poll is left as is, so that the next
+// GetLabEventsStream still finds every slot that is gone since then
+func (s *Service) GetOpenLabEventsStream(ctx context.Context) chan *Event {
+	return s.labEventsStream(ctx, false)
+}
+
+func (s *Service) labEventsStream(ctx context.Context, detectGone bool) chan *Event {
 	ctx, span := tracer.Start(ctx, "lab_polling.service.GetLabEventsStream")
 
 	s.logger.Info("starting lab events stream")
@@ -49,12 +84,16 @@ func (s *Service) GetLabEventsStream(ctx context.Context) chan *Event {
 		eventCount := 0
 		slotCount := 0
 		errorCount := 0
+		warningCount := 0
+		fetchErrorCount := 0
+		snapshot := make(slotSnapshot)
 
 		for slot := range slots {
 			slotCount++
 
 			if slot.Err != nil {
 				errorCount++
+				fetchErrorCount++
 				span.RecordError(slot.Err)
 				s.logger.Errorw("error receiving slot from dikidi client",
 					"error", slot.Err,
@@ -63,18 +102,24 @@ func (s *Service) GetLabEventsStream(ctx context.Context) chan *Event {
 				continue
 			}
 
-			parsed, err := s.slotParser.ParseSlot(slot.Data)
-			if err != nil {
-				errorCount++
+			parsed, diagnostics := s.slotParser.ParseSlot(slot.Data)
+			for _, diagnostic := range diagnostics {
+				if diagnostic.Severity == SeverityError {
+					errorCount++
+				} else {
+					warningCount++
+				}
+				s.reportDiagnostic(ctx, &diagnostic)
+			}
+			if err := s.repo.SaveUnparsedEntries(ctx, uniqueDiagnostics(diagnostics), time.Now()); err != nil {
 				span.RecordError(err)
-				s.logger.Errorw("error parsing slot",
+				s.logger.Errorw("failed to save unparsed entries",
 					"error", err,
-					"slot_count", slotCount,
-					"error_count", errorCount)
-				continue
+					"service_id", slot.Data.Data.ServiceID)
 			}
 
 			for _, event := range parsed {
+				snapshot.add(&event)
 				select {
 				case events <- &event:
 					eventCount++
@@ -96,17 +141,371 @@ func (s *Service) GetLabEventsStream(ctx context.Context) chan *Event {
 			}
 		}
 
+		if ctx.Err() != nil {
+			span.SetStatus(codes.Error, "context cancelled")
+			s.logger.Warnw("lab events stream cancelled by context",
+				"events_sent", eventCount,
+				"slots_processed", slotCount,
+				"context_error", ctx.Err())
+			return
+		}
+
+		var gone []Event
+		if detectGone {
+			gone = s.detectGoneSlots(ctx, snapshot, fetchErrorCount)
+		}
+		for _, event := range gone {
+			select {
+			case events <- &event:
+			case <-ctx.Done():
+				span.SetStatus(codes.Error, "context cancelled")
+				s.logger.Warnw("lab events stream cancelled by context while sending gone events",
+					"context_error", ctx.Err())
+				return
+			}
+		}
+
 		span.SetAttributes(
 			attribute.Int("events.total", eventCount),
+			attribute.Int("events.gone", len(gone)),
 			attribute.Int("slots.total", slotCount),
 			attribute.Int("errors.total", errorCount),
+			attribute.Int("warnings.total", warningCount),
 		)
 
 		s.logger.Infow("lab events stream completed",
 			"events_sent", eventCount,
+			"gone_events_sent", len(gone),
 			"slots_processed", slotCount,
-			"errors", errorCount)
+			"errors", errorCount,
+			"warnings", warningCount)
 	}()
 
 	return events
 }
+
+// detectGoneSlots diffs the snapshot of a complete poll against the stored one, stores it in its place and reports
+// any change to the polling policy. A poll that failed to fetch some slots would report their lessons as gone, so
+// it is skipped and the stored snapshot is kept. So is a poll whose previous snapshot could not be loaded
+func (s *Service) detectGoneSlots(ctx context.Context, snapshot slotSnapshot, fetchErrorCount int) []Event {
+	if fetchErrorCount > 0 {
+		s.logger.Warnw("skipping gone slot detection, some slots were not fetched",
+			"fetch_errors", fetchErrorCount)
+		return nil
+	}
+
+	rawPrev, err := s.repo.GetSlotSnapshot(ctx)
+	if err != nil {
+		s.logger.Errorw("skipping gone slot detection, failed to get previous slot snapshot", "error", err)
+		return nil
+	}
+	var prev slotSnapshot
+	if rawPrev != nil {
+		if err := json.Unmarshal(rawPrev, &prev); err != nil {
+			s.logger.Errorw("discarding invalid previous slot snapshot", "error", err)
+			prev = nil
+		}
+	}
+
+	var gone []Event
+	changed := false
+	if prev != nil {
+		gone = goneEvents(prev, snapshot)
+		// Diffing the other way round finds lessons that appeared
+		changed = len(gone) > 0 || len(goneEvents(snapshot, prev)) > 0
+	}
+
+	rawSnapshot, err := json.Marshal(snapshot)
+	if err != nil {
+		s.logger.Errorw("failed to encode slot snapshot", "error", err)
+	} else if err := s.repo.SaveSlotSnapshot(ctx, rawSnapshot); err != nil {
+		s.logger.Errorw("failed to save slot snapshot", "error", err)
+	}
+
+	if changed {
+		if err := s.repo.SavePollingChange(ctx, time.Now()); err != nil {
+			s.logger.Errorw("failed to save polling change", "error", err)
+		}
+	}
+
+	return gone
+}
+
+// NextPoll picks the time of the next poll by the polling policy and returns it with the rule it was picked by.
+// A storage error is logged and the policy falls back to the schedule without the boost
+func (s *Service) NextPoll(ctx context.Context, now time.Time) (time.Time, string) {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.NextPoll")
+	defer span.End()
+
+	var lastChangeAt *time.Time
+	state, err := s.repo.GetPollingState(ctx)
+	if err != nil {
+		span.RecordError(err)
+		s.logger.Errorw("failed to get polling state", "error", err)
+	} else {
+		lastChangeAt = state.LastChangeAt
+	}
+
+	return s.policy.Next(now, lastChangeAt)
+}
+
+// SaveNextPoll shares the next poll scheduled by the instance that polls, so that any instance can show it
+func (s *Service) SaveNextPoll(ctx context.Context, next time.Time, rule string) error {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.SaveNextPoll")
+	defer span.End()
+
+	if err := s.repo.SaveNextPoll(ctx, next, rule); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "SaveNextPoll",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetPollingPolicy returns the polling schedule with the rule in effect now
+func (s *Service) GetPollingPolicy(ctx context.Context) (*GetPollingPolicyRes, error) {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.GetPollingPolicy")
+	defer span.End()
+
+	state, err := s.repo.GetPollingState(ctx)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetPollingPolicy",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := &GetPollingPolicyRes{
+		PollingPolicyState: s.policy.State(time.Now(), state.LastChangeAt),
+		LastChangeAt:       state.LastChangeAt,
+		NextPollAt:         state.NextPollAt,
+	}
+	if state.NextPollRule != nil {
+		result.NextPollRule = *state.NextPollRule
+	}
+
+	return result, nil
+}
+
+func (s *Service) GetUnparsedEntries(ctx context.Context, req *GetUnparsedEntriesReq) ([]GetUnparsedEntryRes, error) {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.GetUnparsedEntries")
+	defer span.End()
+
+	entries, err := s.repo.GetUnparsedEntries(ctx, req.Severity, req.Limit)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetUnparsedEntries",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]GetUnparsedEntryRes, len(entries))
+	for i, entry := range entries {
+		result[i] = GetUnparsedEntryRes{
+			ServiceID:   entry.ServiceID,
+			MasterID:    entry.MasterID,
+			Field:       entry.Field,
+			RawText:     entry.RawText,
+			Severity:    entry.Severity,
+			Username:    entry.Username,
+			ServiceName: entry.ServiceName,
+			Reason:      entry.Reason,
+			Occurrences: entry.Occurrences,
+			FirstSeenAt: entry.FirstSeenAt,
+			LastSeenAt:  entry.LastSeenAt,
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Service) reportDiagnostic(ctx context.Context, diagnostic *ParseDiagnostic) {
+	s.diagnosticsCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("severity", string(diagnostic.Severity)),
+		attribute.String("field", string(diagnostic.Field)),
+	))
+
+	fields := []any{
+		"service_id", diagnostic.ServiceID,
+		"master_id", diagnostic.MasterID,
+		"field", diagnostic.Field,
+		"raw_text", diagnostic.RawText,
+		"reason", diagnostic.Reason,
+		"username", diagnostic.Username,
+		"service_name", diagnostic.ServiceName,
+	}
+	if diagnostic.Severity == SeverityError {
+		s.logger.Errorw("dropped master when parsing slot", fields...)
+	} else {
+		s.logger.Warnw("skipped slot time when parsing slot", fields...)
+	}
+}
+
+// uniqueDiagnostics drops repeated diagnostics of the same entry, which a single upsert cannot update twice
+func uniqueDiagnostics(diagnostics []ParseDiagnostic) []ParseDiagnostic {
+	type entryKey struct {
+		serviceID, masterID int
+		field               DiagnosticField
+		rawText             string
+	}
+
+	seen := make(map[entryKey]struct{}, len(diagnostics))
+	result := make([]ParseDiagnostic, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		key := entryKey{diagnostic.ServiceID, diagnostic.MasterID, diagnostic.Field, diagnostic.RawText}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, diagnostic)
+	}
+	return result
+}
+
+// SaveJobRun records a finished or skipped run of a worker job
+func (s *Service) SaveJobRun(ctx context.Context, run *JobRun) error {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.SaveJobRun")
+	defer span.End()
+
+	counts := run.Counts
+	if counts == nil {
+		counts = map[string]int{}
+	}
+	dbRun := &DBJobRun{
+		RunUUID:    uuid.New(),
+		Job:        run.Job,
+		Instance:   run.Instance,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		Outcome:    run.Outcome,
+		Counts:     counts,
+	}
+	if run.Error != "" {
+		dbRun.Error = &run.Error
+	}
+
+	if err := s.repo.SaveJobRun(ctx, dbRun); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "SaveJobRun",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SaveJobNextRun shares the next scheduled run of a job, so that any instance can show it. A nil nextRunAt
+// means the job is not scheduled
+func (s *Service) SaveJobNextRun(ctx context.Context, name string, nextRunAt *time.Time) error {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.SaveJobNextRun")
+	defer span.End()
+
+	if err := s.repo.SaveJobNextRun(ctx, name, nextRunAt, time.Now()); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "SaveJobNextRun",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetJobs returns the next scheduled run of every job and the most recent runs
+func (s *Service) GetJobs(ctx context.Context, req *GetJobsReq) (*GetJobsRes, error) {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.GetJobs")
+	defer span.End()
+
+	jobs, err := s.repo.GetJobs(ctx)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetJobs",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	runs, err := s.repo.GetJobRuns(ctx, req.Job, req.Limit)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetJobs",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := &GetJobsRes{
+		Jobs: make([]JobRes, len(jobs)),
+		Runs: make([]JobRunRes, len(runs)),
+	}
+	for i, job := range jobs {
+		result.Jobs[i] = JobRes{
+			Name:      job.Name,
+			NextRunAt: job.NextRunAt,
+			UpdatedAt: job.UpdatedAt,
+		}
+	}
+	for i, run := range runs {
+		result.Runs[i] = JobRunRes{
+			RunUUID:    run.RunUUID,
+			Job:        run.Job,
+			Instance:   run.Instance,
+			StartedAt:  run.StartedAt,
+			FinishedAt: run.FinishedAt,
+			Outcome:    run.Outcome,
+			Counts:     run.Counts,
+		}
+		if run.Error != nil {
+			result.Runs[i].Error = *run.Error
+		}
+	}
+
+	return result, nil
+}
+
+// PruneJobRuns deletes runs started before the given time. Returns the number of deleted runs
+func (s *Service) PruneJobRuns(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "lab_polling.service.PruneJobRuns")
+	defer span.End()
+
+	deleted, err := s.repo.DeleteJobRunsBefore(ctx, before)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "PruneJobRuns",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,108 @@
+package lab_polling
+
+import (
+	"encoding/json"
+	"labgrab/internal/shared/lab"
+	"labgrab/internal/shared/types"
+	"time"
+)
+
+// labKey identifies a lab across polls. Events of different masters with the same key are merged
+type labKey struct {
+	labType    lab.Type
+	topic      lab.Topic
+	number     int
+	auditorium int
+}
+
+// slotSnapshot holds the lessons open in one poll by lab, with their dates
+type slotSnapshot map[labKey]map[types.DayOfWeek]map[int][]time.Time
+
+// snapshotLab is a lab of a snapshot as it is stored between polls, JSON objects can't be keyed by labKey
+type snapshotLab struct {
+	Type       lab.Type                                `json:"type"`
+	Topic      lab.Topic                               `json:"topic"`
+	Number     int                                     `json:"number"`
+	Auditorium int                                     `json:"auditorium"`
+	Lessons    map[types.DayOfWeek]map[int][]time.Time `json:"lessons"`
+}
+
+func (s slotSnapshot) MarshalJSON() ([]byte, error) {
+	labs := make([]snapshotLab, 0, len(s))
+	for key, lessons := range s {
+		labs = append(labs, snapshotLab{
+			Type:       key.labType,
+			Topic:      key.topic,
+			Number:     key.number,
+			Auditorium: key.auditorium,
+			Lessons:    lessons,
+		})
+	}
+	return json.Marshal(labs)
+}
+
+func (s *slotSnapshot) UnmarshalJSON(data []byte) error {
+	var labs []snapshotLab
+	if err := json.Unmarshal(data, &labs); err != nil {
+		return err
+	}
+	*s = make(slotSnapshot, len(labs))
+	for _, l := range labs {
+		(*s)[labKey{labType: l.Type, topic: l.Topic, number: l.Number, auditorium: l.Auditorium}] = l.Lessons
+	}
+	return nil
+}
+
+func (s slotSnapshot) add(event *Event) {
+	key := labKey{labType: event.Type, topic: event.Topic, number: event.Number, auditorium: event.Auditorium}
+	days, ok := s[key]
+	if !ok {
+		days = make(map[types.DayOfWeek]map[int][]time.Time)
+		s[key] = days
+	}
+
+	for day, lessons := range event.Schedule {
+		if days[day] == nil {
+			days[day] = make(map[int][]time.Time)
+		}
+		for lesson := range lessons {
+			days[day][lesson] = append(days[day][lesson], event.Dates[day][lesson]...)
+		}
+	}
+}
+
+// goneEvents returns an event for every lab that has lessons open in prev and missing in cur
+func goneEvents(prev, cur slotSnapshot) []Event {
+	var events []Event
+	for key, prevDays := range prev {
+		var event *Event
+		for day, lessons := range prevDays {
+			for lesson, dates := range lessons {
+				if _, ok := cur[key][day][lesson]; ok {
+					continue
+				}
+				if event == nil {
+					event = &Event{
+						Type:       key.labType,
+						Topic:      key.topic,
+						Number:     key.number,
+						Auditorium: key.auditorium,
+						Schedule:   make(map[types.DayOfWeek]map[int][]string),
+						Dates:      make(map[types.DayOfWeek]map[int][]time.Time),
+						Gone:       true,
+					}
+				}
+				if event.Schedule[day] == nil {
+					event.Schedule[day] = make(map[int][]string)
+					event.Dates[day] = make(map[int][]time.Time)
+				}
+				event.Schedule[day][lesson] = []string{}
+				event.Dates[day][lesson] = dates
+			}
+		}
+		if event != nil {
+			events = append(events, *event)
+		}
+	}
+	return events
+}
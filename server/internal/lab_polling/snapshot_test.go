@@ -0,0 +1,122 @@
+package lab_polling
+
+import (
+	"encoding/json"
+	"labgrab/internal/shared/types"
+	"testing"
+	"time"
+)
+
+func TestGoneEvents(t *testing.T) {
+	monday := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	wednesday := monday.AddDate(0, 0, 2)
+
+	prev := make(slotSnapshot)
+	prev.add(&Event{
+		Type: "Defence", Topic: "Optics", Number: 3, Auditorium: 214,
+		Schedule: map[types.DayOfWeek]map[int][]string{
+			types.DayMon: {1: {"Иванов И.И."}},
+			types.DayWed: {2: {"Петров П.П."}},
+		},
+		Dates: map[types.DayOfWeek]map[int][]time.Time{
+			types.DayMon: {1: {monday}},
+			types.DayWed: {2: {wednesday}},
+		},
+	})
+	prev.add(&Event{
+		Type: "Defence", Topic: "Mechanics", Number: 1, Auditorium: 101,
+		Schedule: map[types.DayOfWeek]map[int][]string{types.DayMon: {3: {"Сидоров С.С."}}},
+	})
+
+	cur := make(slotSnapshot)
+	cur.add(&Event{
+		Type: "Defence", Topic: "Optics", Number: 3, Auditorium: 214,
+		Schedule: map[types.DayOfWeek]map[int][]string{
+			types.DayMon: {1: {"Иванов И.И."}},
+			types.DayThu: {4: {"Петров П.П."}},
+		},
+	})
+	cur.add(&Event{
+		Type: "Defence", Topic: "Mechanics", Number: 1, Auditorium: 101,
+		Schedule: map[types.DayOfWeek]map[int][]string{types.DayMon: {3: {"Сидоров С.С."}}},
+	})
+
+	gone := goneEvents(prev, cur)
+	if len(gone) != 1 {
+		t.Fatalf("goneEvents() returned %d events, want 1: %+v", len(gone), gone)
+	}
+
+	event := gone[0]
+	if !event.Gone || event.Topic != "Optics" || event.Number != 3 || event.Auditorium != 214 {
+		t.Errorf("goneEvents() event = %+v, want a gone Optics №3 event in 214", event)
+	}
+	if len(event.Schedule) != 1 || len(event.Schedule[types.DayWed]) != 1 {
+		t.Errorf("goneEvents() schedule = %v, want only Wed lesson 2", event.Schedule)
+	}
+	if _, ok := event.Schedule[types.DayWed][2]; !ok {
+		t.Errorf("goneEvents() schedule = %v, want Wed lesson 2", event.Schedule)
+	}
+	if dates := event.Dates[types.DayWed][2]; len(dates) != 1 || !dates[0].Equal(wednesday) {
+		t.Errorf("goneEvents() dates = %v, want the date from the previous poll", event.Dates)
+	}
+}
+
+func TestGoneEventsMergesMasters(t *testing.T) {
+	prev := make(slotSnapshot)
+	prev.add(&Event{
+		Type: "Defence", Topic: "Optics", Number: 3, Auditorium: 214,
+		Schedule: map[types.DayOfWeek]map[int][]string{types.DayMon: {1: {"Иванов И.И."}}},
+	})
+
+	// The lesson moved to another master of the same lab, so it is still open
+	cur := make(slotSnapshot)
+	cur.add(&Event{
+		Type: "Defence", Topic: "Optics", Number: 3, Auditorium: 214,
+		Schedule: map[types.DayOfWeek]map[int][]string{types.DayTue: {2: {"Иванов И.И."}}},
+	})
+	cur.add(&Event{
+		Type: "Defence", Topic: "Optics", Number: 3, Auditorium: 214,
+		Schedule: map[types.DayOfWeek]map[int][]string{types.DayMon: {1: {"Петров П.П."}}},
+	})
+
+	if gone := goneEvents(prev, cur); len(gone) != 0 {
+		t.Errorf("goneEvents() = %+v, want none", gone)
+	}
+}
+
+func TestSlotSnapshotJSON(t *testing.T) {
+	monday := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	prev := make(slotSnapshot)
+	prev.add(&Event{
+		Type: "Defence", Topic: "Optics", Number: 3, Auditorium: 214,
+		Schedule: map[types.DayOfWeek]map[int][]string{
+			types.DayMon: {1: {"Иванов И.И."}},
+			types.DayWed: {2: {"Петров П.П."}},
+		},
+		Dates: map[types.DayOfWeek]map[int][]time.Time{types.DayMon: {1: {monday}}},
+	})
+
+	data, err := json.Marshal(prev)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var stored slotSnapshot
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	// A snapshot read back from the database diffs the same way as the one kept in memory
+	cur := make(slotSnapshot)
+	cur.add(&Event{
+		Type: "Defence", Topic: "Optics", Number: 3, Auditorium: 214,
+		Schedule: map[types.DayOfWeek]map[int][]string{types.DayWed: {2: {"Петров П.П."}}},
+	})
+	gone := goneEvents(stored, cur)
+	if len(gone) != 1 || len(gone[0].Schedule) != 1 {
+		t.Fatalf("goneEvents() = %+v, want Mon lesson 1 gone", gone)
+	}
+	if dates := gone[0].Dates[types.DayMon][1]; len(dates) != 1 || !dates[0].Equal(monday) {
+		t.Errorf("goneEvents() dates = %v, want the stored date", gone[0].Dates)
+	}
+}
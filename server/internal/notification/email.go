@@ -0,0 +1,158 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"labgrab/internal/shared/api/smtp"
+	"labgrab/internal/shared/types"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+var dayNames = map[types.DayOfWeek]string{
+	types.DayMon: "Понедельник",
+	types.DayTue: "Вторник",
+	types.DayWed: "Среда",
+	types.DayThu: "Четверг",
+	types.DayFri: "Пятница",
+	types.DaySat: "Суббота",
+	types.DaySun: "Воскресенье",
+}
+
+// Email sends notifications to the verified email address of the user
+type Email struct {
+	client *smtp.Client
+	html   *htmltemplate.Template
+	text   *texttemplate.Template
+}
+
+func NewEmail(client *smtp.Client) (*Email, error) {
+	funcs := map[string]any{"join": strings.Join}
+
+	html, err := htmltemplate.New("").Funcs(funcs).ParseFS(templates, "templates/*.html.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("invalid html template: %w", err)
+	}
+
+	text, err := texttemplate.New("").Funcs(funcs).ParseFS(templates, "templates/*.txt.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("invalid text template: %w", err)
+	}
+
+	return &Email{client: client, html: html, text: text}, nil
+}
+
+func (e *Email) Channel() Channel {
+	return ChannelEmail
+}
+
+func (e *Email) Notify(ctx context.Context, n *Notification) error {
+	if n.Contacts.Email == nil {
+		return nil
+	}
+
+	var data any = newEmailTemplateData(n)
+	name := "match"
+	subject := fmt.Sprintf("Свободные слоты: %s, лабораторная №%d", n.LabTopic, n.LabNumber)
+	switch n.Kind {
+	case KindSlotsGone:
+		name = "gone"
+		subject = fmt.Sprintf("Слоты заняты: %s, лабораторная №%d", n.LabTopic, n.LabNumber)
+	case KindDigest:
+		items := make([]*emailTemplateData, len(n.Digest))
+		for i, item := range n.Digest {
+			items[i] = newEmailTemplateData(item)
+		}
+		data = items
+		name = "digest"
+		subject = fmt.Sprintf("Сводка по подпискам: %d %s", len(items), pluralUpdates(len(items)))
+	}
+
+	var html, text bytes.Buffer
+	if err := e.html.ExecuteTemplate(&html, name+".html.tmpl", data); err != nil {
+		return fmt.Errorf("failed to render html template: %w", err)
+	}
+	if err := e.text.ExecuteTemplate(&text, name+".txt.tmpl", data); err != nil {
+		return fmt.Errorf("failed to render text template: %w", err)
+	}
+
+	return e.client.Send(ctx, &smtp.Message{
+		To:      []string{*n.Contacts.Email},
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+}
+
+type emailTemplateData struct {
+	Gone              bool
+	LabType           string
+	LabTopic          string
+	LabNumber         int
+	LabAuditorium     int
+	NewDays           []emailTemplateDay
+	StillOpenDays     []emailTemplateDay
+	GoneDays          []emailTemplateDay
+	Teachers          []string
+	PreferredTeachers []string
+}
+
+type emailTemplateDay struct {
+	Name    string
+	Lessons []string
+}
+
+func newEmailTemplateData(n *Notification) *emailTemplateData {
+	data := &emailTemplateData{
+		Gone:              n.Kind == KindSlotsGone,
+		LabType:           n.LabType,
+		LabTopic:          n.LabTopic,
+		LabNumber:         n.LabNumber,
+		LabAuditorium:     n.LabAuditorium,
+		Teachers:          n.Teachers,
+		PreferredTeachers: n.PreferredTeachers,
+	}
+
+	data.NewDays = newEmailTemplateDays(n.NewTimeslots)
+	data.StillOpenDays = newEmailTemplateDays(n.StillOpenTimeslots)
+	data.GoneDays = newEmailTemplateDays(n.GoneTimeslots)
+
+	return data
+}
+
+func newEmailTemplateDays(timeslots map[types.DayOfWeek][]int) []emailTemplateDay {
+	var days []emailTemplateDay
+	for _, day := range types.DaysOfWeek {
+		lessons, ok := timeslots[day]
+		if !ok || len(lessons) == 0 {
+			continue
+		}
+		sorted := slices.Sorted(slices.Values(lessons))
+		names := make([]string, len(sorted))
+		for i, lesson := range sorted {
+			names[i] = strconv.Itoa(lesson)
+		}
+		days = append(days, emailTemplateDay{Name: dayNames[day], Lessons: names})
+	}
+	return days
+}
+
+// pluralUpdates returns the russian word for updates agreeing with count
+func pluralUpdates(count int) string {
+	switch {
+	case count%10 == 1 && count%100 != 11:
+		return "обновление"
+	case count%10 >= 2 && count%10 <= 4 && (count%100 < 12 || count%100 > 14):
+		return "обновления"
+	default:
+		return "обновлений"
+	}
+}
@@ -0,0 +1,306 @@
+package notification_test
+
+import (
+	"context"
+	"io"
+	"labgrab/internal/notification"
+	"labgrab/internal/shared/api/smtp"
+	"labgrab/internal/shared/api/smtp/smtptest"
+	"labgrab/internal/shared/types"
+	"labgrab/pkg/config"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailNotify(t *testing.T) {
+	sink, err := smtptest.NewSink()
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	defer sink.Close()
+
+	email, err := notification.NewEmail(smtp.NewClient(&config.SMTPConfig{
+		Host:    sink.Host(),
+		Port:    sink.Port(),
+		From:    "noreply@labgrab.test",
+		Timeout: time.Second,
+	}))
+	if err != nil {
+		t.Fatalf("NewEmail() error = %v", err)
+	}
+
+	address := "student@example.com"
+	n := &notification.Notification{
+		UserUUID:         uuid.New(),
+		SubscriptionUUID: uuid.New(),
+		LabType:          "Performance",
+		LabTopic:         "Optics",
+		LabNumber:        3,
+		LabAuditorium:    214,
+		MatchingTimeslots: map[types.DayOfWeek][]int{
+			types.DayWed: {4, 2},
+			types.DayMon: {1},
+		},
+		NewTimeslots: map[types.DayOfWeek][]int{
+			types.DayWed: {4, 2},
+			types.DayMon: {1},
+		},
+		Teachers:          []string{"Иванов И.И.", "Петров П.П."},
+		PreferredTeachers: []string{"Иванов И.И."},
+		CreatedAt:         time.Now(),
+		Contacts:          notification.Contacts{Email: &address},
+	}
+
+	if err := email.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	if len(messages[0].To) != 1 || messages[0].To[0] != address {
+		t.Errorf("RCPT TO = %v, want [%s]", messages[0].To, address)
+	}
+
+	text, html := readParts(t, messages[0].Data)
+	for _, want := range []string{"Optics", "№3", "аудитория 214", "Понедельник: 1 пара", "Среда: 2, 4 пара", "Ваши предпочтительные преподаватели: Иванов И.И.", "Преподаватели: Иванов И.И., Петров П.П."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part does not contain %q:\n%s", want, text)
+		}
+	}
+	if !strings.Contains(html, "<b>Optics</b>") {
+		t.Errorf("html part does not contain lab topic:\n%s", html)
+	}
+	if strings.Index(text, "Понедельник") > strings.Index(text, "Среда") {
+		t.Errorf("days are not in calendar order:\n%s", text)
+	}
+}
+
+func TestEmailNotifySplitsNewAndStillOpenSlots(t *testing.T) {
+	sink, err := smtptest.NewSink()
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	defer sink.Close()
+
+	email, err := notification.NewEmail(smtp.NewClient(&config.SMTPConfig{
+		Host:    sink.Host(),
+		Port:    sink.Port(),
+		From:    "noreply@labgrab.test",
+		Timeout: time.Second,
+	}))
+	if err != nil {
+		t.Fatalf("NewEmail() error = %v", err)
+	}
+
+	address := "student@example.com"
+	n := &notification.Notification{
+		LabType:   "Performance",
+		LabTopic:  "Optics",
+		LabNumber: 3,
+		MatchingTimeslots: map[types.DayOfWeek][]int{
+			types.DayWed: {2},
+			types.DayMon: {1},
+		},
+		NewTimeslots:       map[types.DayOfWeek][]int{types.DayWed: {2}},
+		StillOpenTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+		Contacts:           notification.Contacts{Email: &address},
+	}
+
+	if err := email.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+
+	text, _ := readParts(t, messages[0].Data)
+	newIdx := strings.Index(text, "Среда: 2 пара")
+	stillOpenIdx := strings.Index(text, "По-прежнему свободны:")
+	oldIdx := strings.Index(text, "Понедельник: 1 пара")
+	if newIdx < 0 || stillOpenIdx < 0 || oldIdx < 0 {
+		t.Fatalf("text part does not contain both slot groups:\n%s", text)
+	}
+	if !(newIdx < stillOpenIdx && stillOpenIdx < oldIdx) {
+		t.Errorf("still open slots are not listed after new ones:\n%s", text)
+	}
+}
+
+func TestEmailNotifySlotsGone(t *testing.T) {
+	sink, err := smtptest.NewSink()
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	defer sink.Close()
+
+	email, err := notification.NewEmail(smtp.NewClient(&config.SMTPConfig{
+		Host:    sink.Host(),
+		Port:    sink.Port(),
+		From:    "noreply@labgrab.test",
+		Timeout: time.Second,
+	}))
+	if err != nil {
+		t.Fatalf("NewEmail() error = %v", err)
+	}
+
+	address := "student@example.com"
+	n := &notification.Notification{
+		Kind:          notification.KindSlotsGone,
+		LabType:       "Performance",
+		LabTopic:      "Optics",
+		LabNumber:     3,
+		GoneTimeslots: map[types.DayOfWeek][]int{types.DayWed: {2}},
+		Contacts:      notification.Contacts{Email: &address},
+	}
+
+	if err := email.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+
+	text, _ := readParts(t, messages[0].Data)
+	for _, want := range []string{"больше недоступны", "Среда: 2 пара"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part does not contain %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestEmailNotifyDigest(t *testing.T) {
+	sink, err := smtptest.NewSink()
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	defer sink.Close()
+
+	email, err := notification.NewEmail(smtp.NewClient(&config.SMTPConfig{
+		Host:    sink.Host(),
+		Port:    sink.Port(),
+		From:    "noreply@labgrab.test",
+		Timeout: time.Second,
+	}))
+	if err != nil {
+		t.Fatalf("NewEmail() error = %v", err)
+	}
+
+	address := "student@example.com"
+	n := &notification.Notification{
+		Kind: notification.KindDigest,
+		Digest: []*notification.Notification{
+			{
+				LabType:           "Performance",
+				LabTopic:          "Optics",
+				LabNumber:         3,
+				MatchingTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+				NewTimeslots:      map[types.DayOfWeek][]int{types.DayMon: {1}},
+			},
+			{
+				Kind:          notification.KindSlotsGone,
+				LabType:       "Defence",
+				LabTopic:      "Mechanics",
+				LabNumber:     1,
+				GoneTimeslots: map[types.DayOfWeek][]int{types.DayWed: {2}},
+			},
+		},
+		Contacts: notification.Contacts{Email: &address},
+	}
+
+	if err := email.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+
+	text, html := readParts(t, messages[0].Data)
+	openIdx := strings.Index(text, "Свободные слоты: Optics")
+	goneIdx := strings.Index(text, "Слоты больше недоступны: Mechanics")
+	if openIdx < 0 || goneIdx < 0 || openIdx > goneIdx {
+		t.Errorf("text part does not list both notifications in order:\n%s", text)
+	}
+	for _, want := range []string{"Понедельник: 1 пара", "Среда: 2 пара"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part does not contain %q:\n%s", want, text)
+		}
+	}
+	if !strings.Contains(html, "<b>Mechanics</b>") {
+		t.Errorf("html part does not contain the gone lab:\n%s", html)
+	}
+}
+
+func TestEmailNotifyWithoutAddress(t *testing.T) {
+	sink, err := smtptest.NewSink()
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	defer sink.Close()
+
+	email, err := notification.NewEmail(smtp.NewClient(&config.SMTPConfig{
+		Host:    sink.Host(),
+		Port:    sink.Port(),
+		From:    "noreply@labgrab.test",
+		Timeout: time.Second,
+	}))
+	if err != nil {
+		t.Fatalf("NewEmail() error = %v", err)
+	}
+
+	if err := email.Notify(context.Background(), &notification.Notification{}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got := len(sink.Messages()); got != 0 {
+		t.Errorf("sink received %d messages, want 0", got)
+	}
+}
+
+func readParts(t *testing.T, data string) (string, string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %v", err)
+	}
+
+	var text, html string
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatalf("failed to decode part: %v", err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+			html = string(body)
+		} else {
+			text = string(body)
+		}
+	}
+
+	return text, html
+}
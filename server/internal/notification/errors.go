@@ -0,0 +1,5 @@
+package notification
+
+import "errors"
+
+var ErrWebhookNotFound = errors.New("webhook not found")
@@ -0,0 +1,8 @@
+package notification
+
+import "net/netip"
+
+// AllowAllWebhookAddrs lets a webhook post to test receivers listening on loopback
+func AllowAllWebhookAddrs(w *Webhook) {
+	w.allowAddr = func(netip.Addr) bool { return true }
+}
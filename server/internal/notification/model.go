@@ -0,0 +1,272 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"labgrab/internal/shared/errors"
+	"labgrab/internal/shared/types"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Channel string
+
+const (
+	ChannelStream  Channel = "Stream"
+	ChannelWebhook Channel = "Webhook"
+	ChannelEmail   Channel = "Email"
+)
+
+var Channels = []Channel{ChannelStream, ChannelWebhook, ChannelEmail}
+
+// DefaultChannels are used for users that never selected channels explicitly
+var DefaultChannels = []Channel{ChannelStream, ChannelWebhook}
+
+type Kind string
+
+const (
+	// KindSlotsOpen announces matching slots
+	KindSlotsOpen Kind = "SlotsOpen"
+	// KindSlotsGone announces that slots the user was notified about are not available anymore
+	KindSlotsGone Kind = "SlotsGone"
+	// KindDigest combines the notifications of a user created within closed digest windows into one message
+	KindDigest Kind = "Digest"
+)
+
+// Event names announced to receivers, sent as the SSE event and in the webhook event header and payload
+const (
+	EventMatch  = "match"
+	EventGone   = "gone"
+	EventDigest = "digest"
+)
+
+// Event returns the name receivers get notifications of the kind under
+func (k Kind) Event() string {
+	switch k {
+	case KindSlotsGone:
+		return EventGone
+	case KindDigest:
+		return EventDigest
+	default:
+		return EventMatch
+	}
+}
+
+// Notifier delivers a single notification through one channel
+type Notifier interface {
+	Channel() Channel
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// Notification is the payload sent to every channel when a subscription matches new slots or when
+// slots it was notified about are gone
+type Notification struct {
+	Kind              Kind                      `json:"kind"`
+	UserUUID          uuid.UUID                 `json:"user_uuid"`
+	SubscriptionUUID  uuid.UUID                 `json:"subscription_uuid"`
+	LabType           string                    `json:"lab_type"`
+	LabTopic          string                    `json:"lab_topic"`
+	LabNumber         int                       `json:"lab_number"`
+	LabAuditorium     int                       `json:"lab_auditorium"`
+	MatchingTimeslots map[types.DayOfWeek][]int `json:"matching_timeslots"`
+	// NewTimeslots and StillOpenTimeslots split MatchingTimeslots into slots seen for the first time and
+	// slots that were already announced
+	NewTimeslots       map[types.DayOfWeek][]int `json:"new_timeslots,omitempty"`
+	StillOpenTimeslots map[types.DayOfWeek][]int `json:"still_open_timeslots,omitempty"`
+	// GoneTimeslots are the slots that are not available anymore, set for KindSlotsGone only
+	GoneTimeslots map[types.DayOfWeek][]int `json:"gone_timeslots,omitempty"`
+	// Teachers are ordered by the user's preference, PreferredTeachers is the subset the user explicitly prefers
+	Teachers          []string  `json:"teachers"`
+	PreferredTeachers []string  `json:"preferred_teachers"`
+	CreatedAt         time.Time `json:"created_at"`
+	// Digest are the combined notifications in the order they were created, set for KindDigest only
+	Digest   []*Notification `json:"digest,omitempty"`
+	Contacts Contacts        `json:"-"`
+	Delivery Delivery        `json:"-"`
+}
+
+// Delivery identifies the attempt to deliver a claimed outbox entry, it is set by the service on delivery
+type Delivery struct {
+	// UUID stays the same across attempts, so that receivers can drop repeated deliveries
+	UUID    uuid.UUID
+	Attempt int
+	// WebhookUUID is the webhook to deliver to, set for webhook entries only
+	WebhookUUID *uuid.UUID
+}
+
+// Contacts holds recipient addresses for channels that need them. Nil means the channel is unavailable
+type Contacts struct {
+	Email *string
+}
+
+// StreamEvent is a notification stored in a user's event stream. ID is the redis stream entry id, Event is
+// the name of the notification kind
+type StreamEvent struct {
+	ID    string
+	Event string
+	Data  []byte
+}
+
+type streamMessage struct {
+	ID    string          `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type SubscribeEventsReq struct {
+	UserUUID    uuid.UUID
+	LastEventID string
+}
+
+// DBUserChannels notification_service.channels
+type DBUserChannels struct {
+	Channels []Channel `db:"channels"`
+	UserUUID uuid.UUID `db:"user_uuid"`
+}
+
+// DBOutboxEntry notification_service.outbox
+type DBOutboxEntry struct {
+	OutboxUUID    uuid.UUID  `db:"outbox_uuid"`
+	Channel       Channel    `db:"channel"`
+	Payload       []byte     `db:"payload"`
+	Attempts      int        `db:"attempts"`
+	LastError     *string    `db:"last_error"`
+	CreatedAt     time.Time  `db:"created_at"`
+	NextAttemptAt time.Time  `db:"next_attempt_at"`
+	LockedUntil   *time.Time `db:"locked_until"`
+	SentAt        *time.Time `db:"sent_at"`
+	FailedAt      *time.Time `db:"failed_at"`
+	UserUUID      uuid.UUID  `db:"user_uuid"`
+	WebhookUUID   *uuid.UUID `db:"webhook_uuid"`
+}
+
+// OutboxEntry is a claimed notification waiting for delivery through a single channel. Webhook entries are
+// written per webhook, so that a failing webhook is retried without repeating deliveries to the others
+type OutboxEntry struct {
+	OutboxUUID   uuid.UUID
+	Channel      Channel
+	WebhookUUID  *uuid.UUID
+	Attempts     int
+	CreatedAt    time.Time
+	Notification *Notification
+}
+
+type DeliveryOutcome string
+
+const (
+	DeliverySent      DeliveryOutcome = "Sent"
+	DeliveryPostponed DeliveryOutcome = "Postponed"
+	DeliverySkipped   DeliveryOutcome = "Skipped"
+	DeliveryFailed    DeliveryOutcome = "Failed"
+)
+
+// DBWebhook notification_service.webhooks
+type DBWebhook struct {
+	WebhookUUID         uuid.UUID  `db:"webhook_uuid"`
+	URL                 string     `db:"url"`
+	Secret              string     `db:"secret"`
+	Enabled             bool       `db:"enabled"`
+	ConsecutiveFailures int        `db:"consecutive_failures"`
+	CreatedAt           time.Time  `db:"created_at"`
+	DisabledAt          *time.Time `db:"disabled_at"`
+	UserUUID            uuid.UUID  `db:"user_uuid"`
+}
+
+// DBWebhookDelivery notification_service.webhook_deliveries
+type DBWebhookDelivery struct {
+	DeliveryUUID     uuid.UUID  `db:"delivery_uuid"`
+	WebhookUUID      uuid.UUID  `db:"webhook_uuid"`
+	SubscriptionUUID *uuid.UUID `db:"subscription_uuid"` // nil for digests, they cover several subscriptions
+	Attempt          int        `db:"attempt"`
+	StatusCode       *int       `db:"status_code"`
+	Error            *string    `db:"error"`
+	Succeeded        bool       `db:"succeeded"`
+	DeliveredAt      time.Time  `db:"delivered_at"`
+}
+
+type CreateWebhookReq struct {
+	UserUUID uuid.UUID
+	URL      string
+}
+
+func (r CreateWebhookReq) Validate() error {
+	err := errors.NewValidationError()
+	u, parseErr := url.Parse(r.URL)
+	if parseErr != nil || !u.IsAbs() || u.Host == "" {
+		err.Add("url", "Webhook url should be an absolute url")
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		err.Add("url", "Webhook url scheme should be either 'http' or 'https'")
+	} else if !allowedWebhookHost(u.Hostname()) {
+		err.Add("url", "Webhook url should not point to a loopback, private or link-local address")
+	}
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
+
+type CreateWebhookRes struct {
+	WebhookUUID uuid.UUID
+	Secret      string
+}
+
+type GetWebhookRes struct {
+	WebhookUUID         uuid.UUID
+	URL                 string
+	Enabled             bool
+	ConsecutiveFailures int
+	CreatedAt           time.Time
+	DisabledAt          *time.Time
+}
+
+type UpdateWebhookReq struct {
+	UserUUID    uuid.UUID
+	WebhookUUID uuid.UUID
+	Enabled     bool
+}
+
+type GetWebhookDeliveriesReq struct {
+	UserUUID    uuid.UUID
+	WebhookUUID uuid.UUID
+	Limit       uint64
+}
+
+type GetWebhookDeliveryRes struct {
+	DeliveryUUID     uuid.UUID
+	SubscriptionUUID *uuid.UUID
+	Attempt          int
+	StatusCode       *int
+	Error            *string
+	Succeeded        bool
+	DeliveredAt      time.Time
+}
+
+// webhookPayload is the signed body posted to user webhooks
+type webhookPayload struct {
+	ID        uuid.UUID     `json:"id"`
+	Event     string        `json:"event"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      *Notification `json:"data"`
+}
+
+type UpdateChannelsReq struct {
+	UserUUID uuid.UUID
+	Channels []Channel
+}
+
+func (r UpdateChannelsReq) Validate() error {
+	err := errors.NewValidationError()
+	for _, channel := range r.Channels {
+		if !slices.Contains(Channels, channel) {
+			err.Add("channels", fmt.Sprintf("Unknown channel '%s'", channel))
+		}
+	}
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package notification
+
+import "time"
+
+// Preferences control when and through which channel notifications of a user are delivered
+type Preferences struct {
+	QuietHours       *QuietHours
+	DigestInterval   time.Duration // zero means immediate delivery
+	MaxPerHour       int           // zero means unlimited
+	PreferredChannel *Channel
+}
+
+// QuietHours is a daily window during which nothing is delivered. Start and End are offsets
+// from midnight, a window with Start after End wraps over midnight
+type QuietHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// DefaultPreferences deliver every notification immediately through the selected channels
+var DefaultPreferences = Preferences{}
+
+// quietUntil returns the end of the quiet window containing now, or zero time if now is outside of it
+func (q *QuietHours) quietUntil(now time.Time) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+
+	switch {
+	case q.Start == q.End:
+		return time.Time{}
+	case q.Start < q.End:
+		if offset >= q.Start && offset < q.End {
+			return midnight.Add(q.End)
+		}
+	default:
+		if offset >= q.Start {
+			return midnight.AddDate(0, 0, 1).Add(q.End)
+		}
+		if offset < q.End {
+			return midnight.Add(q.End)
+		}
+	}
+
+	return time.Time{}
+}
+
+// digestAt returns the end of the digest window containing createdAt. Windows are aligned to local
+// midnight, so all notifications created within one window are delivered together
+func digestAt(createdAt time.Time, interval time.Duration) time.Time {
+	midnight := time.Date(createdAt.Year(), createdAt.Month(), createdAt.Day(), 0, 0, 0, 0, createdAt.Location())
+	windows := createdAt.Sub(midnight)/interval + 1
+	return midnight.Add(windows * interval)
+}
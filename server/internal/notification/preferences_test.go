@@ -0,0 +1,66 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursQuietUntil(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.March, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		now   time.Time
+		want  time.Time
+	}{
+		{name: "inside daytime window", quiet: QuietHours{Start: 13 * time.Hour, End: 15 * time.Hour}, now: at(10, 14, 0), want: at(10, 15, 0)},
+		{name: "at start of daytime window", quiet: QuietHours{Start: 13 * time.Hour, End: 15 * time.Hour}, now: at(10, 13, 0), want: at(10, 15, 0)},
+		{name: "at end of daytime window", quiet: QuietHours{Start: 13 * time.Hour, End: 15 * time.Hour}, now: at(10, 15, 0), want: time.Time{}},
+		{name: "before daytime window", quiet: QuietHours{Start: 13 * time.Hour, End: 15 * time.Hour}, now: at(10, 9, 30), want: time.Time{}},
+		{name: "overnight window before midnight", quiet: QuietHours{Start: 23 * time.Hour, End: 7 * time.Hour}, now: at(10, 23, 30), want: at(11, 7, 0)},
+		{name: "overnight window after midnight", quiet: QuietHours{Start: 23 * time.Hour, End: 7 * time.Hour}, now: at(11, 3, 0), want: at(11, 7, 0)},
+		{name: "outside overnight window", quiet: QuietHours{Start: 23 * time.Hour, End: 7 * time.Hour}, now: at(10, 12, 0), want: time.Time{}},
+		{name: "empty window", quiet: QuietHours{Start: 8 * time.Hour, End: 8 * time.Hour}, now: at(10, 8, 0), want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.quiet.quietUntil(tt.now)
+			if !got.Equal(tt.want) {
+				t.Errorf("quietUntil(%s) = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestAt(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	at := func(hour, minute, second int) time.Time {
+		return time.Date(2025, time.March, 10, hour, minute, second, 0, loc)
+	}
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		interval  time.Duration
+		want      time.Time
+	}{
+		{name: "inside window", createdAt: at(10, 7, 0), interval: 30 * time.Minute, want: at(10, 30, 0)},
+		{name: "at window start", createdAt: at(10, 30, 0), interval: 30 * time.Minute, want: at(11, 0, 0)},
+		{name: "just before window end", createdAt: at(10, 59, 59), interval: 30 * time.Minute, want: at(11, 0, 0)},
+		{name: "last window of the day", createdAt: at(23, 50, 0), interval: time.Hour, want: time.Date(2025, time.March, 11, 0, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := digestAt(tt.createdAt, tt.interval)
+			if !got.Equal(tt.want) {
+				t.Errorf("digestAt(%s, %s) = %s, want %s", tt.createdAt, tt.interval, got, tt.want)
+			}
+		})
+	}
+}
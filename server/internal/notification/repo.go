@@ -0,0 +1,738 @@
+package notification
+
+import (
+	"context"
+	stderrors "errors"
+	"labgrab/internal/shared/errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Repository is the storage used by Service and Webhook. Repo implements it on postgres
+type Repository interface {
+	CreateWebhook(ctx context.Context, webhook *DBWebhook) error
+	GetWebhooks(ctx context.Context, userUUID uuid.UUID) ([]DBWebhook, error)
+	GetEnabledWebhooks(ctx context.Context, userUUID uuid.UUID) ([]DBWebhook, error)
+	SetWebhookEnabled(ctx context.Context, userUUID, webhookUUID uuid.UUID, enabled bool) (bool, error)
+	DeleteWebhook(ctx context.Context, userUUID, webhookUUID uuid.UUID) (bool, error)
+	RecordWebhookSuccess(ctx context.Context, webhookUUID uuid.UUID) error
+	RecordWebhookFailure(ctx context.Context, webhookUUID uuid.UUID, disableAfter int) (bool, error)
+	CreateWebhookDelivery(ctx context.Context, delivery *DBWebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, userUUID, webhookUUID uuid.UUID, limit uint64) ([]DBWebhookDelivery, error)
+	GetChannels(ctx context.Context, userUUID uuid.UUID) ([]Channel, error)
+	SetChannels(ctx context.Context, data *DBUserChannels) error
+	CreateOutboxEntries(ctx context.Context, entries []DBOutboxEntry) error
+	ClaimOutboxEntries(ctx context.Context, limit uint64, lockedUntil time.Time) ([]DBOutboxEntry, error)
+	ClaimDigestOutboxEntries(ctx context.Context, userUUID uuid.UUID, channel Channel, webhookUUID *uuid.UUID, createdBefore, lockedUntil time.Time) ([]DBOutboxEntry, error)
+	MarkOutboxEntriesSent(ctx context.Context, outboxUUIDs []uuid.UUID) error
+	MarkOutboxEntryFailed(ctx context.Context, outboxUUID uuid.UUID, lastError string, nextAttemptAt *time.Time) error
+	DeleteOutboxEntry(ctx context.Context, outboxUUID uuid.UUID) error
+	PostponeOutboxEntry(ctx context.Context, outboxUUID uuid.UUID, nextAttemptAt time.Time) error
+	GetSentOutboxStats(ctx context.Context, userUUID uuid.UUID, channel Channel, since time.Time) (int, *time.Time, error)
+	PruneOutboxEntries(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ Repository = (*Repo)(nil)
+
+type Repo struct {
+	pool *pgxpool.Pool
+	sq   squirrel.StatementBuilderType
+}
+
+func NewRepo(pool *pgxpool.Pool) *Repo {
+	return &Repo{pool: pool, sq: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+}
+
+func (r *Repo) CreateWebhook(ctx context.Context, webhook *DBWebhook) error {
+	query, args, err := r.sq.Insert("notification_service.webhooks").
+		Columns("webhook_uuid", "url", "secret", "enabled", "consecutive_failures", "created_at", "user_uuid").
+		Values(webhook.WebhookUUID, webhook.URL, webhook.Secret, webhook.Enabled, webhook.ConsecutiveFailures, webhook.CreatedAt, webhook.UserUUID).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "CreateWebhook",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "CreateWebhook",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) GetWebhooks(ctx context.Context, userUUID uuid.UUID) ([]DBWebhook, error) {
+	return r.getWebhooks(ctx, "GetWebhooks", squirrel.Eq{"user_uuid": userUUID})
+}
+
+func (r *Repo) GetEnabledWebhooks(ctx context.Context, userUUID uuid.UUID) ([]DBWebhook, error) {
+	return r.getWebhooks(ctx, "GetEnabledWebhooks", squirrel.Eq{"user_uuid": userUUID, "enabled": true})
+}
+
+func (r *Repo) getWebhooks(ctx context.Context, procedure string, where squirrel.Sqlizer) ([]DBWebhook, error) {
+	query, args, err := r.sq.Select(
+		"webhook_uuid",
+		"url",
+		"secret",
+		"enabled",
+		"consecutive_failures",
+		"created_at",
+		"disabled_at",
+		"user_uuid",
+	).
+		From("notification_service.webhooks").
+		Where(where).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: procedure,
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: procedure,
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var webhooks []DBWebhook
+	for rows.Next() {
+		var webhook DBWebhook
+		err = rows.Scan(
+			&webhook.WebhookUUID,
+			&webhook.URL,
+			&webhook.Secret,
+			&webhook.Enabled,
+			&webhook.ConsecutiveFailures,
+			&webhook.CreatedAt,
+			&webhook.DisabledAt,
+			&webhook.UserUUID,
+		)
+		if err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: procedure,
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: procedure,
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return webhooks, nil
+}
+
+// SetWebhookEnabled returns false when the user has no such webhook
+func (r *Repo) SetWebhookEnabled(ctx context.Context, userUUID, webhookUUID uuid.UUID, enabled bool) (bool, error) {
+	builder := r.sq.Update("notification_service.webhooks").
+		Set("enabled", enabled).
+		Where(squirrel.Eq{"webhook_uuid": webhookUUID, "user_uuid": userUUID})
+	if enabled {
+		builder = builder.Set("consecutive_failures", 0).Set("disabled_at", nil)
+	} else {
+		builder = builder.Set("disabled_at", squirrel.Expr("NOW()"))
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "SetWebhookEnabled",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "SetWebhookEnabled",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteWebhook returns false when the user has no such webhook
+func (r *Repo) DeleteWebhook(ctx context.Context, userUUID, webhookUUID uuid.UUID) (bool, error) {
+	query, args, err := r.sq.Delete("notification_service.webhooks").
+		Where(squirrel.Eq{"webhook_uuid": webhookUUID, "user_uuid": userUUID}).
+		ToSql()
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "DeleteWebhook",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "DeleteWebhook",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *Repo) RecordWebhookSuccess(ctx context.Context, webhookUUID uuid.UUID) error {
+	query, args, err := r.sq.Update("notification_service.webhooks").
+		Set("consecutive_failures", 0).
+		Where(squirrel.Eq{"webhook_uuid": webhookUUID}).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "RecordWebhookSuccess",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "RecordWebhookSuccess",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// RecordWebhookFailure increments the failure counter and disables the webhook once it reaches
+// disableAfter. Returns whether the webhook is disabled after the update
+func (r *Repo) RecordWebhookFailure(ctx context.Context, webhookUUID uuid.UUID, disableAfter int) (bool, error) {
+	query, args, err := r.sq.Update("notification_service.webhooks").
+		Set("consecutive_failures", squirrel.Expr("consecutive_failures + 1")).
+		Set("enabled", squirrel.Expr("enabled AND consecutive_failures + 1 < ?", disableAfter)).
+		Set("disabled_at", squirrel.Expr(
+			"CASE WHEN enabled AND consecutive_failures + 1 >= ? THEN NOW() ELSE disabled_at END",
+			disableAfter,
+		)).
+		Where(squirrel.Eq{"webhook_uuid": webhookUUID}).
+		Suffix("RETURNING NOT enabled").
+		ToSql()
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "RecordWebhookFailure",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var disabled bool
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&disabled)
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "RecordWebhookFailure",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+
+	return disabled, nil
+}
+
+func (r *Repo) CreateWebhookDelivery(ctx context.Context, delivery *DBWebhookDelivery) error {
+	query, args, err := r.sq.Insert("notification_service.webhook_deliveries").
+		Columns("delivery_uuid", "webhook_uuid", "subscription_uuid", "attempt", "status_code", "error", "succeeded", "delivered_at").
+		Values(
+			delivery.DeliveryUUID,
+			delivery.WebhookUUID,
+			delivery.SubscriptionUUID,
+			delivery.Attempt,
+			delivery.StatusCode,
+			delivery.Error,
+			delivery.Succeeded,
+			delivery.DeliveredAt,
+		).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "CreateWebhookDelivery",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "CreateWebhookDelivery",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+func (r *Repo) GetWebhookDeliveries(ctx context.Context, userUUID, webhookUUID uuid.UUID, limit uint64) ([]DBWebhookDelivery, error) {
+	query, args, err := r.sq.Select(
+		"wd.delivery_uuid",
+		"wd.webhook_uuid",
+		"wd.subscription_uuid",
+		"wd.attempt",
+		"wd.status_code",
+		"wd.error",
+		"wd.succeeded",
+		"wd.delivered_at",
+	).
+		From("notification_service.webhook_deliveries AS wd").
+		InnerJoin("notification_service.webhooks AS w ON wd.webhook_uuid = w.webhook_uuid").
+		Where(squirrel.Eq{"wd.webhook_uuid": webhookUUID, "w.user_uuid": userUUID}).
+		OrderBy("wd.delivered_at DESC").
+		Limit(limit).
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetWebhookDeliveries",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetWebhookDeliveries",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var deliveries []DBWebhookDelivery
+	for rows.Next() {
+		var delivery DBWebhookDelivery
+		err = rows.Scan(
+			&delivery.DeliveryUUID,
+			&delivery.WebhookUUID,
+			&delivery.SubscriptionUUID,
+			&delivery.Attempt,
+			&delivery.StatusCode,
+			&delivery.Error,
+			&delivery.Succeeded,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetWebhookDeliveries",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetWebhookDeliveries",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return deliveries, nil
+}
+
+// GetChannels returns channels selected by the user or nil if the user never selected any
+func (r *Repo) GetChannels(ctx context.Context, userUUID uuid.UUID) ([]Channel, error) {
+	query, args, err := r.sq.Select("channels").
+		From("notification_service.channels").
+		Where(squirrel.Eq{"user_uuid": userUUID}).
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetChannels",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var raw []string
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&raw)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetChannels",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+
+	channels := make([]Channel, len(raw))
+	for i, channel := range raw {
+		channels[i] = Channel(channel)
+	}
+
+	return channels, nil
+}
+
+func (r *Repo) SetChannels(ctx context.Context, data *DBUserChannels) error {
+	raw := make([]string, len(data.Channels))
+	for i, channel := range data.Channels {
+		raw[i] = string(channel)
+	}
+
+	query, args, err := r.sq.Insert("notification_service.channels").
+		Columns("channels", "user_uuid").
+		Values(raw, data.UserUUID).
+		Suffix("ON CONFLICT (user_uuid) DO UPDATE SET channels = EXCLUDED.channels").
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetChannels",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetChannels",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+func (r *Repo) CreateOutboxEntries(ctx context.Context, entries []DBOutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	builder := r.sq.Insert("notification_service.outbox").
+		Columns("outbox_uuid", "channel", "payload", "attempts", "created_at", "next_attempt_at", "user_uuid", "webhook_uuid")
+	for _, entry := range entries {
+		builder = builder.Values(
+			entry.OutboxUUID,
+			string(entry.Channel),
+			entry.Payload,
+			entry.Attempts,
+			entry.CreatedAt,
+			entry.NextAttemptAt,
+			entry.UserUUID,
+			entry.WebhookUUID,
+		)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "CreateOutboxEntries",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "CreateOutboxEntries",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// ClaimOutboxEntries locks up to limit pending entries that are due for delivery until lockedUntil.
+// Entries claimed by another dispatcher are skipped, entries whose lease has expired are claimed again
+func (r *Repo) ClaimOutboxEntries(ctx context.Context, limit uint64, lockedUntil time.Time) ([]DBOutboxEntry, error) {
+	pending := r.sq.Select("outbox_uuid").
+		From("notification_service.outbox").
+		Where("sent_at IS NULL AND failed_at IS NULL").
+		Where("next_attempt_at <= NOW()").
+		Where("(locked_until IS NULL OR locked_until < NOW())").
+		OrderBy("next_attempt_at").
+		Limit(limit).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	return r.claimOutboxEntries(ctx, "ClaimOutboxEntries", pending, lockedUntil)
+}
+
+// ClaimDigestOutboxEntries locks until lockedUntil the pending entries of the user, channel and webhook created
+// before createdBefore, whether they are due or not, so that they are delivered in one digest. Entries claimed
+// by another dispatcher are skipped
+func (r *Repo) ClaimDigestOutboxEntries(
+	ctx context.Context,
+	userUUID uuid.UUID,
+	channel Channel,
+	webhookUUID *uuid.UUID,
+	createdBefore time.Time,
+	lockedUntil time.Time,
+) ([]DBOutboxEntry, error) {
+	pending := r.sq.Select("outbox_uuid").
+		From("notification_service.outbox").
+		Where("sent_at IS NULL AND failed_at IS NULL").
+		Where(squirrel.Eq{"user_uuid": userUUID, "channel": string(channel), "webhook_uuid": webhookUUID}).
+		Where(squirrel.Lt{"created_at": createdBefore}).
+		Where("(locked_until IS NULL OR locked_until < NOW())").
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	return r.claimOutboxEntries(ctx, "ClaimDigestOutboxEntries", pending, lockedUntil)
+}
+
+func (r *Repo) claimOutboxEntries(
+	ctx context.Context,
+	procedure string,
+	pending squirrel.SelectBuilder,
+	lockedUntil time.Time,
+) ([]DBOutboxEntry, error) {
+	query, args, err := r.sq.Update("notification_service.outbox").
+		Set("locked_until", lockedUntil).
+		Where(squirrel.Expr("outbox_uuid IN (?)", pending)).
+		Suffix("RETURNING outbox_uuid, channel, payload, attempts, created_at, next_attempt_at, user_uuid, webhook_uuid").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: procedure,
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: procedure,
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var entries []DBOutboxEntry
+	for rows.Next() {
+		var entry DBOutboxEntry
+		var channel string
+		err = rows.Scan(
+			&entry.OutboxUUID,
+			&channel,
+			&entry.Payload,
+			&entry.Attempts,
+			&entry.CreatedAt,
+			&entry.NextAttemptAt,
+			&entry.UserUUID,
+			&entry.WebhookUUID,
+		)
+		if err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: procedure,
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		entry.Channel = Channel(channel)
+		entry.LockedUntil = &lockedUntil
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: procedure,
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return entries, nil
+}
+
+// MarkOutboxEntriesSent marks entries delivered in one message as sent. They get the same sent_at, which is
+// how GetSentOutboxStats counts them as a single message
+func (r *Repo) MarkOutboxEntriesSent(ctx context.Context, outboxUUIDs []uuid.UUID) error {
+	query, args, err := r.sq.Update("notification_service.outbox").
+		Set("attempts", squirrel.Expr("attempts + 1")).
+		Set("sent_at", squirrel.Expr("NOW()")).
+		Set("locked_until", nil).
+		Where(squirrel.Eq{"outbox_uuid": outboxUUIDs}).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "MarkOutboxEntriesSent",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "MarkOutboxEntriesSent",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// MarkOutboxEntryFailed records a failed attempt. The entry is retried at nextAttemptAt or,
+// if it is nil, marked as permanently failed
+func (r *Repo) MarkOutboxEntryFailed(ctx context.Context, outboxUUID uuid.UUID, lastError string, nextAttemptAt *time.Time) error {
+	builder := r.sq.Update("notification_service.outbox").
+		Set("attempts", squirrel.Expr("attempts + 1")).
+		Set("last_error", lastError).
+		Set("locked_until", nil).
+		Where(squirrel.Eq{"outbox_uuid": outboxUUID})
+	if nextAttemptAt != nil {
+		builder = builder.Set("next_attempt_at", *nextAttemptAt)
+	} else {
+		builder = builder.Set("failed_at", squirrel.Expr("NOW()"))
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "MarkOutboxEntryFailed",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "MarkOutboxEntryFailed",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+func (r *Repo) DeleteOutboxEntry(ctx context.Context, outboxUUID uuid.UUID) error {
+	query, args, err := r.sq.Delete("notification_service.outbox").
+		Where(squirrel.Eq{"outbox_uuid": outboxUUID}).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "DeleteOutboxEntry",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "DeleteOutboxEntry",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// PostponeOutboxEntry releases a claimed entry without counting an attempt
+func (r *Repo) PostponeOutboxEntry(ctx context.Context, outboxUUID uuid.UUID, nextAttemptAt time.Time) error {
+	query, args, err := r.sq.Update("notification_service.outbox").
+		Set("next_attempt_at", nextAttemptAt).
+		Set("locked_until", nil).
+		Where(squirrel.Eq{"outbox_uuid": outboxUUID}).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "PostponeOutboxEntry",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "PostponeOutboxEntry",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// GetSentOutboxStats returns how many messages were sent to the user through the channel since the
+// given time and when the earliest of them was sent. Entries of a digest share sent_at and count once
+func (r *Repo) GetSentOutboxStats(ctx context.Context, userUUID uuid.UUID, channel Channel, since time.Time) (int, *time.Time, error) {
+	query, args, err := r.sq.Select("COUNT(DISTINCT sent_at)", "MIN(sent_at)").
+		From("notification_service.outbox").
+		Where(squirrel.Eq{"user_uuid": userUUID, "channel": string(channel)}).
+		Where(squirrel.GtOrEq{"sent_at": since}).
+		ToSql()
+	if err != nil {
+		return 0, nil, &errors.ErrDBProcedure{
+			Procedure: "GetSentOutboxStats",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var count int
+	var earliest *time.Time
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&count, &earliest)
+	if err != nil {
+		return 0, nil, &errors.ErrDBProcedure{
+			Procedure: "GetSentOutboxStats",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+
+	return count, earliest, nil
+}
+
+// PruneOutboxEntries deletes entries sent or failed before the given time and returns how many were deleted
+func (r *Repo) PruneOutboxEntries(ctx context.Context, before time.Time) (int64, error) {
+	query, args, err := r.sq.Delete("notification_service.outbox").
+		Where(squirrel.Expr("COALESCE(sent_at, failed_at) < ?", before)).
+		ToSql()
+	if err != nil {
+		return 0, &errors.ErrDBProcedure{
+			Procedure: "PruneOutboxEntries",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, &errors.ErrDBProcedure{
+			Procedure: "PruneOutboxEntries",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return tag.RowsAffected(), nil
+}
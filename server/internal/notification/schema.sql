@@ -0,0 +1,64 @@
+create schema if not exists notification_service;
+
+create table if not exists notification_service.webhooks
+(
+    webhook_uuid         uuid        not null,
+    url                  text        not null,
+    secret               text        not null,
+    enabled              boolean     not null default true,
+    consecutive_failures int         not null default 0,
+    created_at           timestamptz not null,
+    disabled_at          timestamptz,
+    user_uuid            uuid        not null,
+    constraint webhooks_pk primary key (webhook_uuid)
+);
+
+create index if not exists webhooks_user_idx on notification_service.webhooks (user_uuid, enabled);
+
+create table if not exists notification_service.webhook_deliveries
+(
+    delivery_uuid     uuid        not null,
+    webhook_uuid      uuid        not null,
+    subscription_uuid uuid,
+    attempt           int         not null,
+    status_code       int,
+    error             text,
+    succeeded         boolean     not null,
+    delivered_at      timestamptz not null,
+    constraint webhook_deliveries_pk primary key (delivery_uuid, attempt),
+    constraint webhook_deliveries_fk foreign key (webhook_uuid) references notification_service.webhooks (webhook_uuid) match simple on delete cascade on update cascade
+);
+
+create index if not exists webhook_deliveries_webhook_idx on notification_service.webhook_deliveries (webhook_uuid, delivered_at);
+
+create table if not exists notification_service.channels
+(
+    channels  text[] not null,
+    user_uuid uuid   not null,
+    constraint channels_pk primary key (user_uuid)
+);
+
+create table if not exists notification_service.outbox
+(
+    outbox_uuid     uuid        not null,
+    channel         text        not null,
+    payload         jsonb       not null,
+    attempts        integer     not null default 0,
+    last_error      text,
+    created_at      timestamptz not null,
+    next_attempt_at timestamptz not null,
+    locked_until    timestamptz,
+    sent_at         timestamptz,
+    failed_at       timestamptz,
+    user_uuid       uuid        not null,
+    webhook_uuid    uuid,
+    constraint outbox_pk primary key (outbox_uuid),
+    -- Webhook entries are written per webhook, entries of other channels have none
+    constraint outbox_webhook_check check ((channel = 'Webhook') = (webhook_uuid is not null))
+);
+
+create index if not exists outbox_pending_idx on notification_service.outbox (next_attempt_at) where sent_at is null and failed_at is null;
+
+create index if not exists outbox_sent_idx on notification_service.outbox (user_uuid, channel, sent_at) where sent_at is not null;
+
+create index if not exists outbox_done_idx on notification_service.outbox (coalesce(sent_at, failed_at)) where sent_at is not null or failed_at is not null;
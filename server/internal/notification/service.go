@@ -0,0 +1,743 @@
+package notification
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"labgrab/internal/shared/errors"
+	"labgrab/pkg/config"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("notification-service")
+
+const defaultOutboxRetention = 7 * 24 * time.Hour
+
+type Service struct {
+	repo      Repository
+	stream    *Stream
+	notifiers map[Channel]Notifier
+	cfg       *config.OutboxConfig
+	location  *time.Location
+	logger    *zap.SugaredLogger
+}
+
+// NewService creates the service. Quiet hours and digest windows are evaluated in location
+func NewService(
+	repo Repository,
+	stream *Stream,
+	notifiers []Notifier,
+	cfg *config.OutboxConfig,
+	location *time.Location,
+	logger *zap.SugaredLogger,
+) *Service {
+	byChannel := make(map[Channel]Notifier, len(notifiers))
+	for _, notifier := range notifiers {
+		byChannel[notifier.Channel()] = notifier
+	}
+	return &Service{repo: repo, stream: stream, notifiers: byChannel, cfg: cfg, location: location, logger: logger}
+}
+
+// Enqueue writes one outbox entry per notification and channel, webhook entries are written per enabled
+// webhook of the user. Entries are delivered later by the dispatcher, so a notification is not lost if the
+// process stops before delivery. Channel selection is checked on delivery, so that changes made in between
+// are respected
+func (s *Service) Enqueue(ctx context.Context, notifications []*Notification) error {
+	ctx, span := tracer.Start(ctx, "notification.service.Enqueue")
+	defer span.End()
+
+	now := time.Now()
+	webhooks := make(map[uuid.UUID][]DBWebhook)
+	var entries []DBOutboxEntry
+	for _, n := range notifications {
+		payload, err := json.Marshal(n)
+		if err != nil {
+			err = &errors.ErrServiceProcedure{
+				Procedure: "Enqueue",
+				Step:      "Payload encoding",
+				Err:       err,
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		for channel := range s.notifiers {
+			entry := DBOutboxEntry{
+				Channel:       channel,
+				Payload:       payload,
+				Attempts:      0,
+				CreatedAt:     now,
+				NextAttemptAt: now,
+				UserUUID:      n.UserUUID,
+			}
+			if channel != ChannelWebhook {
+				entry.OutboxUUID = uuid.New()
+				entries = append(entries, entry)
+				continue
+			}
+
+			userWebhooks, ok := webhooks[n.UserUUID]
+			if !ok {
+				userWebhooks, err = s.repo.GetEnabledWebhooks(ctx, n.UserUUID)
+				if err != nil {
+					err = &errors.ErrServiceProcedure{
+						Procedure: "Enqueue",
+						Step:      "Repository call",
+						Err:       err,
+					}
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+					return err
+				}
+				webhooks[n.UserUUID] = userWebhooks
+			}
+			for _, webhook := range userWebhooks {
+				entry.OutboxUUID = uuid.New()
+				entry.WebhookUUID = &webhook.WebhookUUID
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	if err := s.repo.CreateOutboxEntries(ctx, entries); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "Enqueue",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ClaimOutbox returns a batch of due outbox entries. Claimed entries are hidden from other
+// dispatchers for the configured lease
+func (s *Service) ClaimOutbox(ctx context.Context) ([]OutboxEntry, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.ClaimOutbox")
+	defer span.End()
+
+	entries, err := s.repo.ClaimOutboxEntries(ctx, s.cfg.BatchSize, time.Now().Add(s.cfg.Lease))
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "ClaimOutbox",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return s.decodeOutboxEntries(ctx, entries), nil
+}
+
+// decodeOutboxEntries decodes payloads of claimed entries. Entries with an invalid payload fail permanently
+func (s *Service) decodeOutboxEntries(ctx context.Context, entries []DBOutboxEntry) []OutboxEntry {
+	result := make([]OutboxEntry, 0, len(entries))
+	for _, entry := range entries {
+		var n Notification
+		if err := json.Unmarshal(entry.Payload, &n); err != nil {
+			s.logger.Errorw("error decoding outbox entry", "outbox_uuid", entry.OutboxUUID, "error", err)
+			s.recordFailure(ctx, entry.OutboxUUID, entry.Attempts, fmt.Errorf("invalid payload: %w", err), true)
+			continue
+		}
+		result = append(result, OutboxEntry{
+			OutboxUUID:   entry.OutboxUUID,
+			Channel:      entry.Channel,
+			WebhookUUID:  entry.WebhookUUID,
+			Attempts:     entry.Attempts,
+			CreatedAt:    entry.CreatedAt,
+			Notification: &n,
+		})
+	}
+	return result
+}
+
+// Deliver sends a claimed entry through its channel and records the outcome. Entries for channels the
+// user has not selected, or other than the preferred one, are dropped. Entries that fall into quiet hours
+// or exceed the hourly limit are postponed without counting an attempt. Failed entries are retried with
+// exponential backoff until the attempts are exhausted. The digest interval is not checked, entries of
+// users that receive digests go through DeliverDigest
+func (s *Service) Deliver(ctx context.Context, entry *OutboxEntry, preferences *Preferences) (DeliveryOutcome, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.Deliver")
+	defer span.End()
+
+	if preferences == nil {
+		preferences = &DefaultPreferences
+	}
+
+	notifier, ok := s.notifiers[entry.Channel]
+	if !ok {
+		err := fmt.Errorf("unknown channel %s", entry.Channel)
+		s.recordFailure(ctx, entry.OutboxUUID, entry.Attempts, err, true)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return DeliveryFailed, err
+	}
+
+	channels, err := s.userChannels(ctx, entry.Notification.UserUUID, preferences)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "Deliver",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return DeliveryFailed, err
+	}
+	if !slices.Contains(channels, entry.Channel) {
+		if err := s.repo.DeleteOutboxEntry(ctx, entry.OutboxUUID); err != nil {
+			err = &errors.ErrServiceProcedure{
+				Procedure: "Deliver",
+				Step:      "Repository call",
+				Err:       err,
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return DeliveryFailed, err
+		}
+		return DeliverySkipped, nil
+	}
+
+	postponeUntil, err := s.postponeUntil(ctx, entry.Notification.UserUUID, entry.Channel, preferences)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "Deliver",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return DeliveryFailed, err
+	}
+	if !postponeUntil.IsZero() {
+		if err := s.repo.PostponeOutboxEntry(ctx, entry.OutboxUUID, postponeUntil); err != nil {
+			err = &errors.ErrServiceProcedure{
+				Procedure: "Deliver",
+				Step:      "Repository call",
+				Err:       err,
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return DeliveryFailed, err
+		}
+		return DeliveryPostponed, nil
+	}
+
+	entry.Notification.Delivery = Delivery{
+		UUID:        entry.OutboxUUID,
+		Attempt:     entry.Attempts + 1,
+		WebhookUUID: entry.WebhookUUID,
+	}
+	if err := notifier.Notify(ctx, entry.Notification); err != nil {
+		s.recordFailure(ctx, entry.OutboxUUID, entry.Attempts, err, false)
+		err = &errors.ErrServiceProcedure{
+			Procedure: "Deliver",
+			Step:      "Notifier call",
+			Err:       fmt.Errorf("%s: %w", entry.Channel, err),
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return DeliveryFailed, err
+	}
+
+	if err := s.repo.MarkOutboxEntriesSent(ctx, []uuid.UUID{entry.OutboxUUID}); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "Deliver",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return DeliveryFailed, err
+	}
+
+	return DeliverySent, nil
+}
+
+// DeliverDigest delivers claimed entries of one user, channel and webhook according to the digest interval of the
+// preferences. Entries whose digest window is still open are postponed to its end. Entries of closed windows,
+// together with the other pending entries of the user and channel created before the end of the latest of
+// them, are sent as one KindDigest notification. Channel selection, quiet hours and the hourly limit are
+// applied as in Deliver, a digest counts as one message. Returns the outcome of every entry
+func (s *Service) DeliverDigest(ctx context.Context, entries []OutboxEntry, preferences *Preferences) (map[DeliveryOutcome]int, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.DeliverDigest")
+	defer span.End()
+
+	outcomes := make(map[DeliveryOutcome]int)
+	if len(entries) == 0 {
+		return outcomes, nil
+	}
+	if preferences == nil || preferences.DigestInterval <= 0 {
+		err := fmt.Errorf("digest interval is not set")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return outcomes, err
+	}
+	channel := entries[0].Channel
+	webhookUUID := entries[0].WebhookUUID
+	userUUID := entries[0].Notification.UserUUID
+
+	fail := func(err error) (map[DeliveryOutcome]int, error) {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "DeliverDigest",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return outcomes, err
+	}
+
+	notifier, ok := s.notifiers[channel]
+	if !ok {
+		err := fmt.Errorf("unknown channel %s", channel)
+		for _, entry := range entries {
+			s.recordFailure(ctx, entry.OutboxUUID, entry.Attempts, err, true)
+		}
+		outcomes[DeliveryFailed] += len(entries)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return outcomes, err
+	}
+
+	channels, err := s.userChannels(ctx, userUUID, preferences)
+	if err != nil {
+		return fail(err)
+	}
+	if !slices.Contains(channels, channel) {
+		for _, entry := range entries {
+			if err := s.repo.DeleteOutboxEntry(ctx, entry.OutboxUUID); err != nil {
+				return fail(err)
+			}
+			outcomes[DeliverySkipped]++
+		}
+		return outcomes, nil
+	}
+
+	now := time.Now().In(s.location)
+	var due []OutboxEntry
+	var windowEnd time.Time
+	for _, entry := range entries {
+		at := digestAt(entry.CreatedAt.In(s.location), preferences.DigestInterval)
+		if at.After(now) {
+			if err := s.repo.PostponeOutboxEntry(ctx, entry.OutboxUUID, at); err != nil {
+				return fail(err)
+			}
+			outcomes[DeliveryPostponed]++
+			continue
+		}
+		due = append(due, entry)
+		if at.After(windowEnd) {
+			windowEnd = at
+		}
+	}
+	if len(due) == 0 {
+		return outcomes, nil
+	}
+
+	// The batch may hold only a part of a digest, the rest is claimed here so that it is not sent separately
+	rest, err := s.repo.ClaimDigestOutboxEntries(ctx, userUUID, channel, webhookUUID, windowEnd, time.Now().Add(s.cfg.Lease))
+	if err != nil {
+		return fail(err)
+	}
+	for _, entry := range s.decodeOutboxEntries(ctx, rest) {
+		entry.Notification.Contacts = entries[0].Notification.Contacts
+		due = append(due, entry)
+	}
+	slices.SortStableFunc(due, func(a, b OutboxEntry) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	postponeUntil, err := s.postponeUntil(ctx, userUUID, channel, preferences)
+	if err != nil {
+		return fail(err)
+	}
+	if !postponeUntil.IsZero() {
+		for _, entry := range due {
+			if err := s.repo.PostponeOutboxEntry(ctx, entry.OutboxUUID, postponeUntil); err != nil {
+				return fail(err)
+			}
+			outcomes[DeliveryPostponed]++
+		}
+		return outcomes, nil
+	}
+
+	digest := &Notification{
+		Kind:      KindDigest,
+		UserUUID:  userUUID,
+		CreatedAt: time.Now(),
+		Digest:    make([]*Notification, len(due)),
+		Contacts:  entries[0].Notification.Contacts,
+	}
+	outboxUUIDs := make([]uuid.UUID, len(due))
+	var deliveryID []byte
+	for i, entry := range due {
+		digest.Digest[i] = entry.Notification
+		outboxUUIDs[i] = entry.OutboxUUID
+		deliveryID = append(deliveryID, entry.OutboxUUID[:]...)
+		digest.Delivery.Attempt = max(digest.Delivery.Attempt, entry.Attempts+1)
+	}
+	// A retry of the same entries is the same delivery
+	digest.Delivery.UUID = uuid.NewSHA1(uuid.NameSpaceOID, deliveryID)
+	digest.Delivery.WebhookUUID = webhookUUID
+
+	if err := notifier.Notify(ctx, digest); err != nil {
+		for _, entry := range due {
+			s.recordFailure(ctx, entry.OutboxUUID, entry.Attempts, err, false)
+		}
+		outcomes[DeliveryFailed] += len(due)
+		err = &errors.ErrServiceProcedure{
+			Procedure: "DeliverDigest",
+			Step:      "Notifier call",
+			Err:       fmt.Errorf("%s: %w", channel, err),
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return outcomes, err
+	}
+
+	if err := s.repo.MarkOutboxEntriesSent(ctx, outboxUUIDs); err != nil {
+		return fail(err)
+	}
+	outcomes[DeliverySent] += len(due)
+
+	return outcomes, nil
+}
+
+// postponeUntil returns when a message to the user through the channel may be delivered according to the
+// quiet hours and the hourly limit of the preferences, or zero time if it may be delivered now
+func (s *Service) postponeUntil(ctx context.Context, userUUID uuid.UUID, channel Channel, preferences *Preferences) (time.Time, error) {
+	now := time.Now().In(s.location)
+
+	if preferences.QuietHours != nil {
+		if until := preferences.QuietHours.quietUntil(now); !until.IsZero() {
+			return until, nil
+		}
+	}
+
+	if preferences.MaxPerHour > 0 {
+		sent, earliest, err := s.repo.GetSentOutboxStats(ctx, userUUID, channel, now.Add(-time.Hour))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if sent >= preferences.MaxPerHour && earliest != nil {
+			return earliest.Add(time.Hour), nil
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// PruneOutbox deletes entries sent or failed longer than the retention ago, returns how many were deleted
+func (s *Service) PruneOutbox(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.PruneOutbox")
+	defer span.End()
+
+	retention := s.cfg.Retention
+	if retention <= 0 {
+		retention = defaultOutboxRetention
+	}
+	pruned, err := s.repo.PruneOutboxEntries(ctx, time.Now().Add(-max(retention, time.Hour)))
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "PruneOutbox",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+func (s *Service) userChannels(ctx context.Context, userUUID uuid.UUID, preferences *Preferences) ([]Channel, error) {
+	if preferences != nil && preferences.PreferredChannel != nil {
+		return []Channel{*preferences.PreferredChannel}, nil
+	}
+
+	channels, err := s.repo.GetChannels(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	if channels == nil {
+		channels = DefaultChannels
+	}
+
+	return channels, nil
+}
+
+func (s *Service) recordFailure(ctx context.Context, outboxUUID uuid.UUID, attempts int, cause error, permanent bool) {
+	var nextAttemptAt *time.Time
+	if !permanent && attempts+1 < s.cfg.MaxAttempts {
+		backoff := s.cfg.InitialBackoff
+		for range attempts {
+			backoff = min(backoff*2, s.cfg.MaxBackoff)
+		}
+		next := time.Now().Add(backoff)
+		nextAttemptAt = &next
+	}
+
+	if err := s.repo.MarkOutboxEntryFailed(ctx, outboxUUID, cause.Error(), nextAttemptAt); err != nil {
+		s.logger.Errorw("error recording outbox failure", "outbox_uuid", outboxUUID, "error", err)
+		return
+	}
+	if nextAttemptAt == nil {
+		s.logger.Warnw("outbox entry failed permanently", "outbox_uuid", outboxUUID, "attempts", attempts+1, "error", cause)
+	}
+}
+
+func (s *Service) SubscribeEvents(ctx context.Context, req *SubscribeEventsReq) (<-chan StreamEvent, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.SubscribeEvents")
+	defer span.End()
+
+	events, err := s.stream.Subscribe(ctx, req.UserUUID, req.LastEventID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "SubscribeEvents",
+			Step:      "Stream subscription",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s *Service) GetChannels(ctx context.Context, userUUID uuid.UUID) ([]Channel, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.GetChannels")
+	defer span.End()
+
+	channels, err := s.repo.GetChannels(ctx, userUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetChannels",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if channels == nil {
+		channels = DefaultChannels
+	}
+
+	return channels, nil
+}
+
+func (s *Service) UpdateChannels(ctx context.Context, req *UpdateChannelsReq) error {
+	ctx, span := tracer.Start(ctx, "notification.service.UpdateChannels")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	err := s.repo.SetChannels(ctx, &DBUserChannels{
+		Channels: req.Channels,
+		UserUUID: req.UserUUID,
+	})
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "UpdateChannels",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, req *CreateWebhookReq) (*CreateWebhookRes, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.CreateWebhook")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if err := validateWebhookAddrs(ctx, req.URL); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "CreateWebhook",
+			Step:      "Secret generation",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	webhook := &DBWebhook{
+		WebhookUUID:         uuid.New(),
+		URL:                 req.URL,
+		Secret:              secret,
+		Enabled:             true,
+		ConsecutiveFailures: 0,
+		CreatedAt:           time.Now(),
+		UserUUID:            req.UserUUID,
+	}
+
+	if err := s.repo.CreateWebhook(ctx, webhook); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "CreateWebhook",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &CreateWebhookRes{
+		WebhookUUID: webhook.WebhookUUID,
+		Secret:      webhook.Secret,
+	}, nil
+}
+
+func (s *Service) GetWebhooks(ctx context.Context, userUUID uuid.UUID) ([]GetWebhookRes, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.GetWebhooks")
+	defer span.End()
+
+	webhooks, err := s.repo.GetWebhooks(ctx, userUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetWebhooks",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]GetWebhookRes, len(webhooks))
+	for i, webhook := range webhooks {
+		result[i] = GetWebhookRes{
+			WebhookUUID:         webhook.WebhookUUID,
+			URL:                 webhook.URL,
+			Enabled:             webhook.Enabled,
+			ConsecutiveFailures: webhook.ConsecutiveFailures,
+			CreatedAt:           webhook.CreatedAt,
+			DisabledAt:          webhook.DisabledAt,
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Service) UpdateWebhook(ctx context.Context, req *UpdateWebhookReq) error {
+	ctx, span := tracer.Start(ctx, "notification.service.UpdateWebhook")
+	defer span.End()
+
+	found, err := s.repo.SetWebhookEnabled(ctx, req.UserUUID, req.WebhookUUID, req.Enabled)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "UpdateWebhook",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if !found {
+		span.RecordError(ErrWebhookNotFound)
+		span.SetStatus(codes.Error, ErrWebhookNotFound.Error())
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, userUUID, webhookUUID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "notification.service.DeleteWebhook")
+	defer span.End()
+
+	found, err := s.repo.DeleteWebhook(ctx, userUUID, webhookUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "DeleteWebhook",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if !found {
+		span.RecordError(ErrWebhookNotFound)
+		span.SetStatus(codes.Error, ErrWebhookNotFound.Error())
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) GetWebhookDeliveries(ctx context.Context, req *GetWebhookDeliveriesReq) ([]GetWebhookDeliveryRes, error) {
+	ctx, span := tracer.Start(ctx, "notification.service.GetWebhookDeliveries")
+	defer span.End()
+
+	deliveries, err := s.repo.GetWebhookDeliveries(ctx, req.UserUUID, req.WebhookUUID, req.Limit)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetWebhookDeliveries",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]GetWebhookDeliveryRes, len(deliveries))
+	for i, delivery := range deliveries {
+		result[i] = GetWebhookDeliveryRes{
+			DeliveryUUID:     delivery.DeliveryUUID,
+			SubscriptionUUID: delivery.SubscriptionUUID,
+			Attempt:          delivery.Attempt,
+			StatusCode:       delivery.StatusCode,
+			Error:            delivery.Error,
+			Succeeded:        delivery.Succeeded,
+			DeliveredAt:      delivery.DeliveredAt,
+		}
+	}
+
+	return result, nil
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,439 @@
+package notification_test
+
+import (
+	"context"
+	"encoding/json"
+	"labgrab/internal/notification"
+	"labgrab/internal/shared/types"
+	"labgrab/pkg/config"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fakeRepo keeps the outbox and webhooks in memory
+type fakeRepo struct {
+	mu         sync.Mutex
+	outbox     map[uuid.UUID]*notification.DBOutboxEntry
+	webhooks   map[uuid.UUID]*notification.DBWebhook
+	deliveries []notification.DBWebhookDelivery
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		outbox:   make(map[uuid.UUID]*notification.DBOutboxEntry),
+		webhooks: make(map[uuid.UUID]*notification.DBWebhook),
+	}
+}
+
+func (r *fakeRepo) CreateWebhook(ctx context.Context, webhook *notification.DBWebhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *webhook
+	r.webhooks[webhook.WebhookUUID] = &stored
+	return nil
+}
+
+func (r *fakeRepo) GetWebhooks(ctx context.Context, userUUID uuid.UUID) ([]notification.DBWebhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []notification.DBWebhook
+	for _, webhook := range r.webhooks {
+		if webhook.UserUUID == userUUID {
+			result = append(result, *webhook)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeRepo) GetEnabledWebhooks(ctx context.Context, userUUID uuid.UUID) ([]notification.DBWebhook, error) {
+	webhooks, _ := r.GetWebhooks(ctx, userUUID)
+	return slices.DeleteFunc(webhooks, func(webhook notification.DBWebhook) bool { return !webhook.Enabled }), nil
+}
+
+func (r *fakeRepo) SetWebhookEnabled(ctx context.Context, userUUID, webhookUUID uuid.UUID, enabled bool) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook, ok := r.webhooks[webhookUUID]
+	if !ok || webhook.UserUUID != userUUID {
+		return false, nil
+	}
+	webhook.Enabled = enabled
+	return true, nil
+}
+
+func (r *fakeRepo) DeleteWebhook(ctx context.Context, userUUID, webhookUUID uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook, ok := r.webhooks[webhookUUID]
+	if !ok || webhook.UserUUID != userUUID {
+		return false, nil
+	}
+	delete(r.webhooks, webhookUUID)
+	return true, nil
+}
+
+func (r *fakeRepo) RecordWebhookSuccess(ctx context.Context, webhookUUID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if webhook, ok := r.webhooks[webhookUUID]; ok {
+		webhook.ConsecutiveFailures = 0
+	}
+	return nil
+}
+
+func (r *fakeRepo) RecordWebhookFailure(ctx context.Context, webhookUUID uuid.UUID, disableAfter int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook, ok := r.webhooks[webhookUUID]
+	if !ok {
+		return false, nil
+	}
+	webhook.ConsecutiveFailures++
+	if webhook.Enabled && disableAfter > 0 && webhook.ConsecutiveFailures >= disableAfter {
+		now := time.Now()
+		webhook.Enabled = false
+		webhook.DisabledAt = &now
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *fakeRepo) CreateWebhookDelivery(ctx context.Context, delivery *notification.DBWebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, *delivery)
+	return nil
+}
+
+func (r *fakeRepo) GetWebhookDeliveries(ctx context.Context, userUUID, webhookUUID uuid.UUID, limit uint64) ([]notification.DBWebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []notification.DBWebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookUUID == webhookUUID {
+			result = append(result, delivery)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeRepo) GetChannels(ctx context.Context, userUUID uuid.UUID) ([]notification.Channel, error) {
+	return nil, nil
+}
+
+func (r *fakeRepo) SetChannels(ctx context.Context, data *notification.DBUserChannels) error {
+	return nil
+}
+
+func (r *fakeRepo) CreateOutboxEntries(ctx context.Context, entries []notification.DBOutboxEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, entry := range entries {
+		stored := entry
+		r.outbox[entry.OutboxUUID] = &stored
+	}
+	return nil
+}
+
+func (r *fakeRepo) ClaimOutboxEntries(ctx context.Context, limit uint64, lockedUntil time.Time) ([]notification.DBOutboxEntry, error) {
+	now := time.Now()
+	return r.claim(lockedUntil, limit, func(entry *notification.DBOutboxEntry) bool {
+		return !entry.NextAttemptAt.After(now)
+	}), nil
+}
+
+func (r *fakeRepo) ClaimDigestOutboxEntries(
+	ctx context.Context,
+	userUUID uuid.UUID,
+	channel notification.Channel,
+	webhookUUID *uuid.UUID,
+	createdBefore, lockedUntil time.Time,
+) ([]notification.DBOutboxEntry, error) {
+	return r.claim(lockedUntil, 0, func(entry *notification.DBOutboxEntry) bool {
+		sameWebhook := (entry.WebhookUUID == nil) == (webhookUUID == nil) &&
+			(webhookUUID == nil || *entry.WebhookUUID == *webhookUUID)
+		return entry.UserUUID == userUUID && entry.Channel == channel && sameWebhook && entry.CreatedAt.Before(createdBefore)
+	}), nil
+}
+
+// claim leases up to limit pending entries that match, oldest first. Zero limit claims every entry
+func (r *fakeRepo) claim(lockedUntil time.Time, limit uint64, match func(*notification.DBOutboxEntry) bool) []notification.DBOutboxEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var result []notification.DBOutboxEntry
+	for _, entry := range r.outbox {
+		if entry.SentAt != nil || entry.FailedAt != nil || (entry.LockedUntil != nil && entry.LockedUntil.After(now)) {
+			continue
+		}
+		if !match(entry) {
+			continue
+		}
+		result = append(result, *entry)
+	}
+	slices.SortFunc(result, func(a, b notification.DBOutboxEntry) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	if limit > 0 && uint64(len(result)) > limit {
+		result = result[:limit]
+	}
+	for i := range result {
+		r.outbox[result[i].OutboxUUID].LockedUntil = &lockedUntil
+		result[i].LockedUntil = &lockedUntil
+	}
+	return result
+}
+
+func (r *fakeRepo) MarkOutboxEntriesSent(ctx context.Context, outboxUUIDs []uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, outboxUUID := range outboxUUIDs {
+		if entry, ok := r.outbox[outboxUUID]; ok {
+			entry.Attempts++
+			entry.SentAt = &now
+			entry.LockedUntil = nil
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepo) MarkOutboxEntryFailed(ctx context.Context, outboxUUID uuid.UUID, lastError string, nextAttemptAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.outbox[outboxUUID]
+	if !ok {
+		return nil
+	}
+	entry.Attempts++
+	entry.LastError = &lastError
+	entry.LockedUntil = nil
+	if nextAttemptAt != nil {
+		entry.NextAttemptAt = *nextAttemptAt
+	} else {
+		now := time.Now()
+		entry.FailedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeRepo) DeleteOutboxEntry(ctx context.Context, outboxUUID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.outbox, outboxUUID)
+	return nil
+}
+
+func (r *fakeRepo) PostponeOutboxEntry(ctx context.Context, outboxUUID uuid.UUID, nextAttemptAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.outbox[outboxUUID]; ok {
+		entry.NextAttemptAt = nextAttemptAt
+		entry.LockedUntil = nil
+	}
+	return nil
+}
+
+func (r *fakeRepo) GetSentOutboxStats(ctx context.Context, userUUID uuid.UUID, channel notification.Channel, since time.Time) (int, *time.Time, error) {
+	return 0, nil, nil
+}
+
+func (r *fakeRepo) PruneOutboxEntries(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pruned int64
+	for outboxUUID, entry := range r.outbox {
+		done := entry.SentAt
+		if done == nil {
+			done = entry.FailedAt
+		}
+		if done != nil && done.Before(before) {
+			delete(r.outbox, outboxUUID)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// sent returns the outbox entries marked as sent
+func (r *fakeRepo) sent() []notification.DBOutboxEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []notification.DBOutboxEntry
+	for _, entry := range r.outbox {
+		if entry.SentAt != nil {
+			result = append(result, *entry)
+		}
+	}
+	return result
+}
+
+// fakeNotifier records the notifications it delivered
+type fakeNotifier struct {
+	channel  notification.Channel
+	mu       sync.Mutex
+	received []*notification.Notification
+}
+
+func (n *fakeNotifier) Channel() notification.Channel {
+	return n.channel
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, notif *notification.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.received = append(n.received, notif)
+	return nil
+}
+
+func newTestOutboxEntry(t *testing.T, userUUID uuid.UUID, createdAt time.Time, labNumber int) notification.DBOutboxEntry {
+	t.Helper()
+
+	payload, err := json.Marshal(&notification.Notification{
+		Kind:              notification.KindSlotsOpen,
+		UserUUID:          userUUID,
+		SubscriptionUUID:  uuid.New(),
+		LabTopic:          "Optics",
+		LabNumber:         labNumber,
+		MatchingTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+		CreatedAt:         createdAt,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+
+	return notification.DBOutboxEntry{
+		OutboxUUID:    uuid.New(),
+		Channel:       notification.ChannelStream,
+		Payload:       payload,
+		CreatedAt:     createdAt,
+		NextAttemptAt: createdAt,
+		UserUUID:      userUUID,
+	}
+}
+
+func TestServiceDeliverDigestCombinesEntries(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	notifier := &fakeNotifier{channel: notification.ChannelStream}
+	svc := notification.NewService(repo, nil, []notification.Notifier{notifier}, &config.OutboxConfig{
+		BatchSize:      2,
+		Lease:          time.Minute,
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+	}, time.UTC, zap.NewNop().Sugar())
+
+	// Three matches within a closed window, only two of them fit into the claimed batch
+	userUUID := uuid.New()
+	windowStart := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	var entries []notification.DBOutboxEntry
+	for i := range 3 {
+		entries = append(entries, newTestOutboxEntry(t, userUUID, windowStart.Add(time.Duration(i)*time.Minute), i+1))
+	}
+	if err := repo.CreateOutboxEntries(ctx, entries); err != nil {
+		t.Fatalf("CreateOutboxEntries() error = %v", err)
+	}
+
+	claimed, err := svc.ClaimOutbox(ctx)
+	if err != nil {
+		t.Fatalf("ClaimOutbox() error = %v", err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("ClaimOutbox() claimed %d entries, want 2", len(claimed))
+	}
+
+	outcomes, err := svc.DeliverDigest(ctx, claimed, &notification.Preferences{DigestInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("DeliverDigest() error = %v", err)
+	}
+	if outcomes[notification.DeliverySent] != 3 {
+		t.Errorf("DeliverDigest() outcomes = %v, want 3 sent", outcomes)
+	}
+
+	if len(notifier.received) != 1 {
+		t.Fatalf("notifier received %d notifications, want 1", len(notifier.received))
+	}
+	digest := notifier.received[0]
+	if digest.Kind != notification.KindDigest || digest.UserUUID != userUUID {
+		t.Errorf("notification kind = %s, user = %s, want a digest for %s", digest.Kind, digest.UserUUID, userUUID)
+	}
+	var numbers []int
+	for _, item := range digest.Digest {
+		numbers = append(numbers, item.LabNumber)
+	}
+	if !slices.Equal(numbers, []int{1, 2, 3}) {
+		t.Errorf("digest lab numbers = %v, want [1 2 3] in creation order", numbers)
+	}
+	if sent := repo.sent(); len(sent) != 3 {
+		t.Errorf("%d outbox entries are marked as sent, want 3", len(sent))
+	}
+}
+
+func TestServiceDeliverDigestPostponesOpenWindow(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	notifier := &fakeNotifier{channel: notification.ChannelStream}
+	svc := notification.NewService(repo, nil, []notification.Notifier{notifier}, &config.OutboxConfig{
+		BatchSize: 10,
+		Lease:     time.Minute,
+	}, time.UTC, zap.NewNop().Sugar())
+
+	userUUID := uuid.New()
+	entry := newTestOutboxEntry(t, userUUID, time.Now(), 1)
+	if err := repo.CreateOutboxEntries(ctx, []notification.DBOutboxEntry{entry}); err != nil {
+		t.Fatalf("CreateOutboxEntries() error = %v", err)
+	}
+	claimed, err := svc.ClaimOutbox(ctx)
+	if err != nil {
+		t.Fatalf("ClaimOutbox() error = %v", err)
+	}
+
+	outcomes, err := svc.DeliverDigest(ctx, claimed, &notification.Preferences{DigestInterval: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("DeliverDigest() error = %v", err)
+	}
+	if outcomes[notification.DeliveryPostponed] != 1 {
+		t.Errorf("DeliverDigest() outcomes = %v, want 1 postponed", outcomes)
+	}
+	if len(notifier.received) != 0 {
+		t.Errorf("notifier received %d notifications before the window closed", len(notifier.received))
+	}
+}
+
+func TestServicePruneOutbox(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := notification.NewService(repo, nil, nil, &config.OutboxConfig{}, time.UTC, zap.NewNop().Sugar())
+
+	userUUID := uuid.New()
+	old, recent, pending := time.Now().Add(-8*24*time.Hour), time.Now().Add(-time.Hour), time.Now()
+	entries := []notification.DBOutboxEntry{
+		newTestOutboxEntry(t, userUUID, old, 1),
+		newTestOutboxEntry(t, userUUID, old, 2),
+		newTestOutboxEntry(t, userUUID, recent, 3),
+		newTestOutboxEntry(t, userUUID, pending, 4),
+	}
+	entries[0].SentAt = &old
+	entries[1].FailedAt = &old
+	entries[2].SentAt = &recent
+	if err := repo.CreateOutboxEntries(ctx, entries); err != nil {
+		t.Fatalf("CreateOutboxEntries() error = %v", err)
+	}
+
+	// Retention is unset, so entries older than the default of 7 days are pruned
+	pruned, err := svc.PruneOutbox(ctx)
+	if err != nil {
+		t.Fatalf("PruneOutbox() error = %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("PruneOutbox() = %d, want 2", pruned)
+	}
+	if len(repo.outbox) != 2 {
+		t.Errorf("%d entries are left, want the recent and the pending one", len(repo.outbox))
+	}
+}
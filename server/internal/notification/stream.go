@@ -0,0 +1,183 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"labgrab/pkg/config"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream publishes notifications to a short per-user redis stream and fans them out
+// to every API replica through redis pub/sub
+type Stream struct {
+	cache *redis.Client
+	cfg   *config.StreamConfig
+}
+
+func NewStream(cache *redis.Client, cfg *config.StreamConfig) *Stream {
+	return &Stream{cache: cache, cfg: cfg}
+}
+
+func (s *Stream) Channel() Channel {
+	return ChannelStream
+}
+
+func (s *Stream) Notify(ctx context.Context, n *Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	event := n.Kind.Event()
+	streamKey := s.streamKey(n.UserUUID)
+	id, err := s.cache.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		MaxLen: s.cfg.Backlog,
+		Approx: true,
+		Values: map[string]any{"event": event, "data": data},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to append to stream: %w", err)
+	}
+
+	message, err := json.Marshal(streamMessage{ID: id, Event: event, Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream message: %w", err)
+	}
+
+	_, err = s.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, streamKey, s.cfg.Retention)
+		pipe.Publish(ctx, s.channelKey(n.UserUUID), message)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish stream message: %w", err)
+	}
+
+	return nil
+}
+
+// Subscribe returns live events for the user. If lastEventID is set, events from the backlog
+// that come after it are replayed first. The channel is closed when ctx is done
+func (s *Stream) Subscribe(ctx context.Context, userUUID uuid.UUID, lastEventID string) (<-chan StreamEvent, error) {
+	if _, _, err := parseStreamID(lastEventID); err != nil {
+		lastEventID = ""
+	}
+
+	// Subscribing before reading the backlog guarantees that nothing published in between is lost.
+	// Duplicates are filtered out by comparing ids below
+	pubsub := s.cache.Subscribe(ctx, s.channelKey(userUUID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to channel: %w", err)
+	}
+
+	var backlog []StreamEvent
+	if lastEventID != "" {
+		entries, err := s.cache.XRange(ctx, s.streamKey(userUUID), "("+lastEventID, "+").Result()
+		if err != nil {
+			pubsub.Close()
+			return nil, fmt.Errorf("failed to read stream backlog: %w", err)
+		}
+		for _, entry := range entries {
+			event, ok := entry.Values["event"].(string)
+			if !ok {
+				continue
+			}
+			data, ok := entry.Values["data"].(string)
+			if !ok {
+				continue
+			}
+			backlog = append(backlog, StreamEvent{ID: entry.ID, Event: event, Data: []byte(data)})
+		}
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer func() {
+			pubsub.Close()
+			close(events)
+		}()
+
+		lastID := lastEventID
+		for _, event := range backlog {
+			select {
+			case events <- event:
+				lastID = event.ID
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var message streamMessage
+				if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
+					continue
+				}
+				if lastID != "" && !streamIDAfter(message.ID, lastID) {
+					continue
+				}
+				select {
+				case events <- StreamEvent{ID: message.ID, Event: message.Event, Data: message.Data}:
+					lastID = message.ID
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func (s *Stream) streamKey(userUUID uuid.UUID) string {
+	return fmt.Sprintf("%s:stream:%s", s.cfg.KeyPrefix, userUUID.String())
+}
+
+func (s *Stream) channelKey(userUUID uuid.UUID) string {
+	return fmt.Sprintf("%s:channel:%s", s.cfg.KeyPrefix, userUUID.String())
+}
+
+func parseStreamID(id string) (uint64, uint64, error) {
+	ms, seq, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid stream id %q", id)
+	}
+	msPart, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream id %q: %w", id, err)
+	}
+	seqPart, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream id %q: %w", id, err)
+	}
+	return msPart, seqPart, nil
+}
+
+func streamIDAfter(id, other string) bool {
+	idMs, idSeq, err := parseStreamID(id)
+	if err != nil {
+		return false
+	}
+	otherMs, otherSeq, err := parseStreamID(other)
+	if err != nil {
+		return true
+	}
+	if idMs != otherMs {
+		return idMs > otherMs
+	}
+	return idSeq > otherSeq
+}
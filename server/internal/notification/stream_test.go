@@ -0,0 +1,216 @@
+package notification_test
+
+import (
+	"context"
+	"encoding/json"
+	"labgrab/internal/notification"
+	"labgrab/internal/shared/redistest"
+	"labgrab/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestStream returns a stream under a key prefix unique to the test
+func newTestStream(t *testing.T) (*redis.Client, *notification.Stream, *config.StreamConfig) {
+	t.Helper()
+
+	cache, prefix := redistest.New(t)
+	cfg := &config.StreamConfig{
+		KeyPrefix: prefix,
+		Backlog:   100,
+		Retention: time.Hour,
+	}
+	return cache, notification.NewStream(cache, cfg), cfg
+}
+
+// notifyStream publishes a notification for the user and returns the stream id it got
+func notifyStream(t *testing.T, cache *redis.Client, stream *notification.Stream, cfg *config.StreamConfig, userUUID uuid.UUID) string {
+	t.Helper()
+	ctx := context.Background()
+	if err := stream.Notify(ctx, &notification.Notification{
+		Kind:             notification.KindSlotsOpen,
+		UserUUID:         userUUID,
+		SubscriptionUUID: uuid.New(),
+		CreatedAt:        time.Now(),
+	}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	entries, err := cache.XRevRangeN(ctx, cfg.KeyPrefix+":stream:"+userUUID.String(), "+", "-", 1).Result()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("failed to read the stream entry: %v", err)
+	}
+	return entries[0].ID
+}
+
+// receiveStream returns the ids of the next n events, failing the test if they do not arrive in time
+func receiveStream(t *testing.T, events <-chan notification.StreamEvent, n int) []string {
+	t.Helper()
+	var ids []string
+	for range n {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed after %v, want %d events", ids, n)
+			}
+			var data notification.Notification
+			if err := json.Unmarshal(event.Data, &data); err != nil {
+				t.Fatalf("invalid event data: %v", err)
+			}
+			ids = append(ids, event.ID)
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want %d events", ids, n)
+		}
+	}
+	return ids
+}
+
+// expectNoStreamEvent fails the test if an event arrives shortly
+func expectNoStreamEvent(t *testing.T, events <-chan notification.StreamEvent) {
+	t.Helper()
+	select {
+	case event := <-events:
+		t.Errorf("got event %s, want none", event.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestStreamSubscribeReplaysBacklog(t *testing.T) {
+	cache, stream, cfg := newTestStream(t)
+	userUUID := uuid.New()
+
+	var published []string
+	for range 3 {
+		published = append(published, notifyStream(t, cache, stream, cfg, userUUID))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := stream.Subscribe(ctx, userUUID, published[0])
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	// Events after the last seen one are replayed in order, the last seen one is not
+	if got := receiveStream(t, events, 2); got[0] != published[1] || got[1] != published[2] {
+		t.Errorf("replayed %v, want %v", got, published[1:])
+	}
+
+	// Live events follow the backlog
+	live := notifyStream(t, cache, stream, cfg, userUUID)
+	if got := receiveStream(t, events, 1); got[0] != live {
+		t.Errorf("got live event %s, want %s", got[0], live)
+	}
+	expectNoStreamEvent(t, events)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("got an event after the context was cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Error("events are not closed after the context was cancelled")
+	}
+}
+
+func TestStreamSubscribeUpToDate(t *testing.T) {
+	cache, stream, cfg := newTestStream(t)
+	userUUID := uuid.New()
+	last := notifyStream(t, cache, stream, cfg, userUUID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := stream.Subscribe(ctx, userUUID, last)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	expectNoStreamEvent(t, events)
+
+	live := notifyStream(t, cache, stream, cfg, userUUID)
+	if got := receiveStream(t, events, 1); got[0] != live {
+		t.Errorf("got live event %s, want %s", got[0], live)
+	}
+}
+
+func TestStreamSubscribeWithoutLastEventID(t *testing.T) {
+	for name, lastEventID := range map[string]string{"missing": "", "invalid": "not-an-id"} {
+		t.Run(name, func(t *testing.T) {
+			cache, stream, cfg := newTestStream(t)
+			userUUID := uuid.New()
+			notifyStream(t, cache, stream, cfg, userUUID)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := stream.Subscribe(ctx, userUUID, lastEventID)
+			if err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+
+			// Without a valid last event id only live events are sent
+			expectNoStreamEvent(t, events)
+			live := notifyStream(t, cache, stream, cfg, userUUID)
+			if got := receiveStream(t, events, 1); got[0] != live {
+				t.Errorf("got live event %s, want %s", got[0], live)
+			}
+			// Events of other users are not sent
+			notifyStream(t, cache, stream, cfg, uuid.New())
+			expectNoStreamEvent(t, events)
+		})
+	}
+}
+
+func TestStreamEventPerKind(t *testing.T) {
+	cache, stream, cfg := newTestStream(t)
+	userUUID := uuid.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := notifyStream(t, cache, stream, cfg, userUUID)
+	events, err := stream.Subscribe(ctx, userUUID, first)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	kinds := map[notification.Kind]string{
+		notification.KindSlotsOpen: notification.EventMatch,
+		notification.KindSlotsGone: notification.EventGone,
+		notification.KindDigest:    notification.EventDigest,
+	}
+	for kind, want := range kinds {
+		if err := stream.Notify(ctx, &notification.Notification{Kind: kind, UserUUID: userUUID, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+		select {
+		case event := <-events:
+			if event.Event != want {
+				t.Errorf("live %s event = %q, want %q", kind, event.Event, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no live %s event", kind)
+		}
+	}
+
+	// Replayed events keep their names
+	replayed, err := stream.Subscribe(ctx, userUUID, first)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	got := make(map[string]int)
+	for range kinds {
+		select {
+		case event := <-replayed:
+			got[event.Event]++
+		case <-time.After(time.Second):
+			t.Fatalf("replayed %v, want every kind", got)
+		}
+	}
+	for _, want := range kinds {
+		if got[want] != 1 {
+			t.Errorf("replayed events = %v, want one %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"labgrab/internal/shared/errors"
+	"labgrab/pkg/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderWebhookSignature = "X-Labgrab-Signature"
+	HeaderWebhookTimestamp = "X-Labgrab-Timestamp"
+	HeaderWebhookDelivery  = "X-Labgrab-Delivery"
+	HeaderWebhookEvent     = "X-Labgrab-Event"
+)
+
+// Webhook posts signed notifications to webhooks of the user. Every request is written to the delivery log,
+// failed requests are retried by the outbox
+type Webhook struct {
+	repo   Repository
+	client *http.Client
+	cfg    *config.WebhookConfig
+	// allowAddr checks every address a request connects to, including redirects and hosts that resolve to
+	// another address than at registration
+	allowAddr func(addr netip.Addr) bool
+	logger    *zap.SugaredLogger
+}
+
+func NewWebhook(repo Repository, cfg *config.WebhookConfig, logger *zap.SugaredLogger) *Webhook {
+	w := &Webhook{
+		repo:      repo,
+		cfg:       cfg,
+		allowAddr: allowedWebhookAddr,
+		logger:    logger,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("invalid webhook address %q: %w", address, err)
+			}
+			if !w.allowAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", errWebhookAddrNotAllowed, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would connect to the webhook instead of the dialer and bypass the address check
+	transport.Proxy = nil
+	w.client = &http.Client{Timeout: cfg.Timeout, Transport: transport}
+
+	return w
+}
+
+var errWebhookAddrNotAllowed = stderrors.New("webhook address is not allowed")
+
+// blockedWebhookPrefixes are not public although netip does not report them as private
+var blockedWebhookPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// allowedWebhookAddr reports whether webhooks may be posted to addr. Loopback, private, link-local and other
+// non public addresses are rejected, so that a webhook can not reach services next to labgrab or cloud metadata
+func allowedWebhookAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedWebhookPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateWebhookAddrs resolves the host of a validated webhook url and rejects it when any of its addresses is
+// not allowed. Requests are checked again when they connect, the host may resolve to other addresses by then
+func validateWebhookAddrs(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if _, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return nil
+	}
+
+	validationErr := errors.NewValidationError()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		validationErr.Add("url", "Webhook url host could not be resolved")
+	} else if slices.ContainsFunc(addrs, func(addr netip.Addr) bool { return !allowedWebhookAddr(addr) }) {
+		validationErr.Add("url", "Webhook url should not point to a loopback, private or link-local address")
+	}
+	if validationErr.HasErrors() {
+		return validationErr
+	}
+	return nil
+}
+
+// allowedWebhookHost reports whether the host of a webhook url may be registered without resolving it. Hosts
+// that are not addresses are checked once resolved
+func allowedWebhookHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return allowedWebhookAddr(addr)
+	}
+	return true
+}
+
+func (w *Webhook) Channel() Channel {
+	return ChannelWebhook
+}
+
+// Notify posts the notification to the webhook of the delivery. A webhook that was disabled or deleted since
+// the entry was written is skipped
+func (w *Webhook) Notify(ctx context.Context, n *Notification) error {
+	if n.Delivery.WebhookUUID == nil {
+		return fmt.Errorf("delivery %s has no webhook", n.Delivery.UUID)
+	}
+
+	webhooks, err := w.repo.GetEnabledWebhooks(ctx, n.UserUUID)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		if webhook.WebhookUUID == *n.Delivery.WebhookUUID {
+			return w.deliver(ctx, &webhook, n.Delivery.UUID, n)
+		}
+	}
+	return nil
+}
+
+// deliver makes a single request and records its outcome. The webhook is disabled after DisableAfter
+// consecutive failed requests
+func (w *Webhook) deliver(ctx context.Context, webhook *DBWebhook, deliveryUUID uuid.UUID, n *Notification) error {
+	event := n.Kind.Event()
+	body, err := json.Marshal(webhookPayload{
+		ID:        deliveryUUID,
+		Event:     event,
+		CreatedAt: time.Now(),
+		Data:      n,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	var subscriptionUUID *uuid.UUID
+	if n.Kind != KindDigest {
+		subscriptionUUID = &n.SubscriptionUUID
+	}
+
+	statusCode, err := w.send(ctx, webhook, deliveryUUID, event, body)
+	w.logDelivery(ctx, &DBWebhookDelivery{
+		DeliveryUUID:     deliveryUUID,
+		WebhookUUID:      webhook.WebhookUUID,
+		SubscriptionUUID: subscriptionUUID,
+		Attempt:          max(n.Delivery.Attempt, 1),
+		StatusCode:       statusCode,
+		Error:            errorMessage(err),
+		Succeeded:        err == nil,
+		DeliveredAt:      time.Now(),
+	})
+
+	if err == nil {
+		if err := w.repo.RecordWebhookSuccess(ctx, webhook.WebhookUUID); err != nil {
+			w.logger.Errorw("error resetting webhook failures", "webhook", webhook.WebhookUUID, "error", err)
+		}
+		return nil
+	}
+
+	disabled, recordErr := w.repo.RecordWebhookFailure(ctx, webhook.WebhookUUID, w.cfg.DisableAfter)
+	if recordErr != nil {
+		w.logger.Errorw("error recording webhook failure", "webhook", webhook.WebhookUUID, "error", recordErr)
+	} else if disabled {
+		w.logger.Warnw("webhook disabled after repeated failures",
+			"webhook", webhook.WebhookUUID,
+			"user", webhook.UserUUID,
+			"disable_after", w.cfg.DisableAfter)
+	}
+
+	return err
+}
+
+func (w *Webhook) send(ctx context.Context, webhook *DBWebhook, deliveryUUID uuid.UUID, event string, body []byte) (*int, error) {
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookEvent, event)
+	req.Header.Set(HeaderWebhookDelivery, deliveryUUID.String())
+	req.Header.Set(HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderWebhookSignature, SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	statusCode := res.StatusCode
+	if statusCode < 200 || statusCode >= 300 {
+		return &statusCode, fmt.Errorf("unexpected status code %d", statusCode)
+	}
+	return &statusCode, nil
+}
+
+func (w *Webhook) logDelivery(ctx context.Context, delivery *DBWebhookDelivery) {
+	if err := w.repo.CreateWebhookDelivery(ctx, delivery); err != nil {
+		w.logger.Errorw("error writing webhook delivery log", "webhook", delivery.WebhookUUID, "error", err)
+	}
+}
+
+// SignWebhookPayload returns the value of the signature header: hex encoded HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook secret
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func errorMessage(err error) *string {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	return &msg
+}
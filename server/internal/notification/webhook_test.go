@@ -0,0 +1,428 @@
+package notification_test
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"labgrab/internal/notification"
+	"labgrab/internal/shared/types"
+	"labgrab/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// webhookReceiver records the delivery ids of the requests it got and answers with status
+type webhookReceiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	status     int
+	deliveries []string
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+	receiver := &webhookReceiver{status: status}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receiver.mu.Lock()
+		receiver.deliveries = append(receiver.deliveries, r.Header.Get(notification.HeaderWebhookDelivery))
+		receiver.mu.Unlock()
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.deliveries...)
+}
+
+func TestWebhookRetriesOnlyFailedWebhook(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	logger := zap.NewNop().Sugar()
+	webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 10}, logger)
+	notification.AllowAllWebhookAddrs(webhook)
+	svc := notification.NewService(repo, nil, []notification.Notifier{webhook}, &config.OutboxConfig{
+		BatchSize:      10,
+		Lease:          time.Minute,
+		MaxAttempts:    3,
+		InitialBackoff: time.Nanosecond,
+		MaxBackoff:     time.Nanosecond,
+	}, time.UTC, logger)
+
+	userUUID := uuid.New()
+	healthy := newWebhookReceiver(t, http.StatusNoContent)
+	failing := newWebhookReceiver(t, http.StatusInternalServerError)
+	for _, receiver := range []*webhookReceiver{healthy, failing} {
+		err := repo.CreateWebhook(ctx, &notification.DBWebhook{
+			WebhookUUID: uuid.New(),
+			URL:         receiver.URL,
+			Secret:      "secret",
+			Enabled:     true,
+			CreatedAt:   time.Now(),
+			UserUUID:    userUUID,
+		})
+		if err != nil {
+			t.Fatalf("CreateWebhook() error = %v", err)
+		}
+	}
+
+	err := svc.Enqueue(ctx, []*notification.Notification{{
+		Kind:              notification.KindSlotsOpen,
+		UserUUID:          userUUID,
+		SubscriptionUUID:  uuid.New(),
+		MatchingTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+		CreatedAt:         time.Now(),
+	}})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	dispatch := func() {
+		t.Helper()
+		time.Sleep(time.Millisecond)
+		entries, err := svc.ClaimOutbox(ctx)
+		if err != nil {
+			t.Fatalf("ClaimOutbox() error = %v", err)
+		}
+		for _, entry := range entries {
+			_, _ = svc.Deliver(ctx, &entry, nil)
+		}
+	}
+
+	dispatch()
+	dispatch()
+
+	if got := healthy.received(); len(got) != 1 {
+		t.Errorf("healthy webhook received %d requests, want 1", len(got))
+	}
+	got := failing.received()
+	if len(got) != 2 {
+		t.Fatalf("failing webhook received %d requests, want 2", len(got))
+	}
+	if got[0] == "" || got[0] != got[1] {
+		t.Errorf("failing webhook delivery ids = %v, want the same id on retry", got)
+	}
+}
+
+// newTestWebhook registers a webhook of a new user posting to url
+func newTestWebhook(t *testing.T, repo *fakeRepo, url string) *notification.DBWebhook {
+	t.Helper()
+	webhook := &notification.DBWebhook{
+		WebhookUUID: uuid.New(),
+		URL:         url,
+		Secret:      "secret",
+		Enabled:     true,
+		CreatedAt:   time.Now(),
+		UserUUID:    uuid.New(),
+	}
+	if err := repo.CreateWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	return webhook
+}
+
+func newTestWebhookNotification(webhook *notification.DBWebhook) *notification.Notification {
+	return &notification.Notification{
+		Kind:              notification.KindSlotsOpen,
+		UserUUID:          webhook.UserUUID,
+		SubscriptionUUID:  uuid.New(),
+		MatchingTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+		CreatedAt:         time.Now(),
+		Delivery:          notification.Delivery{UUID: uuid.New(), Attempt: 1, WebhookUUID: &webhook.WebhookUUID},
+	}
+}
+
+func TestWebhookRequiresDeliveryWebhook(t *testing.T) {
+	repo := newFakeRepo()
+	webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 10}, zap.NewNop().Sugar())
+	notification.AllowAllWebhookAddrs(webhook)
+
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	n := newTestWebhookNotification(newTestWebhook(t, repo, receiver.URL))
+	n.Delivery.WebhookUUID = nil
+
+	if err := webhook.Notify(context.Background(), n); err == nil {
+		t.Error("Notify() without a webhook succeeded")
+	}
+	if got := receiver.received(); len(got) != 0 {
+		t.Errorf("webhook received %d requests, want none", len(got))
+	}
+}
+
+func TestWebhookDisabledAfterFailures(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 2}, zap.NewNop().Sugar())
+	notification.AllowAllWebhookAddrs(webhook)
+
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	registered := newTestWebhook(t, repo, receiver.URL)
+
+	for range 2 {
+		if err := webhook.Notify(ctx, newTestWebhookNotification(registered)); err == nil {
+			t.Error("Notify() succeeded on a failing webhook")
+		}
+	}
+	if err := webhook.Notify(ctx, newTestWebhookNotification(registered)); err != nil {
+		t.Errorf("Notify() to a disabled webhook error = %v", err)
+	}
+
+	stored := repo.webhooks[registered.WebhookUUID]
+	if stored.Enabled || stored.DisabledAt == nil {
+		t.Errorf("webhook enabled = %t after %d failures, want it disabled", stored.Enabled, stored.ConsecutiveFailures)
+	}
+	// The third notification finds the webhook disabled and is not posted
+	if got := receiver.received(); len(got) != 2 {
+		t.Errorf("webhook received %d requests, want 2", len(got))
+	}
+	if len(repo.deliveries) != 2 || repo.deliveries[0].Succeeded || repo.deliveries[1].Succeeded {
+		t.Errorf("delivery log = %+v, want 2 failed deliveries", repo.deliveries)
+	}
+}
+
+func TestWebhookSuccessResetsFailures(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 2}, zap.NewNop().Sugar())
+	notification.AllowAllWebhookAddrs(webhook)
+
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	registered := newTestWebhook(t, repo, receiver.URL)
+
+	_ = webhook.Notify(ctx, newTestWebhookNotification(registered))
+	receiver.mu.Lock()
+	receiver.status = http.StatusOK
+	receiver.mu.Unlock()
+	if err := webhook.Notify(ctx, newTestWebhookNotification(registered)); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	receiver.mu.Lock()
+	receiver.status = http.StatusInternalServerError
+	receiver.mu.Unlock()
+	_ = webhook.Notify(ctx, newTestWebhookNotification(registered))
+
+	// Failures are counted since the last success only
+	stored := repo.webhooks[registered.WebhookUUID]
+	if !stored.Enabled || stored.ConsecutiveFailures != 1 {
+		t.Errorf("webhook enabled = %t with %d failures, want enabled with 1", stored.Enabled, stored.ConsecutiveFailures)
+	}
+}
+
+func TestWebhookRefusesInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 10}, zap.NewNop().Sugar())
+
+	// The receiver listens on loopback, as a service next to labgrab would
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	registered := newTestWebhook(t, repo, receiver.URL)
+
+	err := webhook.Notify(ctx, newTestWebhookNotification(registered))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Notify() error = %v, want the address to be refused", err)
+	}
+	if got := receiver.received(); len(got) != 0 {
+		t.Errorf("receiver on loopback got %d requests, want none", len(got))
+	}
+}
+
+func TestCreateWebhookReqValidate(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://example.com/hooks/labgrab", valid: true},
+		{url: "http://93.184.216.34:8080/hook", valid: true},
+		{url: "https://[2606:2800:220:1:248:1893:25c8:1946]/hook", valid: true},
+		{url: "ftp://example.com/hook", valid: false},
+		{url: "/relative/hook", valid: false},
+		{url: "http://localhost:8080/hook", valid: false},
+		{url: "http://api.localhost/hook", valid: false},
+		{url: "http://127.0.0.1/hook", valid: false},
+		{url: "http://[::1]/hook", valid: false},
+		{url: "http://[::ffff:127.0.0.1]/hook", valid: false},
+		{url: "http://10.0.0.5/hook", valid: false},
+		{url: "http://172.16.3.4/hook", valid: false},
+		{url: "http://192.168.1.1/hook", valid: false},
+		{url: "http://169.254.169.254/latest/meta-data", valid: false},
+		{url: "http://[fe80::1]/hook", valid: false},
+		{url: "http://[fd00::1]/hook", valid: false},
+		{url: "http://100.64.0.1/hook", valid: false},
+		{url: "http://0.0.0.0/hook", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := notification.CreateWebhookReq{UserUUID: uuid.New(), URL: tt.url}.Validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	got := notification.SignWebhookPayload("secret", 1700000000, []byte(`{"id":"delivery"}`))
+	want := "sha256=4dad1cd4df3bcf89d5dc0e4d9cd381e4bede164dd2250e133c28d76037ea1e85"
+	if got != want {
+		t.Errorf("SignWebhookPayload() = %q, want %q", got, want)
+	}
+
+	// The timestamp is signed together with the body, so a captured request can not be replayed later
+	if replayed := notification.SignWebhookPayload("secret", 1700000001, []byte(`{"id":"delivery"}`)); replayed == got {
+		t.Error("SignWebhookPayload() does not depend on the timestamp")
+	}
+	if other := notification.SignWebhookPayload("other", 1700000000, []byte(`{"id":"delivery"}`)); other == got {
+		t.Error("SignWebhookPayload() does not depend on the secret")
+	}
+}
+
+func TestWebhookSignsRequests(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 10}, zap.NewNop().Sugar())
+	notification.AllowAllWebhookAddrs(webhook)
+
+	var signature, computed string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(notification.HeaderWebhookTimestamp), 10, 64)
+		signature = r.Header.Get(notification.HeaderWebhookSignature)
+		computed = notification.SignWebhookPayload("secret", timestamp, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	registered := newTestWebhook(t, repo, server.URL)
+
+	if err := webhook.Notify(ctx, newTestWebhookNotification(registered)); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if signature == "" || signature != computed {
+		t.Errorf("signature header = %q, want %q", signature, computed)
+	}
+}
+
+func TestWebhookEventPerKind(t *testing.T) {
+	tests := []struct {
+		kind  notification.Kind
+		event string
+	}{
+		{kind: notification.KindSlotsOpen, event: notification.EventMatch},
+		{kind: notification.KindSlotsGone, event: notification.EventGone},
+		{kind: notification.KindDigest, event: notification.EventDigest},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			ctx := context.Background()
+			repo := newFakeRepo()
+			webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 10}, zap.NewNop().Sugar())
+			notification.AllowAllWebhookAddrs(webhook)
+
+			var header string
+			var payload struct {
+				Event string `json:"event"`
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Get(notification.HeaderWebhookEvent)
+				json.NewDecoder(r.Body).Decode(&payload)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			t.Cleanup(server.Close)
+			registered := newTestWebhook(t, repo, server.URL)
+
+			n := newTestWebhookNotification(registered)
+			n.Kind = tt.kind
+			if err := webhook.Notify(ctx, n); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if header != tt.event {
+				t.Errorf("event header = %q, want %q", header, tt.event)
+			}
+			if payload.Event != tt.event {
+				t.Errorf("payload event = %q, want %q", payload.Event, tt.event)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryLogSubscription(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	webhook := notification.NewWebhook(repo, &config.WebhookConfig{Timeout: time.Second, DisableAfter: 10}, zap.NewNop().Sugar())
+	notification.AllowAllWebhookAddrs(webhook)
+
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	registered := newTestWebhook(t, repo, receiver.URL)
+
+	match := newTestWebhookNotification(registered)
+	digest := newTestWebhookNotification(registered)
+	digest.Kind = notification.KindDigest
+	digest.SubscriptionUUID = uuid.Nil
+	digest.Digest = []*notification.Notification{newTestWebhookNotification(registered)}
+	for _, n := range []*notification.Notification{match, digest} {
+		if err := webhook.Notify(ctx, n); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	if len(repo.deliveries) != 2 {
+		t.Fatalf("delivery log has %d entries, want 2", len(repo.deliveries))
+	}
+	if got := repo.deliveries[0].SubscriptionUUID; got == nil || *got != match.SubscriptionUUID {
+		t.Errorf("match delivery subscription = %v, want %s", got, match.SubscriptionUUID)
+	}
+	// A digest covers several subscriptions, so its delivery is logged without one
+	if got := repo.deliveries[1].SubscriptionUUID; got != nil {
+		t.Errorf("digest delivery subscription = %s, want none", got)
+	}
+}
+
+func TestServiceWebhookNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := notification.NewService(repo, nil, nil, &config.OutboxConfig{}, time.UTC, zap.NewNop().Sugar())
+	registered := newTestWebhook(t, repo, "https://example.com/hook")
+
+	foreign := []struct {
+		name        string
+		userUUID    uuid.UUID
+		webhookUUID uuid.UUID
+	}{
+		{name: "unknown webhook", userUUID: registered.UserUUID, webhookUUID: uuid.New()},
+		{name: "webhook of another user", userUUID: uuid.New(), webhookUUID: registered.WebhookUUID},
+	}
+	for _, tt := range foreign {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.UpdateWebhook(ctx, &notification.UpdateWebhookReq{UserUUID: tt.userUUID, WebhookUUID: tt.webhookUUID})
+			if !stderrors.Is(err, notification.ErrWebhookNotFound) {
+				t.Errorf("UpdateWebhook() error = %v, want %v", err, notification.ErrWebhookNotFound)
+			}
+			if err := svc.DeleteWebhook(ctx, tt.userUUID, tt.webhookUUID); !stderrors.Is(err, notification.ErrWebhookNotFound) {
+				t.Errorf("DeleteWebhook() error = %v, want %v", err, notification.ErrWebhookNotFound)
+			}
+		})
+	}
+
+	if !repo.webhooks[registered.WebhookUUID].Enabled {
+		t.Fatal("UpdateWebhook() of another user disabled the webhook")
+	}
+	if err := svc.UpdateWebhook(ctx, &notification.UpdateWebhookReq{UserUUID: registered.UserUUID, WebhookUUID: registered.WebhookUUID}); err != nil {
+		t.Errorf("UpdateWebhook() error = %v", err)
+	}
+	if err := svc.DeleteWebhook(ctx, registered.UserUUID, registered.WebhookUUID); err != nil {
+		t.Errorf("DeleteWebhook() error = %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package smtp_test
+
+import (
+	"context"
+	"labgrab/internal/shared/api/smtp"
+	"labgrab/internal/shared/api/smtp/smtptest"
+	"labgrab/pkg/config"
+	"mime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientSend(t *testing.T) {
+	sink, err := smtptest.NewSink()
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	defer sink.Close()
+
+	client := smtp.NewClient(&config.SMTPConfig{
+		Host:    sink.Host(),
+		Port:    sink.Port(),
+		From:    "Labgrab <noreply@labgrab.test>",
+		Timeout: time.Second,
+	})
+
+	msg := &smtp.Message{
+		To:      []string{"student@example.com"},
+		Subject: "Свободные слоты",
+		Text:    "Оптика, лабораторная работа №3",
+		HTML:    "<p>Оптика, лабораторная работа №3</p>",
+	}
+	if err := client.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+
+	got := messages[0]
+	if got.From != "noreply@labgrab.test" {
+		t.Errorf("MAIL FROM = %q, want %q", got.From, "noreply@labgrab.test")
+	}
+	if len(got.To) != 1 || got.To[0] != "student@example.com" {
+		t.Errorf("RCPT TO = %v, want [student@example.com]", got.To)
+	}
+
+	wantHeaders := []string{
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"To: student@example.com",
+		"Content-Type: multipart/alternative;",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Type: text/html; charset=utf-8",
+	}
+	for _, header := range wantHeaders {
+		if !strings.Contains(got.Data, header) {
+			t.Errorf("message does not contain %q", header)
+		}
+	}
+}
+
+func TestClientSendUnreachable(t *testing.T) {
+	sink, err := smtptest.NewSink()
+	if err != nil {
+		t.Fatalf("failed to start smtp sink: %v", err)
+	}
+	host, port := sink.Host(), sink.Port()
+	sink.Close()
+
+	client := smtp.NewClient(&config.SMTPConfig{
+		Host:    host,
+		Port:    port,
+		From:    "noreply@labgrab.test",
+		Timeout: time.Second,
+	})
+
+	err = client.Send(context.Background(), &smtp.Message{To: []string{"student@example.com"}, Text: "text"})
+	if err == nil {
+		t.Fatal("Send() error = nil, want connection error")
+	}
+}
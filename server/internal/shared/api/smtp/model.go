@@ -0,0 +1,8 @@
+package smtp
+
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
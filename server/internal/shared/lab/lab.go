@@ -0,0 +1,12 @@
+// Package lab holds the identifiers of lab types and topics shared by the polling and subscription domains.
+// Valid values are not fixed in code, they come from the lab catalog of the config
+package lab
+
+// Type of a lab session, like Performance or Defence
+type Type string
+
+// TypeDefence is the only type with its own rules, a defence can take place in any auditorium
+const TypeDefence Type = "Defence"
+
+// Topic of a lab, like Optics or Mechanics
+type Topic string
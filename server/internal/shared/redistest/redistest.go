@@ -0,0 +1,47 @@
+// Package redistest connects tests to a redis they may write keys to
+package redistest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Env names the url of the test redis, e.g. redis://localhost:6379/15. Tests using it are skipped when it is unset
+const Env = "LABGRAB_TEST_REDIS_URL"
+
+// New connects to the test redis and returns a key prefix unique to the test. Keys under the prefix are deleted
+// when the test ends
+func New(t testing.TB) (*redis.Client, string) {
+	t.Helper()
+
+	url := os.Getenv(Env)
+	if url == "" {
+		t.Skipf("%s is not set", Env)
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", Env, err)
+	}
+	cache := redis.NewClient(options)
+	ctx := context.Background()
+	if err := cache.Ping(ctx).Err(); err != nil {
+		t.Fatalf("failed to connect to %s: %v", Env, err)
+	}
+
+	prefix := "labgrab_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	t.Cleanup(func() {
+		iter := cache.Scan(ctx, 0, prefix+":*", 1000).Iterator()
+		for iter.Next(ctx) {
+			cache.Del(ctx, iter.Val())
+		}
+		cache.Close()
+	})
+
+	return cache, prefix
+}
@@ -11,3 +11,6 @@ const (
 	DaySat DayOfWeek = "SAT"
 	DaySun DayOfWeek = "SUN"
 )
+
+// DaysOfWeek lists all days in calendar order starting from Monday
+var DaysOfWeek = []DayOfWeek{DayMon, DayTue, DayWed, DayThu, DayFri, DaySat, DaySun}
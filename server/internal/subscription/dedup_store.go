@@ -0,0 +1,342 @@
+package subscription
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"labgrab/pkg/config"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	dedupBackendRedis  = "redis"
+	dedupBackendMemory = "memory"
+
+	defaultDedupMaxEntries = 100000
+
+	dedupValueClaimed = "claimed"
+	dedupValueSeen    = "seen"
+	// dedupValueLegacy marked announced slots before keys were claimed and committed
+	dedupValueLegacy = "1"
+)
+
+// DedupStore keeps dedup keys of slots and the subscriptions notified about every slot
+type DedupStore interface {
+	// Claim claims every missing key for claimTTL and reports which keys it claimed. Keys already marked
+	// as seen get ttl again together with notified[i], the notified hash of the slot of keys[i], so that a slot
+	// open for longer than ttl is still reported as gone. Keys claimed by someone else are left untouched.
+	// The batch is atomic
+	Claim(ctx context.Context, keys []string, notified []string, claimTTL, ttl time.Duration) ([]bool, error)
+	// Commit marks keys as seen and records the notified subscriptions, both for ttl
+	Commit(ctx context.Context, seen []string, notified []NotifiedEntry, ttl time.Duration) error
+	// Notified returns subscription uuid to user uuid of the subscriptions notified about every key
+	Notified(ctx context.Context, keys []string) ([]map[string]string, error)
+	// Release deletes seen keys and forgets the notified subscriptions
+	Release(ctx context.Context, seen []string, notified []NotifiedEntry) error
+}
+
+// NotifiedEntry records that a subscription of a user was notified about the slot of Key
+type NotifiedEntry struct {
+	Key              string
+	SubscriptionUUID string
+	UserUUID         string
+}
+
+// NewDedupStore returns the store selected by the deduplicator config
+func NewDedupStore(cache *redis.Client, cfg *config.DeduplicatorConfig) (DedupStore, error) {
+	switch cfg.Backend {
+	case "", dedupBackendRedis:
+		return NewRedisDedupStore(cache), nil
+	case dedupBackendMemory:
+		maxEntries := cfg.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultDedupMaxEntries
+		}
+		return NewMemoryDedupStore(maxEntries), nil
+	default:
+		return nil, fmt.Errorf("unknown deduplicator backend %q", cfg.Backend)
+	}
+}
+
+// claimScript claims the first ARGV[3] keys in KEYS with SET NX and returns 1 for each key it claimed. Keys
+// already committed as seen get their TTL refreshed together with their notified hash, which follows them in
+// KEYS at the same offset. Keys claimed by another event are left untouched.
+// ARGV[1] is the claim TTL and ARGV[2] is the seen TTL, both in milliseconds
+var claimScript = redis.NewScript(`
+local n = tonumber(ARGV[3])
+local result = {}
+for i = 1, n do
+	local key = KEYS[i]
+	if redis.call('SET', key, 'claimed', 'NX', 'PX', ARGV[1]) then
+		result[i] = 1
+	else
+		if redis.call('GET', key) == 'seen' then
+			redis.call('PEXPIRE', key, ARGV[2])
+			redis.call('PEXPIRE', KEYS[n + i], ARGV[2])
+		end
+		result[i] = 0
+	end
+end
+return result
+`)
+
+// migrateScript marks the key in KEYS[1] as seen if it holds ARGV[1], keeping its TTL
+var migrateScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], 'seen', 'KEEPTTL')
+	return 1
+end
+return 0
+`)
+
+// RedisDedupStore keeps dedup state in redis, shared by every instance
+type RedisDedupStore struct {
+	cache *redis.Client
+}
+
+func NewRedisDedupStore(cache *redis.Client) *RedisDedupStore {
+	return &RedisDedupStore{cache: cache}
+}
+
+func (s *RedisDedupStore) Claim(ctx context.Context, keys []string, notified []string, claimTTL, ttl time.Duration) ([]bool, error) {
+	if len(notified) != len(keys) {
+		return nil, fmt.Errorf("failed to claim keys: got %d notified keys for %d keys", len(notified), len(keys))
+	}
+
+	scriptKeys := append(append(make([]string, 0, 2*len(keys)), keys...), notified...)
+	flags, err := claimScript.Run(ctx, s.cache, scriptKeys, claimTTL.Milliseconds(), ttl.Milliseconds(), len(keys)).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim keys: %w", err)
+	}
+	if len(flags) != len(keys) {
+		return nil, fmt.Errorf("failed to claim keys: got %d results for %d keys", len(flags), len(keys))
+	}
+
+	claimed := make([]bool, len(flags))
+	for i, flag := range flags {
+		claimed[i] = flag == 1
+	}
+	return claimed, nil
+}
+
+func (s *RedisDedupStore) Commit(ctx context.Context, seen []string, notified []NotifiedEntry, ttl time.Duration) error {
+	_, err := s.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range seen {
+			pipe.Set(ctx, key, dedupValueSeen, ttl)
+		}
+		for _, entry := range notified {
+			pipe.HSet(ctx, entry.Key, entry.SubscriptionUUID, entry.UserUUID)
+			pipe.PExpire(ctx, entry.Key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set keys: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisDedupStore) Notified(ctx context.Context, keys []string) ([]map[string]string, error) {
+	cmds := make([]*redis.MapStringStringCmd, len(keys))
+	_, err := s.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notified subscriptions: %w", err)
+	}
+
+	result := make([]map[string]string, len(cmds))
+	for i, cmd := range cmds {
+		result[i] = cmd.Val()
+	}
+	return result, nil
+}
+
+func (s *RedisDedupStore) Release(ctx context.Context, seen []string, notified []NotifiedEntry) error {
+	_, err := s.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range seen {
+			pipe.Del(ctx, key)
+		}
+		for _, entry := range notified {
+			pipe.HDel(ctx, entry.Key, entry.SubscriptionUUID)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete keys: %w", err)
+	}
+	return nil
+}
+
+// MigrateLegacyKeys marks dedup keys written by earlier versions as seen, so that claims refresh them instead of
+// treating them as claimed by another event. Returns the number of migrated keys
+func (s *RedisDedupStore) MigrateLegacyKeys(ctx context.Context, keyPrefix string) (int, error) {
+	migrated := 0
+	// Notified hashes share the prefix, scanning strings only skips them
+	iter := s.cache.ScanType(ctx, 0, keyPrefix+":*", 1000, "string").Iterator()
+	for iter.Next(ctx) {
+		ok, err := migrateScript.Run(ctx, s.cache, []string{iter.Val()}, dedupValueLegacy).Int()
+		if err != nil {
+			return migrated, fmt.Errorf("failed to migrate key %s: %w", iter.Val(), err)
+		}
+		migrated += ok
+	}
+	if err := iter.Err(); err != nil {
+		return migrated, fmt.Errorf("failed to scan keys: %w", err)
+	}
+	return migrated, nil
+}
+
+type memoryDedupEntry struct {
+	key       string
+	value     string
+	fields    map[string]string
+	expiresAt time.Time
+}
+
+// MemoryDedupStore keeps dedup state in the process with per key TTL, evicting least recently used keys
+// above maxEntries. It is not shared between instances and is lost on restart
+type MemoryDedupStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	now        func() time.Time
+}
+
+func NewMemoryDedupStore(maxEntries int) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+func (s *MemoryDedupStore) Claim(ctx context.Context, keys []string, notified []string, claimTTL, ttl time.Duration) ([]bool, error) {
+	if len(notified) != len(keys) {
+		return nil, fmt.Errorf("failed to claim keys: got %d notified keys for %d keys", len(notified), len(keys))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	claimed := make([]bool, len(keys))
+	for i, key := range keys {
+		entry := s.get(key, now)
+		if entry == nil {
+			s.put(&memoryDedupEntry{key: key, value: dedupValueClaimed, expiresAt: now.Add(claimTTL)})
+			claimed[i] = true
+			continue
+		}
+		if entry.value == dedupValueSeen {
+			entry.expiresAt = now.Add(ttl)
+			if notifiedEntry := s.get(notified[i], now); notifiedEntry != nil {
+				notifiedEntry.expiresAt = now.Add(ttl)
+			}
+		}
+	}
+	return claimed, nil
+}
+
+func (s *MemoryDedupStore) Commit(ctx context.Context, seen []string, notified []NotifiedEntry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, key := range seen {
+		s.put(&memoryDedupEntry{key: key, value: dedupValueSeen, expiresAt: now.Add(ttl)})
+	}
+	for _, notifiedEntry := range notified {
+		entry := s.get(notifiedEntry.Key, now)
+		if entry == nil {
+			entry = &memoryDedupEntry{key: notifiedEntry.Key, fields: make(map[string]string)}
+			s.put(entry)
+		}
+		entry.fields[notifiedEntry.SubscriptionUUID] = notifiedEntry.UserUUID
+		entry.expiresAt = now.Add(ttl)
+	}
+	return nil
+}
+
+func (s *MemoryDedupStore) Notified(ctx context.Context, keys []string) ([]map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	result := make([]map[string]string, len(keys))
+	for i, key := range keys {
+		result[i] = make(map[string]string)
+		if entry := s.get(key, now); entry != nil {
+			for field, value := range entry.fields {
+				result[i][field] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryDedupStore) Release(ctx context.Context, seen []string, notified []NotifiedEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, key := range seen {
+		s.remove(key)
+	}
+	for _, notifiedEntry := range notified {
+		entry := s.get(notifiedEntry.Key, now)
+		if entry == nil {
+			continue
+		}
+		delete(entry.fields, notifiedEntry.SubscriptionUUID)
+		if len(entry.fields) == 0 {
+			s.remove(notifiedEntry.Key)
+		}
+	}
+	return nil
+}
+
+// get returns a live entry and marks it as recently used, expired entries are removed
+func (s *MemoryDedupStore) get(key string, now time.Time) *memoryDedupEntry {
+	element, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*memoryDedupEntry)
+	if !now.Before(entry.expiresAt) {
+		s.remove(key)
+		return nil
+	}
+	s.lru.MoveToFront(element)
+	return entry
+}
+
+// put stores the entry as the most recently used one, replacing an entry with the same key
+func (s *MemoryDedupStore) put(entry *memoryDedupEntry) {
+	if element, ok := s.entries[entry.key]; ok {
+		element.Value = entry
+		s.lru.MoveToFront(element)
+		return
+	}
+
+	s.entries[entry.key] = s.lru.PushFront(entry)
+	for s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.remove(oldest.Value.(*memoryDedupEntry).key)
+	}
+}
+
+func (s *MemoryDedupStore) remove(key string) {
+	if element, ok := s.entries[key]; ok {
+		s.lru.Remove(element)
+		delete(s.entries, key)
+	}
+}
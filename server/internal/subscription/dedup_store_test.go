@@ -0,0 +1,240 @@
+package subscription
+
+import (
+	"context"
+	"labgrab/internal/shared/redistest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStoreClaim(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryDedupStore(10)
+	store.now = func() time.Time { return now }
+
+	claimed, err := store.Claim(ctx, []string{"a", "b"}, []string{"notified:a", "notified:b"}, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if want := []bool{true, true}; !reflect.DeepEqual(claimed, want) {
+		t.Errorf("Claim() = %v, want %v", claimed, want)
+	}
+
+	if err := store.Commit(ctx, []string{"a"}, nil, time.Hour); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// "b" was never committed, so its claim expires and it can be claimed again
+	now = now.Add(2 * time.Minute)
+	claimed, err = store.Claim(ctx, []string{"a", "b", "c"}, []string{"notified:a", "notified:b", "notified:c"}, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if want := []bool{false, true, true}; !reflect.DeepEqual(claimed, want) {
+		t.Errorf("Claim() = %v, want %v", claimed, want)
+	}
+
+	// Claiming a seen key refreshes its TTL
+	now = now.Add(59 * time.Minute)
+	claimed, err = store.Claim(ctx, []string{"a"}, []string{"notified:a"}, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if claimed[0] {
+		t.Errorf("Claim() claimed a seen key with refreshed TTL")
+	}
+
+	now = now.Add(time.Hour)
+	claimed, err = store.Claim(ctx, []string{"a"}, []string{"notified:a"}, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if !claimed[0] {
+		t.Errorf("Claim() did not claim an expired key")
+	}
+}
+
+func TestMemoryDedupStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryDedupStore(2)
+
+	if err := store.Commit(ctx, []string{"a", "b"}, nil, time.Hour); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	// Touch "a" so that "b" is the least recently used key
+	if _, err := store.Claim(ctx, []string{"a"}, []string{"notified:a"}, time.Minute, time.Hour); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if err := store.Commit(ctx, []string{"c"}, nil, time.Hour); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	claimed, err := store.Claim(ctx, []string{"a", "b"}, []string{"notified:a", "notified:b"}, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if want := []bool{false, true}; !reflect.DeepEqual(claimed, want) {
+		t.Errorf("Claim() = %v, want %v", claimed, want)
+	}
+}
+
+func TestMemoryDedupStoreNotified(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryDedupStore(10)
+
+	notified := []NotifiedEntry{
+		{Key: "slot", SubscriptionUUID: "sub-1", UserUUID: "user-1"},
+		{Key: "slot", SubscriptionUUID: "sub-2", UserUUID: "user-2"},
+	}
+	if err := store.Commit(ctx, nil, notified, time.Hour); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if err := store.Release(ctx, nil, notified[:1]); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	got, err := store.Notified(ctx, []string{"slot", "other"})
+	if err != nil {
+		t.Fatalf("Notified() error = %v", err)
+	}
+	want := []map[string]string{{"sub-2": "user-2"}, {}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Notified() = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryDedupStoreClaimRefreshesNotified(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryDedupStore(10)
+	store.now = func() time.Time { return now }
+
+	notified := []NotifiedEntry{{Key: "notified:a", SubscriptionUUID: "sub-1", UserUUID: "user-1"}}
+	if err := store.Commit(ctx, []string{"a"}, notified, time.Hour); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// The slot stays open for longer than the TTL, every poll claims it again
+	for range 3 {
+		now = now.Add(50 * time.Minute)
+		if _, err := store.Claim(ctx, []string{"a"}, []string{"notified:a"}, time.Minute, time.Hour); err != nil {
+			t.Fatalf("Claim() error = %v", err)
+		}
+	}
+
+	got, err := store.Notified(ctx, []string{"notified:a"})
+	if err != nil {
+		t.Fatalf("Notified() error = %v", err)
+	}
+	if want := []map[string]string{{"sub-1": "user-1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Notified() = %v, want %v", got, want)
+	}
+}
+
+func TestRedisDedupStoreMigrateLegacyKeys(t *testing.T) {
+	cache, prefix := redistest.New(t)
+	ctx := context.Background()
+	store := NewRedisDedupStore(cache)
+
+	legacy, seen, notified := prefix+":legacy", prefix+":seen", prefix+":notified:slot"
+	cache.Set(ctx, legacy, dedupValueLegacy, time.Hour)
+	cache.Set(ctx, seen, dedupValueSeen, time.Hour)
+	cache.HSet(ctx, notified, "sub-1", "user-1")
+
+	migrated, err := store.MigrateLegacyKeys(ctx, prefix)
+	if err != nil {
+		t.Fatalf("MigrateLegacyKeys() error = %v", err)
+	}
+	if migrated != 1 {
+		t.Errorf("MigrateLegacyKeys() = %d, want 1", migrated)
+	}
+
+	if value := cache.Get(ctx, legacy).Val(); value != dedupValueSeen {
+		t.Errorf("legacy key = %q, want %q", value, dedupValueSeen)
+	}
+	if ttl := cache.PTTL(ctx, legacy).Val(); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("legacy key TTL = %s, want the TTL it had", ttl)
+	}
+	if fields := cache.HGetAll(ctx, notified).Val(); !reflect.DeepEqual(fields, map[string]string{"sub-1": "user-1"}) {
+		t.Errorf("notified hash = %v, want it untouched", fields)
+	}
+
+	// Claims refresh migrated keys instead of treating them as claimed by another event
+	claimed, err := store.Claim(ctx, []string{legacy}, []string{prefix + ":notified:legacy"}, time.Minute, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if claimed[0] {
+		t.Error("Claim() claimed a migrated key")
+	}
+	if ttl := cache.PTTL(ctx, legacy).Val(); ttl <= time.Hour {
+		t.Errorf("migrated key TTL = %s after claim, want it refreshed", ttl)
+	}
+}
+
+func TestRedisDedupStoreClaim(t *testing.T) {
+	cache, prefix := redistest.New(t)
+	ctx := context.Background()
+	store := NewRedisDedupStore(cache)
+
+	a, b := prefix+":a", prefix+":b"
+	notifiedA, notifiedB := prefix+":notified:a", prefix+":notified:b"
+
+	claimed, err := store.Claim(ctx, []string{a, b}, []string{notifiedA, notifiedB}, 300*time.Millisecond, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if want := []bool{true, true}; !reflect.DeepEqual(claimed, want) {
+		t.Errorf("Claim() = %v, want %v", claimed, want)
+	}
+	if value := cache.Get(ctx, a).Val(); value != dedupValueClaimed {
+		t.Errorf("claimed key = %q, want %q", value, dedupValueClaimed)
+	}
+	if ttl := cache.PTTL(ctx, a).Val(); ttl <= 0 || ttl > 300*time.Millisecond {
+		t.Errorf("claimed key TTL = %s, want up to the claim TTL", ttl)
+	}
+
+	// Keys claimed by another event are neither claimed again nor refreshed
+	claimed, err = store.Claim(ctx, []string{a}, []string{notifiedA}, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if claimed[0] {
+		t.Error("Claim() claimed a key claimed by another event")
+	}
+	if ttl := cache.PTTL(ctx, a).Val(); ttl > 300*time.Millisecond {
+		t.Errorf("claimed key TTL = %s after another claim, want it untouched", ttl)
+	}
+
+	notified := []NotifiedEntry{{Key: notifiedA, SubscriptionUUID: "sub-1", UserUUID: "user-1"}}
+	if err := store.Commit(ctx, []string{a}, notified, time.Minute); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if value := cache.Get(ctx, a).Val(); value != dedupValueSeen {
+		t.Errorf("committed key = %q, want %q", value, dedupValueSeen)
+	}
+	if fields := cache.HGetAll(ctx, notifiedA).Val(); !reflect.DeepEqual(fields, map[string]string{"sub-1": "user-1"}) {
+		t.Errorf("notified hash = %v, want the committed subscription", fields)
+	}
+
+	// "b" was never committed, so its claim expires and it can be claimed again. Seen "a" is refreshed
+	// together with its notified hash instead
+	time.Sleep(500 * time.Millisecond)
+	claimed, err = store.Claim(ctx, []string{a, b}, []string{notifiedA, notifiedB}, 300*time.Millisecond, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if want := []bool{false, true}; !reflect.DeepEqual(claimed, want) {
+		t.Errorf("Claim() = %v, want %v", claimed, want)
+	}
+	for _, key := range []string{a, notifiedA} {
+		if ttl := cache.PTTL(ctx, key).Val(); ttl <= time.Minute {
+			t.Errorf("%s TTL = %s after claim, want it refreshed to the seen TTL", key, ttl)
+		}
+	}
+	if exists := cache.Exists(ctx, notifiedB).Val(); exists != 0 {
+		t.Error("Claim() created the notified hash of a newly claimed key")
+	}
+}
@@ -5,73 +5,202 @@ import (
 	"crypto/sha3"
 	"encoding/hex"
 	"fmt"
+	"labgrab/internal/shared/lab"
+	"labgrab/internal/shared/types"
 	"labgrab/pkg/config"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/google/uuid"
 )
 
 type Deduplicator struct {
-	cache *redis.Client
+	store DedupStore
 	cfg   *config.DeduplicatorConfig
 }
 
-func NewDeduplicator(cache *redis.Client, cfg *config.DeduplicatorConfig) *Deduplicator {
-	return &Deduplicator{cache: cache, cfg: cfg}
+func NewDeduplicator(store DedupStore, cfg *config.DeduplicatorConfig) *Deduplicator {
+	return &Deduplicator{store: store, cfg: cfg}
 }
 
-func (d *Deduplicator) Deduplicate(
+// Claim atomically claims dedup keys of all slots of the matches in a single round trip and keeps
+// matches that have at least one newly claimed slot, recording those slots in NewTimeslots.
+// Claimed keys expire after ClaimTTL unless Commit is called, seen keys and the notified subscriptions of
+// their slots are kept for another TTL
+func (d *Deduplicator) Claim(
 	ctx context.Context,
 	req *GetMatchingSubscriptionsReq,
 	matches []DBSubscriptionMatchResult,
 ) ([]DBSubscriptionMatchResult, error) {
+	var keys, notified []string
+	var slots []claimedSlot
+	for i := range matches {
+		for day, lessons := range matches[i].MatchingTimeslots {
+			for _, lesson := range lessons {
+				keys = append(keys, d.slotKey(req, &matches[i], day, lesson))
+				notified = append(notified, d.generateNotifiedKey(req.LabType, req.LabTopic, req.LabNumber, req.LabAuditorium, day, lesson))
+				slots = append(slots, claimedSlot{match: i, day: day, lesson: lesson})
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	claimed, err := d.store.Claim(ctx, keys, notified, d.cfg.ClaimTTL, d.cfg.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	newTimeslots := make([]map[types.DayOfWeek][]int, len(matches))
+	for i, slot := range slots {
+		if !claimed[i] {
+			continue
+		}
+		if newTimeslots[slot.match] == nil {
+			newTimeslots[slot.match] = make(map[types.DayOfWeek][]int)
+		}
+		newTimeslots[slot.match][slot.day] = append(newTimeslots[slot.match][slot.day], slot.lesson)
+	}
+
 	var result []DBSubscriptionMatchResult
+	for i, match := range matches {
+		if newTimeslots[i] == nil {
+			continue
+		}
+		match.NewTimeslots = newTimeslots[i]
+		result = append(result, match)
+	}
 
-	for _, match := range matches {
-		hasNewSlot := false
+	return result, nil
+}
 
+// Commit marks dedup keys of every slot of the matches as seen, so that they are filtered out next time,
+// and records the subscriptions as notified about the slots. It must be called only after the matches
+// were persisted for delivery
+func (d *Deduplicator) Commit(
+	ctx context.Context,
+	req *GetMatchingSubscriptionsReq,
+	matches []DBSubscriptionMatchResult,
+) error {
+	var seen []string
+	var notified []NotifiedEntry
+	for _, match := range matches {
 		for day, lessons := range match.MatchingTimeslots {
 			for _, lesson := range lessons {
-				key := d.generateKey(
-					&keyGenerationParams{
-						subscriptionUUID: match.SubscriptionUUID,
-						labType:          req.LabType,
-						labTopic:         req.LabTopic,
-						labNumber:        req.LabNumber,
-						labAuditorium:    req.LabAuditorium,
-						day:              day,
-						lesson:           lesson,
-					},
-				)
-
-				exists, err := d.cache.Exists(ctx, key).Result()
-				if err != nil {
-					return nil, fmt.Errorf("failed to check key existence: %w", err)
-				}
-
-				if exists > 0 {
-					err = d.cache.Expire(ctx, key, d.cfg.TTL).Err()
-					if err != nil {
-						return nil, fmt.Errorf("failed to update TTL: %w", err)
-					}
-				} else {
-					hasNewSlot = true
-
-					err = d.cache.Set(ctx, key, "1", d.cfg.TTL).Err()
-					if err != nil {
-						return nil, fmt.Errorf("failed to set key: %w", err)
-					}
-				}
+				seen = append(seen, d.slotKey(req, &match, day, lesson))
+				notified = append(notified, NotifiedEntry{
+					Key:              d.generateNotifiedKey(req.LabType, req.LabTopic, req.LabNumber, req.LabAuditorium, day, lesson),
+					SubscriptionUUID: match.SubscriptionUUID.String(),
+					UserUUID:         match.UserUUID.String(),
+				})
 			}
 		}
+	}
+
+	return d.store.Commit(ctx, seen, notified, d.cfg.TTL)
+}
 
-		if hasNewSlot {
-			result = append(result, match)
+// Notified returns the subscriptions that were notified about the gone slots, with the gone slots of each
+func (d *Deduplicator) Notified(ctx context.Context, req *GetGoneSlotSubscriptionsReq) ([]GetGoneSlotSubscriptionsRes, error) {
+	var keys []string
+	var slots []claimedSlot
+	for day, lessons := range req.GoneTimeslots {
+		for _, lesson := range lessons {
+			keys = append(keys, d.generateNotifiedKey(req.LabType, req.LabTopic, req.LabNumber, req.LabAuditorium, day, lesson))
+			slots = append(slots, claimedSlot{day: day, lesson: lesson})
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	notified, err := d.store.Notified(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []GetGoneSlotSubscriptionsRes
+	index := make(map[uuid.UUID]int)
+	for i, subscriptions := range notified {
+		for rawSubscriptionUUID, rawUserUUID := range subscriptions {
+			subscriptionUUID, err := uuid.Parse(rawSubscriptionUUID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subscription uuid %q: %w", rawSubscriptionUUID, err)
+			}
+			userUUID, err := uuid.Parse(rawUserUUID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user uuid %q: %w", rawUserUUID, err)
+			}
+
+			j, ok := index[subscriptionUUID]
+			if !ok {
+				j = len(result)
+				index[subscriptionUUID] = j
+				result = append(result, GetGoneSlotSubscriptionsRes{
+					UserUUID:         userUUID,
+					SubscriptionUUID: subscriptionUUID,
+					GoneTimeslots:    make(map[types.DayOfWeek][]int),
+				})
+			}
+			result[j].GoneTimeslots[slots[i].day] = append(result[j].GoneTimeslots[slots[i].day], slots[i].lesson)
 		}
 	}
 
 	return result, nil
 }
 
+// Release deletes dedup keys of the gone slots of the subscriptions, so that a slot that opens again is
+// treated as new, and forgets that the subscriptions were notified about them
+func (d *Deduplicator) Release(
+	ctx context.Context,
+	req *GetGoneSlotSubscriptionsReq,
+	matches []GetGoneSlotSubscriptionsRes,
+) error {
+	var seen []string
+	var notified []NotifiedEntry
+	for _, match := range matches {
+		for day, lessons := range match.GoneTimeslots {
+			for _, lesson := range lessons {
+				seen = append(seen, d.generateKey(&keyGenerationParams{
+					subscriptionUUID: match.SubscriptionUUID,
+					labType:          req.LabType,
+					labTopic:         req.LabTopic,
+					labNumber:        req.LabNumber,
+					labAuditorium:    req.LabAuditorium,
+					day:              day,
+					lesson:           lesson,
+				}))
+				notified = append(notified, NotifiedEntry{
+					Key:              d.generateNotifiedKey(req.LabType, req.LabTopic, req.LabNumber, req.LabAuditorium, day, lesson),
+					SubscriptionUUID: match.SubscriptionUUID.String(),
+				})
+			}
+		}
+	}
+
+	return d.store.Release(ctx, seen, notified)
+}
+
+func (d *Deduplicator) slotKey(
+	req *GetMatchingSubscriptionsReq,
+	match *DBSubscriptionMatchResult,
+	day types.DayOfWeek,
+	lesson int,
+) string {
+	return d.generateKey(
+		&keyGenerationParams{
+			subscriptionUUID: match.SubscriptionUUID,
+			labType:          req.LabType,
+			labTopic:         req.LabTopic,
+			labNumber:        req.LabNumber,
+			labAuditorium:    req.LabAuditorium,
+			day:              day,
+			lesson:           lesson,
+		},
+	)
+}
+
 func (d *Deduplicator) generateKey(params *keyGenerationParams) string {
 	data := fmt.Sprintf("%s:%s:%d:%d:%s:%s:%d",
 		params.labType,
@@ -91,3 +220,22 @@ func (d *Deduplicator) generateKey(params *keyGenerationParams) string {
 
 	return key
 }
+
+// generateNotifiedKey returns the key of the hash of subscription uuid to user uuid for every subscription
+// notified about the slot. Unlike dedup keys it does not depend on the subscription
+func (d *Deduplicator) generateNotifiedKey(
+	labType lab.Type,
+	labTopic lab.Topic,
+	labNumber int,
+	labAuditorium int,
+	day types.DayOfWeek,
+	lesson int,
+) string {
+	data := fmt.Sprintf("%s:%s:%d:%d:%s:%d", labType, labTopic, labNumber, labAuditorium, day, lesson)
+
+	hash := sha3.New256()
+	hash.Write([]byte(data))
+	hashHex := hex.EncodeToString(hash.Sum(nil))
+
+	return fmt.Sprintf("%s:notified:%s", d.cfg.KeyPrefix, hashHex)
+}
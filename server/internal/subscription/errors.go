@@ -0,0 +1,5 @@
+package subscription
+
+import "errors"
+
+var ErrTimeExclusionNotFound = errors.New("time exclusion not found")
@@ -1,43 +1,53 @@
 package subscription
 
 import (
+	"fmt"
 	"labgrab/internal/shared/errors"
+	"labgrab/internal/shared/lab"
 	"labgrab/internal/shared/types"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
-type LabType string
-
-const (
-	LabTypeDefence     LabType = "Defence"
-	LabTypePerformance LabType = "Performance"
-)
-
-type LabTopic string
-
-const (
-	LabTopicVirtual     LabTopic = "Virtual"
-	LabTopicElectricity LabTopic = "Electricity"
-	LabTopicMechanics   LabTopic = "Mechanics"
-	LabTopicOptics      LabTopic = "Optics"
-	LabTopicsRigidBody  LabTopic = "Rigid Body"
-)
-
 // DBSubscription subscription_service.subscriptions
 type DBSubscription struct {
 	SubscriptionUUID uuid.UUID  `db:"subscription_uuid"`
-	LabType          LabType    `db:"lab_type"`
-	LabTopic         LabTopic   `db:"lab_topic"`
-	LabNumber        int        `db:"lab_number"`
-	LabAuditorium    *int       `db:"lab_auditorium"` // Defence can happen in any auditorium
+	LabType          lab.Type   `db:"lab_type"`
+	LabTopic         lab.Topic  `db:"lab_topic"`
+	LabNumbers       []int      `db:"lab_numbers"`
+	LabAuditoriums   []int      `db:"lab_auditoriums"` // nil means any auditorium, Defence can happen in any of them
+	ValidFrom        *time.Time `db:"valid_from"`
+	ValidUntil       *time.Time `db:"valid_until"`
+	SlotsBefore      *time.Time `db:"slots_before"` // Only slots strictly before this date are matched
 	CreatedAt        time.Time  `db:"created_at"`
 	ClosedAt         *time.Time `db:"closed_at"`
 	UserUUID         uuid.UUID  `db:"user_uuid"`
 }
 
+// DBLabType subscription_service.lab_types
+type DBLabType struct {
+	Code   lab.Type `db:"code"`
+	Name   string   `db:"name"`
+	Active bool     `db:"active"`
+}
+
+// DBLabTopic subscription_service.lab_topics
+type DBLabTopic struct {
+	Code   lab.Topic `db:"code"`
+	Name   string    `db:"name"`
+	Active bool      `db:"active"`
+}
+
+type DeliveryMode string
+
+const (
+	DeliveryModeImmediate DeliveryMode = "Immediate"
+	DeliveryModeDigest    DeliveryMode = "Digest"
+)
+
 // DBTimePreferences subscription_service.time_preferences
 type DBTimePreferences struct {
 	DayOfWeek types.DayOfWeek `db:"day_of_week"`
@@ -45,10 +55,53 @@ type DBTimePreferences struct {
 	UserUUID  uuid.UUID       `db:"user_uuid"`
 }
 
+// DBSubscriptionTimePreferences subscription_service.subscription_time_preferences
+type DBSubscriptionTimePreferences struct {
+	DayOfWeek        types.DayOfWeek `db:"day_of_week"`
+	Lessons          []int           `db:"lessons"`
+	SubscriptionUUID uuid.UUID       `db:"subscription_uuid"`
+}
+
+// DBTimeExclusion subscription_service.time_exclusions. Both dates are inclusive
+type DBTimeExclusion struct {
+	ExclusionUUID uuid.UUID `db:"exclusion_uuid"`
+	StartsOn      time.Time `db:"starts_on"`
+	EndsOn        time.Time `db:"ends_on"`
+	Reason        *string   `db:"reason"`
+	UserUUID      uuid.UUID `db:"user_uuid"`
+}
+
+type TeacherPreferenceMode string
+
+const (
+	// TeacherPreferenceModeBlacklist matches any teacher except blacklisted ones
+	TeacherPreferenceModeBlacklist TeacherPreferenceMode = "Blacklist"
+	// TeacherPreferenceModeWhitelist matches only preferred teachers
+	TeacherPreferenceModeWhitelist TeacherPreferenceMode = "Whitelist"
+	// TeacherPreferenceModeRanked matches like the blacklist mode and orders available teachers by preference
+	TeacherPreferenceModeRanked TeacherPreferenceMode = "Ranked"
+)
+
+var TeacherPreferenceModes = []TeacherPreferenceMode{
+	TeacherPreferenceModeBlacklist,
+	TeacherPreferenceModeWhitelist,
+	TeacherPreferenceModeRanked,
+}
+
 // DBTeacherPreferences subscription_service.teacher_preferences
 type DBTeacherPreferences struct {
-	BlacklistedTeachers []string  `db:"blacklisted_teachers"`
-	UserUUID            uuid.UUID `db:"user_uuid"`
+	Mode                TeacherPreferenceMode `db:"mode"`
+	BlacklistedTeachers []string              `db:"blacklisted_teachers"`
+	PreferredTeachers   []string              `db:"preferred_teachers"` // Ordered from the most preferred one
+	UserUUID            uuid.UUID             `db:"user_uuid"`
+}
+
+// DBSubscriptionTeacherPreferences subscription_service.subscription_teacher_preferences
+type DBSubscriptionTeacherPreferences struct {
+	Mode                TeacherPreferenceMode `db:"mode"`
+	BlacklistedTeachers []string              `db:"blacklisted_teachers"`
+	PreferredTeachers   []string              `db:"preferred_teachers"`
+	SubscriptionUUID    uuid.UUID             `db:"subscription_uuid"`
 }
 
 // DBDetails subscription_service.details
@@ -58,6 +111,18 @@ type DBDetails struct {
 	UserUUID                   uuid.UUID  `db:"user_uuid"`
 }
 
+// DBNotificationPreferences subscription_service.notification_preferences. Quiet hours are minutes
+// since midnight in the parser timezone, digest interval is in minutes
+type DBNotificationPreferences struct {
+	QuietHoursStart  *int         `db:"quiet_hours_start"`
+	QuietHoursEnd    *int         `db:"quiet_hours_end"`
+	DeliveryMode     DeliveryMode `db:"delivery_mode"`
+	DigestInterval   int          `db:"digest_interval"`
+	MaxPerHour       *int         `db:"max_per_hour"`
+	PreferredChannel *string      `db:"preferred_channel"`
+	UserUUID         uuid.UUID    `db:"user_uuid"`
+}
+
 type DBUserSubscriptionData struct {
 	TimePreferences            map[types.DayOfWeek][]int
 	BlacklistedTeachers        []string
@@ -67,11 +132,13 @@ type DBUserSubscriptionData struct {
 }
 
 type DBSubscriptionSearch struct {
-	LabType        LabType
-	LabTopic       LabTopic
+	LabType        lab.Type
+	LabTopic       lab.Topic
 	LabNumber      int
 	LabAuditorium  int
 	AvailableSlots map[types.DayOfWeek]map[int][]string
+	SlotDates      map[types.DayOfWeek]map[int][]time.Time
+	Groups         []string // Nil means the slots are open to every group
 }
 
 type DBSubscriptionMatchResult struct {
@@ -80,25 +147,28 @@ type DBSubscriptionMatchResult struct {
 	SuccessfulSubscriptions    int
 	LastSuccessfulSubscription *time.Time
 	MatchingTimeslots          map[types.DayOfWeek][]int
+	// NewTimeslots is the part of MatchingTimeslots claimed by this event, filled by the deduplicator
+	NewTimeslots      map[types.DayOfWeek][]int
+	Teachers          []string
+	PreferredTeachers []string
 }
 
 type CreateSubscriptionReq struct {
-	UserUUID      uuid.UUID
-	LabType       LabType
-	LabTopic      LabTopic
-	LabNumber     int
-	LabAuditorium *int
-	CreatedAt     time.Time
+	UserUUID       uuid.UUID
+	LabType        lab.Type
+	LabTopic       lab.Topic
+	LabNumbers     []int
+	LabAuditoriums []int // nil means any auditorium
+	ValidFrom      *time.Time
+	ValidUntil     *time.Time
+	SlotsBefore    *time.Time
+	CreatedAt      time.Time
 }
 
 func (r CreateSubscriptionReq) Validate() error {
 	err := errors.NewValidationError()
-	if r.LabType == LabTypePerformance && r.LabAuditorium == nil {
-		err.Add("lab_type & lab_auditorium", "If lab type is equal to 'Performance' lab auditorium should be provided")
-	}
-	if r.LabType == LabTypeDefence && r.LabAuditorium != nil {
-		err.Add("lab_type & lab_auditorium", "If lab type is equal to 'Defence' lab auditorium should not be provided")
-	}
+	validateLabs(err, r.LabType, r.LabNumbers, r.LabAuditoriums)
+	validateValidityWindow(err, r.ValidFrom, r.ValidUntil)
 	if err.HasErrors() {
 		return err
 	}
@@ -115,19 +185,95 @@ type CreateSubscriptionDataReq struct {
 type UpdateSubscriptionDataReq struct {
 	UserUUID         uuid.UUID
 	SubscriptionUUID uuid.UUID
-	LabType          LabType
-	LabTopic         LabTopic
-	LabNumber        int
-	LabAuditorium    *int
+	LabType          lab.Type
+	LabTopic         lab.Topic
+	LabNumbers       []int
+	LabAuditoriums   []int // nil means any auditorium
+	ValidFrom        *time.Time
+	ValidUntil       *time.Time
+	SlotsBefore      *time.Time
 }
 
 func (r UpdateSubscriptionDataReq) Validate() error {
 	err := errors.NewValidationError()
-	if r.LabType == LabTypePerformance && r.LabAuditorium == nil {
-		err.Add("lab_type & lab_auditorium", "If lab type is equal to 'Performance' lab auditorium should be provided")
+	validateLabs(err, r.LabType, r.LabNumbers, r.LabAuditoriums)
+	validateValidityWindow(err, r.ValidFrom, r.ValidUntil)
+	if err.HasErrors() {
+		return err
 	}
-	if r.LabType == LabTypeDefence && r.LabAuditorium != nil {
-		err.Add("lab_type & lab_auditorium", "If lab type is equal to 'Defence' lab auditorium should not be provided")
+	return nil
+}
+
+func validateLabs(err *errors.ValidationError, labType lab.Type, numbers, auditoriums []int) {
+	if len(numbers) == 0 {
+		err.Add("lab_numbers", "At least one lab number should be provided")
+	}
+	for _, number := range numbers {
+		if number <= 0 {
+			err.Add("lab_numbers", "Lab numbers should be positive")
+			break
+		}
+	}
+	if auditoriums != nil && len(auditoriums) == 0 {
+		err.Add("lab_auditoriums", "Lab auditoriums should be omitted to match any auditorium")
+	}
+	if labType == lab.TypeDefence && auditoriums != nil {
+		err.Add("lab_type & lab_auditoriums", "If lab type is equal to 'Defence' lab auditoriums should not be provided")
+	}
+}
+
+func validateValidityWindow(err *errors.ValidationError, validFrom, validUntil *time.Time) {
+	if validFrom != nil && validUntil != nil && validUntil.Before(*validFrom) {
+		err.Add("valid_from & valid_until", "Valid until date should not be before valid from date")
+	}
+}
+
+// UpdateSubscriptionTimePreferencesReq replaces time preference overrides of the subscription. An empty map
+// removes the overrides, so the subscription falls back to the time preferences of the user
+type UpdateSubscriptionTimePreferencesReq struct {
+	SubscriptionUUID uuid.UUID
+	TimePreferences  map[types.DayOfWeek][]int
+}
+
+func (r UpdateSubscriptionTimePreferencesReq) Validate() error {
+	err := errors.NewValidationError()
+	for day, lessons := range r.TimePreferences {
+		if !slices.Contains(types.DaysOfWeek, day) {
+			err.Add("time_preferences", fmt.Sprintf("Unknown day of week '%s'", day))
+			continue
+		}
+		if len(lessons) == 0 {
+			err.Add("time_preferences", fmt.Sprintf("Lessons for '%s' should not be empty", day))
+		}
+		for _, lesson := range lessons {
+			if lesson <= 0 {
+				err.Add("time_preferences", fmt.Sprintf("Lessons for '%s' should be positive", day))
+				break
+			}
+		}
+	}
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
+
+type CreateTimeExclusionReq struct {
+	UserUUID uuid.UUID
+	StartsOn time.Time
+	EndsOn   time.Time
+	Reason   *string
+}
+
+const maxTimeExclusionReasonLength = 200
+
+func (r CreateTimeExclusionReq) Validate() error {
+	err := errors.NewValidationError()
+	if r.EndsOn.Before(r.StartsOn) {
+		err.Add("starts_on & ends_on", "End date should not be before start date")
+	}
+	if r.Reason != nil && len([]rune(*r.Reason)) > maxTimeExclusionReasonLength {
+		err.Add("reason", fmt.Sprintf("Reason should not be longer than %d characters", maxTimeExclusionReasonLength))
 	}
 	if err.HasErrors() {
 		return err
@@ -135,20 +281,48 @@ func (r UpdateSubscriptionDataReq) Validate() error {
 	return nil
 }
 
+type TimeExclusion struct {
+	ExclusionUUID uuid.UUID
+	StartsOn      time.Time
+	EndsOn        time.Time
+	Reason        *string
+}
+
 type GetMatchingSubscriptionsReq struct {
-	LabType        LabType
-	LabTopic       LabTopic
+	LabType        lab.Type
+	LabTopic       lab.Topic
 	LabNumber      int
 	LabAuditorium  int
 	AvailableSlots map[types.DayOfWeek]map[int][]string
+	SlotDates      map[types.DayOfWeek]map[int][]time.Time
+	Groups         []string // Nil means the slots are open to every group
+}
+
+// GetGoneSlotSubscriptionsReq describes lessons of a lab that were open in the previous poll and are gone now
+type GetGoneSlotSubscriptionsReq struct {
+	LabType       lab.Type
+	LabTopic      lab.Topic
+	LabNumber     int
+	LabAuditorium int
+	GoneTimeslots map[types.DayOfWeek][]int
+}
+
+type GetGoneSlotSubscriptionsRes struct {
+	UserUUID         uuid.UUID
+	SubscriptionUUID uuid.UUID
+	// GoneTimeslots are the gone lessons the subscription was notified about
+	GoneTimeslots map[types.DayOfWeek][]int
 }
 
 type GetSubscriptionRes struct {
 	SubscriptionUUID uuid.UUID
-	LabType          LabType
-	LabTopic         LabTopic
-	LabNumber        int
-	LabAuditorium    *int
+	LabType          lab.Type
+	LabTopic         lab.Topic
+	LabNumbers       []int
+	LabAuditoriums   []int
+	ValidFrom        *time.Time
+	ValidUntil       *time.Time
+	SlotsBefore      *time.Time
 	CreatedAt        time.Time
 	ClosedAt         *time.Time
 }
@@ -159,14 +333,190 @@ type GetMatchingSubscriptionsRes struct {
 	SuccessfulSubscriptions    int
 	LastSuccessfulSubscription *time.Time
 	MatchingTimeslots          map[types.DayOfWeek][]int
+	// NewTimeslots are the matching slots seen for the first time, StillOpenTimeslots are the rest of them
+	NewTimeslots       map[types.DayOfWeek][]int
+	StillOpenTimeslots map[types.DayOfWeek][]int
+	// Teachers are the acceptable teachers of the matching slots, preferred ones first in the order of preference
+	Teachers []string
+	// PreferredTeachers are the available teachers from the preferred list, in the order of preference
+	PreferredTeachers []string
+}
+
+type TeacherPreferences struct {
+	Mode                TeacherPreferenceMode
+	BlacklistedTeachers []string
+	PreferredTeachers   []string
+}
+
+// DefaultTeacherPreferences are used for users without stored teacher preferences
+var DefaultTeacherPreferences = TeacherPreferences{
+	Mode:                TeacherPreferenceModeBlacklist,
+	BlacklistedTeachers: []string{},
+	PreferredTeachers:   []string{},
+}
+
+func (p TeacherPreferences) validate(err *errors.ValidationError) {
+	if !slices.Contains(TeacherPreferenceModes, p.Mode) {
+		err.Add("mode", fmt.Sprintf("Unknown teacher preference mode '%s'", p.Mode))
+	}
+	if p.Mode == TeacherPreferenceModeWhitelist && len(p.PreferredTeachers) == 0 {
+		err.Add("preferred_teachers", "At least one preferred teacher should be provided in the 'Whitelist' mode")
+	}
+	for _, teacher := range p.PreferredTeachers {
+		if slices.Contains(p.BlacklistedTeachers, teacher) {
+			err.Add("preferred_teachers & blacklisted_teachers", fmt.Sprintf("Teacher '%s' can not be both preferred and blacklisted", teacher))
+			break
+		}
+	}
+}
+
+type UpdateTeacherPreferencesReq struct {
+	UserUUID uuid.UUID
+	TeacherPreferences
+}
+
+func (r UpdateTeacherPreferencesReq) Validate() error {
+	err := errors.NewValidationError()
+	r.TeacherPreferences.validate(err)
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
+
+// UpdateSubscriptionTeacherPreferencesReq sets teacher preference overrides of the subscription. Nil preferences
+// remove the overrides, so the subscription falls back to the teacher preferences of the user
+type UpdateSubscriptionTeacherPreferencesReq struct {
+	SubscriptionUUID   uuid.UUID
+	TeacherPreferences *TeacherPreferences
+}
+
+func (r UpdateSubscriptionTeacherPreferencesReq) Validate() error {
+	if r.TeacherPreferences == nil {
+		return nil
+	}
+	err := errors.NewValidationError()
+	r.TeacherPreferences.validate(err)
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
+
+type NotificationPreferences struct {
+	QuietHoursStart  *int
+	QuietHoursEnd    *int
+	DeliveryMode     DeliveryMode
+	DigestInterval   int
+	MaxPerHour       *int
+	PreferredChannel *string
+}
+
+// DefaultNotificationPreferences are used for users that never changed their preferences
+var DefaultNotificationPreferences = NotificationPreferences{
+	DeliveryMode: DeliveryModeImmediate,
+}
+
+type UpdateNotificationPreferencesReq struct {
+	UserUUID uuid.UUID
+	NotificationPreferences
+}
+
+func (r UpdateNotificationPreferencesReq) Validate() error {
+	err := errors.NewValidationError()
+	if (r.QuietHoursStart == nil) != (r.QuietHoursEnd == nil) {
+		err.Add("quiet_hours", "Both start and end of quiet hours should be provided")
+	}
+	for field, minutes := range map[string]*int{"quiet_hours_start": r.QuietHoursStart, "quiet_hours_end": r.QuietHoursEnd} {
+		if minutes != nil && (*minutes < 0 || *minutes >= 24*60) {
+			err.Add(field, "Should be a time of day between 00:00 and 23:59")
+		}
+	}
+	switch r.DeliveryMode {
+	case DeliveryModeImmediate:
+	case DeliveryModeDigest:
+		if r.DigestInterval <= 0 {
+			err.Add("digest_interval", "Should be positive in 'Digest' delivery mode")
+		}
+	default:
+		err.Add("delivery_mode", "Should be one of 'Immediate', 'Digest'")
+	}
+	if r.MaxPerHour != nil && *r.MaxPerHour <= 0 {
+		err.Add("max_per_hour", "Should be positive")
+	}
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
+
+// dbSearchEvent is a search encoded for GetMatchingSubscriptionsBySlots
+type dbSearchEvent struct {
+	EventIndex     int                                  `json:"event_index"`
+	LabType        string                               `json:"lab_type"`
+	LabTopic       string                               `json:"lab_topic"`
+	LabNumber      int                                  `json:"lab_number"`
+	LabAuditorium  int                                  `json:"lab_auditorium"`
+	AvailableSlots map[types.DayOfWeek]map[int][]string `json:"available_slots"`
+	SlotDates      map[types.DayOfWeek]map[int][]string `json:"slot_dates"`
+	Groups         []string                             `json:"groups"`
 }
 
 type keyGenerationParams struct {
 	subscriptionUUID uuid.UUID
-	labType          LabType
-	labTopic         LabTopic
+	labType          lab.Type
+	labTopic         lab.Topic
 	labNumber        int
 	labAuditorium    int
 	day              types.DayOfWeek
 	lesson           int
 }
+
+type claimedSlot struct {
+	match  int
+	day    types.DayOfWeek
+	lesson int
+}
+
+type SyncLabCatalogReq struct {
+	Types  []DBLabType
+	Topics []DBLabTopic
+}
+
+func (r SyncLabCatalogReq) Validate() error {
+	err := errors.NewValidationError()
+	if len(r.Types) == 0 {
+		err.Add("types", "At least one lab type should be provided")
+	}
+	if len(r.Topics) == 0 {
+		err.Add("topics", "At least one lab topic should be provided")
+	}
+	seenTypes := make(map[lab.Type]struct{}, len(r.Types))
+	for _, labType := range r.Types {
+		if labType.Code == "" || labType.Name == "" {
+			err.Add("types", "Lab types should have a code and a name")
+		} else if _, ok := seenTypes[labType.Code]; ok {
+			err.Add("types", fmt.Sprintf("Lab type '%s' is listed twice", labType.Code))
+		}
+		seenTypes[labType.Code] = struct{}{}
+	}
+	seenTopics := make(map[lab.Topic]struct{}, len(r.Topics))
+	for _, topic := range r.Topics {
+		if topic.Code == "" || topic.Name == "" {
+			err.Add("topics", "Lab topics should have a code and a name")
+		} else if _, ok := seenTopics[topic.Code]; ok {
+			err.Add("topics", fmt.Sprintf("Lab topic '%s' is listed twice", topic.Code))
+		}
+		seenTopics[topic.Code] = struct{}{}
+	}
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
+
+// GetLabCatalogRes lists the active lab types and topics
+type GetLabCatalogRes struct {
+	Types  []DBLabType
+	Topics []DBLabTopic
+}
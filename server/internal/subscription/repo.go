@@ -3,10 +3,9 @@ package subscription
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	stderrors "errors"
 	"labgrab/internal/shared/errors"
 	"labgrab/internal/shared/types"
-	"log/slog"
 	"time"
 
 	"github.com/Masterminds/squirrel"
@@ -15,6 +14,39 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Repository is the storage used by Service. Repo implements it on postgres
+type Repository interface {
+	CreateSubscription(ctx context.Context, sub *DBSubscription) (uuid.UUID, error)
+	GetSubscription(ctx context.Context, subscriptionUUID uuid.UUID) (*DBSubscription, error)
+	GetSubscriptions(ctx context.Context, userUUID uuid.UUID) ([]DBSubscription, error)
+	UpdateSubscription(ctx context.Context, sub *DBSubscription) error
+	HasOverlappingSubscription(ctx context.Context, sub *DBSubscription) (bool, error)
+	CloseSubscription(ctx context.Context, subscriptionUUID uuid.UUID) error
+	CloseExpiredSubscriptions(ctx context.Context) (int64, error)
+	RestoreSubscription(ctx context.Context, subscriptionUUID uuid.UUID) error
+	DeleteSubscription(ctx context.Context, subscriptionUUID uuid.UUID) error
+	CreateSubscriptionData(ctx context.Context, data *DBUserSubscriptionData, tx pgx.Tx) error
+	GetSubscriptionTimePreferences(ctx context.Context, subscriptionUUID uuid.UUID) ([]DBSubscriptionTimePreferences, error)
+	SetSubscriptionTimePreferences(ctx context.Context, subscriptionUUID uuid.UUID, preferences []DBSubscriptionTimePreferences) error
+	GetTeacherPreferences(ctx context.Context, userUUID uuid.UUID) (*DBTeacherPreferences, error)
+	SetTeacherPreferences(ctx context.Context, preferences *DBTeacherPreferences) error
+	GetSubscriptionTeacherPreferences(ctx context.Context, subscriptionUUID uuid.UUID) (*DBSubscriptionTeacherPreferences, error)
+	SetSubscriptionTeacherPreferences(ctx context.Context, preferences *DBSubscriptionTeacherPreferences) error
+	DeleteSubscriptionTeacherPreferences(ctx context.Context, subscriptionUUID uuid.UUID) error
+	CreateTimeExclusion(ctx context.Context, exclusion *DBTimeExclusion) (uuid.UUID, error)
+	GetTimeExclusions(ctx context.Context, userUUID uuid.UUID) ([]DBTimeExclusion, error)
+	DeleteTimeExclusion(ctx context.Context, userUUID, exclusionUUID uuid.UUID) (bool, error)
+	GetMatchingSubscriptionsBySlot(ctx context.Context, search *DBSubscriptionSearch) ([]DBSubscriptionMatchResult, error)
+	GetMatchingSubscriptionsBySlots(ctx context.Context, searches []DBSubscriptionSearch) ([][]DBSubscriptionMatchResult, error)
+	GetNotificationPreferences(ctx context.Context, userUUID uuid.UUID) (*DBNotificationPreferences, error)
+	SetNotificationPreferences(ctx context.Context, preferences *DBNotificationPreferences) error
+	SyncLabCatalog(ctx context.Context, labTypes []DBLabType, topics []DBLabTopic) error
+	GetLabTypes(ctx context.Context) ([]DBLabType, error)
+	GetLabTopics(ctx context.Context) ([]DBLabTopic, error)
+}
+
+var _ Repository = (*Repo)(nil)
+
 type Repo struct {
 	pool *pgxpool.Pool
 	sq   squirrel.StatementBuilderType
@@ -34,8 +66,30 @@ func (r *Repo) CreateSubscription(ctx context.Context, sub *DBSubscription) (uui
 		}
 	}
 	query, args, err := r.sq.Insert("subscription_service.subscriptions").
-		Columns("subscription_uuid", "lab_type", "lab_topic", "lab_number", "lab_auditorium", "created_at", "user_uuid").
-		Values(subscriptionUUID, sub.LabType, sub.LabTopic, sub.LabNumber, sub.LabAuditorium, sub.CreatedAt, sub.UserUUID).
+		Columns(
+			"subscription_uuid",
+			"lab_type",
+			"lab_topic",
+			"lab_numbers",
+			"lab_auditoriums",
+			"valid_from",
+			"valid_until",
+			"slots_before",
+			"created_at",
+			"user_uuid",
+		).
+		Values(
+			subscriptionUUID,
+			sub.LabType,
+			sub.LabTopic,
+			sub.LabNumbers,
+			sub.LabAuditoriums,
+			sub.ValidFrom,
+			sub.ValidUntil,
+			sub.SlotsBefore,
+			sub.CreatedAt,
+			sub.UserUUID,
+		).
 		ToSql()
 	if err != nil {
 		return uuid.Nil, &errors.ErrDBProcedure{
@@ -62,8 +116,11 @@ func (r *Repo) GetSubscription(ctx context.Context, subscriptionUUID uuid.UUID)
 		"subscription_uuid",
 		"lab_type",
 		"lab_topic",
-		"lab_number",
-		"lab_auditorium",
+		"lab_numbers",
+		"lab_auditoriums",
+		"valid_from",
+		"valid_until",
+		"slots_before",
 		"created_at",
 		"closed_at",
 		"user_uuid",
@@ -85,8 +142,11 @@ func (r *Repo) GetSubscription(ctx context.Context, subscriptionUUID uuid.UUID)
 		&sub.SubscriptionUUID,
 		&sub.LabType,
 		&sub.LabTopic,
-		&sub.LabNumber,
-		&sub.LabAuditorium,
+		&sub.LabNumbers,
+		&sub.LabAuditoriums,
+		&sub.ValidFrom,
+		&sub.ValidUntil,
+		&sub.SlotsBefore,
 		&sub.CreatedAt,
 		&sub.ClosedAt,
 		&sub.UserUUID,
@@ -107,8 +167,11 @@ func (r *Repo) GetSubscriptions(ctx context.Context, userUUID uuid.UUID) ([]DBSu
 		"subscription_uuid",
 		"lab_type",
 		"lab_topic",
-		"lab_number",
-		"lab_auditorium",
+		"lab_numbers",
+		"lab_auditoriums",
+		"valid_from",
+		"valid_until",
+		"slots_before",
 		"created_at",
 		"closed_at",
 		"user_uuid",
@@ -141,8 +204,11 @@ func (r *Repo) GetSubscriptions(ctx context.Context, userUUID uuid.UUID) ([]DBSu
 			&sub.SubscriptionUUID,
 			&sub.LabType,
 			&sub.LabTopic,
-			&sub.LabNumber,
-			&sub.LabAuditorium,
+			&sub.LabNumbers,
+			&sub.LabAuditoriums,
+			&sub.ValidFrom,
+			&sub.ValidUntil,
+			&sub.SlotsBefore,
 			&sub.CreatedAt,
 			&sub.ClosedAt,
 			&sub.UserUUID,
@@ -172,8 +238,11 @@ func (r *Repo) UpdateSubscription(ctx context.Context, sub *DBSubscription) erro
 	query, args, err := r.sq.Update("subscription_service.subscriptions").
 		Set("lab_type", sub.LabType).
 		Set("lab_topic", sub.LabTopic).
-		Set("lab_number", sub.LabNumber).
-		Set("lab_auditorium", sub.LabAuditorium).
+		Set("lab_numbers", sub.LabNumbers).
+		Set("lab_auditoriums", sub.LabAuditoriums).
+		Set("valid_from", sub.ValidFrom).
+		Set("valid_until", sub.ValidUntil).
+		Set("slots_before", sub.SlotsBefore).
 		Where(squirrel.Eq{"subscription_uuid": sub.SubscriptionUUID}).
 		ToSql()
 	if err != nil {
@@ -195,6 +264,43 @@ func (r *Repo) UpdateSubscription(ctx context.Context, sub *DBSubscription) erro
 	return nil
 }
 
+// HasOverlappingSubscription reports whether another open subscription of the user covers the same lab type and
+// topic and shares a lab number and an auditorium with sub. Nil auditoriums cover every auditorium
+func (r *Repo) HasOverlappingSubscription(ctx context.Context, sub *DBSubscription) (bool, error) {
+	overlapping := r.sq.Select("1").
+		From("subscription_service.subscriptions").
+		Where(squirrel.Eq{
+			"user_uuid": sub.UserUUID,
+			"lab_type":  sub.LabType,
+			"lab_topic": sub.LabTopic,
+			"closed_at": nil,
+		}).
+		Where(squirrel.NotEq{"subscription_uuid": sub.SubscriptionUUID}).
+		Where("lab_numbers && ?", sub.LabNumbers)
+	if sub.LabAuditoriums != nil {
+		overlapping = overlapping.Where("(lab_auditoriums IS NULL OR lab_auditoriums && ?)", sub.LabAuditoriums)
+	}
+
+	query, args, err := overlapping.Prefix("SELECT EXISTS (").Suffix(")").ToSql()
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "HasOverlappingSubscription",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var exists bool
+	if err := r.pool.QueryRow(ctx, query, args...).Scan(&exists); err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "HasOverlappingSubscription",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return exists, nil
+}
+
 func (r *Repo) CloseSubscription(ctx context.Context, subscriptionUUID uuid.UUID) error {
 	query, args, err := r.sq.Update("subscription_service.subscriptions").
 		Set("closed_at", squirrel.Expr("NOW()")).
@@ -219,6 +325,36 @@ func (r *Repo) CloseSubscription(ctx context.Context, subscriptionUUID uuid.UUID
 	return nil
 }
 
+// CloseExpiredSubscriptions closes open subscriptions that can no longer match: their validity window is over
+// or every slot they accept is already in the past. Returns the number of closed subscriptions
+func (r *Repo) CloseExpiredSubscriptions(ctx context.Context) (int64, error) {
+	query, args, err := r.sq.Update("subscription_service.subscriptions").
+		Set("closed_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"closed_at": nil}).
+		Where(squirrel.Or{
+			squirrel.Expr("valid_until < CURRENT_DATE"),
+			squirrel.Expr("slots_before <= CURRENT_DATE"),
+		}).
+		ToSql()
+	if err != nil {
+		return 0, &errors.ErrDBProcedure{
+			Procedure: "CloseExpiredSubscriptions",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, &errors.ErrDBProcedure{
+			Procedure: "CloseExpiredSubscriptions",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return tag.RowsAffected(), nil
+}
+
 func (r *Repo) RestoreSubscription(ctx context.Context, subscriptionUUID uuid.UUID) error {
 	query, args, err := r.sq.Update("subscription_service.subscriptions").
 		Set("closed_at", nil).
@@ -335,56 +471,562 @@ func (r *Repo) CreateSubscriptionData(ctx context.Context, data *DBUserSubscript
 	return nil
 }
 
+func (r *Repo) GetSubscriptionTimePreferences(ctx context.Context, subscriptionUUID uuid.UUID) ([]DBSubscriptionTimePreferences, error) {
+	query, args, err := r.sq.Select(
+		"day_of_week",
+		"lessons",
+		"subscription_uuid",
+	).
+		From("subscription_service.subscription_time_preferences").
+		Where(squirrel.Eq{"subscription_uuid": subscriptionUUID}).
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetSubscriptionTimePreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetSubscriptionTimePreferences",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var preferences []DBSubscriptionTimePreferences
+	for rows.Next() {
+		var preference DBSubscriptionTimePreferences
+		var dayOfWeek string
+		err = rows.Scan(
+			&dayOfWeek,
+			&preference.Lessons,
+			&preference.SubscriptionUUID,
+		)
+		if err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetSubscriptionTimePreferences",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		preference.DayOfWeek = types.DayOfWeek(dayOfWeek)
+		preferences = append(preferences, preference)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetSubscriptionTimePreferences",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return preferences, nil
+}
+
+// SetSubscriptionTimePreferences replaces all time preference overrides of the subscription
+func (r *Repo) SetSubscriptionTimePreferences(ctx context.Context, subscriptionUUID uuid.UUID, preferences []DBSubscriptionTimePreferences) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		query, args, err := r.sq.Delete("subscription_service.subscription_time_preferences").
+			Where(squirrel.Eq{"subscription_uuid": subscriptionUUID}).
+			ToSql()
+		if err != nil {
+			return &errors.ErrDBProcedure{
+				Procedure: "SetSubscriptionTimePreferences",
+				Step:      "Query setup",
+				Err:       err,
+			}
+		}
+		if _, err = tx.Exec(ctx, query, args...); err != nil {
+			return &errors.ErrDBProcedure{
+				Procedure: "SetSubscriptionTimePreferences",
+				Step:      "Query execution",
+				Err:       err,
+			}
+		}
+
+		if len(preferences) == 0 {
+			return nil
+		}
+
+		insert := r.sq.Insert("subscription_service.subscription_time_preferences").
+			Columns("day_of_week", "lessons", "subscription_uuid")
+		for _, preference := range preferences {
+			insert = insert.Values(preference.DayOfWeek, preference.Lessons, subscriptionUUID)
+		}
+		query, args, err = insert.ToSql()
+		if err != nil {
+			return &errors.ErrDBProcedure{
+				Procedure: "SetSubscriptionTimePreferences",
+				Step:      "Query setup",
+				Err:       err,
+			}
+		}
+		if _, err = tx.Exec(ctx, query, args...); err != nil {
+			return &errors.ErrDBProcedure{
+				Procedure: "SetSubscriptionTimePreferences",
+				Step:      "Query execution",
+				Err:       err,
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetTeacherPreferences returns teacher preferences of the user or nil if there are none
+func (r *Repo) GetTeacherPreferences(ctx context.Context, userUUID uuid.UUID) (*DBTeacherPreferences, error) {
+	query, args, err := r.sq.Select(
+		"mode",
+		"blacklisted_teachers",
+		"preferred_teachers",
+		"user_uuid",
+	).
+		From("subscription_service.teacher_preferences").
+		Where(squirrel.Eq{"user_uuid": userUUID}).
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetTeacherPreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var preferences DBTeacherPreferences
+	var mode string
+	err = r.pool.QueryRow(ctx, query, args...).Scan(
+		&mode,
+		&preferences.BlacklistedTeachers,
+		&preferences.PreferredTeachers,
+		&preferences.UserUUID,
+	)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetTeacherPreferences",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+	preferences.Mode = TeacherPreferenceMode(mode)
+
+	return &preferences, nil
+}
+
+func (r *Repo) SetTeacherPreferences(ctx context.Context, preferences *DBTeacherPreferences) error {
+	query, args, err := r.sq.Insert("subscription_service.teacher_preferences").
+		Columns("mode", "blacklisted_teachers", "preferred_teachers", "user_uuid").
+		Values(string(preferences.Mode), preferences.BlacklistedTeachers, preferences.PreferredTeachers, preferences.UserUUID).
+		Suffix(`ON CONFLICT (user_uuid) DO UPDATE SET
+			mode = EXCLUDED.mode,
+			blacklisted_teachers = EXCLUDED.blacklisted_teachers,
+			preferred_teachers = EXCLUDED.preferred_teachers`).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetTeacherPreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetTeacherPreferences",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// GetSubscriptionTeacherPreferences returns teacher preference overrides of the subscription or nil if there are none
+func (r *Repo) GetSubscriptionTeacherPreferences(ctx context.Context, subscriptionUUID uuid.UUID) (*DBSubscriptionTeacherPreferences, error) {
+	query, args, err := r.sq.Select(
+		"mode",
+		"blacklisted_teachers",
+		"preferred_teachers",
+		"subscription_uuid",
+	).
+		From("subscription_service.subscription_teacher_preferences").
+		Where(squirrel.Eq{"subscription_uuid": subscriptionUUID}).
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetSubscriptionTeacherPreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var preferences DBSubscriptionTeacherPreferences
+	var mode string
+	err = r.pool.QueryRow(ctx, query, args...).Scan(
+		&mode,
+		&preferences.BlacklistedTeachers,
+		&preferences.PreferredTeachers,
+		&preferences.SubscriptionUUID,
+	)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetSubscriptionTeacherPreferences",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+	preferences.Mode = TeacherPreferenceMode(mode)
+
+	return &preferences, nil
+}
+
+func (r *Repo) SetSubscriptionTeacherPreferences(ctx context.Context, preferences *DBSubscriptionTeacherPreferences) error {
+	query, args, err := r.sq.Insert("subscription_service.subscription_teacher_preferences").
+		Columns("mode", "blacklisted_teachers", "preferred_teachers", "subscription_uuid").
+		Values(string(preferences.Mode), preferences.BlacklistedTeachers, preferences.PreferredTeachers, preferences.SubscriptionUUID).
+		Suffix(`ON CONFLICT (subscription_uuid) DO UPDATE SET
+			mode = EXCLUDED.mode,
+			blacklisted_teachers = EXCLUDED.blacklisted_teachers,
+			preferred_teachers = EXCLUDED.preferred_teachers`).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetSubscriptionTeacherPreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetSubscriptionTeacherPreferences",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+func (r *Repo) DeleteSubscriptionTeacherPreferences(ctx context.Context, subscriptionUUID uuid.UUID) error {
+	query, args, err := r.sq.Delete("subscription_service.subscription_teacher_preferences").
+		Where(squirrel.Eq{"subscription_uuid": subscriptionUUID}).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "DeleteSubscriptionTeacherPreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "DeleteSubscriptionTeacherPreferences",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+func (r *Repo) CreateTimeExclusion(ctx context.Context, exclusion *DBTimeExclusion) (uuid.UUID, error) {
+	exclusionUUID, err := uuid.NewUUID()
+	if err != nil {
+		return uuid.Nil, &errors.ErrDBProcedure{
+			Procedure: "CreateTimeExclusion",
+			Step:      "UUID generation",
+			Err:       err,
+		}
+	}
+	query, args, err := r.sq.Insert("subscription_service.time_exclusions").
+		Columns("exclusion_uuid", "starts_on", "ends_on", "reason", "user_uuid").
+		Values(exclusionUUID, exclusion.StartsOn, exclusion.EndsOn, exclusion.Reason, exclusion.UserUUID).
+		ToSql()
+	if err != nil {
+		return uuid.Nil, &errors.ErrDBProcedure{
+			Procedure: "CreateTimeExclusion",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return uuid.Nil, &errors.ErrDBProcedure{
+			Procedure: "CreateTimeExclusion",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return exclusionUUID, nil
+}
+
+func (r *Repo) GetTimeExclusions(ctx context.Context, userUUID uuid.UUID) ([]DBTimeExclusion, error) {
+	query, args, err := r.sq.Select(
+		"exclusion_uuid",
+		"starts_on",
+		"ends_on",
+		"reason",
+		"user_uuid",
+	).
+		From("subscription_service.time_exclusions").
+		Where(squirrel.Eq{"user_uuid": userUUID}).
+		OrderBy("starts_on", "ends_on").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetTimeExclusions",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetTimeExclusions",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var exclusions []DBTimeExclusion
+	for rows.Next() {
+		var exclusion DBTimeExclusion
+		err = rows.Scan(
+			&exclusion.ExclusionUUID,
+			&exclusion.StartsOn,
+			&exclusion.EndsOn,
+			&exclusion.Reason,
+			&exclusion.UserUUID,
+		)
+		if err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetTimeExclusions",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetTimeExclusions",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return exclusions, nil
+}
+
+// DeleteTimeExclusion deletes the exclusion if it belongs to the user. Returns false when nothing was deleted
+func (r *Repo) DeleteTimeExclusion(ctx context.Context, userUUID, exclusionUUID uuid.UUID) (bool, error) {
+	query, args, err := r.sq.Delete("subscription_service.time_exclusions").
+		Where(squirrel.Eq{"exclusion_uuid": exclusionUUID, "user_uuid": userUUID}).
+		ToSql()
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "DeleteTimeExclusion",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, &errors.ErrDBProcedure{
+			Procedure: "DeleteTimeExclusion",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetMatchingSubscriptionsBySlot matches a single event, it is GetMatchingSubscriptionsBySlots with one search
 func (r *Repo) GetMatchingSubscriptionsBySlot(ctx context.Context, search *DBSubscriptionSearch) ([]DBSubscriptionMatchResult, error) {
-	availableSlotsJSON, err := convertAvailableSlotsToJSON(search.AvailableSlots)
-	fmt.Println(availableSlotsJSON)
+	results, err := r.GetMatchingSubscriptionsBySlots(ctx, []DBSubscriptionSearch{*search})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// GetMatchingSubscriptionsBySlots finds open subscriptions that match the slots of every search in a single
+// query. Matches of a search are ordered by the number of successful subscriptions of the user and then by the
+// last of them, so that users that got fewer slots come first. The result has one entry per search, in the
+// same order
+func (r *Repo) GetMatchingSubscriptionsBySlots(ctx context.Context, searches []DBSubscriptionSearch) ([][]DBSubscriptionMatchResult, error) {
+	results := make([][]DBSubscriptionMatchResult, len(searches))
+	if len(searches) == 0 {
+		return results, nil
+	}
+
+	searchesJSON, err := convertSearchesToJSON(searches)
 	if err != nil {
 		return nil, &errors.ErrDBProcedure{
-			Procedure: "GetMatchingSubscriptionsBySlot",
+			Procedure: "GetMatchingSubscriptionsBySlots",
 			Step:      "JSON conversion",
 			Err:       err,
 		}
 	}
 
 	query := `
-WITH available_slots_expanded AS (
-    SELECT 
+WITH events AS (
+    SELECT
+        (e ->> 'event_index')::int AS event_index,
+        e ->> 'lab_type' AS lab_type,
+        e ->> 'lab_topic' AS lab_topic,
+        (e ->> 'lab_number')::int AS lab_number,
+        (e ->> 'lab_auditorium')::int AS lab_auditorium,
+        e -> 'available_slots' AS available_slots,
+        COALESCE(e -> 'slot_dates', '{}'::jsonb) AS slot_dates,
+        CASE WHEN jsonb_typeof(e -> 'groups') = 'array'
+            THEN ARRAY(SELECT jsonb_array_elements_text(e -> 'groups'))
+        END AS groups
+    FROM jsonb_array_elements($1::jsonb) AS e
+),
+available_slots_expanded AS (
+    SELECT
+        ev.event_index,
+        ev.lab_type,
+        ev.lab_topic,
+        ev.lab_number,
+        ev.lab_auditorium,
+        ev.groups,
         days.key::text AS day_of_week,
         lessons.key::int AS lesson,
-        lessons.value AS teachers
-    FROM jsonb_each($5::jsonb) AS days,
+        lessons.value AS teachers,
+        COALESCE(ev.slot_dates -> days.key -> lessons.key, '[]'::jsonb) AS dates
+    FROM events ev,
+         LATERAL jsonb_each(ev.available_slots) AS days,
          LATERAL jsonb_each(days.value) AS lessons
 ),
 matching_subscriptions AS (
-    SELECT 
+    SELECT
+        ase.event_index,
         s.subscription_uuid,
         s.user_uuid,
         d.successful_subscriptions,
         d.last_successful_subscription,
         ase.day_of_week::day_of_week,
-        ase.lesson
-    FROM subscription_service.subscriptions s
+        ase.lesson,
+        ase.teachers,
+        teachp.mode,
+        teachp.blacklisted_teachers,
+        teachp.preferred_teachers
+    FROM available_slots_expanded ase
+    INNER JOIN subscription_service.subscriptions s
+        ON s.lab_type = ase.lab_type
+        AND s.lab_topic = ase.lab_topic
+        AND s.lab_numbers @> ARRAY[ase.lab_number]
+        AND (s.lab_auditoriums IS NULL OR ase.lab_auditorium = ANY(s.lab_auditoriums))
+        AND s.closed_at IS NULL
     INNER JOIN subscription_service.details d ON s.user_uuid = d.user_uuid
-    CROSS JOIN available_slots_expanded ase
-    INNER JOIN subscription_service.time_preferences tp 
-        ON s.user_uuid = tp.user_uuid 
-        AND tp.day_of_week = ase.day_of_week::day_of_week
+    INNER JOIN LATERAL (
+        -- Subscription level overrides win over the time preferences of the user
+        SELECT stp.day_of_week, stp.lessons
+        FROM subscription_service.subscription_time_preferences stp
+        WHERE stp.subscription_uuid = s.subscription_uuid
+        UNION ALL
+        SELECT utp.day_of_week, utp.lessons
+        FROM subscription_service.time_preferences utp
+        WHERE utp.user_uuid = s.user_uuid
+          AND NOT EXISTS (
+              SELECT 1
+              FROM subscription_service.subscription_time_preferences o
+              WHERE o.subscription_uuid = s.subscription_uuid
+          )
+    ) tp
+        ON tp.day_of_week = ase.day_of_week::day_of_week
         AND ase.lesson = ANY(tp.lessons)
-    INNER JOIN subscription_service.teacher_preferences teachp 
-        ON s.user_uuid = teachp.user_uuid
-    WHERE s.lab_type = $1
-      AND s.lab_topic = $2
-      AND s.lab_number = $3
-      AND (s.lab_auditorium IS NULL OR s.lab_auditorium = $4)
-      AND s.closed_at IS NULL
+    INNER JOIN LATERAL (
+        -- Same precedence for teacher preferences
+        SELECT stp.mode, stp.blacklisted_teachers, stp.preferred_teachers
+        FROM subscription_service.subscription_teacher_preferences stp
+        WHERE stp.subscription_uuid = s.subscription_uuid
+        UNION ALL
+        SELECT utp.mode, utp.blacklisted_teachers, utp.preferred_teachers
+        FROM subscription_service.teacher_preferences utp
+        WHERE utp.user_uuid = s.user_uuid
+          AND NOT EXISTS (
+              SELECT 1
+              FROM subscription_service.subscription_teacher_preferences o
+              WHERE o.subscription_uuid = s.subscription_uuid
+          )
+    ) teachp ON TRUE
+    WHERE (
+          -- Restricted slots are open to listed groups and to groups of listed streams: "ИУ-12" covers "ИУ-12-3"
+          ase.groups IS NULL
+          OR EXISTS (
+              SELECT 1
+              FROM user_service.users_details ud
+              CROSS JOIN unnest(ase.groups) allowed_group
+              WHERE ud.user_uuid = s.user_uuid
+                AND (upper(ud.group_code) = allowed_group
+                     OR starts_with(upper(ud.group_code), allowed_group || '-'))
+          )
+      )
+      AND (s.valid_from IS NULL OR s.valid_from <= CURRENT_DATE)
+      AND (s.valid_until IS NULL OR s.valid_until >= CURRENT_DATE)
+      AND (
+          (jsonb_array_length(ase.dates) = 0 AND s.slots_before IS NULL)
+          OR EXISTS (
+              SELECT 1
+              FROM jsonb_array_elements_text(ase.dates) slot_date
+              WHERE (s.slots_before IS NULL OR slot_date::date < s.slots_before)
+                AND NOT EXISTS (
+                    SELECT 1
+                    FROM subscription_service.time_exclusions te
+                    WHERE te.user_uuid = s.user_uuid
+                      AND slot_date::date BETWEEN te.starts_on AND te.ends_on
+                )
+          )
+      )
+      -- Every mode needs a suitable teacher, a slot without a known teacher matches nobody
       AND EXISTS (
-          SELECT 1 
+          SELECT 1
           FROM jsonb_array_elements_text(ase.teachers) teacher
-          WHERE teacher != ALL(teachp.blacklisted_teachers)
+          WHERE CASE teachp.mode
+              WHEN 'Whitelist' THEN teacher = ANY(teachp.preferred_teachers)
+              ELSE teacher != ALL(teachp.blacklisted_teachers)
+          END
       )
 ),
+matched_teachers AS (
+    SELECT DISTINCT
+        ms.event_index,
+        ms.subscription_uuid,
+        teacher,
+        array_position(ms.preferred_teachers, teacher) AS preference_rank
+    FROM matching_subscriptions ms
+    CROSS JOIN LATERAL jsonb_array_elements_text(ms.teachers) teacher
+    WHERE CASE ms.mode
+        WHEN 'Whitelist' THEN teacher = ANY(ms.preferred_teachers)
+        ELSE teacher != ALL(ms.blacklisted_teachers)
+    END
+),
 grouped_by_day AS (
-    SELECT 
+    SELECT
+        event_index,
         user_uuid,
         subscription_uuid,
         successful_subscriptions,
@@ -392,58 +1034,71 @@ grouped_by_day AS (
         day_of_week,
         jsonb_agg(DISTINCT lesson ORDER BY lesson) as lessons_array
     FROM matching_subscriptions
-    GROUP BY user_uuid, subscription_uuid, successful_subscriptions, last_successful_subscription, day_of_week
+    GROUP BY event_index, user_uuid, subscription_uuid, successful_subscriptions, last_successful_subscription, day_of_week
 )
-SELECT 
+SELECT
+    event_index,
     user_uuid,
     subscription_uuid,
     successful_subscriptions,
     last_successful_subscription,
-    jsonb_object_agg(day_of_week, lessons_array) as matching_timeslots
+    jsonb_object_agg(day_of_week, lessons_array) as matching_timeslots,
+    COALESCE((
+        SELECT jsonb_agg(mt.teacher ORDER BY mt.preference_rank NULLS LAST, mt.teacher)
+        FROM matched_teachers mt
+        WHERE mt.event_index = grouped_by_day.event_index
+          AND mt.subscription_uuid = grouped_by_day.subscription_uuid
+    ), '[]'::jsonb) as teachers,
+    COALESCE((
+        SELECT jsonb_agg(mt.teacher ORDER BY mt.preference_rank)
+        FROM matched_teachers mt
+        WHERE mt.event_index = grouped_by_day.event_index
+          AND mt.subscription_uuid = grouped_by_day.subscription_uuid
+          AND mt.preference_rank IS NOT NULL
+    ), '[]'::jsonb) as preferred_teachers
 FROM grouped_by_day
-GROUP BY user_uuid, subscription_uuid, successful_subscriptions, last_successful_subscription
-ORDER BY 
+GROUP BY event_index, user_uuid, subscription_uuid, successful_subscriptions, last_successful_subscription
+ORDER BY
+    event_index ASC,
     successful_subscriptions ASC,
     last_successful_subscription ASC NULLS FIRST
 `
 
-	rows, err := r.pool.Query(ctx, query,
-		search.LabType,
-		search.LabTopic,
-		search.LabNumber,
-		search.LabAuditorium,
-		availableSlotsJSON,
-	)
+	rows, err := r.pool.Query(ctx, query, searchesJSON)
 	if err != nil {
 		return nil, &errors.ErrDBProcedure{
-			Procedure: "GetMatchingSubscriptionsBySlot",
+			Procedure: "GetMatchingSubscriptionsBySlots",
 			Step:      "Query execution",
 			Err:       err,
 		}
 	}
 	defer rows.Close()
 
-	var results []DBSubscriptionMatchResult
-
 	for rows.Next() {
 		var (
+			eventIndex                 int
 			userUUID                   uuid.UUID
 			subscriptionUUID           uuid.UUID
 			successfulSubscriptions    int
 			lastSuccessfulSubscription *time.Time
 			matchingTimeslotsJSON      []byte
+			teachers                   []string
+			preferredTeachers          []string
 		)
 
 		err = rows.Scan(
+			&eventIndex,
 			&userUUID,
 			&subscriptionUUID,
 			&successfulSubscriptions,
 			&lastSuccessfulSubscription,
 			&matchingTimeslotsJSON,
+			&teachers,
+			&preferredTeachers,
 		)
 		if err != nil {
 			return nil, &errors.ErrDBProcedure{
-				Procedure: "GetMatchingSubscriptionsBySlot",
+				Procedure: "GetMatchingSubscriptionsBySlots",
 				Step:      "Row scanning",
 				Err:       err,
 			}
@@ -452,38 +1107,66 @@ ORDER BY
 		matchingTimeslots, err := convertJSONToMatchingTimeslots(matchingTimeslotsJSON)
 		if err != nil {
 			return nil, &errors.ErrDBProcedure{
-				Procedure: "GetMatchingSubscriptionsBySlot",
+				Procedure: "GetMatchingSubscriptionsBySlots",
 				Step:      "JSON conversion",
 				Err:       err,
 			}
 		}
 
-		results = append(results, DBSubscriptionMatchResult{
+		results[eventIndex] = append(results[eventIndex], DBSubscriptionMatchResult{
 			UserUUID:                   userUUID,
 			SubscriptionUUID:           subscriptionUUID,
 			SuccessfulSubscriptions:    successfulSubscriptions,
 			LastSuccessfulSubscription: lastSuccessfulSubscription,
 			MatchingTimeslots:          matchingTimeslots,
+			Teachers:                   teachers,
+			PreferredTeachers:          preferredTeachers,
 		})
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, &errors.ErrDBProcedure{
-			Procedure: "GetMatchingSubscriptionsBySlot",
+			Procedure: "GetMatchingSubscriptionsBySlots",
 			Step:      "Row error check",
 			Err:       err,
 		}
 	}
 
-	for _, result := range results {
-		slog.Info("result", result)
-	}
-
 	return results, nil
 }
 
-func convertAvailableSlotsToJSON(slots map[types.DayOfWeek]map[int][]string) ([]byte, error) {
-	return json.Marshal(slots)
+// formatSlotDates keeps only the calendar date of every slot, the time of day is already encoded by the lesson
+func formatSlotDates(dates map[types.DayOfWeek]map[int][]time.Time) map[types.DayOfWeek]map[int][]string {
+	result := make(map[types.DayOfWeek]map[int][]string, len(dates))
+	for day, lessons := range dates {
+		result[day] = make(map[int][]string, len(lessons))
+		for lesson, datetimes := range lessons {
+			formatted := make([]string, len(datetimes))
+			for i, datetime := range datetimes {
+				formatted[i] = datetime.Format(time.DateOnly)
+			}
+			result[day][lesson] = formatted
+		}
+	}
+	return result
+}
+
+// convertSearchesToJSON encodes the searches as one json array, every element carries its index in searches
+func convertSearchesToJSON(searches []DBSubscriptionSearch) ([]byte, error) {
+	events := make([]dbSearchEvent, len(searches))
+	for i, search := range searches {
+		events[i] = dbSearchEvent{
+			EventIndex:     i,
+			LabType:        string(search.LabType),
+			LabTopic:       string(search.LabTopic),
+			LabNumber:      search.LabNumber,
+			LabAuditorium:  search.LabAuditorium,
+			AvailableSlots: search.AvailableSlots,
+			SlotDates:      formatSlotDates(search.SlotDates),
+			Groups:         search.Groups,
+		}
+	}
+	return json.Marshal(events)
 }
 
 func convertJSONToMatchingTimeslots(data []byte) (map[types.DayOfWeek][]int, error) {
@@ -499,3 +1182,262 @@ func convertJSONToMatchingTimeslots(data []byte) (map[types.DayOfWeek][]int, err
 
 	return result, nil
 }
+
+// GetNotificationPreferences returns preferences of the user or nil if the user never changed them
+func (r *Repo) GetNotificationPreferences(ctx context.Context, userUUID uuid.UUID) (*DBNotificationPreferences, error) {
+	query, args, err := r.sq.Select(
+		"quiet_hours_start",
+		"quiet_hours_end",
+		"delivery_mode",
+		"digest_interval",
+		"max_per_hour",
+		"preferred_channel",
+		"user_uuid",
+	).
+		From("subscription_service.notification_preferences").
+		Where(squirrel.Eq{"user_uuid": userUUID}).
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetNotificationPreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	var preferences DBNotificationPreferences
+	var deliveryMode string
+	err = r.pool.QueryRow(ctx, query, args...).Scan(
+		&preferences.QuietHoursStart,
+		&preferences.QuietHoursEnd,
+		&deliveryMode,
+		&preferences.DigestInterval,
+		&preferences.MaxPerHour,
+		&preferences.PreferredChannel,
+		&preferences.UserUUID,
+	)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetNotificationPreferences",
+			Step:      "Row scanning",
+			Err:       err,
+		}
+	}
+	preferences.DeliveryMode = DeliveryMode(deliveryMode)
+
+	return &preferences, nil
+}
+
+func (r *Repo) SetNotificationPreferences(ctx context.Context, preferences *DBNotificationPreferences) error {
+	query, args, err := r.sq.Insert("subscription_service.notification_preferences").
+		Columns(
+			"quiet_hours_start",
+			"quiet_hours_end",
+			"delivery_mode",
+			"digest_interval",
+			"max_per_hour",
+			"preferred_channel",
+			"user_uuid",
+		).
+		Values(
+			preferences.QuietHoursStart,
+			preferences.QuietHoursEnd,
+			string(preferences.DeliveryMode),
+			preferences.DigestInterval,
+			preferences.MaxPerHour,
+			preferences.PreferredChannel,
+			preferences.UserUUID,
+		).
+		Suffix(`ON CONFLICT (user_uuid) DO UPDATE SET
+			quiet_hours_start = EXCLUDED.quiet_hours_start,
+			quiet_hours_end = EXCLUDED.quiet_hours_end,
+			delivery_mode = EXCLUDED.delivery_mode,
+			digest_interval = EXCLUDED.digest_interval,
+			max_per_hour = EXCLUDED.max_per_hour,
+			preferred_channel = EXCLUDED.preferred_channel`).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetNotificationPreferences",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	_, err = r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SetNotificationPreferences",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// SyncLabCatalog upserts the given lab types and topics as active and deactivates the missing ones
+func (r *Repo) SyncLabCatalog(ctx context.Context, labTypes []DBLabType, topics []DBLabTopic) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		typeCodes := make([]string, len(labTypes))
+		typeNames := make([]string, len(labTypes))
+		for i, labType := range labTypes {
+			typeCodes[i], typeNames[i] = string(labType.Code), labType.Name
+		}
+		if err := r.syncCatalogTable(ctx, tx, "subscription_service.lab_types", typeCodes, typeNames); err != nil {
+			return err
+		}
+
+		topicCodes := make([]string, len(topics))
+		topicNames := make([]string, len(topics))
+		for i, topic := range topics {
+			topicCodes[i], topicNames[i] = string(topic.Code), topic.Name
+		}
+		return r.syncCatalogTable(ctx, tx, "subscription_service.lab_topics", topicCodes, topicNames)
+	})
+}
+
+func (r *Repo) syncCatalogTable(ctx context.Context, tx pgx.Tx, table string, codes, names []string) error {
+	if len(codes) > 0 {
+		insert := r.sq.Insert(table).Columns("code", "name", "active")
+		for i := range codes {
+			insert = insert.Values(codes[i], names[i], true)
+		}
+		query, args, err := insert.
+			Suffix("ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, active = true").
+			ToSql()
+		if err != nil {
+			return &errors.ErrDBProcedure{
+				Procedure: "SyncLabCatalog",
+				Step:      "Query setup",
+				Err:       err,
+			}
+		}
+		if _, err = tx.Exec(ctx, query, args...); err != nil {
+			return &errors.ErrDBProcedure{
+				Procedure: "SyncLabCatalog",
+				Step:      "Query execution",
+				Err:       err,
+			}
+		}
+	}
+
+	query, args, err := r.sq.Update(table).
+		Set("active", false).
+		Where(squirrel.NotEq{"code": codes}).
+		ToSql()
+	if err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SyncLabCatalog",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		return &errors.ErrDBProcedure{
+			Procedure: "SyncLabCatalog",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) GetLabTypes(ctx context.Context) ([]DBLabType, error) {
+	query, args, err := r.sq.Select("code", "name", "active").
+		From("subscription_service.lab_types").
+		Where(squirrel.Eq{"active": true}).
+		OrderBy("code").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetLabTypes",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetLabTypes",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var labTypes []DBLabType
+	for rows.Next() {
+		var labType DBLabType
+		if err = rows.Scan(&labType.Code, &labType.Name, &labType.Active); err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetLabTypes",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		labTypes = append(labTypes, labType)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetLabTypes",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return labTypes, nil
+}
+
+func (r *Repo) GetLabTopics(ctx context.Context) ([]DBLabTopic, error) {
+	query, args, err := r.sq.Select("code", "name", "active").
+		From("subscription_service.lab_topics").
+		Where(squirrel.Eq{"active": true}).
+		OrderBy("code").
+		ToSql()
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetLabTopics",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetLabTopics",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+	defer rows.Close()
+
+	var topics []DBLabTopic
+	for rows.Next() {
+		var topic DBLabTopic
+		if err = rows.Scan(&topic.Code, &topic.Name, &topic.Active); err != nil {
+			return nil, &errors.ErrDBProcedure{
+				Procedure: "GetLabTopics",
+				Step:      "Row scanning",
+				Err:       err,
+			}
+		}
+		topics = append(topics, topic)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &errors.ErrDBProcedure{
+			Procedure: "GetLabTopics",
+			Step:      "Row error check",
+			Err:       err,
+		}
+	}
+
+	return topics, nil
+}
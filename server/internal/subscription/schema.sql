@@ -1,32 +1,153 @@
 create schema if not exists subscription_service;
 
-create type lab_type as enum ('Defence', 'Performance');
-create type lab_topic as enum ('Virtual', 'Electricity', 'Mechanics', 'Optics', 'Rigid Body');
+-- Filled from the lab catalog of the config on startup, entries removed from the config become inactive
+create table if not exists subscription_service.lab_types
+(
+    code   text    not null,
+    name   text    not null,
+    active boolean not null default true,
+    constraint lab_types_pk primary key (code)
+);
+
+create table if not exists subscription_service.lab_topics
+(
+    code   text    not null,
+    name   text    not null,
+    active boolean not null default true,
+    constraint lab_topics_pk primary key (code)
+);
 
 create table if not exists subscription_service.subscriptions
 (
-    subscription_uuid uuid        not null unique,
-    lab_type          lab_type    not null,
-    lab_topic         lab_topic   not null,
-    lab_number        int         not null,
-    lab_auditorium    int         ,
+    subscription_uuid uuid        not null,
+    lab_type          text        not null,
+    lab_topic         text        not null,
+    lab_numbers       int[]       not null,
+    lab_auditoriums   int[], -- null means any auditorium
+    valid_from        date,
+    valid_until       date,
+    slots_before      date,
     created_at        timestamptz not null,
     closed_at         timestamptz,
     user_uuid         uuid        not null,
-    constraint subscriptions_pk primary key (lab_type, lab_topic, lab_number, lab_auditorium,
-                                             user_uuid)
+    constraint subscriptions_pk primary key (subscription_uuid),
+    constraint subscriptions_lab_numbers_check check (cardinality(lab_numbers) > 0),
+    constraint subscriptions_validity_check check (valid_from is null or valid_until is null or
+                                                   valid_from <= valid_until),
+    constraint subscriptions_lab_type_fk foreign key (lab_type) references subscription_service.lab_types (code),
+    constraint subscriptions_lab_topic_fk foreign key (lab_topic) references subscription_service.lab_topics (code)
 );
 
+-- Lab types and topics used to be enums
+alter table subscription_service.subscriptions
+    alter column lab_type type text,
+    alter column lab_topic type text;
+drop type if exists lab_type;
+drop type if exists lab_topic;
+
+-- Subscriptions used to cover a single lab and auditorium and were keyed by the lab and the user
+do
+$$
+    begin
+        if exists (select
+                   from information_schema.columns
+                   where table_schema = 'subscription_service'
+                     and table_name = 'subscriptions'
+                     and column_name = 'lab_number') then
+            alter table subscription_service.subscriptions
+                drop constraint subscriptions_pk,
+                add column lab_numbers int[],
+                add column lab_auditoriums int[];
+            update subscription_service.subscriptions
+            set lab_numbers     = array [lab_number],
+                lab_auditoriums = case when lab_auditorium is null then null else array [lab_auditorium] end;
+            alter table subscription_service.subscriptions
+                alter column lab_numbers set not null,
+                drop column lab_number,
+                drop column lab_auditorium,
+                drop constraint if exists subscriptions_subscription_uuid_key,
+                add constraint subscriptions_pk primary key (subscription_uuid);
+        end if;
+    end
+$$;
+
+alter table subscription_service.subscriptions
+    add column if not exists valid_from date,
+    add column if not exists valid_until date,
+    add column if not exists slots_before date;
+
+-- Lab types and topics of existing subscriptions stay valid until the catalog is synced on startup
+insert into subscription_service.lab_types (code, name, active)
+select distinct lab_type, lab_type, false
+from subscription_service.subscriptions
+on conflict (code) do nothing;
+insert into subscription_service.lab_topics (code, name, active)
+select distinct lab_topic, lab_topic, false
+from subscription_service.subscriptions
+on conflict (code) do nothing;
+
+-- add constraint has no if not exists
+do
+$$
+    begin
+        alter table subscription_service.subscriptions
+            add constraint subscriptions_lab_numbers_check check (cardinality(lab_numbers) > 0);
+    exception
+        when duplicate_object then null;
+    end
+$$;
+
+do
+$$
+    begin
+        alter table subscription_service.subscriptions
+            add constraint subscriptions_validity_check check (valid_from is null or valid_until is null or
+                                                               valid_from <= valid_until);
+    exception
+        when duplicate_object then null;
+    end
+$$;
+
+do
+$$
+    begin
+        alter table subscription_service.subscriptions
+            add constraint subscriptions_lab_type_fk foreign key (lab_type) references subscription_service.lab_types (code);
+    exception
+        when duplicate_object then null;
+    end
+$$;
+
+do
+$$
+    begin
+        alter table subscription_service.subscriptions
+            add constraint subscriptions_lab_topic_fk foreign key (lab_topic) references subscription_service.lab_topics (code);
+    exception
+        when duplicate_object then null;
+    end
+$$;
+
 create index if not exists subscriptions_search_idx on subscription_service.subscriptions (lab_type,
                                                                                            lab_topic,
-                                                                                           lab_number,
-                                                                                           lab_auditorium,
                                                                                            closed_at,
                                                                                            user_uuid);
 
+create index if not exists subscriptions_lab_numbers_idx on subscription_service.subscriptions using gin (lab_numbers);
+
+create index if not exists subscriptions_user_idx on subscription_service.subscriptions (user_uuid);
+
 
 
-create type day_of_week as enum ('MON', 'TUE', 'WED', 'THU', 'FRI', 'SAT', 'SUN');
+-- create type has no if not exists
+do
+$$
+    begin
+        create type day_of_week as enum ('MON', 'TUE', 'WED', 'THU', 'FRI', 'SAT', 'SUN');
+    exception
+        when duplicate_object then null;
+    end
+$$;
 
 create table if not exists subscription_service.time_preferences
 (
@@ -38,13 +159,56 @@ create table if not exists subscription_service.time_preferences
 
 create index if not exists time_preferences_search_idx on subscription_service.time_preferences (day_of_week, user_uuid);
 
+-- Overrides time_preferences of the user for a single subscription. When a subscription has at least one row here,
+-- user level preferences are ignored for it
+create table if not exists subscription_service.subscription_time_preferences
+(
+    day_of_week       day_of_week not null,
+    lessons           int[]       not null,
+    subscription_uuid uuid        not null references subscription_service.subscriptions (subscription_uuid) on delete cascade,
+    constraint subscription_time_preferences_pk primary key (subscription_uuid, day_of_week)
+);
+
+-- Dates the user is busy on, both bounds are inclusive. A single date exclusion has starts_on = ends_on
+create table if not exists subscription_service.time_exclusions
+(
+    exclusion_uuid uuid not null,
+    starts_on      date not null,
+    ends_on        date not null,
+    reason         text,
+    user_uuid      uuid not null,
+    constraint time_exclusions_pk primary key (exclusion_uuid),
+    constraint time_exclusions_range_check check (starts_on <= ends_on)
+);
+
+create index if not exists time_exclusions_search_idx on subscription_service.time_exclusions (user_uuid, starts_on, ends_on);
+
+-- mode is one of 'Blacklist', 'Whitelist' or 'Ranked'. preferred_teachers is ordered from the most preferred one,
+-- it restricts matches in the Whitelist mode and only ranks available teachers in the other modes
 create table if not exists subscription_service.teacher_preferences
 (
+    mode                 text   not null default 'Blacklist',
     blacklisted_teachers text[] not null,
+    preferred_teachers   text[] not null default '{}',
     user_uuid            uuid   not null,
     constraint teacher_preferences_pk primary key (user_uuid)
 );
 
+-- Teacher preferences used to be a blacklist only
+alter table subscription_service.teacher_preferences
+    add column if not exists mode text not null default 'Blacklist',
+    add column if not exists preferred_teachers text[] not null default '{}';
+
+-- Overrides teacher_preferences of the user for a single subscription
+create table if not exists subscription_service.subscription_teacher_preferences
+(
+    mode                 text   not null,
+    blacklisted_teachers text[] not null default '{}',
+    preferred_teachers   text[] not null default '{}',
+    subscription_uuid    uuid   not null references subscription_service.subscriptions (subscription_uuid) on delete cascade,
+    constraint subscription_teacher_preferences_pk primary key (subscription_uuid)
+);
+
 create table if not exists subscription_service.details
 (
     successful_subscriptions     int  not null,
@@ -53,3 +217,16 @@ create table if not exists subscription_service.details
     constraint details_pk primary key (user_uuid)
 );
 
+
+create table if not exists subscription_service.notification_preferences
+(
+    quiet_hours_start smallint,
+    quiet_hours_end   smallint,
+    delivery_mode     text not null default 'Immediate',
+    digest_interval   int  not null default 0,
+    max_per_hour      int,
+    preferred_channel text,
+    user_uuid         uuid not null,
+    constraint notification_preferences_pk primary key (user_uuid),
+    constraint notification_preferences_quiet_hours_check check ((quiet_hours_start is null) = (quiet_hours_end is null))
+);
@@ -2,7 +2,13 @@ package subscription
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"labgrab/internal/shared/errors"
+	"labgrab/internal/shared/lab"
+	"labgrab/internal/shared/types"
+	"labgrab/pkg/config"
+	"slices"
 
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
@@ -13,12 +19,12 @@ import (
 var tracer = otel.Tracer("subscription-service")
 
 type Service struct {
-	repo         *Repo
+	repo         Repository
 	deduplicator *Deduplicator
 	logger       *zap.SugaredLogger
 }
 
-func NewService(repo *Repo, deduplicator *Deduplicator, logger *zap.SugaredLogger) *Service {
+func NewService(repo Repository, deduplicator *Deduplicator, logger *zap.SugaredLogger) *Service {
 	return &Service{repo: repo, deduplicator: deduplicator, logger: logger}
 }
 
@@ -32,14 +38,29 @@ func (s *Service) CreateSubscription(ctx context.Context, req *CreateSubscriptio
 		return uuid.Nil, err
 	}
 
+	if err := s.validateLabCatalog(ctx, "CreateSubscription", req.LabType, req.LabTopic); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return uuid.Nil, err
+	}
+
 	dbSub := &DBSubscription{
-		LabType:       req.LabType,
-		LabTopic:      req.LabTopic,
-		LabNumber:     req.LabNumber,
-		LabAuditorium: req.LabAuditorium,
-		CreatedAt:     req.CreatedAt,
-		ClosedAt:      nil,
-		UserUUID:      req.UserUUID,
+		LabType:        req.LabType,
+		LabTopic:       req.LabTopic,
+		LabNumbers:     req.LabNumbers,
+		LabAuditoriums: req.LabAuditoriums,
+		ValidFrom:      req.ValidFrom,
+		ValidUntil:     req.ValidUntil,
+		SlotsBefore:    req.SlotsBefore,
+		CreatedAt:      req.CreatedAt,
+		ClosedAt:       nil,
+		UserUUID:       req.UserUUID,
+	}
+
+	if err := s.validateNoOverlap(ctx, "CreateSubscription", dbSub); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return uuid.Nil, err
 	}
 
 	subscriptionUUID, err := s.repo.CreateSubscription(ctx, dbSub)
@@ -104,8 +125,11 @@ func (s *Service) GetSubscription(ctx context.Context, subscriptionUUID uuid.UUI
 		SubscriptionUUID: sub.SubscriptionUUID,
 		LabType:          sub.LabType,
 		LabTopic:         sub.LabTopic,
-		LabNumber:        sub.LabNumber,
-		LabAuditorium:    sub.LabAuditorium,
+		LabNumbers:       sub.LabNumbers,
+		LabAuditoriums:   sub.LabAuditoriums,
+		ValidFrom:        sub.ValidFrom,
+		ValidUntil:       sub.ValidUntil,
+		SlotsBefore:      sub.SlotsBefore,
 		CreatedAt:        sub.CreatedAt,
 		ClosedAt:         sub.ClosedAt,
 	}, nil
@@ -133,8 +157,11 @@ func (s *Service) GetSubscriptions(ctx context.Context, userUUID uuid.UUID) ([]G
 			SubscriptionUUID: sub.SubscriptionUUID,
 			LabType:          sub.LabType,
 			LabTopic:         sub.LabTopic,
-			LabNumber:        sub.LabNumber,
-			LabAuditorium:    sub.LabAuditorium,
+			LabNumbers:       sub.LabNumbers,
+			LabAuditoriums:   sub.LabAuditoriums,
+			ValidFrom:        sub.ValidFrom,
+			ValidUntil:       sub.ValidUntil,
+			SlotsBefore:      sub.SlotsBefore,
 			CreatedAt:        sub.CreatedAt,
 			ClosedAt:         sub.ClosedAt,
 		}
@@ -153,15 +180,30 @@ func (s *Service) UpdateSubscription(ctx context.Context, req *UpdateSubscriptio
 		return err
 	}
 
+	if err := s.validateLabCatalog(ctx, "UpdateSubscription", req.LabType, req.LabTopic); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
 	subscription := &DBSubscription{
 		SubscriptionUUID: req.SubscriptionUUID,
 		LabType:          req.LabType,
 		LabTopic:         req.LabTopic,
-		LabNumber:        req.LabNumber,
-		LabAuditorium:    req.LabAuditorium,
+		LabNumbers:       req.LabNumbers,
+		LabAuditoriums:   req.LabAuditoriums,
+		ValidFrom:        req.ValidFrom,
+		ValidUntil:       req.ValidUntil,
+		SlotsBefore:      req.SlotsBefore,
 		UserUUID:         req.UserUUID,
 	}
 
+	if err := s.validateNoOverlap(ctx, "UpdateSubscription", subscription); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
 	err := s.repo.UpdateSubscription(ctx, subscription)
 	if err != nil {
 		err = &errors.ErrServiceProcedure{
@@ -196,11 +238,49 @@ func (s *Service) CloseSubscription(ctx context.Context, subscriptionUUID uuid.U
 	return nil
 }
 
+// CloseExpiredSubscriptions closes subscriptions whose validity window or slot date limit has passed
+func (s *Service) CloseExpiredSubscriptions(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.CloseExpiredSubscriptions")
+	defer span.End()
+
+	closed, err := s.repo.CloseExpiredSubscriptions(ctx)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "CloseExpiredSubscriptions",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+
+	return closed, nil
+}
+
 func (s *Service) RestoreSubscription(ctx context.Context, subscriptionUUID uuid.UUID) error {
 	ctx, span := tracer.Start(ctx, "subscription.service.RestoreSubscription")
 	defer span.End()
 
-	err := s.repo.RestoreSubscription(ctx, subscriptionUUID)
+	sub, err := s.repo.GetSubscription(ctx, subscriptionUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "RestoreSubscription",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := s.validateNoOverlap(ctx, "RestoreSubscription", sub); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	err = s.repo.RestoreSubscription(ctx, subscriptionUUID)
 	if err != nil {
 		err = &errors.ErrServiceProcedure{
 			Procedure: "RestoreSubscription",
@@ -234,19 +314,286 @@ func (s *Service) DeleteSubscription(ctx context.Context, subscriptionUUID uuid.
 	return nil
 }
 
-func (s *Service) GetMatchingSubscriptions(ctx context.Context, req *GetMatchingSubscriptionsReq) ([]GetMatchingSubscriptionsRes, error) {
-	ctx, span := tracer.Start(ctx, "subscription.service.GetMatchingSubscriptions")
+// GetSubscriptionTimePreferences returns time preference overrides of the subscription, an empty map means the
+// subscription uses time preferences of the user
+func (s *Service) GetSubscriptionTimePreferences(ctx context.Context, subscriptionUUID uuid.UUID) (map[types.DayOfWeek][]int, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetSubscriptionTimePreferences")
 	defer span.End()
 
-	search := &DBSubscriptionSearch{
-		LabType:        req.LabType,
-		LabTopic:       req.LabTopic,
-		LabNumber:      req.LabNumber,
-		LabAuditorium:  req.LabAuditorium,
-		AvailableSlots: req.AvailableSlots,
+	preferences, err := s.repo.GetSubscriptionTimePreferences(ctx, subscriptionUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetSubscriptionTimePreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make(map[types.DayOfWeek][]int, len(preferences))
+	for _, preference := range preferences {
+		result[preference.DayOfWeek] = preference.Lessons
+	}
+
+	return result, nil
+}
+
+func (s *Service) UpdateSubscriptionTimePreferences(ctx context.Context, req *UpdateSubscriptionTimePreferencesReq) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.UpdateSubscriptionTimePreferences")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	preferences := make([]DBSubscriptionTimePreferences, 0, len(req.TimePreferences))
+	for day, lessons := range req.TimePreferences {
+		preferences = append(preferences, DBSubscriptionTimePreferences{
+			DayOfWeek:        day,
+			Lessons:          lessons,
+			SubscriptionUUID: req.SubscriptionUUID,
+		})
+	}
+
+	if err := s.repo.SetSubscriptionTimePreferences(ctx, req.SubscriptionUUID, preferences); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "UpdateSubscriptionTimePreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) GetTeacherPreferences(ctx context.Context, userUUID uuid.UUID) (*TeacherPreferences, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetTeacherPreferences")
+	defer span.End()
+
+	preferences, err := s.repo.GetTeacherPreferences(ctx, userUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetTeacherPreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if preferences == nil {
+		defaults := DefaultTeacherPreferences
+		return &defaults, nil
+	}
+
+	return &TeacherPreferences{
+		Mode:                preferences.Mode,
+		BlacklistedTeachers: preferences.BlacklistedTeachers,
+		PreferredTeachers:   preferences.PreferredTeachers,
+	}, nil
+}
+
+func (s *Service) UpdateTeacherPreferences(ctx context.Context, req *UpdateTeacherPreferencesReq) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.UpdateTeacherPreferences")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	preferences := &DBTeacherPreferences{
+		Mode:                req.Mode,
+		BlacklistedTeachers: nonNilTeachers(req.BlacklistedTeachers),
+		PreferredTeachers:   nonNilTeachers(req.PreferredTeachers),
+		UserUUID:            req.UserUUID,
+	}
+
+	if err := s.repo.SetTeacherPreferences(ctx, preferences); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "UpdateTeacherPreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetSubscriptionTeacherPreferences returns teacher preference overrides of the subscription, nil means the
+// subscription uses teacher preferences of the user
+func (s *Service) GetSubscriptionTeacherPreferences(ctx context.Context, subscriptionUUID uuid.UUID) (*TeacherPreferences, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetSubscriptionTeacherPreferences")
+	defer span.End()
+
+	preferences, err := s.repo.GetSubscriptionTeacherPreferences(ctx, subscriptionUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetSubscriptionTeacherPreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if preferences == nil {
+		return nil, nil
+	}
+
+	return &TeacherPreferences{
+		Mode:                preferences.Mode,
+		BlacklistedTeachers: preferences.BlacklistedTeachers,
+		PreferredTeachers:   preferences.PreferredTeachers,
+	}, nil
+}
+
+func (s *Service) UpdateSubscriptionTeacherPreferences(ctx context.Context, req *UpdateSubscriptionTeacherPreferencesReq) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.UpdateSubscriptionTeacherPreferences")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	var err error
+	if req.TeacherPreferences == nil {
+		err = s.repo.DeleteSubscriptionTeacherPreferences(ctx, req.SubscriptionUUID)
+	} else {
+		err = s.repo.SetSubscriptionTeacherPreferences(ctx, &DBSubscriptionTeacherPreferences{
+			Mode:                req.TeacherPreferences.Mode,
+			BlacklistedTeachers: nonNilTeachers(req.TeacherPreferences.BlacklistedTeachers),
+			PreferredTeachers:   nonNilTeachers(req.TeacherPreferences.PreferredTeachers),
+			SubscriptionUUID:    req.SubscriptionUUID,
+		})
+	}
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "UpdateSubscriptionTeacherPreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// nonNilTeachers keeps not null array columns happy
+func nonNilTeachers(teachers []string) []string {
+	if teachers == nil {
+		return []string{}
+	}
+	return teachers
+}
+
+func (s *Service) CreateTimeExclusion(ctx context.Context, req *CreateTimeExclusionReq) (uuid.UUID, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.CreateTimeExclusion")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return uuid.Nil, err
+	}
+
+	exclusion := &DBTimeExclusion{
+		StartsOn: req.StartsOn,
+		EndsOn:   req.EndsOn,
+		Reason:   req.Reason,
+		UserUUID: req.UserUUID,
+	}
+
+	exclusionUUID, err := s.repo.CreateTimeExclusion(ctx, exclusion)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "CreateTimeExclusion",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return uuid.Nil, err
+	}
+
+	return exclusionUUID, nil
+}
+
+func (s *Service) GetTimeExclusions(ctx context.Context, userUUID uuid.UUID) ([]TimeExclusion, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetTimeExclusions")
+	defer span.End()
+
+	exclusions, err := s.repo.GetTimeExclusions(ctx, userUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetTimeExclusions",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([]TimeExclusion, len(exclusions))
+	for i, exclusion := range exclusions {
+		result[i] = TimeExclusion{
+			ExclusionUUID: exclusion.ExclusionUUID,
+			StartsOn:      exclusion.StartsOn,
+			EndsOn:        exclusion.EndsOn,
+			Reason:        exclusion.Reason,
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Service) DeleteTimeExclusion(ctx context.Context, userUUID, exclusionUUID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.DeleteTimeExclusion")
+	defer span.End()
+
+	deleted, err := s.repo.DeleteTimeExclusion(ctx, userUUID, exclusionUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "DeleteTimeExclusion",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if !deleted {
+		span.RecordError(ErrTimeExclusionNotFound)
+		span.SetStatus(codes.Error, ErrTimeExclusionNotFound.Error())
+		return ErrTimeExclusionNotFound
 	}
 
-	matches, err := s.repo.GetMatchingSubscriptionsBySlot(ctx, search)
+	return nil
+}
+
+func (s *Service) GetMatchingSubscriptions(ctx context.Context, req *GetMatchingSubscriptionsReq) ([]GetMatchingSubscriptionsRes, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetMatchingSubscriptions")
+	defer span.End()
+
+	matches, err := s.repo.GetMatchingSubscriptionsBySlot(ctx, newSubscriptionSearch(req))
 	if err != nil {
 		err = &errors.ErrServiceProcedure{
 			Procedure: "GetMatchingSubscriptions",
@@ -258,7 +605,7 @@ func (s *Service) GetMatchingSubscriptions(ctx context.Context, req *GetMatching
 		return nil, err
 	}
 
-	relevantMatches, err := s.deduplicator.Deduplicate(ctx, req, matches)
+	result, err := s.claimMatches(ctx, req, matches)
 	if err != nil {
 		err = &errors.ErrServiceProcedure{
 			Procedure: "GetMatchingSubscriptions",
@@ -270,6 +617,119 @@ func (s *Service) GetMatchingSubscriptions(ctx context.Context, req *GetMatching
 		return nil, err
 	}
 
+	return result, nil
+}
+
+// GetMatchingSubscriptionsBatch matches all events of a polling cycle with a single query and then deduplicates
+// every event on its own. The result has one entry per request, in the same order. A failed deduplication leaves
+// the entry of its event nil and does not stop the rest, the errors are returned together with the result. A nil
+// result means that the query failed
+func (s *Service) GetMatchingSubscriptionsBatch(ctx context.Context, reqs []*GetMatchingSubscriptionsReq) ([][]GetMatchingSubscriptionsRes, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetMatchingSubscriptionsBatch")
+	defer span.End()
+
+	searches := make([]DBSubscriptionSearch, len(reqs))
+	for i, req := range reqs {
+		searches[i] = *newSubscriptionSearch(req)
+	}
+
+	matches, err := s.repo.GetMatchingSubscriptionsBySlots(ctx, searches)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetMatchingSubscriptionsBatch",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	var claimErrs []error
+	result := make([][]GetMatchingSubscriptionsRes, len(reqs))
+	for i, req := range reqs {
+		result[i], err = s.claimMatches(ctx, req, matches[i])
+		if err != nil {
+			err = &errors.ErrServiceProcedure{
+				Procedure: "GetMatchingSubscriptionsBatch",
+				Step:      "Deduplication",
+				Err:       err,
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			claimErrs = append(claimErrs, err)
+		}
+	}
+
+	return result, stderrors.Join(claimErrs...)
+}
+
+// PreviewMatchingSubscriptions matches events the same way as GetMatchingSubscriptionsBatch without touching
+// deduplication, so every matching slot is returned and nothing is claimed
+func (s *Service) PreviewMatchingSubscriptions(ctx context.Context, reqs []*GetMatchingSubscriptionsReq) ([][]GetMatchingSubscriptionsRes, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.PreviewMatchingSubscriptions")
+	defer span.End()
+
+	searches := make([]DBSubscriptionSearch, len(reqs))
+	for i, req := range reqs {
+		searches[i] = *newSubscriptionSearch(req)
+	}
+
+	matches, err := s.repo.GetMatchingSubscriptionsBySlots(ctx, searches)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "PreviewMatchingSubscriptions",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := make([][]GetMatchingSubscriptionsRes, len(reqs))
+	for i := range reqs {
+		result[i] = make([]GetMatchingSubscriptionsRes, len(matches[i]))
+		for j, match := range matches[i] {
+			result[i][j] = GetMatchingSubscriptionsRes{
+				UserUUID:                   match.UserUUID,
+				SubscriptionUUID:           match.SubscriptionUUID,
+				SuccessfulSubscriptions:    match.SuccessfulSubscriptions,
+				LastSuccessfulSubscription: match.LastSuccessfulSubscription,
+				MatchingTimeslots:          match.MatchingTimeslots,
+				Teachers:                   match.Teachers,
+				PreferredTeachers:          match.PreferredTeachers,
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func newSubscriptionSearch(req *GetMatchingSubscriptionsReq) *DBSubscriptionSearch {
+	return &DBSubscriptionSearch{
+		LabType:        req.LabType,
+		LabTopic:       req.LabTopic,
+		LabNumber:      req.LabNumber,
+		LabAuditorium:  req.LabAuditorium,
+		AvailableSlots: req.AvailableSlots,
+		SlotDates:      req.SlotDates,
+		Groups:         req.Groups,
+	}
+}
+
+// claimMatches keeps matches with at least one slot not announced before and splits their slots into new
+// and still open ones
+func (s *Service) claimMatches(
+	ctx context.Context,
+	req *GetMatchingSubscriptionsReq,
+	matches []DBSubscriptionMatchResult,
+) ([]GetMatchingSubscriptionsRes, error) {
+	relevantMatches, err := s.deduplicator.Claim(ctx, req, matches)
+	if err != nil {
+		return nil, err
+	}
+
 	result := make([]GetMatchingSubscriptionsRes, len(relevantMatches))
 	for i, match := range relevantMatches {
 		result[i] = GetMatchingSubscriptionsRes{
@@ -278,8 +738,278 @@ func (s *Service) GetMatchingSubscriptions(ctx context.Context, req *GetMatching
 			SuccessfulSubscriptions:    match.SuccessfulSubscriptions,
 			LastSuccessfulSubscription: match.LastSuccessfulSubscription,
 			MatchingTimeslots:          match.MatchingTimeslots,
+			NewTimeslots:               match.NewTimeslots,
+			StillOpenTimeslots:         subtractTimeslots(match.MatchingTimeslots, match.NewTimeslots),
+			Teachers:                   match.Teachers,
+			PreferredTeachers:          match.PreferredTeachers,
 		}
 	}
 
 	return result, nil
 }
+
+// subtractTimeslots returns the lessons of a that are not present in b, omitting days left empty
+func subtractTimeslots(a, b map[types.DayOfWeek][]int) map[types.DayOfWeek][]int {
+	result := make(map[types.DayOfWeek][]int)
+	for day, lessons := range a {
+		for _, lesson := range lessons {
+			if !slices.Contains(b[day], lesson) {
+				result[day] = append(result[day], lesson)
+			}
+		}
+	}
+	return result
+}
+
+// CommitMatches marks slots of the matches as seen. Call it after the matches are handed off for
+// delivery, otherwise a crash in between would suppress them forever
+func (s *Service) CommitMatches(ctx context.Context, req *GetMatchingSubscriptionsReq, matches []GetMatchingSubscriptionsRes) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.CommitMatches")
+	defer span.End()
+
+	dbMatches := make([]DBSubscriptionMatchResult, len(matches))
+	for i, match := range matches {
+		dbMatches[i] = DBSubscriptionMatchResult{
+			UserUUID:                   match.UserUUID,
+			SubscriptionUUID:           match.SubscriptionUUID,
+			SuccessfulSubscriptions:    match.SuccessfulSubscriptions,
+			LastSuccessfulSubscription: match.LastSuccessfulSubscription,
+			MatchingTimeslots:          match.MatchingTimeslots,
+			Teachers:                   match.Teachers,
+			PreferredTeachers:          match.PreferredTeachers,
+		}
+	}
+
+	if err := s.deduplicator.Commit(ctx, req, dbMatches); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "CommitMatches",
+			Step:      "Deduplication",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetGoneSlotSubscriptions returns subscriptions that were notified about slots that are gone now
+func (s *Service) GetGoneSlotSubscriptions(ctx context.Context, req *GetGoneSlotSubscriptionsReq) ([]GetGoneSlotSubscriptionsRes, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetGoneSlotSubscriptions")
+	defer span.End()
+
+	matches, err := s.deduplicator.Notified(ctx, req)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetGoneSlotSubscriptions",
+			Step:      "Deduplication",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// ReleaseGoneSlots clears dedup state of the gone slots, so that they are treated as new once they open again.
+// Call it after the gone notifications are handed off for delivery
+func (s *Service) ReleaseGoneSlots(ctx context.Context, req *GetGoneSlotSubscriptionsReq, matches []GetGoneSlotSubscriptionsRes) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.ReleaseGoneSlots")
+	defer span.End()
+
+	if err := s.deduplicator.Release(ctx, req, matches); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "ReleaseGoneSlots",
+			Step:      "Deduplication",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) GetNotificationPreferences(ctx context.Context, userUUID uuid.UUID) (*NotificationPreferences, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetNotificationPreferences")
+	defer span.End()
+
+	preferences, err := s.repo.GetNotificationPreferences(ctx, userUUID)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "GetNotificationPreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if preferences == nil {
+		defaults := DefaultNotificationPreferences
+		return &defaults, nil
+	}
+
+	return &NotificationPreferences{
+		QuietHoursStart:  preferences.QuietHoursStart,
+		QuietHoursEnd:    preferences.QuietHoursEnd,
+		DeliveryMode:     preferences.DeliveryMode,
+		DigestInterval:   preferences.DigestInterval,
+		MaxPerHour:       preferences.MaxPerHour,
+		PreferredChannel: preferences.PreferredChannel,
+	}, nil
+}
+
+func (s *Service) UpdateNotificationPreferences(ctx context.Context, req *UpdateNotificationPreferencesReq) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.UpdateNotificationPreferences")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	preferences := &DBNotificationPreferences{
+		QuietHoursStart:  req.QuietHoursStart,
+		QuietHoursEnd:    req.QuietHoursEnd,
+		DeliveryMode:     req.DeliveryMode,
+		DigestInterval:   req.DigestInterval,
+		MaxPerHour:       req.MaxPerHour,
+		PreferredChannel: req.PreferredChannel,
+		UserUUID:         req.UserUUID,
+	}
+	if preferences.DeliveryMode == DeliveryModeImmediate {
+		preferences.DigestInterval = 0
+	}
+
+	if err := s.repo.SetNotificationPreferences(ctx, preferences); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "UpdateNotificationPreferences",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SyncLabCatalog makes the lab types and topics of the config the only ones new subscriptions may use
+func (s *Service) SyncLabCatalog(ctx context.Context, cfg *config.LabCatalogConfig) error {
+	ctx, span := tracer.Start(ctx, "subscription.service.SyncLabCatalog")
+	defer span.End()
+
+	req := &SyncLabCatalogReq{
+		Types:  make([]DBLabType, len(cfg.Types)),
+		Topics: make([]DBLabTopic, len(cfg.Topics)),
+	}
+	for i, entry := range cfg.Types {
+		req.Types[i] = DBLabType{Code: lab.Type(entry.Code), Name: entry.Name, Active: true}
+	}
+	for i, entry := range cfg.Topics {
+		req.Topics[i] = DBLabTopic{Code: lab.Topic(entry.Code), Name: entry.Name, Active: true}
+	}
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := s.repo.SyncLabCatalog(ctx, req.Types, req.Topics); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "SyncLabCatalog",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) GetLabCatalog(ctx context.Context) (*GetLabCatalogRes, error) {
+	ctx, span := tracer.Start(ctx, "subscription.service.GetLabCatalog")
+	defer span.End()
+
+	catalog, err := s.getLabCatalog(ctx, "GetLabCatalog")
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+func (s *Service) getLabCatalog(ctx context.Context, procedure string) (*GetLabCatalogRes, error) {
+	labTypes, err := s.repo.GetLabTypes(ctx)
+	if err != nil {
+		return nil, &errors.ErrServiceProcedure{
+			Procedure: procedure,
+			Step:      "Repository call",
+			Err:       err,
+		}
+	}
+
+	topics, err := s.repo.GetLabTopics(ctx)
+	if err != nil {
+		return nil, &errors.ErrServiceProcedure{
+			Procedure: procedure,
+			Step:      "Repository call",
+			Err:       err,
+		}
+	}
+
+	return &GetLabCatalogRes{Types: labTypes, Topics: topics}, nil
+}
+
+// validateNoOverlap rejects a subscription that shares a lab number and an auditorium with another open
+// subscription of the user, both would be notified about the same slots
+func (s *Service) validateNoOverlap(ctx context.Context, procedure string, sub *DBSubscription) error {
+	overlaps, err := s.repo.HasOverlappingSubscription(ctx, sub)
+	if err != nil {
+		return &errors.ErrServiceProcedure{
+			Procedure: procedure,
+			Step:      "Repository call",
+			Err:       err,
+		}
+	}
+
+	if overlaps {
+		validationErr := errors.NewValidationError()
+		validationErr.Add("lab_numbers & lab_auditoriums", "An open subscription already covers some of these lab numbers and auditoriums")
+		return validationErr
+	}
+	return nil
+}
+
+// validateLabCatalog rejects lab types and topics that are missing from the catalog or no longer active
+func (s *Service) validateLabCatalog(ctx context.Context, procedure string, labType lab.Type, labTopic lab.Topic) error {
+	catalog, err := s.getLabCatalog(ctx, procedure)
+	if err != nil {
+		return err
+	}
+
+	validationErr := errors.NewValidationError()
+	if !slices.ContainsFunc(catalog.Types, func(t DBLabType) bool { return t.Code == labType }) {
+		validationErr.Add("lab_type", fmt.Sprintf("Unknown lab type '%s'", labType))
+	}
+	if !slices.ContainsFunc(catalog.Topics, func(t DBLabTopic) bool { return t.Code == labTopic }) {
+		validationErr.Add("lab_topic", fmt.Sprintf("Unknown lab topic '%s'", labTopic))
+	}
+	if validationErr.HasErrors() {
+		return validationErr
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package subscription_test
+
+import (
+	"context"
+	stderrors "errors"
+	"labgrab/internal/shared/errors"
+	"labgrab/internal/shared/types"
+	"labgrab/internal/subscription"
+	"labgrab/pkg/config"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fakeRepo serves the same matches for every search. Methods other than matching are not used
+type fakeRepo struct {
+	subscription.Repository
+	matches []subscription.DBSubscriptionMatchResult
+	err     error
+}
+
+func (r *fakeRepo) GetMatchingSubscriptionsBySlot(
+	ctx context.Context,
+	search *subscription.DBSubscriptionSearch,
+) ([]subscription.DBSubscriptionMatchResult, error) {
+	return r.matches, r.err
+}
+
+func (r *fakeRepo) GetMatchingSubscriptionsBySlots(
+	ctx context.Context,
+	searches []subscription.DBSubscriptionSearch,
+) ([][]subscription.DBSubscriptionMatchResult, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	result := make([][]subscription.DBSubscriptionMatchResult, len(searches))
+	for i := range searches {
+		result[i] = r.matches
+	}
+	return result, nil
+}
+
+// failingDedupStore fails the claim with the given number, counting from 1
+type failingDedupStore struct {
+	subscription.DedupStore
+	failClaim int
+	claims    int
+}
+
+func (s *failingDedupStore) Claim(ctx context.Context, keys []string, notified []string, claimTTL, ttl time.Duration) ([]bool, error) {
+	s.claims++
+	if s.claims == s.failClaim {
+		return nil, stderrors.New("connection reset")
+	}
+	return s.DedupStore.Claim(ctx, keys, notified, claimTTL, ttl)
+}
+
+// overlapRepo reports every checked subscription as overlapping when overlapping is set and counts saved ones
+type overlapRepo struct {
+	subscription.Repository
+	overlapping bool
+	checked     []subscription.DBSubscription
+	saved       int
+}
+
+func (r *overlapRepo) GetLabTypes(ctx context.Context) ([]subscription.DBLabType, error) {
+	return []subscription.DBLabType{{Code: "Performance", Active: true}}, nil
+}
+
+func (r *overlapRepo) GetLabTopics(ctx context.Context) ([]subscription.DBLabTopic, error) {
+	return []subscription.DBLabTopic{{Code: "Optics", Active: true}}, nil
+}
+
+func (r *overlapRepo) HasOverlappingSubscription(ctx context.Context, sub *subscription.DBSubscription) (bool, error) {
+	r.checked = append(r.checked, *sub)
+	return r.overlapping, nil
+}
+
+func (r *overlapRepo) CreateSubscription(ctx context.Context, sub *subscription.DBSubscription) (uuid.UUID, error) {
+	r.saved++
+	return uuid.New(), nil
+}
+
+func (r *overlapRepo) UpdateSubscription(ctx context.Context, sub *subscription.DBSubscription) error {
+	r.saved++
+	return nil
+}
+
+func newTestService(repo subscription.Repository) *subscription.Service {
+	cfg := &config.DeduplicatorConfig{
+		Backend:  "memory",
+		TTL:      time.Hour,
+		ClaimTTL: time.Minute,
+	}
+	store, err := subscription.NewDedupStore(nil, cfg)
+	if err != nil {
+		panic(err)
+	}
+	return subscription.NewService(repo, subscription.NewDeduplicator(store, cfg), zap.NewNop().Sugar())
+}
+
+var testMatchReq = &subscription.GetMatchingSubscriptionsReq{
+	LabType:       "Defence",
+	LabTopic:      "Optics",
+	LabNumber:     3,
+	LabAuditorium: 214,
+}
+
+func TestGetMatchingSubscriptionsClaimsSlots(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeRepo{matches: []subscription.DBSubscriptionMatchResult{{
+		UserUUID:          uuid.New(),
+		SubscriptionUUID:  uuid.New(),
+		MatchingTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+	}}}
+	svc := newTestService(repo)
+
+	matches, err := svc.GetMatchingSubscriptions(ctx, testMatchReq)
+	if err != nil {
+		t.Fatalf("GetMatchingSubscriptions() error = %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("GetMatchingSubscriptions() returned %d matches, want 1", len(matches))
+	}
+	if want := map[types.DayOfWeek][]int{types.DayMon: {1}}; !reflect.DeepEqual(matches[0].NewTimeslots, want) {
+		t.Errorf("NewTimeslots = %v, want %v", matches[0].NewTimeslots, want)
+	}
+	if len(matches[0].StillOpenTimeslots) != 0 {
+		t.Errorf("StillOpenTimeslots = %v, want none", matches[0].StillOpenTimeslots)
+	}
+
+	// The slot stays claimed until the claim expires, so a concurrent event does not announce it again
+	matches, err = svc.GetMatchingSubscriptions(ctx, testMatchReq)
+	if err != nil {
+		t.Fatalf("GetMatchingSubscriptions() error = %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("GetMatchingSubscriptions() returned %d matches for a claimed slot, want 0", len(matches))
+	}
+}
+
+func TestGetMatchingSubscriptionsSplitsNewAndStillOpen(t *testing.T) {
+	ctx := context.Background()
+	match := subscription.DBSubscriptionMatchResult{
+		UserUUID:          uuid.New(),
+		SubscriptionUUID:  uuid.New(),
+		MatchingTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+	}
+	repo := &fakeRepo{matches: []subscription.DBSubscriptionMatchResult{match}}
+	svc := newTestService(repo)
+
+	matches, err := svc.GetMatchingSubscriptions(ctx, testMatchReq)
+	if err != nil {
+		t.Fatalf("GetMatchingSubscriptions() error = %v", err)
+	}
+	if err := svc.CommitMatches(ctx, testMatchReq, matches); err != nil {
+		t.Fatalf("CommitMatches() error = %v", err)
+	}
+
+	matches, err = svc.GetMatchingSubscriptions(ctx, testMatchReq)
+	if err != nil {
+		t.Fatalf("GetMatchingSubscriptions() error = %v", err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("GetMatchingSubscriptions() returned %d matches for seen slots, want 0", len(matches))
+	}
+
+	match.MatchingTimeslots = map[types.DayOfWeek][]int{types.DayMon: {1}, types.DayWed: {2}}
+	repo.matches = []subscription.DBSubscriptionMatchResult{match}
+
+	matches, err = svc.GetMatchingSubscriptions(ctx, testMatchReq)
+	if err != nil {
+		t.Fatalf("GetMatchingSubscriptions() error = %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("GetMatchingSubscriptions() returned %d matches, want 1", len(matches))
+	}
+	if want := map[types.DayOfWeek][]int{types.DayWed: {2}}; !reflect.DeepEqual(matches[0].NewTimeslots, want) {
+		t.Errorf("NewTimeslots = %v, want %v", matches[0].NewTimeslots, want)
+	}
+	if want := map[types.DayOfWeek][]int{types.DayMon: {1}}; !reflect.DeepEqual(matches[0].StillOpenTimeslots, want) {
+		t.Errorf("StillOpenTimeslots = %v, want %v", matches[0].StillOpenTimeslots, want)
+	}
+}
+
+func TestGoneSlotsAreReleased(t *testing.T) {
+	ctx := context.Background()
+	match := subscription.DBSubscriptionMatchResult{
+		UserUUID:          uuid.New(),
+		SubscriptionUUID:  uuid.New(),
+		MatchingTimeslots: map[types.DayOfWeek][]int{types.DayWed: {2}},
+	}
+	svc := newTestService(&fakeRepo{matches: []subscription.DBSubscriptionMatchResult{match}})
+
+	matches, err := svc.GetMatchingSubscriptions(ctx, testMatchReq)
+	if err != nil {
+		t.Fatalf("GetMatchingSubscriptions() error = %v", err)
+	}
+	if err := svc.CommitMatches(ctx, testMatchReq, matches); err != nil {
+		t.Fatalf("CommitMatches() error = %v", err)
+	}
+
+	goneReq := &subscription.GetGoneSlotSubscriptionsReq{
+		LabType:       testMatchReq.LabType,
+		LabTopic:      testMatchReq.LabTopic,
+		LabNumber:     testMatchReq.LabNumber,
+		LabAuditorium: testMatchReq.LabAuditorium,
+		GoneTimeslots: map[types.DayOfWeek][]int{types.DayWed: {2}, types.DayFri: {5}},
+	}
+	gone, err := svc.GetGoneSlotSubscriptions(ctx, goneReq)
+	if err != nil {
+		t.Fatalf("GetGoneSlotSubscriptions() error = %v", err)
+	}
+	want := []subscription.GetGoneSlotSubscriptionsRes{{
+		UserUUID:         match.UserUUID,
+		SubscriptionUUID: match.SubscriptionUUID,
+		GoneTimeslots:    map[types.DayOfWeek][]int{types.DayWed: {2}},
+	}}
+	if !reflect.DeepEqual(gone, want) {
+		t.Fatalf("GetGoneSlotSubscriptions() = %+v, want %+v", gone, want)
+	}
+
+	if err := svc.ReleaseGoneSlots(ctx, goneReq, gone); err != nil {
+		t.Fatalf("ReleaseGoneSlots() error = %v", err)
+	}
+
+	gone, err = svc.GetGoneSlotSubscriptions(ctx, goneReq)
+	if err != nil {
+		t.Fatalf("GetGoneSlotSubscriptions() error = %v", err)
+	}
+	if len(gone) != 0 {
+		t.Errorf("GetGoneSlotSubscriptions() after release = %+v, want none", gone)
+	}
+
+	matches, err = svc.GetMatchingSubscriptions(ctx, testMatchReq)
+	if err != nil {
+		t.Fatalf("GetMatchingSubscriptions() error = %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("GetMatchingSubscriptions() returned %d matches for a reopened slot, want 1", len(matches))
+	}
+}
+
+func TestGetMatchingSubscriptionsRepoError(t *testing.T) {
+	svc := newTestService(&fakeRepo{err: stderrors.New("connection refused")})
+
+	_, err := svc.GetMatchingSubscriptions(context.Background(), testMatchReq)
+	var procedureErr *errors.ErrServiceProcedure
+	if !stderrors.As(err, &procedureErr) || procedureErr.Step != "Repository call" {
+		t.Errorf("GetMatchingSubscriptions() error = %v, want a repository call error", err)
+	}
+}
+
+func TestGetMatchingSubscriptionsBatchIsolatesFailedClaims(t *testing.T) {
+	cfg := &config.DeduplicatorConfig{TTL: time.Hour, ClaimTTL: time.Minute}
+	store := &failingDedupStore{DedupStore: subscription.NewMemoryDedupStore(10), failClaim: 2}
+	repo := &fakeRepo{matches: []subscription.DBSubscriptionMatchResult{{
+		UserUUID:          uuid.New(),
+		SubscriptionUUID:  uuid.New(),
+		MatchingTimeslots: map[types.DayOfWeek][]int{types.DayMon: {1}},
+	}}}
+	svc := subscription.NewService(repo, subscription.NewDeduplicator(store, cfg), zap.NewNop().Sugar())
+
+	reqs := make([]*subscription.GetMatchingSubscriptionsReq, 3)
+	for i := range reqs {
+		req := *testMatchReq
+		req.LabNumber = i + 1
+		reqs[i] = &req
+	}
+
+	matches, err := svc.GetMatchingSubscriptionsBatch(context.Background(), reqs)
+	var procedureErr *errors.ErrServiceProcedure
+	if !stderrors.As(err, &procedureErr) || procedureErr.Step != "Deduplication" {
+		t.Errorf("GetMatchingSubscriptionsBatch() error = %v, want a deduplication error", err)
+	}
+	if len(matches) != 3 {
+		t.Fatalf("GetMatchingSubscriptionsBatch() returned %d entries, want 3", len(matches))
+	}
+	for i, want := range []int{1, 0, 1} {
+		if len(matches[i]) != want {
+			t.Errorf("GetMatchingSubscriptionsBatch()[%d] has %d matches, want %d", i, len(matches[i]), want)
+		}
+	}
+}
+
+func TestGetMatchingSubscriptionsBatchRepoError(t *testing.T) {
+	svc := newTestService(&fakeRepo{err: stderrors.New("connection refused")})
+
+	matches, err := svc.GetMatchingSubscriptionsBatch(context.Background(), []*subscription.GetMatchingSubscriptionsReq{testMatchReq})
+	if matches != nil || err == nil {
+		t.Errorf("GetMatchingSubscriptionsBatch() = %v, %v, want nil and the repository error", matches, err)
+	}
+}
+
+func TestSubscriptionOverlapIsRejected(t *testing.T) {
+	userUUID, subscriptionUUID := uuid.New(), uuid.New()
+	save := map[string]func(svc *subscription.Service) error{
+		"create": func(svc *subscription.Service) error {
+			_, err := svc.CreateSubscription(context.Background(), &subscription.CreateSubscriptionReq{
+				UserUUID:       userUUID,
+				LabType:        "Performance",
+				LabTopic:       "Optics",
+				LabNumbers:     []int{1, 2},
+				LabAuditoriums: []int{214},
+			})
+			return err
+		},
+		"update": func(svc *subscription.Service) error {
+			return svc.UpdateSubscription(context.Background(), &subscription.UpdateSubscriptionDataReq{
+				UserUUID:         userUUID,
+				SubscriptionUUID: subscriptionUUID,
+				LabType:          "Performance",
+				LabTopic:         "Optics",
+				LabNumbers:       []int{1, 2},
+				LabAuditoriums:   []int{214},
+			})
+		},
+	}
+
+	for name, save := range save {
+		t.Run(name, func(t *testing.T) {
+			repo := &overlapRepo{overlapping: true}
+			err := save(newTestService(repo))
+			var validationErr *errors.ValidationError
+			if !stderrors.As(err, &validationErr) {
+				t.Fatalf("error = %v, want a validation error", err)
+			}
+			if repo.saved != 0 {
+				t.Error("overlapping subscription was saved")
+			}
+			if len(repo.checked) != 1 || repo.checked[0].UserUUID != userUUID || !reflect.DeepEqual(repo.checked[0].LabNumbers, []int{1, 2}) {
+				t.Errorf("checked %+v, want the saved subscription", repo.checked)
+			}
+
+			repo.overlapping = false
+			if err := save(newTestService(repo)); err != nil {
+				t.Fatalf("error = %v without overlap", err)
+			}
+			if repo.saved != 1 {
+				t.Errorf("saved %d subscriptions without overlap, want 1", repo.saved)
+			}
+		})
+	}
+
+	// An update is checked against the other subscriptions only
+	repo := &overlapRepo{}
+	save["update"](newTestService(repo))
+	if repo.checked[0].SubscriptionUUID != subscriptionUUID {
+		t.Errorf("checked subscription %s, want %s", repo.checked[0].SubscriptionUUID, subscriptionUUID)
+	}
+}
@@ -0,0 +1,79 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"labgrab/internal/shared/api/smtp"
+	"net/url"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+var (
+	verificationHTML = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/verification.html.tmpl"))
+	verificationText = texttemplate.Must(texttemplate.ParseFS(templates, "templates/verification.txt.tmpl"))
+)
+
+type verificationTemplateData struct {
+	Email     string
+	Link      string
+	ExpiresAt string
+}
+
+// generateVerificationToken returns a random token sent to the user and its hash stored in the database
+func generateVerificationToken() (string, string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", "", err
+	}
+	encoded := hex.EncodeToString(token)
+	return encoded, hashVerificationToken(encoded), nil
+}
+
+func hashVerificationToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func verificationLink(baseURL, token string) (string, error) {
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+func sendVerificationEmail(ctx context.Context, mailer *smtp.Client, email, link string, expiresAt time.Time) error {
+	data := verificationTemplateData{
+		Email:     email,
+		Link:      link,
+		ExpiresAt: expiresAt.Format("02.01.2006 15:04 MST"),
+	}
+
+	var html, text bytes.Buffer
+	if err := verificationHTML.Execute(&html, data); err != nil {
+		return fmt.Errorf("failed to render html template: %w", err)
+	}
+	if err := verificationText.Execute(&text, data); err != nil {
+		return fmt.Errorf("failed to render text template: %w", err)
+	}
+
+	return mailer.Send(ctx, &smtp.Message{
+		To:      []string{email},
+		Subject: "Подтверждение email в Labgrab",
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+}
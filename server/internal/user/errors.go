@@ -1,10 +1,13 @@
 package user
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
+var ErrInvalidVerificationToken = errors.New("verification token is invalid or expired")
+
 type ValidationError struct {
 	Errors map[string]string
 }
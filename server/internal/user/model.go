@@ -1,6 +1,8 @@
 package user
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
@@ -16,19 +18,31 @@ type DBUserDetails struct {
 
 // DBUserContacts user_service.users_contacts
 type DBUserContacts struct {
-	PhoneNumber string    `db:"phone_number"`
-	TelegramID  int       `db:"telegram_id"`
-	UserUUID    uuid.UUID `db:"user_uuid"`
+	PhoneNumber     string     `db:"phone_number"`
+	TelegramID      int        `db:"telegram_id"`
+	Email           *string    `db:"email"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	UserUUID        uuid.UUID  `db:"user_uuid"`
+}
+
+// DBEmailVerification user_service.email_verifications
+type DBEmailVerification struct {
+	TokenHash string    `db:"token_hash"`
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+	UserUUID  uuid.UUID `db:"user_uuid"`
 }
 
 type DBUserInfo struct {
-	UUID        uuid.UUID `db:"uuid"`
-	Name        string    `db:"name"`
-	Surname     string    `db:"surname"`
-	Patronymic  string    `db:"patronymic"`
-	GroupCode   string    `db:"group_code"`
-	PhoneNumber string    `db:"phone_number"`
-	TelegramID  int       `db:"telegram_id"`
+	UUID            uuid.UUID  `db:"uuid"`
+	Name            string     `db:"name"`
+	Surname         string     `db:"surname"`
+	Patronymic      string     `db:"patronymic"`
+	GroupCode       string     `db:"group_code"`
+	PhoneNumber     string     `db:"phone_number"`
+	TelegramID      int        `db:"telegram_id"`
+	Email           *string    `db:"email"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
 }
 
 type CreateUserReq struct {
@@ -47,13 +61,15 @@ type CreateUserRes struct {
 }
 
 type GetUserInfoRes struct {
-	UUID        uuid.UUID
-	Name        string
-	Surname     string
-	Patronymic  string
-	GroupCode   string
-	PhoneNumber string
-	TelegramID  int
+	UUID          uuid.UUID
+	Name          string
+	Surname       string
+	Patronymic    string
+	GroupCode     string
+	PhoneNumber   string
+	TelegramID    int
+	Email         *string
+	EmailVerified bool
 }
 
 type UpdateUserDetailsReq struct {
@@ -69,3 +85,19 @@ type UpdateUserContactsReq struct {
 	PhoneNumber string
 	TelegramID  int
 }
+
+type RequestEmailVerificationReq struct {
+	UserUUID uuid.UUID
+	Email    string
+}
+
+func (r RequestEmailVerificationReq) Validate() error {
+	err := NewValidationError()
+	if !ValidateEmail(r.Email) {
+		err.Add("email", "Invalid email address")
+	}
+	if err.HasErrors() {
+		return err
+	}
+	return nil
+}
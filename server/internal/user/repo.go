@@ -10,6 +10,19 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Repository is the storage used by Service. Repo implements it on postgres
+type Repository interface {
+	CreateUser(ctx context.Context, details *DBUserDetails, contacts *DBUserContacts, tx pgx.Tx) (uuid.UUID, error)
+	GetUserInfo(ctx context.Context, userUUID uuid.UUID) (*DBUserInfo, error)
+	UpdateUserDetails(ctx context.Context, details *DBUserDetails) error
+	UpdateUserContacts(ctx context.Context, contacts *DBUserContacts) error
+	ExistsByTelegramID(ctx context.Context, telegramID int) (bool, error)
+	CreateEmailVerification(ctx context.Context, verification *DBEmailVerification) error
+	VerifyEmail(ctx context.Context, tokenHash string) (bool, error)
+}
+
+var _ Repository = (*Repo)(nil)
+
 type Repo struct {
 	pool *pgxpool.Pool
 	sq   squirrel.StatementBuilderType
@@ -108,6 +121,8 @@ func (r *Repo) GetUserInfo(ctx context.Context, userUUID uuid.UUID) (*DBUserInfo
 		"ud.group_code",
 		"uc.phone_number",
 		"uc.telegram_id",
+		"uc.email",
+		"uc.email_verified_at",
 	).
 		From("user_service.users_details AS ud").
 		InnerJoin("user_service.users_contacts AS uc ON ud.user_uuid = uc.user_uuid").
@@ -129,6 +144,8 @@ func (r *Repo) GetUserInfo(ctx context.Context, userUUID uuid.UUID) (*DBUserInfo
 		&userInfo.GroupCode,
 		&userInfo.PhoneNumber,
 		&userInfo.TelegramID,
+		&userInfo.Email,
+		&userInfo.EmailVerifiedAt,
 	)
 
 	if err != nil {
@@ -223,3 +240,102 @@ func (r *Repo) ExistsByTelegramID(ctx context.Context, telegramID int) (bool, er
 
 	return exists, nil
 }
+
+// CreateEmailVerification replaces the user's email with an unverified one and stores a new
+// verification token, invalidating all previously issued ones
+func (r *Repo) CreateEmailVerification(ctx context.Context, verification *DBEmailVerification) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		query, args, err := r.sq.Update("user_service.users_contacts").
+			Set("email", verification.Email).
+			Set("email_verified_at", nil).
+			Where(squirrel.Eq{"user_uuid": verification.UserUUID}).
+			ToSql()
+		if err != nil {
+			return &repo_errors.ErrDBProcedure{
+				Procedure: "CreateEmailVerification",
+				Step:      "Query setup",
+				Err:       err,
+			}
+		}
+		if _, err = tx.Exec(ctx, query, args...); err != nil {
+			return &repo_errors.ErrDBProcedure{
+				Procedure: "CreateEmailVerification",
+				Step:      "Query execution",
+				Err:       err,
+			}
+		}
+
+		query, args, err = r.sq.Delete("user_service.email_verifications").
+			Where(squirrel.Eq{"user_uuid": verification.UserUUID}).
+			ToSql()
+		if err != nil {
+			return &repo_errors.ErrDBProcedure{
+				Procedure: "CreateEmailVerification",
+				Step:      "Query setup",
+				Err:       err,
+			}
+		}
+		if _, err = tx.Exec(ctx, query, args...); err != nil {
+			return &repo_errors.ErrDBProcedure{
+				Procedure: "CreateEmailVerification",
+				Step:      "Query execution",
+				Err:       err,
+			}
+		}
+
+		query, args, err = r.sq.Insert("user_service.email_verifications").
+			Columns("token_hash", "email", "expires_at", "user_uuid").
+			Values(verification.TokenHash, verification.Email, verification.ExpiresAt, verification.UserUUID).
+			ToSql()
+		if err != nil {
+			return &repo_errors.ErrDBProcedure{
+				Procedure: "CreateEmailVerification",
+				Step:      "Query setup",
+				Err:       err,
+			}
+		}
+		if _, err = tx.Exec(ctx, query, args...); err != nil {
+			return &repo_errors.ErrDBProcedure{
+				Procedure: "CreateEmailVerification",
+				Step:      "Query execution",
+				Err:       err,
+			}
+		}
+
+		return nil
+	})
+}
+
+// VerifyEmail consumes an unexpired token and marks the email it was issued for as verified.
+// Returns false if the token is unknown, expired or the user has changed the email since
+func (r *Repo) VerifyEmail(ctx context.Context, tokenHash string) (bool, error) {
+	verification := r.sq.Delete("user_service.email_verifications").
+		Where(squirrel.Eq{"token_hash": tokenHash}).
+		Where("expires_at > NOW()").
+		Suffix("RETURNING user_uuid, email")
+
+	query, args, err := r.sq.Update("user_service.users_contacts AS uc").
+		PrefixExpr(squirrel.ConcatExpr("WITH verification AS (", verification, ")")).
+		Set("email_verified_at", squirrel.Expr("NOW()")).
+		From("verification AS v").
+		Where("uc.user_uuid = v.user_uuid AND uc.email = v.email").
+		ToSql()
+	if err != nil {
+		return false, &repo_errors.ErrDBProcedure{
+			Procedure: "VerifyEmail",
+			Step:      "Query setup",
+			Err:       err,
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, &repo_errors.ErrDBProcedure{
+			Procedure: "VerifyEmail",
+			Step:      "Query execution",
+			Err:       err,
+		}
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -21,7 +21,24 @@ create table if not exists user_service.users_contacts
 (
     phone_number text not null,
     telegram_id  bigint not null ,
+    email        text,
+    email_verified_at timestamptz,
     user_uuid    uuid not null,
     constraint users_contacts_pk primary key (user_uuid),
     constraint users_contacts_fk foreign key (user_uuid) references user_service.users (uuid) match simple on delete cascade on update cascade
-)
\ No newline at end of file
+);
+
+-- Contacts used to have no email
+alter table user_service.users_contacts
+    add column if not exists email text,
+    add column if not exists email_verified_at timestamptz;
+
+create table if not exists user_service.email_verifications
+(
+    token_hash text        not null,
+    email      text        not null,
+    expires_at timestamptz not null,
+    user_uuid  uuid        not null,
+    constraint email_verifications_pk primary key (token_hash),
+    constraint email_verifications_fk foreign key (user_uuid) references user_service.users (uuid) match simple on delete cascade on update cascade
+);
@@ -2,7 +2,10 @@ package user
 
 import (
 	"context"
+	"labgrab/internal/shared/api/smtp"
 	"labgrab/internal/shared/errors"
+	"labgrab/pkg/config"
+	"time"
 
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
@@ -13,12 +16,14 @@ import (
 var tracer = otel.Tracer("user-service")
 
 type Service struct {
-	repo   *Repo
+	repo   Repository
+	mailer *smtp.Client
+	cfg    *config.EmailVerificationConfig
 	logger *zap.SugaredLogger
 }
 
-func NewService(repo *Repo, logger *zap.SugaredLogger) *Service {
-	return &Service{repo: repo, logger: logger}
+func NewService(repo Repository, mailer *smtp.Client, cfg *config.EmailVerificationConfig, logger *zap.SugaredLogger) *Service {
+	return &Service{repo: repo, mailer: mailer, cfg: cfg, logger: logger}
 }
 
 func (s *Service) CreateUser(ctx context.Context, req *CreateUserReq) (uuid.UUID, error) {
@@ -81,13 +86,15 @@ func (s *Service) GetUserInfo(ctx context.Context, userUUID string) (*GetUserInf
 	}
 
 	return &GetUserInfoRes{
-		UUID:        userInfo.UUID,
-		Name:        userInfo.Name,
-		Surname:     userInfo.Surname,
-		Patronymic:  userInfo.Patronymic,
-		GroupCode:   userInfo.GroupCode,
-		PhoneNumber: userInfo.PhoneNumber,
-		TelegramID:  userInfo.TelegramID,
+		UUID:          userInfo.UUID,
+		Name:          userInfo.Name,
+		Surname:       userInfo.Surname,
+		Patronymic:    userInfo.Patronymic,
+		GroupCode:     userInfo.GroupCode,
+		PhoneNumber:   userInfo.PhoneNumber,
+		TelegramID:    userInfo.TelegramID,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerifiedAt != nil,
 	}, nil
 }
 
@@ -162,6 +169,101 @@ func (s *Service) ExistsByTelegramID(ctx context.Context, telegramID int) (bool,
 	return exists, nil
 }
 
+// RequestEmailVerification sets an unverified email for the user and sends a verification link to it
+func (s *Service) RequestEmailVerification(ctx context.Context, req *RequestEmailVerificationReq) error {
+	ctx, span := tracer.Start(ctx, "user.service.RequestEmailVerification")
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	token, tokenHash, err := generateVerificationToken()
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "RequestEmailVerification",
+			Step:      "Token generation",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	link, err := verificationLink(s.cfg.LinkBaseURL, token)
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "RequestEmailVerification",
+			Step:      "Link building",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	verification := &DBEmailVerification{
+		TokenHash: tokenHash,
+		Email:     req.Email,
+		ExpiresAt: time.Now().Add(s.cfg.TTL),
+		UserUUID:  req.UserUUID,
+	}
+
+	if err := s.repo.CreateEmailVerification(ctx, verification); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "RequestEmailVerification",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := sendVerificationEmail(ctx, s.mailer, req.Email, link, verification.ExpiresAt); err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "RequestEmailVerification",
+			Step:      "Email sending",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	s.logger.Infow("sent email verification", "user_uuid", req.UserUUID)
+
+	return nil
+}
+
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "user.service.VerifyEmail")
+	defer span.End()
+
+	verified, err := s.repo.VerifyEmail(ctx, hashVerificationToken(token))
+	if err != nil {
+		err = &errors.ErrServiceProcedure{
+			Procedure: "VerifyEmail",
+			Step:      "Repository call",
+			Err:       err,
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if !verified {
+		err = ErrInvalidVerificationToken
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
 func parseUUID(uuidStr string) (uuid.UUID, error) {
 	return uuid.Parse(uuidStr)
 }
@@ -1,6 +1,10 @@
 package user
 
-import "regexp"
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+)
 
 var alphabeticRegexp = regexp.MustCompile("^[\\p{L}\\_\\-\\. ]+$")
 var groupCodeRegexp = regexp.MustCompile("^\\p{L}{2,3}\\-[0-9]{1,2}\\-[0-9]{1,2}$")
@@ -21,3 +25,13 @@ func ValidatePhoneNumber(phoneNumber string) bool {
 func ValidateTelegramID(telegramID int) bool {
 	return telegramID > 0
 }
+
+// ValidateEmail accepts a bare address like user@example.com without display name
+func ValidateEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return false
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	return strings.Contains(domain, ".")
+}
@@ -143,3 +143,32 @@ func TestValidateTelegramID(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "simple address", input: "student@example.com", want: true},
+		{name: "address with dots and plus", input: "ivan.petrov+labs@mail.ru", want: true},
+		{name: "subdomain", input: "student@stud.university.edu", want: true},
+
+		{name: "empty string", input: "", want: false},
+		{name: "missing at sign", input: "student.example.com", want: false},
+		{name: "missing local part", input: "@example.com", want: false},
+		{name: "domain without dot", input: "student@localhost", want: false},
+		{name: "display name", input: "Ivan <student@example.com>", want: false},
+		{name: "surrounding spaces", input: " student@example.com ", want: false},
+		{name: "two addresses", input: "a@example.com, b@example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := user.ValidateEmail(tt.input)
+			if got != tt.want {
+				t.Errorf("ValidateEmail(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,21 @@
+// Command labgrab runs the service. The serve and worker commands run the HTTP API and the schedulers as separate
+// processes sharing the same config, see usage for all commands
 package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	api_admin "labgrab/internal/application/admin"
+	api_notification "labgrab/internal/application/notification"
 	api_subscription "labgrab/internal/application/subscription"
 	api_user "labgrab/internal/application/user"
 	"labgrab/internal/auth"
 	"labgrab/internal/lab_polling"
+	"labgrab/internal/notification"
 	"labgrab/internal/shared/api/dikidi"
+	"labgrab/internal/shared/api/smtp"
 	"labgrab/internal/subscription"
 	"labgrab/internal/user"
 	"labgrab/pkg/config"
@@ -15,27 +24,71 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/go-co-op/gocron/v2"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
+const usage = `Usage: labgrab [command]
+
+Commands:
+  serve      run the HTTP API
+  worker     run the polling and notification schedulers
+  migrate    create or upgrade schemas and tables in postgres and dedup keys in redis
+  poll-once  poll Dikidi once and print open slots with matching subscriptions as JSON, nobody is notified
+
+Without a command the HTTP API and the schedulers run in a single process`
+
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	log := logger.Init()
 
-	log.Info("Starting service")
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
 
+	switch command {
+	case "":
+		app := newApp(ctx, log)
+		app.startWorker(ctx)
+		app.serve(ctx)
+		app.stopWorker()
+	case "serve":
+		newApp(ctx, log).serve(ctx)
+	case "worker":
+		app := newApp(ctx, log)
+		app.startWorker(ctx)
+		<-ctx.Done()
+		log.Info("Shutting down worker")
+		app.stopWorker()
+	case "migrate":
+		migrate(ctx, log, loadConfig(log))
+	case "poll-once":
+		newApp(ctx, log).pollOnce(ctx)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func loadConfig(log *zap.SugaredLogger) *config.Config {
 	log.Info("Loading config")
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal("Fatal error occurred when loading config", "error", err)
 	}
 	log.Info("Loaded config")
+	return cfg
+}
 
+func connectPostgres(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) *pgxpool.Pool {
 	log.Info("Establishing postgres connection")
 	pgconfig, err := pgxpool.ParseConfig(cfg.InfraConfig.PostgresConfig.ConnectionString)
 	if err != nil {
@@ -59,7 +112,10 @@ func main() {
 		)
 	}
 	log.Info("Connected to postgresql server")
+	return pool
+}
 
+func connectRedis(log *zap.SugaredLogger, cfg *config.Config) *redis.Client {
 	log.Info("Establishing redis connection")
 	cache := redis.NewClient(&redis.Options{
 		Addr:     cfg.InfraConfig.RedisConfig.Address,
@@ -67,6 +123,34 @@ func main() {
 		DB:       cfg.InfraConfig.RedisConfig.DB,
 	})
 	log.Info("Connected to redis server")
+	return cache
+}
+
+// app holds the services shared by all commands
+type app struct {
+	cfg                   *config.Config
+	log                   *zap.SugaredLogger
+	pool                  *pgxpool.Pool
+	labPollingService     *lab_polling.Service
+	subscriptionService   *subscription.Service
+	notificationService   *notification.Service
+	userService           *user.Service
+	authService           *auth.Service
+	subscriptionScheduler *api_subscription.Scheduler
+	notificationScheduler *api_notification.Scheduler
+}
+
+func newApp(ctx context.Context, log *zap.SugaredLogger) *app {
+	log.Info("Starting service")
+
+	cfg := loadConfig(log)
+	pool := connectPostgres(ctx, log, cfg)
+
+	cache := connectRedis(log, cfg)
+
+	log.Info("Setting up smtp client")
+	mailer := smtp.NewClient(&cfg.InfraConfig.SMTPConfig)
+	log.Info("Finished setting up smtp client")
 
 	log.Info("Setting up dikidi client")
 	httpClient := dikidi.NewAdaptiveHTTPClient(&cfg.APIClientConfig.HTTPClientConfig)
@@ -82,18 +166,95 @@ func main() {
 			err,
 		)
 	}
-	labPollingService := lab_polling.NewService(dikidiClient, slotParser, log)
+	pollingLocation, err := time.LoadLocation(cfg.PollingServiceConfig.ParserConfig.Timezone)
+	if err != nil {
+		log.Fatal(
+			"Fatal error occurred when loading polling timezone",
+			"error",
+			err,
+		)
+	}
+	pollingPolicy, err := lab_polling.NewPollingPolicy(cfg.PollingServiceConfig.ScheduleConfig, pollingLocation)
+	if err != nil {
+		log.Fatal(
+			"Fatal error occurred when creating polling policy",
+			"error",
+			err,
+		)
+	}
+	labPollingRepo := lab_polling.NewRepo(pool)
+	labPollingService, err := lab_polling.NewService(labPollingRepo, dikidiClient, slotParser, pollingPolicy, log)
+	if err != nil {
+		log.Fatal(
+			"Fatal error occurred when creating polling service",
+			"error",
+			err,
+		)
+	}
 	log.Info("Finished setting up polling service")
 
 	log.Info("Setting up subscription service")
 	subscriptionRepo := subscription.NewRepo(pool)
-	deduplicator := subscription.NewDeduplicator(cache, cfg.SubscriptionServiceConfig.DeduplicatorConfig)
+	dedupStore, err := subscription.NewDedupStore(cache, cfg.SubscriptionServiceConfig.DeduplicatorConfig)
+	if err != nil {
+		log.Fatal(
+			"Fatal error occurred when creating deduplicator store",
+			"error",
+			err,
+		)
+	}
+	// A seen key is refreshed only when the next poll claims it, so every poll must come before it expires
+	if err := pollingPolicy.CheckMaxInterval(cfg.SubscriptionServiceConfig.DeduplicatorConfig.TTL); err != nil {
+		log.Fatal(
+			"Fatal error occurred when checking polling schedule against deduplicator ttl",
+			"error",
+			err,
+		)
+	}
+	deduplicator := subscription.NewDeduplicator(dedupStore, cfg.SubscriptionServiceConfig.DeduplicatorConfig)
 	subscriptionService := subscription.NewService(subscriptionRepo, deduplicator, log)
+	if err := subscriptionService.SyncLabCatalog(ctx, &cfg.LabCatalogConfig); err != nil {
+		log.Fatal(
+			"Fatal error occurred when syncing lab catalog",
+			"error",
+			err,
+		)
+	}
 	log.Info("Finished setting up subscription service")
 
+	log.Info("Setting up notification service")
+	notificationLocation, err := time.LoadLocation(cfg.PollingServiceConfig.ParserConfig.Timezone)
+	if err != nil {
+		log.Fatal(
+			"Fatal error occurred when loading notification timezone",
+			"error",
+			err,
+		)
+	}
+	notificationRepo := notification.NewRepo(pool)
+	notificationStream := notification.NewStream(cache, cfg.NotificationServiceConfig.StreamConfig)
+	notificationWebhook := notification.NewWebhook(notificationRepo, cfg.NotificationServiceConfig.WebhookConfig, log)
+	notificationEmail, err := notification.NewEmail(mailer)
+	if err != nil {
+		log.Fatal(
+			"Fatal error occurred when creating email notifier",
+			"error",
+			err,
+		)
+	}
+	notificationService := notification.NewService(
+		notificationRepo,
+		notificationStream,
+		[]notification.Notifier{notificationStream, notificationWebhook, notificationEmail},
+		cfg.NotificationServiceConfig.OutboxConfig,
+		notificationLocation,
+		log,
+	)
+	log.Info("Finished setting up notification service")
+
 	log.Info("Setting up user service")
 	userRepo := user.NewRepo(pool)
-	userService := user.NewService(userRepo, log)
+	userService := user.NewService(userRepo, mailer, cfg.UserServiceConfig.EmailVerificationConfig, log)
 	log.Info("Finished setting up user service")
 
 	log.Info("Setting up auth service")
@@ -101,27 +262,151 @@ func main() {
 	log.Info("Finished setting up auth service")
 
 	log.Info("Setting up schedulers")
-	subscriptionScheduler := api_subscription.NewScheduler(dikidiClient, labPollingService, subscriptionService, log)
-	if err := subscriptionScheduler.Start(ctx); err != nil {
-		log.Fatal("Fatal error occurred when starting subscription scheduler", "error", err)
+	var pollingLocker gocron.Locker
+	if cfg.PollingServiceConfig.LockConfig != nil {
+		pollingLocker = api_subscription.NewRedisLocker(cache, cfg.PollingServiceConfig.LockConfig, log)
+	}
+	subscriptionScheduler, err := api_subscription.NewScheduler(
+		dikidiClient,
+		labPollingService,
+		subscriptionService,
+		notificationService,
+		cfg.PollingServiceConfig.JobsConfig,
+		pollingLocker,
+		log,
+	)
+	if err != nil {
+		log.Fatal(
+			"Fatal error occurred when creating subscription scheduler",
+			"error",
+			err,
+		)
+	}
+	notificationScheduler := api_notification.NewScheduler(notificationService, subscriptionService, userService, cfg.NotificationServiceConfig.OutboxConfig, log)
+	log.Info("Finished setting up schedulers")
+
+	return &app{
+		cfg:                   cfg,
+		log:                   log,
+		pool:                  pool,
+		labPollingService:     labPollingService,
+		subscriptionService:   subscriptionService,
+		notificationService:   notificationService,
+		userService:           userService,
+		authService:           authService,
+		subscriptionScheduler: subscriptionScheduler,
+		notificationScheduler: notificationScheduler,
+	}
+}
+
+func (a *app) startWorker(ctx context.Context) {
+	a.log.Info("Starting schedulers")
+	if err := a.subscriptionScheduler.Start(ctx); err != nil {
+		a.log.Fatal("Fatal error occurred when starting subscription scheduler", "error", err)
+	}
+	if err := a.notificationScheduler.Start(ctx); err != nil {
+		a.log.Fatal("Fatal error occurred when starting notification scheduler", "error", err)
 	}
+	a.log.Info("Started schedulers")
+}
+
+func (a *app) stopWorker() {
+	if err := a.subscriptionScheduler.Stop(); err != nil {
+		a.log.Errorw("Error stopping subscription scheduler", "error", err)
+	}
+	if err := a.notificationScheduler.Stop(); err != nil {
+		a.log.Errorw("Error stopping notification scheduler", "error", err)
+	}
+}
+
+// serve runs the HTTP API until ctx is done
+func (a *app) serve(ctx context.Context) {
+	log := a.log
 	log.Info("Setting up routes")
 	r := mux.NewRouter()
 	log.Info("Setting up user domain routes")
-	userHandler := api_user.NewHandler(authService, userService, subscriptionService, pool, log)
+	userHandler := api_user.NewHandler(a.authService, a.userService, a.subscriptionService, a.pool, log)
 	userHandler.RegisterRoutes(r)
 	log.Info("Finished setting up user domain routes")
 	log.Info("Setting up subscription domain routes")
-	subscriptionHandler := api_subscription.NewHandler(subscriptionService, log)
+	subscriptionHandler := api_subscription.NewHandler(a.subscriptionService, log)
 	subscriptionHandler.RegisterRoutes(r)
 	log.Info("Finished setting up subscription domain routes")
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		log.Fatal("Failed to start http server", "error", err)
-	}
+	log.Info("Setting up notification domain routes")
+	notificationHandler := api_notification.NewHandler(a.notificationService, a.cfg.NotificationServiceConfig.StreamConfig, log)
+	notificationHandler.RegisterRoutes(r)
+	log.Info("Finished setting up notification domain routes")
+	log.Info("Setting up admin routes")
+	adminHandler := api_admin.NewHandler(a.labPollingService, log)
+	adminHandler.RegisterRoutes(r)
+	log.Info("Finished setting up admin routes")
 	log.Info("Finished setting up routes")
-	select {
-	case <-ctx.Done():
+
+	server := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		<-ctx.Done()
 		log.Info("Shutting down server")
-		return
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorw("Error shutting down http server", "error", err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("Failed to start http server", "error", err)
+	}
+}
+
+// pollOnce prints the result of a single polling cycle to stdout, logs go to stderr
+func (a *app) pollOnce(ctx context.Context) {
+	result, err := a.subscriptionScheduler.PollOnce(ctx)
+	if err != nil {
+		a.log.Fatal("Fatal error occurred when polling", "error", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		a.log.Fatal("Failed to write poll result", "error", err)
+	}
+}
+
+// migrate applies the schemas of all services and upgrades dedup keys written by earlier versions. Schemas
+// create what is missing and upgrade existing tables in place, so it is safe to run on every deploy
+func migrate(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) {
+	pool := connectPostgres(ctx, log, cfg)
+	defer pool.Close()
+	cache := connectRedis(log, cfg)
+	defer cache.Close()
+
+	schemas := []struct {
+		service string
+		schema  string
+	}{
+		{"user", user.Schema},
+		{"subscription", subscription.Schema},
+		{"notification", notification.Schema},
+		{"lab_polling", lab_polling.Schema},
+	}
+	for _, schema := range schemas {
+		log.Infow("Applying schema", "service", schema.service)
+		// Without arguments the schema is sent over the simple protocol, which allows several statements
+		if _, err := pool.Exec(ctx, schema.schema); err != nil {
+			log.Fatal("Fatal error occurred when applying schema", "service", schema.service, "error", err)
+		}
+	}
+	log.Info("Applied schemas")
+
+	dedupStore, err := subscription.NewDedupStore(cache, cfg.SubscriptionServiceConfig.DeduplicatorConfig)
+	if err != nil {
+		log.Fatal("Fatal error occurred when creating deduplicator store", "error", err)
+	}
+	if redisStore, ok := dedupStore.(*subscription.RedisDedupStore); ok {
+		log.Info("Migrating dedup keys")
+		migrated, err := redisStore.MigrateLegacyKeys(ctx, cfg.SubscriptionServiceConfig.DeduplicatorConfig.KeyPrefix)
+		if err != nil {
+			log.Fatal("Fatal error occurred when migrating dedup keys", "error", err)
+		}
+		log.Infow("Migrated dedup keys", "migrated", migrated)
 	}
 }
@@ -0,0 +1,13 @@
+package config
+
+// LabCatalogConfig lists the lab types and topics subscriptions may use. Entries removed from the config are
+// kept in the database for existing subscriptions but cannot be used by new ones
+type LabCatalogConfig struct {
+	Types  []LabCatalogEntryConfig `yaml:"types"`
+	Topics []LabCatalogEntryConfig `yaml:"topics"`
+}
+
+type LabCatalogEntryConfig struct {
+	Code string `yaml:"code"`
+	Name string `yaml:"name"`
+}
@@ -11,12 +11,27 @@ type Config struct {
 	InfraConfig               InfraConfig
 	APIClientConfig           DikidiClientConfig `yaml:"dikidi_client"`
 	AuthServiceConfig         AuthServiceConfig
+	UserServiceConfig         UserServiceConfig         `yaml:"user_service"`
 	PollingServiceConfig      PollingServiceConfig      `yaml:"polling_service"`
 	SubscriptionServiceConfig SubscriptionServiceConfig `yaml:"subscription_service"`
+	NotificationServiceConfig NotificationServiceConfig `yaml:"notification_service"`
+	LabCatalogConfig          LabCatalogConfig          `yaml:"lab_catalog"`
 }
 
 func Load() (*Config, error) {
-	file, err := os.ReadFile("config.yaml")
+	config, err := LoadFile("config.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	err = envconfig.Process("", config)
+
+	return config, nil
+}
+
+// LoadFile reads the yaml config without applying environment variables
+func LoadFile(path string) (*Config, error) {
+	file, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -26,7 +41,5 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
-	err = envconfig.Process("", &config)
-
 	return &config, nil
 }
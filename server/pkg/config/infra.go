@@ -1,8 +1,11 @@
 package config
 
+import "time"
+
 type InfraConfig struct {
 	RedisConfig    RedisConfig
 	PostgresConfig PostgresConfig
+	SMTPConfig     SMTPConfig
 }
 
 type RedisConfig struct {
@@ -14,3 +17,12 @@ type RedisConfig struct {
 type PostgresConfig struct {
 	ConnectionString string `envconfig:"POSTGRES_CONN_STRING"`
 }
+
+type SMTPConfig struct {
+	Host     string        `envconfig:"SMTP_HOST"`
+	Port     int           `envconfig:"SMTP_PORT" default:"587"`
+	Username string        `envconfig:"SMTP_USER"`
+	Password string        `envconfig:"SMTP_PASS"`
+	From     string        `envconfig:"SMTP_FROM"`
+	Timeout  time.Duration `envconfig:"SMTP_TIMEOUT" default:"10s"`
+}
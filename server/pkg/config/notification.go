@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+type NotificationServiceConfig struct {
+	StreamConfig  *StreamConfig  `yaml:"stream"`
+	WebhookConfig *WebhookConfig `yaml:"webhook"`
+	OutboxConfig  *OutboxConfig  `yaml:"outbox"`
+}
+
+type StreamConfig struct {
+	KeyPrefix string        `yaml:"key_prefix"`
+	Backlog   int64         `yaml:"backlog"`
+	Retention time.Duration `yaml:"retention"`
+	// Heartbeat is the interval between SSE heartbeat comments, 15s when unset
+	Heartbeat time.Duration `yaml:"heartbeat"`
+}
+
+// WebhookConfig configures webhook requests. Failed requests are retried by the outbox
+type WebhookConfig struct {
+	Timeout      time.Duration `yaml:"timeout"`
+	DisableAfter int           `yaml:"disable_after"`
+}
+
+type OutboxConfig struct {
+	Interval       time.Duration `yaml:"interval"`
+	BatchSize      uint64        `yaml:"batch_size"`
+	Lease          time.Duration `yaml:"lease"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// Retention is how long sent and failed entries are kept, 7 days when unset. It is at least an hour, so
+	// that the hourly limit sees every recent message
+	Retention time.Duration `yaml:"retention"`
+}
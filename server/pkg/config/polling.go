@@ -1,14 +1,77 @@
 package config
 
+import "time"
+
 type PollingServiceConfig struct {
 	ParserConfig ParserConfig `yaml:"parser"`
+	// LockConfig keeps polling jobs on a single instance, jobs run without a lock when it is omitted
+	LockConfig *LockConfig `yaml:"lock"`
+	// ScheduleConfig picks the interval between polls, a fixed 30s to 1m interval is used when it is omitted
+	ScheduleConfig *PollingScheduleConfig `yaml:"schedule"`
+	// JobsConfig controls runs of the worker jobs, runs are skipped on overlap and kept for a week when it is omitted
+	JobsConfig *JobsConfig `yaml:"jobs"`
+}
+
+type JobsConfig struct {
+	// Overlap is "skip" (default) or "queue", what happens to a run that is due while the previous run of the
+	// same job is still going. A queued run starts as soon as the previous one finishes
+	Overlap string `yaml:"overlap"`
+	// RunsRetention is how long finished runs are kept for the admin API
+	RunsRetention time.Duration `yaml:"runs_retention"`
+}
+
+// PollingScheduleConfig picks the interval between polls. The first window containing the current time in the
+// parser timezone applies, Default applies outside of all windows. Boost overrides both for a while after a poll
+// detects slots that appeared or disappeared
+type PollingScheduleConfig struct {
+	Default PollingIntervalConfig `yaml:"default"`
+	Windows []PollingWindowConfig `yaml:"windows"`
+	Boost   *PollingBoostConfig   `yaml:"boost"`
+}
+
+// PollingIntervalConfig is a random interval between Min and Max, so that polls do not follow a fixed rhythm
+type PollingIntervalConfig struct {
+	Min time.Duration `yaml:"min"`
+	Max time.Duration `yaml:"max"`
+}
+
+type PollingWindowConfig struct {
+	Name string `yaml:"name"`
+	// Days limits the window to days of week (MON, TUE, ...), the window applies every day when empty
+	Days []string `yaml:"days"`
+	// Start and End are HH:MM, a window ending before its start spans midnight
+	Start    string                `yaml:"start"`
+	End      string                `yaml:"end"`
+	Interval PollingIntervalConfig `yaml:",inline"`
+}
+
+type PollingBoostConfig struct {
+	// Duration is how long the boost lasts after the last detected change
+	Duration time.Duration         `yaml:"duration"`
+	Interval PollingIntervalConfig `yaml:",inline"`
+}
+
+type LockConfig struct {
+	KeyPrefix string `yaml:"key_prefix"`
+	// TTL bounds how long the lock of a crashed instance stays taken, a running job extends it every third of TTL
+	TTL time.Duration `yaml:"ttl"`
+	// Hold keeps the lock with the instance after a run, so that it runs the job again while other instances
+	// keep skipping it. It should exceed the job interval
+	Hold time.Duration `yaml:"hold"`
 }
 
 type ParserConfig struct {
+	// Rules take precedence over the legacy patterns and maps below, which are converted to rules when no
+	// rules are configured
+	Rules []ParsingRuleConfig `yaml:"rules"`
+
 	NumberRegexpPattern     string `yaml:"number_pattern"`
 	AuditoriumRegexpPattern string `yaml:"auditorium_pattern"`
 	SpotRegexpPattern       string `yaml:"spot_pattern"`
 	TopicRegexpPattern      string `yaml:"topic_pattern"`
+	// GroupRegexpPattern is optional, its first capture group holds a comma or semicolon separated list of
+	// groups or streams the service is restricted to
+	GroupRegexpPattern string `yaml:"group_pattern"`
 
 	NamePrefix string `yaml:"name_prefix"`
 
@@ -17,4 +80,46 @@ type ParserConfig struct {
 	TopicMap    map[string]string `yaml:"topic_map"`
 	TypeMap     map[string]string `yaml:"type_map"`
 	DefaultType string            `yaml:"default_type"`
+
+	// LessonGrid is optional, the standard eight lesson timetable is used when no terms are configured
+	LessonGrid LessonGridConfig `yaml:"lesson_grid"`
+}
+
+type LessonGridConfig struct {
+	Terms []LessonTermConfig `yaml:"terms"`
+}
+
+// LessonTermConfig is a timetable that applies from EffectiveFrom (YYYY-MM-DD) until the next term starts.
+// An empty EffectiveFrom makes the term apply to all dates before the first dated term
+type LessonTermConfig struct {
+	EffectiveFrom string               `yaml:"effective_from"`
+	Lessons       []LessonPeriodConfig `yaml:"lessons"`
+	// Weekdays replaces Lessons for specific days, keyed by day of week (MON, TUE, ...)
+	Weekdays map[string][]LessonPeriodConfig `yaml:"weekdays"`
+}
+
+type LessonPeriodConfig struct {
+	Number int    `yaml:"number"`
+	Start  string `yaml:"start"`
+	End    string `yaml:"end"`
+}
+
+// ParsingRuleConfig extracts a single field of a lab from the master username or service name. Rules of a
+// field are tried from the highest priority, rules of equal priority in the order they are listed
+type ParsingRuleConfig struct {
+	Name     string `yaml:"name"`
+	Field    string `yaml:"field"`
+	Pattern  string `yaml:"pattern"`
+	Priority int    `yaml:"priority"`
+	// Source is username or service_name, both are searched in that order when empty
+	Source string `yaml:"source"`
+	// Capture names the group holding the value, the group named "value" or the first group is used when
+	// empty, the whole match when the pattern has no groups
+	Capture string `yaml:"capture"`
+	// Value replaces the captured text, Map translates it. A rule whose capture is missing from Map does
+	// not match
+	Value string            `yaml:"value"`
+	Map   map[string]string `yaml:"map"`
+	// Strip removes the matches from the username when extracting the teacher name
+	Strip bool `yaml:"strip"`
 }
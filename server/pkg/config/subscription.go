@@ -7,6 +7,14 @@ type SubscriptionServiceConfig struct {
 }
 
 type DeduplicatorConfig struct {
-	KeyPrefix string        `yaml:"key_prefix"`
-	TTL       time.Duration `yaml:"ttl"`
+	// Backend is "redis" (default) or "memory". The memory backend keeps keys in the process and suits a
+	// single instance only
+	Backend string `yaml:"backend"`
+	// MaxEntries caps the number of keys kept by the memory backend, least recently used keys are evicted first
+	MaxEntries int           `yaml:"max_entries"`
+	KeyPrefix  string        `yaml:"key_prefix"`
+	TTL        time.Duration `yaml:"ttl"`
+	// ClaimTTL bounds how long a slot claimed by a running event stays suppressed before it is committed,
+	// so that a crash before notifications are enqueued only delays them
+	ClaimTTL time.Duration `yaml:"claim_ttl"`
 }
@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+type UserServiceConfig struct {
+	EmailVerificationConfig *EmailVerificationConfig `yaml:"email_verification"`
+}
+
+type EmailVerificationConfig struct {
+	LinkBaseURL string        `yaml:"link_base_url"`
+	TTL         time.Duration `yaml:"ttl"`
+}